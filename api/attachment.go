@@ -0,0 +1,473 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
+	log "github.com/brunoksato/golang-boilerplate/log"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/brunoksato/golang-boilerplate/storage"
+	"github.com/brunoksato/golang-boilerplate/util"
+	"github.com/labstack/echo/v4"
+)
+
+// AVATAR_MAX_PIXELS guards against images that are tiny on disk but decode
+// into gigabytes of pixels.
+const AVATAR_MAX_PIXELS = 40000000
+
+const UPLOAD_URL_EXPIRATION = 15 * time.Minute
+
+// MULTIPART_OVERHEAD_BYTES leaves room for the part headers and boundaries
+// around a file of exactly the maximum upload size.
+const MULTIPART_OVERHEAD_BYTES = 64 << 10
+
+var AVATAR_CONTENT_TYPES = []string{"image/jpeg", "image/png", "image/gif"}
+
+type PresignRequest struct {
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// UploadAttachment stores the "file" field of a multipart form and records
+// it as an Attachment of the current user.
+func UploadAttachment(c echo.Context) error {
+	ctx := ServerContext(c)
+
+	header, err := formFile(c)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_UPLOAD_INVALID))
+	}
+	if header.Size > ctx.Config.Upload.MaxBytes {
+		return log.AddDefaultError(c, uploadTooLargeError(header.Size, ctx.Config.Upload.MaxBytes))
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+	defer f.Close()
+
+	contentType, body, merr := SniffUpload(f, ctx.Config.Upload.ContentTypes)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+
+	attachment := model.Attachment{
+		UserID:      ctx.User.ID,
+		Key:         storage.NewKey(fmt.Sprintf("attachments/%d", ctx.User.ID), header.Filename),
+		FileName:    filepath.Base(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+		Status:      model.ATTACHMENT_STATUS_UPLOADED,
+	}
+
+	merr = DefaultValidationForCreate(c, ctx, &attachment)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+
+	store := storage.Default()
+	err = store.Put(attachment.Key, body, attachment.Size, contentType)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	err = ctx.Repository.Create(&attachment)
+	if err != nil {
+		store.Delete(attachment.Key)
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	ctx.Payload["results"] = attachment
+	return c.JSON(http.StatusCreated, ctx.Payload)
+}
+
+// PresignAttachment starts a direct upload: it records a pending Attachment
+// and returns a URL the client PUTs the file to, after which it calls
+// CompleteAttachment.
+func PresignAttachment(c echo.Context) error {
+	ctx := ServerContext(c)
+
+	request := PresignRequest{}
+	if err := c.Bind(&request); err != nil {
+		return log.AddDefaultError(c, core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_UPLOAD_INVALID))
+	}
+
+	contentType, _, err := mime.ParseMediaType(request.ContentType)
+	if err != nil || !containsString(ctx.Config.Upload.ContentTypes, contentType) {
+		return log.AddDefaultError(c, uploadContentTypeError(request.ContentType))
+	}
+	if request.Size <= 0 {
+		return log.AddDefaultError(c, core.NewBusinessError("size: must be greater than zero;",
+			core.ERROR_SUBCODE_UPLOAD_INVALID, map[string]interface{}{"field": "size"}))
+	}
+	if request.Size > ctx.Config.Upload.MaxBytes {
+		return log.AddDefaultError(c, uploadTooLargeError(request.Size, ctx.Config.Upload.MaxBytes))
+	}
+
+	attachment := model.Attachment{
+		UserID:      ctx.User.ID,
+		Key:         storage.NewKey(fmt.Sprintf("attachments/%d", ctx.User.ID), request.FileName),
+		FileName:    filepath.Base(request.FileName),
+		ContentType: contentType,
+		Size:        request.Size,
+		Status:      model.ATTACHMENT_STATUS_PENDING,
+	}
+
+	merr := DefaultValidationForCreate(c, ctx, &attachment)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+
+	uploadURL, err := storage.Default().PresignPut(attachment.Key, contentType, UPLOAD_URL_EXPIRATION)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	err = ctx.Repository.Create(&attachment)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	ctx.Payload["results"] = attachment
+	ctx.Payload["upload"] = map[string]interface{}{
+		"url":        uploadURL,
+		"method":     http.MethodPut,
+		"headers":    storage.PresignedPutHeaders(contentType),
+		"expires_at": time.Now().Add(UPLOAD_URL_EXPIRATION).UTC(),
+	}
+	return c.JSON(http.StatusCreated, ctx.Payload)
+}
+
+// CompleteAttachment checks what actually landed in storage after a
+// presigned upload, since the client could have sent anything.
+func CompleteAttachment(c echo.Context) error {
+	ctx := ServerContext(c)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+	}
+
+	attachment := model.Attachment{}
+	err = ctx.Repository.FindByID(&attachment, uint(id))
+	if err != nil {
+		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+	}
+
+	if attachment.UserID != ctx.User.ID && !ctx.User.IsAdmin() {
+		return log.AddDefaultError(c, core.NewPermissionError("You do not have permission",
+			core.ERROR_SUBCODE_USER_LACKS_PERMISSION))
+	}
+
+	if attachment.Status == model.ATTACHMENT_STATUS_UPLOADED {
+		ctx.Payload["results"] = attachment
+		return c.JSON(http.StatusOK, ctx.Payload)
+	}
+
+	store := storage.Default()
+	obj, err := store.Stat(attachment.Key)
+	if err == storage.ErrNotFound {
+		return log.AddDefaultError(c, core.NewBusinessError("The file has not been uploaded yet",
+			core.ERROR_SUBCODE_UPLOAD_MISSING))
+	}
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	reject := func(merr core.DefaultError) error {
+		store.Delete(attachment.Key)
+		ctx.Repository.Delete(&attachment)
+		return log.AddDefaultError(c, merr)
+	}
+
+	if obj.Size > ctx.Config.Upload.MaxBytes {
+		return reject(uploadTooLargeError(obj.Size, ctx.Config.Upload.MaxBytes))
+	}
+
+	f, err := store.Open(attachment.Key)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+	contentType, _, merr := SniffUpload(f, ctx.Config.Upload.ContentTypes)
+	f.Close()
+	if merr != nil {
+		return reject(merr)
+	}
+
+	err = ctx.Repository.UpdateFields(&attachment, map[string]interface{}{
+		"status":       model.ATTACHMENT_STATUS_UPLOADED,
+		"size":         obj.Size,
+		"content_type": contentType,
+	})
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	ctx.Payload["results"] = attachment
+	return c.JSON(http.StatusOK, ctx.Payload)
+}
+
+// UploadAvatar turns the "file" field of a multipart form into a square
+// thumbnail of AVATAR_SIZE pixels and makes it the current user's image.
+func UploadAvatar(c echo.Context) error {
+	ctx := ServerContext(c)
+
+	header, err := formFile(c)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_UPLOAD_INVALID))
+	}
+	if header.Size > ctx.Config.Upload.MaxBytes {
+		return log.AddDefaultError(c, uploadTooLargeError(header.Size, ctx.Config.Upload.MaxBytes))
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+	defer f.Close()
+
+	contentType, body, merr := SniffUpload(f, AVATAR_CONTENT_TYPES)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	thumb, ext, merr := avatarThumbnail(data, contentType, ctx.Config.Upload.AvatarSize)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+
+	attachment := model.Attachment{
+		UserID:      ctx.User.ID,
+		Key:         storage.NewKey(fmt.Sprintf("avatars/%d", ctx.User.ID), ext),
+		FileName:    filepath.Base(header.Filename),
+		ContentType: mime.TypeByExtension(ext),
+		Size:        int64(len(thumb)),
+		Status:      model.ATTACHMENT_STATUS_UPLOADED,
+	}
+
+	store := storage.Default()
+	err = store.Put(attachment.Key, bytes.NewReader(thumb), attachment.Size, attachment.ContentType)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	user := model.User{}
+	previous := model.Attachment{}
+	err = ctx.Repository.Transaction(func(tx repository.Repository) error {
+		if err := tx.FindByID(&user, ctx.User.ID); err != nil {
+			return err
+		}
+		// The update sets the new avatar on user, the old one is read first.
+		previousID := user.AvatarID
+		if err := tx.Create(&attachment); err != nil {
+			return err
+		}
+		err := tx.UpdateFields(&user, map[string]interface{}{
+			"avatar_id": attachment.ID,
+			"image":     attachment.URL,
+		})
+		if err != nil || previousID == nil {
+			return err
+		}
+		if tx.FindByID(&previous, *previousID) != nil {
+			return nil
+		}
+		return tx.Delete(&previous)
+	})
+	if err != nil {
+		store.Delete(attachment.Key)
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	if previous.Key != "" {
+		store.Delete(previous.Key)
+	}
+
+	ctx.Repository.FindByID(&user, ctx.User.ID)
+	ctx.Payload["results"] = user
+	return c.JSON(http.StatusOK, ctx.Payload)
+}
+
+// GetFile serves objects of the filesystem storage. Anything whose content
+// is not one of the accepted upload types is sent as a download so an
+// uploaded page can never run in the API's origin.
+func GetFile(c echo.Context) error {
+	fs, ok := storage.Default().(*storage.Filesystem)
+	if !ok {
+		return log.AddDefaultError(c, core.NewNotFoundError("Files are not served by this server"))
+	}
+
+	key := fileKey(c)
+	obj, err := fs.Stat(key)
+	if err == storage.ErrNotFound || err == storage.ErrInvalidKey {
+		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+	}
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	f, err := fs.Open(key)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+	defer f.Close()
+
+	contentType, _, _ := mime.ParseMediaType(obj.ContentType)
+	if !containsString(config.FromContext(c).Upload.ContentTypes, contentType) && !containsString(AVATAR_CONTENT_TYPES, contentType) {
+		obj.ContentType = echo.MIMEOctetStream
+		c.Response().Header().Set(echo.HeaderContentDisposition,
+			fmt.Sprintf("attachment; filename=%q", filepath.Base(key)))
+	}
+	c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(obj.Size, 10))
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	return c.Stream(http.StatusOK, obj.ContentType, f)
+}
+
+// PutSignedFile accepts uploads made with a URL from Filesystem.PresignPut,
+// once: the object of a completed upload was checked and can't be replaced.
+func PutSignedFile(c echo.Context) error {
+	fs, ok := storage.Default().(*storage.Filesystem)
+	if !ok {
+		return log.AddDefaultError(c, core.NewNotFoundError("Files are not served by this server"))
+	}
+
+	req := c.Request()
+	key := fileKey(c)
+	err := fs.VerifyPut(key, req.Header.Get(echo.HeaderContentType), c.QueryParams())
+	if err != nil {
+		return log.AddDefaultError(c, core.NewPermissionError(err.Error(), core.ERROR_SUBCODE_UPLOAD_SIGNATURE_INVALID))
+	}
+
+	maxBytes := config.FromContext(c).Upload.MaxBytes
+	if req.ContentLength > maxBytes {
+		return log.AddDefaultError(c, uploadTooLargeError(req.ContentLength, maxBytes))
+	}
+
+	body := http.MaxBytesReader(c.Response(), req.Body, maxBytes)
+	err = fs.Create(key, body, req.ContentLength, req.Header.Get(echo.HeaderContentType))
+	if err == storage.ErrObjectExists {
+		return log.AddDefaultError(c, core.NewPermissionError("The upload URL was already used",
+			core.ERROR_SUBCODE_UPLOAD_SIGNATURE_INVALID))
+	}
+	if err != nil {
+		return log.AddDefaultError(c, core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_UPLOAD_INVALID))
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// SniffUpload works out the content type from the first bytes of r rather
+// than trusting the client, and checks it against allowed. The returned
+// reader still yields the whole upload.
+func SniffUpload(r io.Reader, allowed []string) (string, io.Reader, core.DefaultError) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", nil, core.NewServerError(err.Error())
+	}
+	if n == 0 {
+		return "", nil, core.NewBusinessError("The file is empty", core.ERROR_SUBCODE_UPLOAD_INVALID)
+	}
+	head = head[:n]
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !containsString(allowed, contentType) {
+		return "", nil, uploadContentTypeError(contentType)
+	}
+	return contentType, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+func avatarThumbnail(data []byte, contentType string, size int) ([]byte, string, core.DefaultError) {
+	bounds, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_UPLOAD_INVALID)
+	}
+	if bounds.Width*bounds.Height > AVATAR_MAX_PIXELS {
+		return nil, "", core.NewBusinessError(
+			fmt.Sprintf("The image is %dx%d, that is too many pixels", bounds.Width, bounds.Height),
+			core.ERROR_SUBCODE_UPLOAD_TOO_LARGE)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_UPLOAD_INVALID)
+	}
+	thumb := util.Thumbnail(img, size)
+
+	// PNG keeps transparency, everything else becomes a JPEG.
+	buf := new(bytes.Buffer)
+	ext := ".jpg"
+	if contentType == "image/png" {
+		ext = ".png"
+		err = png.Encode(buf, thumb)
+	} else {
+		err = jpeg.Encode(buf, thumb, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		return nil, "", core.NewServerError(err.Error())
+	}
+	return buf.Bytes(), ext, nil
+}
+
+// formFile caps the request body before the multipart form is parsed, so a
+// huge upload is cut off instead of being spooled to disk first.
+func formFile(c echo.Context) (*multipart.FileHeader, error) {
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, config.FromContext(c).Upload.MaxBytes+MULTIPART_OVERHEAD_BYTES)
+	return c.FormFile("file")
+}
+
+func fileKey(c echo.Context) string {
+	key := c.Param("*")
+	if unescaped, err := url.PathUnescape(key); err == nil {
+		key = unescaped
+	}
+	return key
+}
+
+func uploadTooLargeError(size int64, maxBytes int64) core.DefaultError {
+	return core.NewBusinessError(
+		fmt.Sprintf("The file has %d bytes, the maximum is %d", size, maxBytes),
+		core.ERROR_SUBCODE_UPLOAD_TOO_LARGE,
+		map[string]interface{}{"max": maxBytes, "size": size},
+	)
+}
+
+func uploadContentTypeError(contentType string) core.DefaultError {
+	return core.NewBusinessError(
+		fmt.Sprintf("Files of type %q are not accepted", contentType),
+		core.ERROR_SUBCODE_UPLOAD_CONTENT_TYPE,
+		map[string]interface{}{"content_type": contentType},
+	)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package api_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/apitest"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupStorage(t *testing.T) (*storage.Filesystem, func()) {
+	dir, err := ioutil.TempDir("", "attachments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := storage.NewFilesystem(dir, "/files", []byte("secret"))
+	storage.SetDefault(fs)
+	return fs, func() {
+		storage.SetDefault(nil)
+		os.RemoveAll(dir)
+	}
+}
+
+func newUploadRequest(method, path, fileName string, content []byte) (*httptest.ResponseRecorder, *http.Request) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", fileName)
+	part.Write(content)
+	writer.Close()
+
+	request := httptest.NewRequest(method, path, body)
+	request.Header.Set("X-Company", "Office")
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	return httptest.NewRecorder(), request
+}
+
+func testPNG(w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 100, 255})
+		}
+	}
+	buf := new(bytes.Buffer)
+	png.Encode(buf, img)
+	return buf.Bytes()
+}
+
+func TestUploadAttachment(t *testing.T) {
+	setup()
+	defer teardown()
+	fs, cleanup := setupStorage(t)
+	defer cleanup()
+	router := router()
+
+	rw, req := newUploadRequest("POST", "/api/attachments", "report.pdf", []byte("%PDF-1.4 test document"))
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 201)
+
+	result := core.JsonToMap(rw.Body.String())["results"].(map[string]interface{})
+	assert.Equal(t, "application/pdf", result["content_type"])
+	assert.Equal(t, "uploaded", result["status"])
+	assert.Equal(t, "report.pdf", result["file_name"])
+
+	obj, err := fs.Stat(result["key"].(string))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(22), obj.Size)
+	assert.Equal(t, fs.URL(result["key"].(string)), result["url"])
+}
+
+func TestUploadAttachmentRejectsContentType(t *testing.T) {
+	setup()
+	defer teardown()
+	_, cleanup := setupStorage(t)
+	defer cleanup()
+	router := router()
+
+	// The name says PNG, the bytes say HTML.
+	rw, req := newUploadRequest("POST", "/api/attachments", "image.png", []byte("<html><script>alert(1)</script></html>"))
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 400)
+
+	body := core.JsonToMap(rw.Body.String())
+	assert.Equal(t, float64(core.ERROR_SUBCODE_UPLOAD_CONTENT_TYPE), body["code"])
+}
+
+func TestUploadAttachmentTooLarge(t *testing.T) {
+	setup()
+	defer teardown()
+	_, cleanup := setupStorage(t)
+	defer cleanup()
+	defer func(maxBytes int64) { TEST_CONFIG.Upload.MaxBytes = maxBytes }(TEST_CONFIG.Upload.MaxBytes)
+	TEST_CONFIG.Upload.MaxBytes = 10
+	router := router()
+
+	rw, req := newUploadRequest("POST", "/api/attachments", "report.pdf", []byte("%PDF-1.4 test document"))
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 400)
+
+	body := core.JsonToMap(rw.Body.String())
+	assert.Equal(t, float64(core.ERROR_SUBCODE_UPLOAD_TOO_LARGE), body["code"])
+}
+
+func TestPresignedAttachment(t *testing.T) {
+	setup()
+	defer teardown()
+	_, cleanup := setupStorage(t)
+	defer cleanup()
+	router := router()
+
+	rw, req := core.NewTestPost("POST", "/api/attachments/presign", map[string]interface{}{
+		"file_name":    "photo.png",
+		"content_type": "image/png",
+		"size":         1000,
+	})
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 201)
+
+	payload := core.JsonToMap(rw.Body.String())
+	result := payload["results"].(map[string]interface{})
+	upload := payload["upload"].(map[string]interface{})
+	assert.Equal(t, "pending", result["status"])
+	assert.Equal(t, "PUT", upload["method"])
+
+	id := uint(result["id"].(float64))
+	completePath := fmt.Sprintf("/api/attachments/%d/complete", id)
+
+	// Completing before the upload is made fails.
+	rw, req = core.NewTestRequest("POST", completePath)
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 400)
+
+	uploadURL, _ := url.Parse(upload["url"].(string))
+	content := testPNG(20, 20)
+
+	// A different content type than the one signed is refused.
+	put := httptest.NewRequest("PUT", uploadURL.String(), bytes.NewReader(content))
+	put.Header.Set("Content-Type", "text/html")
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, put)
+	core.AssertResponseCode(t, rw, 403)
+
+	put = httptest.NewRequest("PUT", uploadURL.String(), bytes.NewReader(content))
+	put.Header.Set("Content-Type", "image/png")
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, put)
+	core.AssertResponseCode(t, rw, 200)
+
+	rw, req = core.NewTestRequest("POST", completePath)
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 200)
+
+	// The URL can't replace the checked file afterwards.
+	put = httptest.NewRequest("PUT", uploadURL.String(), strings.NewReader("<script>alert(1)</script>"))
+	put.Header.Set("Content-Type", "image/png")
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, put)
+	core.AssertResponseCode(t, rw, 403)
+
+	attachment := model.Attachment{}
+	TESTDB.First(&attachment, id)
+	assert.Equal(t, model.ATTACHMENT_STATUS_UPLOADED, attachment.Status)
+	assert.Equal(t, int64(len(content)), attachment.Size)
+
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest("GET", uploadURL.Path, nil))
+	core.AssertResponseCode(t, rw, 200)
+	assert.Equal(t, "image/png", rw.Header().Get("Content-Type"))
+	assert.Equal(t, content, rw.Body.Bytes())
+}
+
+func TestUploadAvatar(t *testing.T) {
+	setup()
+	defer teardown()
+	fs, cleanup := setupStorage(t)
+	defer cleanup()
+	router := router()
+
+	rw, req := newUploadRequest("PUT", "/api/users/avatar", "me.png", testPNG(600, 400))
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 200)
+
+	user := model.User{}
+	TESTDB.First(&user, 999)
+	assert.NotNil(t, user.AvatarID)
+
+	first := model.Attachment{}
+	TESTDB.First(&first, *user.AvatarID)
+	assert.Equal(t, first.URL, user.Image)
+
+	f, err := fs.Open(first.Key)
+	assert.Nil(t, err)
+	img, err := png.Decode(f)
+	f.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 256), img.Bounds())
+
+	// A new avatar replaces the old one, object included.
+	rw, req = newUploadRequest("PUT", "/api/users/avatar", "me.png", testPNG(300, 300))
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 200)
+
+	_, err = fs.Stat(first.Key)
+	assert.Equal(t, storage.ErrNotFound, err)
+	assert.True(t, TESTDB.First(&model.Attachment{}, first.ID).RecordNotFound())
+}
+
+func TestDeleteAvatarWithoutDatabase(t *testing.T) {
+	_, cleanup := setupStorage(t)
+	defer cleanup()
+	client := apitest.NewMemory(t, TEST_CONFIG)
+	user := client.CreateUser()
+
+	avatar := model.Attachment{UserID: user.ID, Key: "avatars/me.png", Status: model.ATTACHMENT_STATUS_UPLOADED}
+	assert.NoError(t, client.Repository.Create(&avatar))
+	assert.NoError(t, client.Repository.UpdateFields(&user, map[string]interface{}{
+		"avatar_id": avatar.ID,
+		"image":     "/files/avatars/me.png",
+	}))
+
+	client.AsUser(user).Delete(fmt.Sprintf("/api/attachments/%d", avatar.ID)).AssertCode(200)
+
+	stored := model.User{}
+	assert.NoError(t, client.Repository.FindByID(&stored, user.ID))
+	assert.Nil(t, stored.AvatarID)
+	assert.Empty(t, stored.Image)
+}
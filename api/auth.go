@@ -2,11 +2,11 @@ package api
 
 import (
 	"net/http"
-	"os"
 
 	"github.com/brunoksato/golang-boilerplate/core"
 	log "github.com/brunoksato/golang-boilerplate/log"
 	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -14,33 +14,28 @@ import (
 
 func SignUp(c echo.Context) error {
 	ctx := ServerContext(c)
-	db := ctx.Database
-	tx := db.Begin()
-
-	if err := tx.Error; err != nil {
-		tx.Rollback()
-		return log.AddDefaultError(c, core.NewServerError(err.Error()))
-	}
 
 	user := model.User{}
 	if err := c.Bind(&user); err != nil {
-		tx.Rollback()
 		return log.AddDefaultError(c, core.NewServerError(err.Error()))
 	}
 
-	cerr := user.Create(ArgonContextTransaction(c, tx), ctx.User)
+	var cerr core.DefaultError
+	err := ctx.Repository.Transaction(func(tx repository.Repository) error {
+		cerr = user.Create(ArgonContext(c).WithRepository(tx), ctx.User)
+		if cerr != nil {
+			return cerr
+		}
+		return tx.First(&user, repository.Where(repository.Eq("email", user.Email)))
+	})
 	if cerr != nil {
-		tx.Rollback()
 		return log.AddDefaultError(c, cerr)
 	}
-
-	err := tx.Where("email = ?", user.Email).Find(&user).Error
 	if err != nil {
-		tx.Rollback()
 		return log.AddDefaultError(c, core.NewServerError(err.Error()))
 	}
 
-	tx.Commit()
+	SIGNUPS.Inc()
 
 	ctx.Payload["results"] = user
 	return c.JSON(http.StatusCreated, ctx.Payload)
@@ -48,7 +43,6 @@ func SignUp(c echo.Context) error {
 
 func SignIn(c echo.Context) error {
 	ctx := ServerContext(c)
-	db := ctx.Database
 
 	u := model.User{}
 	if err := c.Bind(&u); err != nil {
@@ -56,18 +50,18 @@ func SignIn(c echo.Context) error {
 	}
 
 	if u.Username != "" {
-		if err := db.Where("username = ?", u.Username).Find(&ctx.User).Error; err != nil {
+		if err := ctx.Repository.First(&ctx.User, repository.Where(repository.Eq("username", u.Username))); err != nil {
 			return log.AddDefaultError(c, core.NewServerError(err.Error()))
 		}
 
 		if ctx.APIType == core.ADMIN_API && !ctx.User.IsAdmin() {
-			return c.JSON(http.StatusUnauthorized, map[string]interface{}{"status": "Not Authorized"})
+			return log.AddDefaultError(c, core.NewAuthenticationError("Admin access required", core.ERROR_SUBCODE_USER_LACKS_PERMISSION))
 		}
 
 		if ok, _ := ctx.User.VerifyPassword(u.Password); ok {
-			expireAt := model.JWTTokenExpirationDate()
+			expireAt := model.JWTTokenExpirationDate(ctx.Config.JWT.TokenExpiration)
 
-			jwt, dberr := model.IssueJWToken(ctx.User.ID, []string{"user"}, expireAt)
+			jwt, dberr := model.IssueJWToken(ctx.User.ID, model.JWTRoles(ctx.User), expireAt, ctx.Config.JWT.SigninKey)
 			if dberr != nil {
 				return log.AddDefaultError(c,
 					core.NewServerError(
@@ -79,52 +73,49 @@ func SignIn(c echo.Context) error {
 				)
 			}
 
+			LOGINS.Inc("success")
 			ctx.Payload["results"] = ctx.User
 			ctx.Payload["token"] = jwt
 			return c.JSON(http.StatusOK, ctx.Payload)
 		}
 	}
 
-	return c.JSON(http.StatusUnauthorized, map[string]interface{}{"status": "Not Authorized"})
+	LOGINS.Inc("failure")
+	return log.AddDefaultError(c, core.NewAuthenticationError("Invalid credentials", core.ERROR_SUBCODE_CREDENTIALS_INVALID))
 }
 
 func RecoverPassword(c echo.Context) error {
 	ctx := ServerContext(c)
-	db := ctx.Database
 
 	email := c.Param("email")
 
 	user := model.User{}
-	count := 0
-
-	err := db.Where("LOWER(email) = LOWER(?)", email).Find(&user).Count(&count).Error
+	err := ctx.Repository.First(&user, repository.Where(repository.EqualFold("email", email)))
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]interface{}{"status": "Email Not Found"})
 	}
 
-	if count > 0 {
-		expireAt := model.JWTTokenExpirationDate()
-		jwt, dberr := model.IssueJWTTokenForEmail(user.ID, user.Email, expireAt)
-		if dberr != nil {
-			return log.AddDefaultError(c,
-				core.NewServerError(
-					dberr.Error(),
-					map[string]interface{}{
-						"user_id": ctx.User.ID,
-					},
-				),
-			)
-		}
-
-		user.ResetPasswordEmail(jwt)
+	expireAt := model.JWTTokenExpirationDate(ctx.Config.JWT.TokenExpiration)
+	jwt, dberr := model.IssueJWTTokenForEmail(user.ID, user.Email, expireAt, ctx.Config.JWT.EmailKey)
+	if dberr != nil {
+		return log.AddDefaultError(c,
+			core.NewServerError(
+				dberr.Error(),
+				map[string]interface{}{
+					"user_id": ctx.User.ID,
+				},
+			),
+		)
 	}
 
+	user.ResetPasswordEmail(c.Request().Context(), jwt, ctx.Config.Sendgrid)
+	PASSWORD_RESETS.Inc("requested")
+
 	return c.JSON(http.StatusOK, map[string]interface{}{"status": "OK"})
 }
 
 func ChangePasswordExternal(c echo.Context) error {
 	ctx := ServerContext(c)
-	db := ctx.Database
 
 	type customPasswordExternal struct {
 		Token    string `json:"token"`
@@ -136,8 +127,7 @@ func ChangePasswordExternal(c echo.Context) error {
 		return log.AddDefaultError(c, core.NewServerError(err.Error()))
 	}
 
-	secretKey := os.Getenv("JWT_KEY_EMAIL")
-	token, err := model.VerifyJWTToken(u.Token, secretKey)
+	token, err := model.VerifyJWTToken(u.Token, ctx.Config.JWT.EmailKey)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]interface{}{"message": "Token invalid"})
 	}
@@ -149,7 +139,7 @@ func ChangePasswordExternal(c echo.Context) error {
 				"status":  "Token invalid",
 				"code":    http.StatusBadRequest,
 			},
-		).Info("ChangePasswordExternal: Token inválido")
+		).Info("ChangePasswordExternal: Invalid token")
 		return c.JSON(http.StatusBadRequest, map[string]interface{}{"message": "Token invalid"})
 	}
 
@@ -158,13 +148,13 @@ func ChangePasswordExternal(c echo.Context) error {
 		email := claims["email"].(string)
 
 		user := model.User{}
-		err := db.Where("email = ?", email).First(&user).Error
+		err := ctx.Repository.First(&user, repository.Where(repository.Eq("email", email)))
 		if err != nil {
 			return log.AddDefaultError(c, core.NewServerError(err.Error()))
 		}
 
 		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
-		uerr := db.Model(&user).Set("gorm:save_associations", false).UpdateColumn("hashed_password", hashedPassword).Error
+		uerr := ctx.Repository.UpdateFields(&user, map[string]interface{}{"hashed_password": hashedPassword})
 		if uerr != nil {
 			return log.AddDefaultError(c, core.NewServerError(uerr.Error()))
 		}
@@ -172,5 +162,6 @@ func ChangePasswordExternal(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]interface{}{"message": "Token invalid or expired"})
 	}
 
+	PASSWORD_RESETS.Inc("completed")
 	return c.JSON(http.StatusOK, map[string]interface{}{"status": "OK"})
 }
@@ -44,6 +44,33 @@ func TestSignInWrong(t *testing.T) {
 	core.AssertResponseCode(t, rw, 401)
 }
 
+func TestSignInWrongProblem(t *testing.T) {
+	setup()
+	defer teardown()
+	router := router()
+
+	u := map[string]interface{}{
+		"username": "system",
+		"password": "wrongpassword",
+	}
+
+	rw, req := core.NewTestPost("POST", "/public/signin", u)
+	req.Header.Set("Accept", "application/problem+json")
+	req.Header.Set("Accept-Language", "pt-BR,pt;q=0.9,en;q=0.5")
+
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 401)
+	assert.Equal(t, "application/problem+json", rw.Header().Get("Content-Type"))
+
+	actual := core.JsonToMap(rw.Body.String())
+	assert.Equal(t, "/problems/credentials-invalid", actual["type"])
+	assert.Equal(t, "Credenciais inválidas", actual["title"])
+	assert.Equal(t, "Credenciais inválidas", actual["detail"])
+	assert.Equal(t, "/public/signin", actual["instance"])
+	assert.Equal(t, float64(401), actual["status"])
+	assert.Equal(t, float64(core.ERROR_SUBCODE_CREDENTIALS_INVALID), actual["subcode"])
+}
+
 func TestSignUp(t *testing.T) {
 	setup()
 	defer teardown()
@@ -69,3 +96,38 @@ func TestSignUp(t *testing.T) {
 	assert.Equal(t, actual["username"], "brunoksato")
 	assert.Equal(t, actual["phone"], "12982575000")
 }
+
+func TestSignUpIdempotencyKey(t *testing.T) {
+	setup()
+	defer teardown()
+	router := router()
+
+	u := map[string]interface{}{
+		"name":     "bruno sato",
+		"username": "brunoksato",
+		"email":    "brunosato@model.com",
+		"password": "password",
+		"phone":    "12982575000",
+	}
+
+	rw, req := core.NewTestPost("POST", "/public/signup", u)
+	req.Header.Set("Idempotency-Key", "signup-1")
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 201)
+	first := rw.Body.String()
+
+	rw, req = core.NewTestPost("POST", "/public/signup", u)
+	req.Header.Set("Idempotency-Key", "signup-1")
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 201)
+	assert.Equal(t, "true", rw.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first, rw.Body.String())
+
+	u["email"] = "other@model.com"
+	rw, req = core.NewTestPost("POST", "/public/signup", u)
+	req.Header.Set("Idempotency-Key", "signup-1")
+	router.ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 422)
+	body := core.JsonToMap(rw.Body.String())
+	assert.Equal(t, float64(core.ERROR_SUBCODE_IDEMPOTENCY_KEY_REUSED), body["code"])
+}
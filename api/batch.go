@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	log "github.com/brunoksato/golang-boilerplate/log"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// BatchOperation is one entry of a batch request. Op is one of "create",
+// "update" or "delete". Update bodies are applied as JSON merge patches.
+type BatchOperation struct {
+	Op      string          `json:"op"`
+	ID      uint            `json:"id,omitempty"`
+	IfMatch string          `json:"if_match,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+}
+
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// errBatchFailed rolls back the transaction of a failed operation, whose
+// result holds the error.
+var errBatchFailed = errors.New("batch operation failed")
+
+type BatchResult struct {
+	Index   int                    `json:"index"`
+	Status  int                    `json:"status"`
+	ID      uint                   `json:"id,omitempty"`
+	Results interface{}            `json:"results,omitempty"`
+	Error   map[string]interface{} `json:"error,omitempty"`
+}
+
+func Batch(c echo.Context) error {
+	ctx := ServerContext(c)
+
+	request := BatchRequest{}
+	if err := c.Bind(&request); err != nil {
+		return log.AddDefaultError(c, core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_BATCH_INVALID))
+	}
+
+	if len(request.Operations) == 0 {
+		return log.AddDefaultError(c, core.NewBusinessError("Batch has no operations", core.ERROR_SUBCODE_BATCH_INVALID))
+	}
+
+	maxSize := ctx.Config.API.BatchMaxSize
+	if len(request.Operations) > maxSize {
+		return log.AddDefaultError(c,
+			core.NewBusinessError(
+				fmt.Sprintf("Batch has %d operations, the maximum is %d", len(request.Operations), maxSize),
+				core.ERROR_SUBCODE_BATCH_TOO_LARGE,
+				map[string]interface{}{"max": maxSize, "size": len(request.Operations)},
+			),
+		)
+	}
+
+	results := make([]BatchResult, len(request.Operations))
+	status := http.StatusOK
+
+	if request.Atomic {
+		failed := -1
+		err := ctx.Repository.Transaction(func(tx repository.Repository) error {
+			for i, op := range request.Operations {
+				results[i] = runBatchOperation(c, ctx, tx, i, op)
+				if results[i].Error != nil {
+					failed = i
+					return errBatchFailed
+				}
+			}
+			return nil
+		})
+		if err != nil && err != errBatchFailed {
+			return log.AddDefaultError(c, core.NewServerError(err.Error()))
+		}
+
+		if failed >= 0 {
+			status = results[failed].Status
+			rolledBack := core.NewBusinessError(
+				fmt.Sprintf("Not applied because operation %d failed", failed),
+				core.ERROR_SUBCODE_BATCH_ROLLED_BACK,
+			)
+			for i := range results {
+				if i != failed {
+					results[i] = BatchResult{
+						Index:  i,
+						Status: http.StatusFailedDependency,
+						ID:     request.Operations[i].ID,
+						Error:  log.LocalizedErrorPayload(rolledBack, log.Language(c)),
+					}
+				}
+			}
+		}
+	} else {
+		for i, op := range request.Operations {
+			err := ctx.Repository.Transaction(func(tx repository.Repository) error {
+				results[i] = runBatchOperation(c, ctx, tx, i, op)
+				if results[i].Error != nil {
+					return errBatchFailed
+				}
+				return nil
+			})
+			if err == errBatchFailed {
+				status = http.StatusMultiStatus
+			} else if err != nil {
+				return log.AddDefaultError(c, core.NewServerError(err.Error()))
+			}
+		}
+	}
+
+	ctx.Payload["results"] = results
+	return c.JSON(status, ctx.Payload)
+}
+
+func runBatchOperation(c echo.Context, ctx *Context, tx repository.Repository, index int, op BatchOperation) BatchResult {
+	var item interface{}
+	var status int
+	var err core.DefaultError
+
+	switch op.Op {
+	case "create":
+		item, err = batchCreate(c, ctx, tx, op)
+		status = http.StatusCreated
+	case "update":
+		item, err = batchUpdate(c, ctx, tx, op)
+		status = http.StatusOK
+	case "delete":
+		item, err = batchDelete(c, ctx, tx, op)
+		status = http.StatusOK
+	default:
+		err = core.NewBusinessError(fmt.Sprintf("Unknown batch operation %q", op.Op), core.ERROR_SUBCODE_BATCH_INVALID)
+	}
+
+	result := BatchResult{Index: index, ID: op.ID}
+	if err != nil {
+		// The data of err goes to the client too, the log fields are a copy.
+		params := map[string]interface{}{}
+		for k, v := range err.Data() {
+			params[k] = v
+		}
+		params["code"] = err.Code()
+		params["subcode"] = err.Subcode()
+		params["batch_index"] = index
+		log.LoggerForParams(c, params).Info("Batch operation failed: " + err.Error())
+
+		result.Status = log.StatusForError(err)
+		result.Error = log.LocalizedErrorPayload(err, log.Language(c))
+		return result
+	}
+
+	result.Status = status
+	result.Results = item
+	result.ID, _ = core.GetID(item)
+	return result
+}
+
+func batchCreate(c echo.Context, ctx *Context, tx repository.Repository, op BatchOperation) (interface{}, core.DefaultError) {
+	item := reflect.New(ctx.Type).Interface()
+	if err := json.Unmarshal(op.Body, item); err != nil {
+		return nil, core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_BATCH_INVALID)
+	}
+
+	userID := ActiveUserID(c, ctx)
+	if userID > 0 {
+		model.SetUserID(item, uint(userID))
+	}
+
+	if model.IsCreator(reflect.PtrTo(ctx.Type)) {
+		creator := item.(model.Creator)
+		err := creator.Create(ArgonContext(c).WithRepository(tx), ctx.User)
+		if err != nil {
+			return nil, err
+		}
+		item = creator
+	} else {
+		err := DefaultValidationForCreate(c, ctx, item)
+		if err != nil {
+			return nil, err
+		}
+
+		dberr := tx.Create(item)
+		if dberr != nil {
+			return nil, core.NewServerError(dberr.Error())
+		}
+	}
+
+	return reloadBatchItem(tx, item)
+}
+
+func batchUpdate(c echo.Context, ctx *Context, tx repository.Repository, op BatchOperation) (interface{}, core.DefaultError) {
+	item, err := batchLoad(ctx, tx, op)
+	if err != nil {
+		return nil, err
+	}
+	version := model.VersionOf(item)
+
+	fields, err := ApplyPatch(item, core.MERGE_PATCH_CONTENT_TYPE, op.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	err = DefaultValidationForUpdate(c, ctx, item, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err = saveUpdate(c, ctx, tx, item, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return reloadBatchItem(tx, item)
+}
+
+func batchDelete(c echo.Context, ctx *Context, tx repository.Repository, op BatchOperation) (interface{}, core.DefaultError) {
+	item, err := batchLoad(ctx, tx, op)
+	if err != nil {
+		return nil, err
+	}
+
+	if model.IsDeleter(reflect.PtrTo(ctx.Type)) {
+		deleter := item.(model.Deleter)
+		err = deleter.Delete(ArgonContext(c).WithRepository(tx), ctx.User)
+	} else {
+		err = DefaultValidationForDelete(c, ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		err = model.DefaultDelete(ArgonContext(c).WithRepository(tx), item)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func batchLoad(ctx *Context, tx repository.Repository, op BatchOperation) (interface{}, core.DefaultError) {
+	if op.ID == 0 {
+		return nil, core.NewBusinessError(fmt.Sprintf("Batch operation %q requires an id", op.Op), core.ERROR_SUBCODE_BATCH_INVALID)
+	}
+
+	item := reflect.New(ctx.Type).Interface()
+	err := tx.FindByID(item, op.ID)
+	if err == repository.ErrNotFound {
+		return nil, core.NewNotFoundError(fmt.Sprintf("No %v has the id %d", ctx.Type, op.ID))
+	}
+	if err != nil {
+		return nil, core.NewServerError(err.Error())
+	}
+
+	if op.IfMatch != "" {
+		etag := model.ETagFor(item)
+		if etag != "" && !etagMatches(op.IfMatch, etag, false) {
+			return nil, core.NewPreconditionFailedError("The item was modified by someone else",
+				core.ERROR_SUBCODE_VERSION_MISMATCH,
+				map[string]interface{}{"etag": etag, "if_match": op.IfMatch})
+		}
+	}
+
+	return item, nil
+}
+
+func reloadBatchItem(tx repository.Repository, item interface{}) (interface{}, core.DefaultError) {
+	id, err := core.GetID(item)
+	if err != nil {
+		return item, nil
+	}
+	if err := tx.FindByID(item, id); err != nil {
+		return nil, core.NewServerError(err.Error())
+	}
+	return item, nil
+}
@@ -0,0 +1,115 @@
+package api_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/api"
+	"github.com/brunoksato/golang-boilerplate/apitest"
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func batchCreate(username string) map[string]interface{} {
+	return map[string]interface{}{
+		"op": "create",
+		"body": map[string]interface{}{
+			"name":     "Batch User",
+			"username": username,
+			"email":    username + "@example.com",
+			"password": "12345",
+		},
+	}
+}
+
+// batchInvalid fails the validation of users.
+var batchInvalid = map[string]interface{}{"op": "create", "body": map[string]interface{}{"name": "No"}}
+
+func countUsers(t *testing.T, client *apitest.Client, username string) int {
+	n, err := client.Repository.Count(&model.User{}, repository.Where(repository.Eq("username", username)))
+	assert.NoError(t, err)
+	return n
+}
+
+func TestBatchAtomicRollsBackOnFirstFailure(t *testing.T) {
+	client := apitest.NewMemory(t, TEST_CONFIG)
+
+	results := []api.BatchResult{}
+	client.AsAdmin().Post("/admin/users/batch", map[string]interface{}{
+		"atomic":     true,
+		"operations": []interface{}{batchCreate("atomic1"), batchInvalid, batchCreate("atomic2")},
+	}).AssertCode(400).Results(&results)
+
+	assert.Len(t, results, 3)
+	assert.Equal(t, 424, results[0].Status)
+	assert.Equal(t, float64(core.ERROR_SUBCODE_BATCH_ROLLED_BACK), results[0].Error["code"])
+	assert.Equal(t, 400, results[1].Status)
+	assert.Equal(t, 424, results[2].Status)
+
+	assert.Equal(t, 0, countUsers(t, client, "atomic1"))
+	assert.Equal(t, 0, countUsers(t, client, "atomic2"))
+}
+
+func TestBatchBestEffortCommitsEachOperation(t *testing.T) {
+	client := apitest.NewMemory(t, TEST_CONFIG)
+
+	results := []api.BatchResult{}
+	client.AsAdmin().Post("/admin/users/batch", map[string]interface{}{
+		"operations": []interface{}{batchCreate("effort1"), batchInvalid, batchCreate("effort2")},
+	}).AssertCode(207).Results(&results)
+
+	assert.Len(t, results, 3)
+	assert.Equal(t, 201, results[0].Status)
+	assert.NotZero(t, results[0].ID)
+	assert.Equal(t, 400, results[1].Status)
+	assert.Equal(t, 201, results[2].Status)
+
+	assert.Equal(t, 1, countUsers(t, client, "effort1"))
+	assert.Equal(t, 1, countUsers(t, client, "effort2"))
+}
+
+func TestBatchRejectsTooManyOperations(t *testing.T) {
+	cfg := *TEST_CONFIG
+	cfg.API.BatchMaxSize = 2
+	client := apitest.NewMemory(t, &cfg)
+
+	operations := []interface{}{}
+	for i := 0; i < 3; i++ {
+		operations = append(operations, batchCreate(fmt.Sprintf("large%d", i)))
+	}
+	body := map[string]interface{}{}
+	client.AsAdmin().Post("/admin/users/batch", map[string]interface{}{"operations": operations}).
+		AssertCode(400).
+		JSON(&body)
+	assert.Equal(t, float64(core.ERROR_SUBCODE_BATCH_TOO_LARGE), body["code"])
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 0, countUsers(t, client, fmt.Sprintf("large%d", i)))
+	}
+}
+
+func TestBatchMaxSize(t *testing.T) {
+	defer os.Setenv("BATCH_MAX_SIZE", os.Getenv("BATCH_MAX_SIZE"))
+
+	os.Setenv("BATCH_MAX_SIZE", "")
+	cfg := config.Default()
+	assert.NoError(t, cfg.LoadEnv())
+	assert.Equal(t, 100, cfg.API.BatchMaxSize)
+
+	os.Setenv("BATCH_MAX_SIZE", "25")
+	cfg = config.Default()
+	assert.NoError(t, cfg.LoadEnv())
+	assert.Equal(t, 25, cfg.API.BatchMaxSize)
+
+	os.Setenv("BATCH_MAX_SIZE", "-1")
+	cfg = config.Default()
+	assert.NoError(t, cfg.LoadEnv())
+	err := cfg.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "BATCH_MAX_SIZE must be positive")
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/brunoksato/golang-boilerplate/cache"
+	"github.com/brunoksato/golang-boilerplate/core"
+	log "github.com/brunoksato/golang-boilerplate/log"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/labstack/echo/v4"
+)
+
+// cachedResponse is a Get or List response kept in the cache.
+type cachedResponse struct {
+	ETag string          `json:"etag,omitempty"`
+	Body json.RawMessage `json:"body"`
+}
+
+func newCachedResponse(etag string, payload map[string]interface{}) (*cachedResponse, core.DefaultError) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, core.NewServerError(err.Error())
+	}
+	return &cachedResponse{ETag: etag, Body: body}, nil
+}
+
+// CacheKey identifies a response about ctx.Type: the generations of the
+// tables it reads, who asks, through which API, and the URL with its query.
+func CacheKey(c echo.Context, ctx *Context, kind string) string {
+	store := cache.Default()
+	table := tableNameFor(ctx, ctx.Type)
+	key := fmt.Sprintf("%s:%s:%s", kind, table, cache.Generation(store, table))
+	if ctx.ParentType != nil {
+		parentTable := tableNameFor(ctx, ctx.ParentType)
+		key = fmt.Sprintf("%s:%s:%s", key, parentTable, cache.Generation(store, parentTable))
+	}
+	return fmt.Sprintf("%s:%s:%d:%s", key, ctx.APIType, ctx.User.ID, c.Request().URL.RequestURI())
+}
+
+// serveCached answers with the response fill builds, cached for the
+// CacheTTL of ctx.Type. Errors are not cached. fill reads from the primary:
+// a replica may not have the writes the generations in the key count yet.
+func serveCached(c echo.Context, ctx *Context, kind string, fill func(ctx *Context) (*cachedResponse, core.DefaultError)) error {
+	ttl := reflect.Zero(ctx.Type).Interface().(model.Cacheable).CacheTTL()
+	value, err := cache.Fetch(cache.Default(), CacheKey(c, ctx, kind), ttl, func() ([]byte, error) {
+		middle.UsePrimary(c)
+		response, merr := fill(ServerContext(c))
+		if merr != nil {
+			return nil, merr
+		}
+		return json.Marshal(response)
+	})
+	if err != nil {
+		if merr, ok := err.(core.DefaultError); ok {
+			return log.AddDefaultError(c, merr)
+		}
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	response := cachedResponse{}
+	if err := json.Unmarshal(value, &response); err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+	if response.ETag != "" {
+		c.Response().Header().Set("ETag", response.ETag)
+		if IsNotModified(c, response.ETag) {
+			return c.NoContent(http.StatusNotModified)
+		}
+	}
+	return c.JSONBlob(http.StatusOK, response.Body)
+}
+
+func tableNameFor(ctx *Context, t reflect.Type) string {
+	if ctx.Database == nil {
+		return core.TableNameFor(t)
+	}
+	return ctx.Database.NewScope(reflect.New(t).Interface()).TableName()
+}
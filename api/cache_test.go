@@ -0,0 +1,59 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/apitest"
+	"github.com/brunoksato/golang-boilerplate/core"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/server"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func getConfiguration(t *testing.T) map[string]interface{} {
+	rw, req := core.NewTestRequest("GET", "/admin/configurations/1")
+	req.Header.Set("X-Company", "Admin")
+	router().ServeHTTP(rw, req)
+	core.AssertResponseCode(t, rw, 200)
+	return core.JsonToMap(rw.Body.String())["results"].(map[string]interface{})
+}
+
+func TestGetIsCachedUntilTheModelChanges(t *testing.T) {
+	setup()
+	defer teardown()
+	TESTDB.Model(&model.User{}).Where("id = ?", 999).UpdateColumn("admin", true)
+
+	assert.Equal(t, 25.0, getConfiguration(t)["min_value_buy"])
+
+	// Raw SQL skips the callbacks that invalidate the cache.
+	TESTDB.Exec("UPDATE configurations SET min_value_buy = 30 WHERE id = 1")
+	assert.Equal(t, 25.0, getConfiguration(t)["min_value_buy"])
+
+	TESTDB.Model(&model.Configuration{}).Where("id = ?", 1).UpdateColumn("min_value_buy", 40)
+	assert.Equal(t, 40.0, getConfiguration(t)["min_value_buy"])
+}
+
+func TestCacheIsFilledFromThePrimary(t *testing.T) {
+	client := apitest.New(t, connect(), TEST_CONFIG)
+	defer cleanAsyncExport()
+
+	// The replica lags: its snapshot was taken before the update.
+	replica := readOnlyReplica(t)
+	defer replica.Close()
+	lagging := replica.Begin()
+	defer lagging.Rollback()
+	assert.NoError(t, lagging.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ").Error)
+	assert.NoError(t, lagging.First(&model.Configuration{}, 1).Error)
+
+	replicas := middle.NewReplicas(client.DB, []string{"test-lagging"}, []*gorm.DB{lagging}, 0)
+	client.Router = server.SetupRouter(apitest.Configurer{DB: client.DB, Config: client.Config, Replicas: replicas})
+	admin := client.AsAdmin()
+
+	admin.Put("/admin/configurations/1", `{"min_value_buy":30}`).AssertCode(202)
+
+	configuration := model.Configuration{}
+	admin.Get("/admin/configurations/1").AssertCode(200).Results(&configuration)
+	assert.Equal(t, 30.0, configuration.MinValueBuy)
+}
@@ -1,20 +1,27 @@
 package api
 
 import (
+	"context"
 	"reflect"
 	"strconv"
 
 	"github.com/Sirupsen/logrus"
-	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/config"
 	"github.com/brunoksato/golang-boilerplate/core"
 	log "github.com/brunoksato/golang-boilerplate/log"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
 	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo/v4"
 	"github.com/olivere/elastic"
 )
 
 type Context struct {
+	Ctx           context.Context
+	Config        *config.Config
 	Database      *gorm.DB
+	Repository    repository.Repository
 	Elastic       *elastic.Client
 	Logger        *logrus.Entry
 	Payload       map[string]interface{}
@@ -32,46 +39,32 @@ type Context struct {
 	ModelCtx      *model.ModelCtx
 }
 
+// ServerContext is built once per request from what the middleware set and
+// reused by later calls. Its database is bound to the request context.
 func ServerContext(c echo.Context) *Context {
-	var t reflect.Type
-	var parentType reflect.Type
-	var user model.User
-	var APIType core.APIType
-	var configuration model.Configuration
-
-	if c.Get("User") != nil {
-		user = c.Get("User").(model.User)
-	}
-
-	if c.Get("Type") != nil {
-		t = c.Get("Type").(reflect.Type)
-	}
-
-	if c.Get("ParentType") != nil {
-		parentType = c.Get("ParentType").(reflect.Type)
-	}
-
-	if c.Get("APIType") != nil {
-		APIType = c.Get("APIType").(core.APIType)
+	if ctx, ok := c.Get("Context").(*Context); ok && ctx != nil {
+		return ctx
 	}
 
-	if c.Get("Configuration") != nil {
-		configuration = c.Get("Configuration").(model.Configuration)
-	}
-
-	return &Context{
-		RequestID:     c.Get("RequestID").(string),
-		Database:      c.Get("Database").(*gorm.DB),
-		Elastic:       c.Get("Elastic").(*elastic.Client),
-		User:          user,
-		Configuration: configuration,
+	t, parentType := middle.Types(c)
+	ctx := &Context{
+		Ctx:           c.Request().Context(),
+		RequestID:     middle.RequestID(c),
+		Config:        config.FromContext(c),
+		Database:      middle.Database(c),
+		Repository:    middle.Repository(c),
+		Elastic:       middle.Elastic(c),
+		User:          middle.User(c),
+		Configuration: middle.Configuration(c),
 		Logger:        log.Logger(c),
 		Type:          t,
 		ParentType:    parentType,
 		Payload:       make(map[string]interface{}),
 		Request:       make(map[string]interface{}),
-		APIType:       APIType,
+		APIType:       middle.APIType(c),
 	}
+	c.Set("Context", ctx)
+	return ctx
 }
 
 func ArgonContext(c echo.Context) *model.ModelCtx {
@@ -79,34 +72,21 @@ func ArgonContext(c echo.Context) *model.ModelCtx {
 	if ctx.ModelCtx == nil {
 		c.Logger().Debug("Creating a new ArgonContext.")
 		ctx.ModelCtx = &model.ModelCtx{
+			Ctx:           ctx.Ctx,
 			RequestID:     ctx.RequestID,
 			APIType:       ctx.APIType,
 			Database:      ctx.Database,
-			Configuration: c.Get("Configuration").(model.Configuration),
-			User:          c.Get("User").(model.User),
-			Logger:        log.Logger(c),
+			Configuration: ctx.Configuration,
+			User:          ctx.User,
+			Logger:        ctx.Logger,
 		}
-	}
-
-	return ctx.ModelCtx
-}
-
-func ArgonContextTransaction(c echo.Context, db *gorm.DB) *model.ModelCtx {
-	ctx := ServerContext(c)
-	if ctx.ModelCtx == nil {
-		c.Logger().Debug("Creating a new ArgonContext.")
-		ctx.ModelCtx = &model.ModelCtx{
-			RequestID:     ctx.RequestID,
-			APIType:       ctx.APIType,
-			Database:      db,
-			Configuration: c.Get("Configuration").(model.Configuration),
-			User:          c.Get("User").(model.User),
-			Logger:        log.Logger(c),
+		// Only a repository set on c overrides the one of Database, so
+		// ModelCtx copies moved to a transaction store in it.
+		if repo, ok := c.Get("Repository").(repository.Repository); ok {
+			ctx.ModelCtx.Repository = repo
 		}
 	}
 
-	ctx.Database = db
-
 	return ctx.ModelCtx
 }
 
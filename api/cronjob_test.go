@@ -0,0 +1,19 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronJobNeedsItsPassword(t *testing.T) {
+	// The job begins its own transaction, which it can't do in TESTDB.
+	client := apitest.New(t, connect(), TEST_CONFIG)
+
+	client.Anonymous().WithHeader("X-Company", "CronJob").Get("/cronjob/sample").AssertCode(401)
+
+	body := map[string]interface{}{}
+	client.AsCronJob().Get("/cronjob/sample").AssertCode(200).JSON(&body)
+	assert.Equal(t, "ok", body["status"])
+}
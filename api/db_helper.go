@@ -1,69 +1,78 @@
 package api
 
 import (
-	"fmt"
+	"context"
 	"reflect"
 	"strings"
 
 	"github.com/brunoksato/golang-boilerplate/model"
 	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/repository"
 	"github.com/jinzhu/gorm"
 )
 
-func OrderByFor(db *gorm.DB, t reflect.Type) *gorm.DB {
+// Detached is repo with its queries bound to ctx instead of the context of
+// the request, for work outliving it.
+func Detached(ctx context.Context, repo repository.Repository) repository.Repository {
+	if g, ok := repo.(*repository.Gorm); ok {
+		return repository.NewGorm(core.WithContext(ctx, g.DB))
+	}
+	return repo
+}
+
+func OrderByFor(q repository.Query, t reflect.Type) repository.Query {
 	if model.IsSorter(t) {
 		item := reflect.New(t).Interface()
 		sorter := item.(model.Sorter)
-		return sorter.OrderBy(db)
+		q.Scopes = append(q.Scopes, sorter.OrderBy)
+		return q
 	}
 
-	tableName := db.NewScope(reflect.New(t).Interface()).TableName()
-	tableName = fmt.Sprintf("\"%s\".", tableName)
-	order := tableName + "\"id\" ASC"
-
+	tableName := core.TableNameFor(t)
 	_, orderField := model.OrderField(t)
 	if orderField != "" {
-		order = fmt.Sprintf("%s\"%s\" ASC, %s", tableName, orderField, order)
+		q.Order = append(q.Order, repository.Order{Column: tableName + "." + orderField})
 	}
-
-	return db.Order(order)
+	q.Order = append(q.Order, repository.Order{Column: tableName + ".id"})
+	return q
 }
 
-func JoinsFor(ctx *Context, db *gorm.DB, parentIsSpecific bool) *gorm.DB {
-	return db.Scopes(core.DefaultPreloads(db, ctx.Type, ctx.APIType, parentIsSpecific))
+func JoinsFor(ctx *Context, q repository.Query, parentIsSpecific bool) repository.Query {
+	q.Scopes = append(q.Scopes, core.DefaultPreloads(ctx.Database, ctx.Type, ctx.APIType, parentIsSpecific))
+	return q
 }
 
-func ScopesFor(ctx *Context, path string, userID uint, db *gorm.DB) *gorm.DB {
+func ScopesFor(ctx *Context, path string, userID uint, q repository.Query) repository.Query {
 	parts := strings.Split(path, "/")
 	for i := len(parts) - 1; i >= 0; i-- {
 		part := parts[i]
 		switch part {
 		//change the name of model
 		case "models":
-			db = db.Where("user_id = ?", userID)
+			q.Where = append(q.Where, repository.Eq("user_id", userID))
 		}
 
 	}
-	return db
+	return q
 }
 
-func FilterByParentFor(db *gorm.DB, pt, t reflect.Type, parentID uint) *gorm.DB {
+func FilterByParentFor(q repository.Query, pt, t reflect.Type, parentID uint) repository.Query {
 	userType := reflect.TypeOf(model.User{})
 
 	if pt == userType {
-		db = FilterByUserFor(db, pt, t, parentID)
+		q = FilterByUserFor(q, pt, t, parentID)
 	} else if pt != nil {
 		parentField := gorm.ToDBName(pt.Name())
-		db = db.Where(parentField+"_id = ?", parentID)
+		q.Where = append(q.Where, repository.Eq(parentField+"_id", parentID))
 	} else if model.TypeHasParentField(t) {
 		_, parentField := model.ParentIdField(t)
-		db = db.Where(parentField+" = ?", parentID)
+		q.Where = append(q.Where, repository.Eq(parentField, parentID))
 	}
 
-	return db
+	return q
 }
 
-func FilterByUserFor(db *gorm.DB, pt, t reflect.Type, userID uint) *gorm.DB {
+func FilterByUserFor(q repository.Query, pt, t reflect.Type, userID uint) repository.Query {
 	var zeroType reflect.Type
 
 	ptName := ""
@@ -77,10 +86,10 @@ func FilterByUserFor(db *gorm.DB, pt, t reflect.Type, userID uint) *gorm.DB {
 		default:
 			_, userIDField := model.UserIDField(t)
 			if userIDField == "user_id" {
-				db = db.Where("user_id = ?", userID)
+				q.Where = append(q.Where, repository.Eq("user_id", userID))
 			}
 		}
 	}
 
-	return db
+	return q
 }
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/labstack/echo/v4"
+)
+
+func SetETag(c echo.Context, item interface{}) string {
+	etag := model.ETagFor(item)
+	if etag != "" {
+		c.Response().Header().Set("ETag", etag)
+	}
+	return etag
+}
+
+func IsNotModified(c echo.Context, etag string) bool {
+	ifNoneMatch := c.Request().Header.Get("If-None-Match")
+	if etag == "" || ifNoneMatch == "" {
+		return false
+	}
+	return etagMatches(ifNoneMatch, etag, true)
+}
+
+func DefaultValidationForIfMatch(c echo.Context, item interface{}) core.DefaultError {
+	ifMatch := c.Request().Header.Get("If-Match")
+	if ifMatch == "" {
+		return nil
+	}
+
+	etag := model.ETagFor(item)
+	if etag == "" {
+		return nil
+	}
+
+	if !etagMatches(ifMatch, etag, false) {
+		return core.NewPreconditionFailedError("The item was modified by someone else",
+			core.ERROR_SUBCODE_VERSION_MISMATCH,
+			map[string]interface{}{"etag": etag, "if_match": ifMatch})
+	}
+	return nil
+}
+
+// etagMatches compares etag against a list header such as If-Match. Weak
+// validators (W/"...") only count for the weak comparison used by
+// If-None-Match.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
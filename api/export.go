@@ -0,0 +1,378 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
+	log "github.com/brunoksato/golang-boilerplate/log"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const EXPORT_FORMAT_CSV = "csv"
+const EXPORT_FORMAT_NDJSON = "ndjson"
+
+const EXPORT_FLUSH_EVERY = 500
+
+// CSV_FORMULA_PREFIXES start the text spreadsheets would run as a formula.
+const CSV_FORMULA_PREFIXES = "=+-@\t\r"
+
+type ExportColumn struct {
+	Name  string
+	Index []int
+}
+
+// ExportFormat picks the export format from ?format= or, failing that, from
+// the Accept header. An empty string means a regular JSON listing.
+func ExportFormat(c echo.Context) string {
+	switch strings.ToLower(c.QueryParam("format")) {
+	case EXPORT_FORMAT_CSV:
+		return EXPORT_FORMAT_CSV
+	case EXPORT_FORMAT_NDJSON:
+		return EXPORT_FORMAT_NDJSON
+	}
+
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return EXPORT_FORMAT_CSV
+	case strings.Contains(accept, "application/x-ndjson"):
+		return EXPORT_FORMAT_NDJSON
+	}
+	return ""
+}
+
+func ExportContentType(format string) string {
+	if format == EXPORT_FORMAT_CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Export streams the items of the route matching q in format.
+func Export(c echo.Context, ctx *Context, q repository.Query, format string) error {
+	if c.QueryParam("async") == "true" {
+		return startAsyncExport(c, ctx, q, format)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, ExportContentType(format))
+	res.Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf("attachment; filename=%q", exportFileName(core.TableNameFor(ctx.Type), format, time.Now())))
+	res.WriteHeader(http.StatusOK)
+
+	n, err := WriteExport(ctx.Repository, q, ctx.Type, ctx.APIType, format, res, res.Flush)
+	if err != nil {
+		// The status line is already on the wire, so the best we can do is
+		// stop the stream and leave a trace of where it broke.
+		log.LoggerForParams(c, map[string]interface{}{"rows": n, "format": format}).
+			Error("Export failed: " + err.Error())
+	}
+	return nil
+}
+
+func GetExportDownload(c echo.Context) error {
+	ctx := ServerContext(c)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+	}
+
+	export := model.Export{}
+	err = ctx.Repository.FindByID(&export, uint(id))
+	if err != nil {
+		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+	}
+
+	canView, merr := export.UserCanView(ArgonContext(c), ctx.User)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+	if !canView {
+		return log.AddDefaultError(c, core.NewPermissionError("You do not have permission",
+			core.ERROR_SUBCODE_USER_LACKS_PERMISSION))
+	}
+
+	switch export.Status {
+	case model.EXPORT_STATUS_DONE:
+		return c.Attachment(export.FileName, exportFileName(export.Resource, export.Format, export.CreatedAt))
+	case model.EXPORT_STATUS_FAILED:
+		return log.AddDefaultError(c, core.NewServerError("Export failed: "+export.Error))
+	}
+
+	ctx.Payload["results"] = export
+	return c.JSON(http.StatusAccepted, ctx.Payload)
+}
+
+// ExportDir is where async exports are written, a temporary directory
+// unless configured.
+func ExportDir(cfg *config.Config) string {
+	dir := cfg.API.ExportDir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "exports")
+	}
+	return dir
+}
+
+func ExportColumns(t reflect.Type, apiType core.APIType) []ExportColumn {
+	columns := []ExportColumn{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for _, col := range ExportColumns(f.Type, apiType) {
+				columns = append(columns, ExportColumn{Name: col.Name, Index: append([]int{i}, col.Index...)})
+			}
+			continue
+		}
+
+		name := core.JsonName(f)
+		if name == "" || name == "-" || !core.IsJsonEnabled(f, apiType) {
+			continue
+		}
+		if f.Tag.Get("sql") == "-" || !isExportableField(f) {
+			continue
+		}
+		columns = append(columns, ExportColumn{Name: name, Index: []int{i}})
+	}
+	return columns
+}
+
+// WriteExport streams every row of repo matched by q into w, one row at a
+// time, so memory stays flat no matter how large the table is. flush, when
+// given, is called every EXPORT_FLUSH_EVERY rows.
+func WriteExport(repo repository.Repository, q repository.Query, t reflect.Type, apiType core.APIType, format string, w io.Writer, flush func()) (int, error) {
+	columns := ExportColumns(t, apiType)
+	writer := newExportWriter(format, w, columns)
+	if err := writer.Header(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	item := reflect.New(t)
+	err := repo.Each(item.Interface(), q, func() error {
+		values := make([]interface{}, len(columns))
+		for i, col := range columns {
+			values[i] = item.Elem().FieldByIndex(col.Index).Interface()
+		}
+		if err := writer.Row(values); err != nil {
+			return err
+		}
+
+		n++
+		if flush != nil && n%EXPORT_FLUSH_EVERY == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return n, err
+	}
+	if flush != nil {
+		flush()
+	}
+	return n, nil
+}
+
+func startAsyncExport(c echo.Context, ctx *Context, q repository.Query, format string) error {
+	export := model.Export{
+		UserID:   ctx.User.ID,
+		Resource: core.TableNameFor(ctx.Type),
+		Format:   format,
+		Status:   model.EXPORT_STATUS_PENDING,
+	}
+	// ctx may read from a replica, the export row is written to the primary.
+	middle.UsePrimary(c)
+	primary := middle.Repository(c)
+	err := primary.Create(&export)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	logger := log.LoggerForParams(c, map[string]interface{}{"export_id": export.ID, "format": format})
+	// The export outlives the request, its context must not stop it.
+	background := context.Background()
+	go runExport(Detached(background, primary), Detached(background, ctx.Repository), q, ctx.Type, ctx.APIType, export, ExportDir(ctx.Config), logger)
+
+	ctx.Payload["results"] = export
+	ctx.Payload["url"] = fmt.Sprintf("/admin/exports/%d/download", export.ID)
+	return c.JSON(http.StatusAccepted, ctx.Payload)
+}
+
+func runExport(primary, repo repository.Repository, q repository.Query, t reflect.Type, apiType core.APIType, export model.Export, dir string, logger *logrus.Entry) {
+	primary.UpdateFields(&export, map[string]interface{}{"status": model.EXPORT_STATUS_RUNNING})
+
+	fail := func(err error) {
+		logger.Error("Async export failed: " + err.Error())
+		primary.UpdateFields(&export, map[string]interface{}{
+			"status": model.EXPORT_STATUS_FAILED,
+			"error":  err.Error(),
+		})
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fail(err)
+		return
+	}
+
+	fileName := filepath.Join(dir, fmt.Sprintf("export-%d.%s", export.ID, export.Format))
+	f, err := os.Create(fileName)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	n, err := WriteExport(repo, q, t, apiType, export.Format, f, nil)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(fileName)
+		fail(err)
+		return
+	}
+
+	primary.UpdateFields(&export, map[string]interface{}{
+		"status":    model.EXPORT_STATUS_DONE,
+		"row_count": n,
+		"file_name": fileName,
+	})
+	logger.WithField("rows", n).Info("Async export finished")
+}
+
+func exportFileName(resource, format string, at time.Time) string {
+	return fmt.Sprintf("%s-%s.%s", resource, at.Format("20060102-150405"), format)
+}
+
+func isExportableField(f reflect.StructField) bool {
+	typ := f.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		return typ == reflect.TypeOf(time.Time{}) ||
+			typ == reflect.TypeOf(core.Timestamp{}) ||
+			typ == reflect.TypeOf(core.NullableTimestamp{})
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Func, reflect.Chan:
+		return false
+	}
+	return true
+}
+
+type exportWriter interface {
+	Header() error
+	Row(values []interface{}) error
+	Flush() error
+}
+
+func newExportWriter(format string, w io.Writer, columns []ExportColumn) exportWriter {
+	if format == EXPORT_FORMAT_CSV {
+		return &csvExportWriter{w: csv.NewWriter(w), columns: columns}
+	}
+	return &ndjsonExportWriter{enc: json.NewEncoder(w), columns: columns}
+}
+
+type csvExportWriter struct {
+	w       *csv.Writer
+	columns []ExportColumn
+}
+
+func (cw *csvExportWriter) Header() error {
+	names := make([]string, len(cw.columns))
+	for i, col := range cw.columns {
+		names[i] = col.Name
+	}
+	return cw.w.Write(names)
+}
+
+func (cw *csvExportWriter) Row(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		cell, err := csvCell(value)
+		if err != nil {
+			return err
+		}
+		record[i] = cell
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvExportWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// csvCell renders a value the same way the JSON API would, so timestamps and
+// numbers in a spreadsheet match what clients already see. Text starting
+// like a formula is prefixed with ' so that it stays text.
+func csvCell(value interface{}) (string, error) {
+	j, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(j, &decoded); err != nil {
+		return "", err
+	}
+
+	switch v := decoded.(type) {
+	case nil:
+		return "", nil
+	case string:
+		if v != "" && strings.ContainsRune(CSV_FORMULA_PREFIXES, rune(v[0])) {
+			return "'" + v, nil
+		}
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return string(j), nil
+}
+
+type ndjsonExportWriter struct {
+	enc     *json.Encoder
+	columns []ExportColumn
+}
+
+func (nw *ndjsonExportWriter) Header() error {
+	return nil
+}
+
+func (nw *ndjsonExportWriter) Row(values []interface{}) error {
+	row := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		row[nw.columns[i].Name] = value
+	}
+	return nw.enc.Encode(row)
+}
+
+func (nw *ndjsonExportWriter) Flush() error {
+	return nil
+}
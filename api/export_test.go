@@ -0,0 +1,251 @@
+package api_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/api"
+	"github.com/brunoksato/golang-boilerplate/apitest"
+	"github.com/brunoksato/golang-boilerplate/core"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/brunoksato/golang-boilerplate/server"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportColumns(t *testing.T) {
+	columns := api.ExportColumns(reflect.TypeOf(model.User{}), core.ADMIN_API)
+
+	names := []string{}
+	for _, col := range columns {
+		names = append(names, col.Name)
+	}
+
+	assert.Equal(t, []string{
+		"id", "created_at", "updated_at", "deleted_at", "last_login",
+		"name", "username", "email", "image", "avatar_id", "phone", "balance", "admin", "ban",
+	}, names)
+}
+
+const EXPORT_FORMULA = `=HYPERLINK("http://evil.example","open")`
+
+func createFormulaUser(t *testing.T) model.User {
+	user, err := model.CreateUser(TESTDB, func(u *model.User) {
+		u.Name = EXPORT_FORMULA
+		u.Phone = "+5512982573000"
+		u.Image = "@image"
+	})
+	assert.NoError(t, err)
+	return user
+}
+
+// csvRows reads an export into maps of its columns, by id.
+func csvRows(t *testing.T, body string) map[string]map[string]string {
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	assert.NoError(t, err)
+
+	rows := map[string]map[string]string{}
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, name := range records[0] {
+			row[name] = record[i]
+		}
+		rows[row["id"]] = row
+	}
+	return rows
+}
+
+func TestExportCSVKeepsFormulasAsText(t *testing.T) {
+	setup()
+	defer teardown()
+	client := apitest.New(t, TESTDB, TEST_CONFIG)
+	admin := client.AsAdmin()
+	user := createFormulaUser(t)
+
+	res := admin.Get("/admin/users?format=csv").AssertCode(200)
+	assert.Equal(t, "text/csv; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Contains(t, res.Header().Get("Content-Disposition"), "users-")
+	assert.True(t, res.Flushed, "the export streams")
+
+	rows := csvRows(t, res.Body.String())
+	// The seeded user, the admin and user.
+	assert.Len(t, rows, 3)
+	row := rows[strconv.Itoa(int(user.ID))]
+	assert.Equal(t, "'"+EXPORT_FORMULA, row["name"])
+	assert.Equal(t, "'+5512982573000", row["phone"])
+	assert.Equal(t, "'@image", row["image"])
+	assert.Equal(t, user.Username, row["username"])
+	assert.Equal(t, "0", row["balance"])
+	assert.Equal(t, "false", row["admin"])
+	assert.NotContains(t, row, "password")
+}
+
+func TestExportNDJSONStreamsRawValues(t *testing.T) {
+	setup()
+	defer teardown()
+	client := apitest.New(t, TESTDB, TEST_CONFIG)
+	admin := client.AsAdmin()
+	user := createFormulaUser(t)
+
+	res := admin.WithHeader("Accept", "application/x-ndjson").Get("/admin/users").AssertCode(200)
+	assert.Equal(t, "application/x-ndjson", res.Header().Get("Content-Type"))
+	assert.True(t, res.Flushed, "the export streams")
+
+	lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+	assert.Len(t, lines, 3)
+	found := false
+	for _, line := range lines {
+		row := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &row))
+		assert.NotContains(t, row, "password")
+		if row["id"] == float64(user.ID) {
+			found = true
+			assert.Equal(t, EXPORT_FORMULA, row["name"], "JSON is not run as a formula")
+			assert.Equal(t, 0.0, row["balance"])
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestWriteExportFlushesAtTheEnd(t *testing.T) {
+	setup()
+	defer teardown()
+
+	flushes := 0
+	out := &strings.Builder{}
+	n, err := api.WriteExport(repository.NewGorm(TESTDB), repository.Query{}, reflect.TypeOf(model.User{}), core.ADMIN_API, api.EXPORT_FORMAT_CSV, out, func() { flushes++ })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, flushes)
+	assert.Len(t, csvRows(t, out.String()), 1)
+}
+
+func TestExportWithoutDatabase(t *testing.T) {
+	client := apitest.NewMemory(t, TEST_CONFIG)
+	user := client.CreateUser()
+
+	res := client.AsAdmin().Get("/admin/users?format=csv").AssertCode(200)
+	rows := csvRows(t, res.Body.String())
+	assert.Len(t, rows, 2, "the user and the admin")
+	assert.Equal(t, user.Email, rows[strconv.Itoa(int(user.ID))]["email"])
+}
+
+// waitForExport polls url until the export is no longer running.
+func waitForExport(admin *apitest.Request, url string) *apitest.Response {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		res := admin.Get(url)
+		if res.Code != 202 || time.Now().After(deadline) {
+			return res
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// asyncExportClient exports to dir on the committed test database: the
+// export runs after the request, outside of its transaction.
+func asyncExportClient(t *testing.T, dir string) *apitest.Client {
+	db := connect()
+	cfg := *TEST_CONFIG
+	cfg.API.ExportDir = dir
+	return apitest.New(t, db, &cfg)
+}
+
+func cleanAsyncExport() {
+	model.DeleteAllCommitedEntities(INITDB)
+	model.SeedDatabase(INITDB)
+}
+
+func TestAsyncExportGoesFromPendingToDone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exports")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	client := asyncExportClient(t, dir)
+	defer cleanAsyncExport()
+	admin := client.AsAdmin()
+
+	export := model.Export{}
+	payload := map[string]interface{}{}
+	res := admin.Get("/admin/users?format=csv&async=true").AssertCode(202).Results(&export).JSON(&payload)
+	assert.Equal(t, model.EXPORT_STATUS_PENDING, export.Status)
+	assert.Equal(t, "users", export.Resource)
+	url := fmt.Sprintf("/admin/exports/%d/download", export.ID)
+	assert.Equal(t, url, payload["url"], res.String())
+
+	download := waitForExport(admin, url).AssertCode(200)
+	// The seeded user and the admin.
+	assert.Len(t, csvRows(t, download.Body.String()), 2)
+
+	stored := model.Export{}
+	assert.NoError(t, INITDB.First(&stored, export.ID).Error)
+	assert.Equal(t, model.EXPORT_STATUS_DONE, stored.Status)
+	assert.Equal(t, 2, stored.RowCount)
+	assert.Equal(t, dir, filepath.Dir(stored.FileName))
+}
+
+func TestAsyncExportReportsItsFailure(t *testing.T) {
+	file, err := ioutil.TempFile("", "exports")
+	assert.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+	// A directory can't be made below a file.
+	client := asyncExportClient(t, filepath.Join(file.Name(), "exports"))
+	defer cleanAsyncExport()
+	admin := client.AsAdmin()
+
+	export := model.Export{}
+	admin.Get("/admin/users?format=ndjson&async=true").AssertCode(202).Results(&export)
+	waitForExport(admin, fmt.Sprintf("/admin/exports/%d/download", export.ID)).AssertCode(500)
+
+	stored := model.Export{}
+	assert.NoError(t, INITDB.First(&stored, export.ID).Error)
+	assert.Equal(t, model.EXPORT_STATUS_FAILED, stored.Status)
+	assert.NotEmpty(t, stored.Error)
+}
+
+// readOnlyReplica connects to the test database in read-only sessions, so
+// writes sent to it fail as they do on a replica.
+func readOnlyReplica(t *testing.T) *gorm.DB {
+	db, err := core.OpenTestConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxIdleConns(1)
+	db.DB().SetMaxOpenConns(1)
+	assert.NoError(t, db.Exec("SET SESSION default_transaction_read_only = on").Error)
+	return db
+}
+
+func TestAsyncExportWritesToThePrimary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exports")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	replica := readOnlyReplica(t)
+	defer replica.Close()
+	client := asyncExportClient(t, dir)
+	defer cleanAsyncExport()
+
+	// Without a sticky window the listing always reads from the replica.
+	replicas := middle.NewReplicas(client.DB, []string{"test-ro"}, []*gorm.DB{replica}, 0)
+	client.Router = server.SetupRouter(apitest.Configurer{DB: client.DB, Config: client.Config, Replicas: replicas})
+	admin := client.AsAdmin()
+
+	export := model.Export{}
+	admin.Get("/admin/users?format=csv&async=true").AssertCode(202).Results(&export)
+	waitForExport(admin, fmt.Sprintf("/admin/exports/%d/download", export.ID)).AssertCode(200)
+
+	stored := model.Export{}
+	assert.NoError(t, INITDB.First(&stored, export.ID).Error)
+	assert.Equal(t, model.EXPORT_STATUS_DONE, stored.Status)
+}
@@ -1,16 +1,19 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
-	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/brunoksato/golang-boilerplate/model"
 	"github.com/brunoksato/golang-boilerplate/core"
 	log "github.com/brunoksato/golang-boilerplate/log"
+	"github.com/brunoksato/golang-boilerplate/repository"
 	"github.com/brunoksato/golang-boilerplate/util"
 	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo/v4"
@@ -19,29 +22,61 @@ import (
 func List(c echo.Context) error {
 	ctx := ServerContext(c)
 
-	db := ctx.Database
+	format := ExportFormat(c)
+	if format != "" {
+		q, err := listQuery(c, ctx)
+		if err != nil {
+			return log.AddDefaultError(c, err)
+		}
+		return Export(c, ctx, DefaultOrder(c, ctx, q), format)
+	}
+
+	if model.IsCacheable(ctx.Type) {
+		return serveCached(c, ctx, "list", func(ctx *Context) (*cachedResponse, core.DefaultError) {
+			err := listItems(c, ctx)
+			if err != nil {
+				return nil, err
+			}
+			return newCachedResponse("", ctx.Payload)
+		})
+	}
 
-	db, err := DefaultListQuery(c, ctx, db)
+	err := listItems(c, ctx)
 	if err != nil {
 		return log.AddDefaultError(c, err)
 	}
 
-	db = DefaultJoins(c, ctx, db)
-	db = DefaultScopes(c, ctx, db)
-	db = DefaultPaging(c, ctx, db)
-	db = DefaultOrder(c, ctx, db)
+	return c.JSON(http.StatusOK, ctx.Payload)
+}
 
-	err = AddListToPayload(ctx, db)
+func listQuery(c echo.Context, ctx *Context) (repository.Query, core.DefaultError) {
+	q, err := DefaultListQuery(c, ctx, repository.Query{})
 	if err != nil {
-		return log.AddDefaultError(c, err)
+		return q, err
 	}
 
-	return c.JSON(http.StatusOK, ctx.Payload)
+	q = DefaultJoins(c, ctx, q)
+	q = DefaultScopes(c, ctx, q)
+	return q, nil
+}
+
+func listItems(c echo.Context, ctx *Context) core.DefaultError {
+	q, err := listQuery(c, ctx)
+	if err != nil {
+		return err
+	}
+
+	q, err = DefaultPaging(c, ctx, q)
+	if err != nil {
+		return err
+	}
+	q = DefaultOrder(c, ctx, q)
+
+	return AddListToPayload(ctx, q)
 }
 
 func Create(c echo.Context) error {
 	ctx := ServerContext(c)
-	db := ctx.Database
 
 	item := reflect.New(ctx.Type).Interface()
 	if err := c.Bind(item); err != nil {
@@ -66,13 +101,18 @@ func Create(c echo.Context) error {
 			return log.AddDefaultError(c, err)
 		}
 
-		dberr := db.Set("gorm:save_associations", false).Create(item).Error
+		dberr := ctx.Repository.Create(item)
 		if dberr != nil {
 			return log.AddDefaultError(c, core.NewServerError(dberr.Error()))
 		}
 	}
 
-	db.First(item)
+	if id, err := core.GetID(item); err == nil {
+		dberr := ctx.Repository.FindByID(item, id)
+		if dberr != nil {
+			return log.AddDefaultError(c, core.NewServerError(dberr.Error()))
+		}
+	}
 
 	ctx.Payload["results"] = item
 	return c.JSON(http.StatusCreated, ctx.Payload)
@@ -80,11 +120,36 @@ func Create(c echo.Context) error {
 
 func Get(c echo.Context) error {
 	ctx := ServerContext(c)
-	db := ctx.Database
 
+	if model.IsCacheable(ctx.Type) {
+		return serveCached(c, ctx, "get", func(ctx *Context) (*cachedResponse, core.DefaultError) {
+			item, merr := getItem(c, ctx)
+			if merr != nil {
+				return nil, merr
+			}
+			ctx.Payload["results"] = item
+			return newCachedResponse(model.ETagFor(item), ctx.Payload)
+		})
+	}
+
+	item, merr := getItem(c, ctx)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+
+	etag := SetETag(c, item)
+	if IsNotModified(c, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	ctx.Payload["results"] = item
+	return c.JSON(http.StatusOK, ctx.Payload)
+}
+
+func getItem(c echo.Context, ctx *Context) (interface{}, core.DefaultError) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+		return nil, core.NewNotFoundError(err.Error())
 	}
 
 	item := reflect.New(ctx.Type).Interface()
@@ -94,30 +159,30 @@ func Get(c echo.Context) error {
 		getter := item.(model.Getter)
 		item, merr = getter.GetByID(ArgonContext(c), ctx.User, uint(id))
 		if merr != nil {
-			return log.AddDefaultError(c, merr)
+			return nil, merr
 		}
 	} else {
-		db = DefaultJoins(c, ctx, db)
-		db = DefaultScopes(c, ctx, db)
-		err = db.First(item, id).Error
-
-		if err != nil {
-			return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+		q := repository.Where(repository.Eq(core.TableNameFor(ctx.Type)+".id", id))
+		q = DefaultJoins(c, ctx, q)
+		q = DefaultScopes(c, ctx, q)
+		merr := findItem(ctx, item, q)
+		if merr != nil {
+			return nil, merr
 		}
 
-		merr := DefaultValidationForGet(c, item)
+		merr = DefaultValidationForGet(c, item)
 		if merr != nil {
-			return log.AddDefaultError(c, merr)
+			return nil, merr
 		}
 	}
 
-	ctx.Payload["results"] = item
-	return c.JSON(http.StatusOK, ctx.Payload)
+	return item, nil
 }
 
+// Update replaces the fields of the item of the id with those of the body.
+// Unsettable fields a client echoes back, like the version, are ignored.
 func Update(c echo.Context) error {
 	ctx := ServerContext(c)
-	db := ctx.Database
 
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -125,54 +190,125 @@ func Update(c echo.Context) error {
 	}
 
 	item := reflect.New(ctx.Type).Interface()
-	err = db.First(item, id).Error
-	if err != nil {
-		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+	merr := findItem(ctx, item, repository.Where(repository.Eq("id", id)))
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
 	}
 
-	if err := c.Bind(item); err != nil {
-		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	merr = DefaultValidationForIfMatch(c, item)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
 	}
+	version := model.VersionOf(item)
 
-	requestMap := core.ModelToJsonMap(item)
+	original := core.ModelToJsonMap(item)
+	bound := reflect.New(ctx.Type).Interface()
+	if err := json.Unmarshal([]byte(core.ModelToJson(item)), bound); err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+	if err := c.Bind(bound); err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+	replaced := core.ModelToJsonMap(bound)
 
 	fields := make([]string, 0)
-	for fieldName, newVal := range requestMap {
+	for _, fieldName := range core.ChangedJsonKeys(original, replaced) {
 		typeField, _ := core.GetFieldByJsonTag(item, fieldName)
 		if typeField != nil && shouldUpdateField(*typeField) {
-			core.SetByJsonTag(item, fieldName, newVal)
-			fields = append(fields, typeField.Name)
+			fields = append(fields, fieldName)
 		}
 	}
+	merr = core.SetJsonKeys(item, replaced, fields)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
 
-	if model.IsUpdater(reflect.PtrTo(ctx.Type)) {
-		updater := item.(model.Updater)
-		merr := updater.Update(ArgonContext(c), ctx.User)
-		if merr != nil {
-			return log.AddDefaultError(c, merr)
-		}
-		item = updater
-	} else {
-		merr := DefaultValidationForUpdate(c, ctx, item, fields)
-		if merr != nil {
-			return log.AddDefaultError(c, merr)
-		}
+	merr = updateItem(c, ctx, &item, id, version, fields)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+	return c.JSON(http.StatusAccepted, ctx.Payload)
+}
 
-		dberr := db.Set("gorm:save_associations", false).Save(item).Error
-		if dberr != nil {
-			return log.AddDefaultError(c, core.NewServerError("Error saving data: "+dberr.Error()))
-		}
+// Patch applies the body to the item of the id as a merge or JSON patch,
+// whichever its Content-Type says.
+func Patch(c echo.Context) error {
+	ctx := ServerContext(c)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
 	}
 
-	db.First(item)
+	item := reflect.New(ctx.Type).Interface()
+	merr := findItem(ctx, item, repository.Where(repository.Eq("id", id)))
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
 
-	ctx.Payload["results"] = item
-	return c.JSON(http.StatusAccepted, ctx.Payload)
+	merr = DefaultValidationForIfMatch(c, item)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+	version := model.VersionOf(item)
+
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	fields, merr := ApplyPatch(item, c.Request().Header.Get(echo.HeaderContentType), body)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+
+	merr = updateItem(c, ctx, &item, id, version, fields)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+	return c.JSON(http.StatusOK, ctx.Payload)
+}
+
+// updateItem checks and saves the json fields Update or Patch changed.
+func updateItem(c echo.Context, ctx *Context, item *interface{}, id int, version interface{}, fields []string) core.DefaultError {
+	merr := DefaultValidationForUpdate(c, ctx, *item, fields)
+	if merr != nil {
+		return merr
+	}
+
+	merr = saveItem(c, ctx, item, id, version)
+	if merr != nil {
+		return merr
+	}
+
+	ctx.Payload["results"] = *item
+	return nil
+}
+
+// saveItem saves the update of item in a transaction and reloads it.
+func saveItem(c echo.Context, ctx *Context, item *interface{}, id int, version interface{}) core.DefaultError {
+	err := ctx.Repository.Transaction(func(tx repository.Repository) error {
+		var merr core.DefaultError
+		*item, merr = saveUpdate(c, ctx, tx, *item, version)
+		if merr != nil {
+			return merr
+		}
+		return nil
+	})
+	if err != nil {
+		return asDefaultError(err)
+	}
+
+	merr := findItem(ctx, *item, repository.Where(repository.Eq("id", id)))
+	if merr != nil {
+		return merr
+	}
+	SetETag(c, *item)
+	return nil
 }
 
 func Delete(c echo.Context) error {
 	ctx := ServerContext(c)
-	db := ctx.Database
 
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -180,12 +316,16 @@ func Delete(c echo.Context) error {
 	}
 
 	item := reflect.New(ctx.Type).Interface()
-	err = db.First(item, id).Error
-	if err != nil {
-		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+	merr := findItem(ctx, item, repository.Where(repository.Eq("id", id)))
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+
+	merr = DefaultValidationForIfMatch(c, item)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
 	}
 
-	var merr core.DefaultError
 	if model.IsDeleter(reflect.PtrTo(ctx.Type)) {
 		deleter := item.(model.Deleter)
 		merr = deleter.Delete(ArgonContext(c), ctx.User)
@@ -209,17 +349,39 @@ func Delete(c echo.Context) error {
 	return c.JSON(http.StatusOK, ctx.Payload)
 }
 
-func DefaultListQuery(c echo.Context, ctx *Context, db *gorm.DB) (*gorm.DB, core.DefaultError) {
+// findItem loads the first item matching q. Only a missing item is not
+// found, other errors are the database's.
+func findItem(ctx *Context, item interface{}, q repository.Query) core.DefaultError {
+	err := ctx.Repository.First(item, q)
+	if err == repository.ErrNotFound {
+		return core.NewNotFoundError(fmt.Sprintf("No %v matches the request", ctx.Type))
+	}
+	if err != nil {
+		return core.NewServerError(err.Error())
+	}
+	return nil
+}
+
+// asDefaultError keeps the errors a transaction returned from a handler
+// and wraps those of the database.
+func asDefaultError(err error) core.DefaultError {
+	if merr, ok := err.(core.DefaultError); ok {
+		return merr
+	}
+	return core.NewServerError(err.Error())
+}
+
+func DefaultListQuery(c echo.Context, ctx *Context, q repository.Query) (repository.Query, core.DefaultError) {
 	var parentID, userID int
 	strParentID := c.Param("parentId")
 	if strParentID != "" {
 		var err error
 		parentID, err = strconv.Atoi(strParentID)
 		if err != nil {
-			return db, core.NewNotFoundError(fmt.Sprintf("Invalid id: %s", strParentID))
+			return q, core.NewNotFoundError(fmt.Sprintf("Invalid id: %s", strParentID))
 		}
 		if parentID <= 0 {
-			return db, core.NewNotFoundError(fmt.Sprintf("Invalid id: %s", strParentID))
+			return q, core.NewNotFoundError(fmt.Sprintf("Invalid id: %s", strParentID))
 		}
 	}
 	strUserID := c.Param("userId")
@@ -227,52 +389,52 @@ func DefaultListQuery(c echo.Context, ctx *Context, db *gorm.DB) (*gorm.DB, core
 		var err error
 		userID, err = strconv.Atoi(strUserID)
 		if err != nil {
-			return db, core.NewNotFoundError(fmt.Sprintf("Invalid id: %s", strUserID))
+			return q, core.NewNotFoundError(fmt.Sprintf("Invalid id: %s", strUserID))
 		}
 		if userID <= 0 {
-			return db, core.NewNotFoundError(fmt.Sprintf("Invalid id: %s", strUserID))
+			return q, core.NewNotFoundError(fmt.Sprintf("Invalid id: %s", strUserID))
 		}
 	}
 
 	if parentID > 0 {
-		db = FilterByParentFor(db, ctx.ParentType, ctx.Type, uint(parentID))
+		q = FilterByParentFor(q, ctx.ParentType, ctx.Type, uint(parentID))
 	}
 
 	if userID > 0 {
-		db = FilterByUserFor(db, ctx.ParentType, ctx.Type, uint(userID))
+		q = FilterByUserFor(q, ctx.ParentType, ctx.Type, uint(userID))
 	}
 
 	switch ctx.APIType {
 	case core.USER_API:
 		userID := ActiveUserID(c, ctx)
 		if ctx.ParentType == reflect.TypeOf(model.User{}) {
-			db = FilterByUserFor(db, ctx.ParentType, ctx.Type, userID)
+			q = FilterByUserFor(q, ctx.ParentType, ctx.Type, userID)
 		}
 	case core.ADMIN_API:
 		// no filter
 	}
-	return db, nil
+	return q, nil
 }
 
-func DefaultJoins(c echo.Context, ctx *Context, db *gorm.DB) *gorm.DB {
+func DefaultJoins(c echo.Context, ctx *Context, q repository.Query) repository.Query {
 	parentID, _ := strconv.Atoi(c.Param("parentId"))
 
 	if parentID > 0 {
-		db = JoinsFor(ctx, db, true)
+		q = JoinsFor(ctx, q, true)
 	} else {
-		db = JoinsFor(ctx, db, false)
+		q = JoinsFor(ctx, q, false)
 	}
-	return db
+	return q
 }
 
-func DefaultScopes(c echo.Context, ctx *Context, db *gorm.DB) *gorm.DB {
+func DefaultScopes(c echo.Context, ctx *Context, q repository.Query) repository.Query {
 	userID := ActiveUserID(c, ctx)
 	path := c.Path()
-	db = ScopesFor(ctx, path, userID, db)
-	return db
+	q = ScopesFor(ctx, path, userID, q)
+	return q
 }
 
-func DefaultPaging(c echo.Context, ctx *Context, db *gorm.DB, opts ...bool) *gorm.DB {
+func DefaultPaging(c echo.Context, ctx *Context, q repository.Query, opts ...bool) (repository.Query, core.DefaultError) {
 	queryTC := true
 	if len(opts) > 0 {
 		queryTC = opts[0]
@@ -282,96 +444,75 @@ func DefaultPaging(c echo.Context, ctx *Context, db *gorm.DB, opts ...bool) *gor
 	limit, _ := strconv.Atoi(c.QueryParam("limit"))
 
 	if limit > 0 && queryTC {
-		queryTotalCount(ctx, db)
+		err := queryTotalCount(ctx, q)
+		if err != nil {
+			return q, err
+		}
 	}
 
 	if st != "" {
 		startIdx, _ := strconv.Atoi(st)
 		if startIdx > 0 {
-			db = db.Offset(startIdx)
+			q.Start = startIdx
 		}
 	}
 
 	if limit > 0 {
-		db = limitQueryByConfig(ctx, db, "", limit)
+		q.Limit = limit
 	}
 
-	return db
+	return q, nil
 }
 
-func queryTotalCount(ctx *Context, db *gorm.DB) {
+func queryTotalCount(ctx *Context, q repository.Query) core.DefaultError {
 	item := reflect.New(ctx.Type).Interface()
-	var n int
-
-	db.Model(item).
-		Select("COUNT(*)").
-		Row().
-		Scan(&n)
+	n, err := ctx.Repository.Count(item, q)
+	if err != nil {
+		return core.NewServerError(err.Error())
+	}
 
 	ctx.Payload["ct"] = n
+	return nil
 }
 
-func limitQueryByConfig(c *Context, db *gorm.DB, key string, requestLimit int) *gorm.DB {
-	dbLimit := requestLimit
-	limitStr := os.Getenv(key)
-	limit, err := strconv.Atoi(limitStr)
-	if err == nil {
-		if dbLimit <= 0 || (limit > 0 && limit < dbLimit) {
-			dbLimit = limit
-		}
-	}
-	if dbLimit > 0 {
-		db = db.Limit(dbLimit)
-	}
-	return db
-}
-
-func DefaultOrder(c echo.Context, ctx *Context, db *gorm.DB) *gorm.DB {
+func DefaultOrder(c echo.Context, ctx *Context, q repository.Query) repository.Query {
 	sort := c.FormValue("sort")
 	if sort != "" {
 		fields, ascending := util.ConvertQueryTermToOrderTerm(sort)
-		tableName := db.NewScope(reflect.New(ctx.Type).Interface()).TableName()
-		order := ""
+		tableName := core.TableNameFor(ctx.Type)
 		for i, field := range fields {
-			term := ""
+			column := ""
 			switch field {
 			case "email":
-				term = fmt.Sprintf("\"%s\".email", tableName)
+				column = "email"
 			case "id":
-				term = fmt.Sprintf("\"%s\".id", tableName)
+				column = "id"
 			case "created_at":
-				term = fmt.Sprintf("\"%s\".id", tableName)
+				column = "id"
 			case "updated_at":
-				term = fmt.Sprintf("\"%s\".id", tableName)
+				column = "id"
 			default:
 				item := reflect.New(ctx.Type).Interface()
 				structField, err := core.GetFieldByJsonTag(item, field)
 				if err == nil {
-					term = fmt.Sprintf("\"%s\".%s", tableName, gorm.ToDBName(structField.Name))
+					column = gorm.ToDBName(structField.Name)
 				} else {
 					continue
 				}
 			}
 
-			if ascending[i] {
-				term = fmt.Sprintf("%s ASC", term)
-			} else {
-				term = fmt.Sprintf("%s DESC", term)
-			}
-
-			order = fmt.Sprintf("%s %s,", order, term)
+			q.Order = append(q.Order, repository.Order{Column: tableName + "." + column, Desc: !ascending[i]})
 		}
 
-		order = fmt.Sprintf("%s %s.id ASC", order, tableName)
-		db = db.Order(order)
+		q.Order = append(q.Order, repository.Order{Column: tableName + ".id"})
 	} else {
-		db = OrderByFor(db, ctx.Type)
+		q = OrderByFor(q, ctx.Type)
 	}
-	return db
+	return q
 }
 
-func AddListToPayload(ctx *Context, db *gorm.DB) core.DefaultError {
-	result, err := getListFromQuery(ctx, db)
+func AddListToPayload(ctx *Context, q repository.Query) core.DefaultError {
+	result, err := getListFromQuery(ctx, q)
 	if err != nil {
 		if err.IsWarning() {
 			ctx.Payload["results"] = result
@@ -383,6 +524,58 @@ func AddListToPayload(ctx *Context, db *gorm.DB) core.DefaultError {
 	return nil
 }
 
+// ApplyPatch applies a merge patch or JSON patch body to item according to
+// contentType and returns the json names of the fields it changed.
+func ApplyPatch(item interface{}, contentType string, body []byte) ([]string, core.DefaultError) {
+	original := core.ModelToJsonMap(item)
+
+	var patched map[string]interface{}
+	var err core.DefaultError
+	switch {
+	case strings.HasPrefix(contentType, core.MERGE_PATCH_CONTENT_TYPE):
+		patched, err = core.ApplyMergePatch(original, body)
+	case strings.HasPrefix(contentType, core.JSON_PATCH_CONTENT_TYPE):
+		patched, err = core.ApplyJsonPatch(original, body)
+	default:
+		err = core.NewBusinessError("Unsupported patch content type: "+contentType,
+			core.ERROR_SUBCODE_PATCH_UNSUPPORTED_MEDIA_TYPE)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields := core.ChangedJsonKeys(original, patched)
+	err = core.SetJsonKeys(item, patched, fields)
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func saveUpdate(c echo.Context, ctx *Context, tx repository.Repository, item interface{}, version interface{}) (interface{}, core.DefaultError) {
+	if version != nil {
+		err := model.BumpVersion(tx, item, version)
+		if err != nil {
+			return item, err
+		}
+	}
+
+	if model.IsUpdater(reflect.PtrTo(ctx.Type)) {
+		updater := item.(model.Updater)
+		err := updater.Update(ArgonContext(c).WithRepository(tx), ctx.User)
+		if err != nil {
+			return item, err
+		}
+		return updater, nil
+	}
+
+	dberr := tx.Update(item)
+	if dberr != nil {
+		return item, core.NewServerError("Error saving data: " + dberr.Error())
+	}
+	return item, nil
+}
+
 func DefaultValidationForGet(c echo.Context, item interface{}) core.DefaultError {
 	ctx := ServerContext(c)
 
@@ -440,11 +633,7 @@ func DefaultValidationForUpdate(c echo.Context, ctx *Context, item interface{},
 	}
 
 	if model.IsValidator(ctx.Type) {
-		err := model.ValidateStructFields(item, fields)
-		if err != nil {
-			return core.NewBusinessError(err.Error())
-		}
-		return nil
+		return model.ValidateStructFields(item, fields)
 	}
 
 	return nil
@@ -471,11 +660,11 @@ func DefaultValidationForDelete(c echo.Context, ctx *Context, item interface{})
 	return nil
 }
 
-func getListFromQuery(ctx *Context, db *gorm.DB) (interface{}, core.DefaultError) {
+func getListFromQuery(ctx *Context, q repository.Query) (interface{}, core.DefaultError) {
 	var err error
 
 	items := util.NewSliceForType(ctx.Type)
-	err = db.Find(items).Error
+	err = ctx.Repository.List(items, q)
 	if err != nil {
 		return nil, core.NewServerError(err.Error())
 	}
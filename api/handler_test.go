@@ -3,14 +3,21 @@ package api_test
 import (
 	"fmt"
 	"os"
+	"sync"
+	"testing"
 
 	"github.com/brunoksato/golang-boilerplate/api"
+	"github.com/brunoksato/golang-boilerplate/apitest"
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
 	middle "github.com/brunoksato/golang-boilerplate/middleware"
 	"github.com/brunoksato/golang-boilerplate/model"
 	"github.com/brunoksato/golang-boilerplate/server"
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,14 +25,25 @@ var CTX *api.Context
 var INITDB *gorm.DB
 var TESTDB *gorm.DB
 var ROLE string = "user"
+var TEST_CONFIG = config.Default()
+
+var initDB sync.Once
 
 func init() {
 	os.Setenv("TEST_ON", "true")
-	INITDB = model.InitTestDB()
+}
+
+// connect opens INITDB on first use, tests that neither call it nor setup
+// run without a database.
+func connect() *gorm.DB {
+	initDB.Do(func() {
+		INITDB = model.InitTestDB()
+	})
+	return INITDB
 }
 
 func setup() {
-	TESTDB = INITDB.Begin()
+	TESTDB = connect().Begin()
 	model.DeleteAllCommitedEntities(TESTDB)
 	model.SeedDatabase(TESTDB)
 }
@@ -79,6 +97,7 @@ type TestMiddlewareConfigurer struct{}
 func (mc TestMiddlewareConfigurer) ConfigureDefaultApiMiddleware(root *echo.Echo) *echo.Echo {
 	root.Use(middleware.Recover())
 	root.Use(middleware.CORS())
+	root.Use(middle.Config(TEST_CONFIG))
 	root.Use(middleware.SecureWithConfig(middleware.SecureConfig{
 		XSSProtection:         "1; mode=block",
 		ContentTypeNosniff:    "nosniff",
@@ -95,17 +114,16 @@ func (mc TestMiddlewareConfigurer) ConfigureDefaultApiMiddleware(root *echo.Echo
 }
 
 func (mc TestMiddlewareConfigurer) ConfigurePublicApiMiddleware(root *echo.Echo) *echo.Group {
-	api := mc.ConfigureDefaultApiMiddleware(root)
-	public := api.Group("/public")
+	public := root.Group("/public")
 	public.Use(middleware.CORSWithConfig(middleware.CORSConfig{AllowOrigins: []string{"*"}}))
 	public.Use(middle.Session)
+	public.Use(middle.Idempotency(TEST_CONFIG.API.IdempotencyTTL, TEST_CONFIG.API.IdempotencyMaxBytes))
 
 	return public
 }
 
 func (mc TestMiddlewareConfigurer) ConfigurePrivateApiMiddleware(root *echo.Echo) *echo.Group {
-	api := mc.ConfigureDefaultApiMiddleware(root)
-	private := api.Group("/api")
+	private := root.Group("/api")
 	private.Use(middleware.Gzip())
 	private.Use(middle.SettingHeaders)
 	private.Use(middleware.CORSWithConfig(middleware.CORSConfig{AllowOrigins: []string{"*"}}))
@@ -117,8 +135,7 @@ func (mc TestMiddlewareConfigurer) ConfigurePrivateApiMiddleware(root *echo.Echo
 }
 
 func (mc TestMiddlewareConfigurer) ConfigureCronJobApiMiddleware(root *echo.Echo) *echo.Group {
-	api := mc.ConfigureDefaultApiMiddleware(root)
-	private := api.Group("/cronjob")
+	private := root.Group("/cronjob")
 	private.Use(middleware.CORS())
 	private.Use(middleware.Gzip())
 	private.Use(middle.SettingHeaders)
@@ -131,8 +148,7 @@ func (mc TestMiddlewareConfigurer) ConfigureCronJobApiMiddleware(root *echo.Echo
 }
 
 func (mc TestMiddlewareConfigurer) ConfigureAdminApiMiddleware(root *echo.Echo) *echo.Group {
-	api := mc.ConfigureDefaultApiMiddleware(root)
-	private := api.Group("/admin")
+	private := root.Group("/admin")
 	private.Use(middleware.CORS())
 	private.Use(middleware.Gzip())
 	private.Use(middle.SettingHeaders)
@@ -180,9 +196,63 @@ func SetUpTestUser(role string) echo.MiddlewareFunc {
 func SetTestUserToken(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		user := c.Get("User").(model.User)
-		expireAt := model.JWTTokenExpirationDate()
-		jwt, _ := model.IssueJWToken(user.ID, []string{"user"}, expireAt)
+		expireAt := model.JWTTokenExpirationDate(TEST_CONFIG.JWT.TokenExpiration)
+		jwt, _ := model.IssueJWToken(user.ID, []string{"user"}, expireAt, TEST_CONFIG.JWT.SigninKey)
 		c.Request().Header.Add("Authorization", fmt.Sprintf("Bearer %s", jwt))
 		return next(c)
 	}
 }
+
+func TestPutIgnoresUnsettableFieldsAndPatchRefusesThem(t *testing.T) {
+	client := apitest.NewMemory(t, TEST_CONFIG)
+	configuration := model.BuildConfiguration()
+	assert.NoError(t, client.Repository.Create(&configuration))
+	path := fmt.Sprintf("/admin/configurations/%d", configuration.ID)
+
+	updated := model.Configuration{}
+	client.AsAdmin().Put(path, `{"min_value_buy":30}`).AssertCode(202).Results(&updated)
+	assert.Equal(t, 30.0, updated.MinValueBuy)
+	assert.Equal(t, uint(2), updated.Version)
+
+	// A client echoing back the item it loaded sends the old version.
+	client.AsAdmin().Put(path, `{"version":1,"min_value_buy":35}`).AssertCode(202).Results(&updated)
+	assert.Equal(t, 35.0, updated.MinValueBuy)
+	assert.Equal(t, uint(3), updated.Version)
+
+	client.AsAdmin().
+		WithHeader("Content-Type", core.MERGE_PATCH_CONTENT_TYPE).
+		Patch(path, `{"version":9}`).
+		AssertCode(403)
+
+	client.AsAdmin().
+		WithHeader("Content-Type", core.MERGE_PATCH_CONTENT_TYPE).
+		Patch(path, `{"min_value_buy":40}`).
+		AssertCode(200).
+		Results(&updated)
+	assert.Equal(t, 40.0, updated.MinValueBuy)
+	assert.Equal(t, uint(4), updated.Version)
+}
+
+func TestConditionalRequestsCheckTheVersion(t *testing.T) {
+	client := apitest.NewMemory(t, TEST_CONFIG)
+	// No route deletes a versioned model, this one is for the test only.
+	configurer := apitest.Configurer{Config: TEST_CONFIG, Repository: client.Repository}
+	configurer.ConfigureAdminApiMiddleware(client.Router).DELETE("/configurations/:id", api.Delete)
+	configuration := model.BuildConfiguration()
+	assert.NoError(t, client.Repository.Create(&configuration))
+	path := fmt.Sprintf("/admin/configurations/%d", configuration.ID)
+
+	stale := client.AsAdmin().Get(path).AssertCode(200).Header().Get("ETag")
+	assert.NotEmpty(t, stale)
+	client.AsAdmin().WithHeader("If-None-Match", stale).Get(path).AssertCode(304)
+
+	client.AsAdmin().Put(path, `{"min_value_buy":30}`).AssertCode(202)
+	current := client.AsAdmin().WithHeader("If-None-Match", stale).Get(path).AssertCode(200).Header().Get("ETag")
+	assert.NotEqual(t, stale, current)
+	client.AsAdmin().WithHeader("If-None-Match", current).Get(path).AssertCode(304)
+
+	client.AsAdmin().WithHeader("If-Match", stale).Delete(path).AssertCode(412)
+	client.AsAdmin().WithHeader("If-Match", stale).Put(path, `{"min_value_buy":40}`).AssertCode(412)
+	client.AsAdmin().WithHeader("If-Match", current).Delete(path).AssertCode(200)
+	client.AsAdmin().Get(path).AssertCode(404)
+}
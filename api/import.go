@@ -0,0 +1,636 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
+	log "github.com/brunoksato/golang-boilerplate/log"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const IMPORT_FORMAT_CSV = "csv"
+const IMPORT_FORMAT_NDJSON = "ndjson"
+
+// IMPORT_ERROR_PREVIEW is how many row errors a synchronous import returns
+// inline. The full list is always in the downloadable report.
+const IMPORT_ERROR_PREVIEW = 100
+
+// errImportRolledBack rolls back an import that must not keep its rows.
+var errImportRolledBack = errors.New("import rolled back")
+
+// Import loads a CSV or NDJSON upload into the resource of the route, one
+// item per row. The file is sent either as the "file" field of a multipart
+// form or as the raw request body.
+//
+// Query parameters:
+//   - format: csv or ndjson, otherwise guessed from the file name or content type
+//   - mode: valid_only (default) keeps every row that passed, all_or_nothing
+//     keeps nothing if a single row failed
+//   - dry_run=true runs every row through validation and rolls everything back
+//   - async=true runs the import in the background; uploads larger than
+//     IMPORT_ASYNC_BYTES always do
+func Import(c echo.Context) error {
+	ctx := ServerContext(c)
+
+	mode := c.QueryParam("mode")
+	if mode == "" {
+		mode = model.IMPORT_MODE_VALID_ONLY
+	}
+	if mode != model.IMPORT_MODE_VALID_ONLY && mode != model.IMPORT_MODE_ALL_OR_NOTHING {
+		return log.AddDefaultError(c, core.NewBusinessError(fmt.Sprintf("Unknown import mode %q", mode),
+			core.ERROR_SUBCODE_IMPORT_INVALID))
+	}
+
+	src, fileName, contentType, err := importUpload(c)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_IMPORT_INVALID))
+	}
+	defer src.Close()
+
+	format := ImportFormat(c, fileName, contentType)
+	if format == "" {
+		return log.AddDefaultError(c, core.NewBusinessError("Import format must be csv or ndjson",
+			core.ERROR_SUBCODE_IMPORT_UNSUPPORTED_FORMAT))
+	}
+
+	imp := model.Import{
+		UserID:   ctx.User.ID,
+		Resource: core.TableNameFor(ctx.Type),
+		Format:   format,
+		Mode:     mode,
+		DryRun:   c.QueryParam("dry_run") == "true",
+		Status:   model.IMPORT_STATUS_PENDING,
+	}
+	err = ctx.Repository.Create(&imp)
+	if err != nil {
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	size, err := saveImportUpload(ctx.Repository, &imp, src, ImportDir(ctx.Config))
+	if err != nil {
+		ctx.Repository.UpdateFields(&imp, map[string]interface{}{
+			"status": model.IMPORT_STATUS_FAILED,
+			"error":  err.Error(),
+		})
+		return log.AddDefaultError(c, core.NewServerError(err.Error()))
+	}
+
+	mctx := *ArgonContext(c)
+	userID := ActiveUserID(c, ctx)
+	logger := log.LoggerForParams(c, map[string]interface{}{"import_id": imp.ID, "format": format, "mode": mode})
+
+	if c.QueryParam("async") == "true" || size > ctx.Config.API.ImportAsyncBytes {
+		// The import outlives the request, its context must not stop it.
+		mctx.Ctx = context.Background()
+		repo := Detached(mctx.Ctx, ctx.Repository)
+		go processImport(repo, mctx, ctx.Type, userID, imp, ImportDir(ctx.Config), logger)
+
+		ctx.Payload["results"] = imp
+		ctx.Payload["url"] = fmt.Sprintf("/admin/imports/%d", imp.ID)
+		return c.JSON(http.StatusAccepted, ctx.Payload)
+	}
+
+	rowErrors, merr := processImport(ctx.Repository, mctx, ctx.Type, userID, imp, ImportDir(ctx.Config), logger)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+
+	ctx.Repository.FindByID(&imp, imp.ID)
+	ctx.Payload["results"] = imp
+	ctx.Payload["errors"] = rowErrors
+	ctx.Payload["report_url"] = fmt.Sprintf("/admin/imports/%d/report", imp.ID)
+	return c.JSON(http.StatusOK, ctx.Payload)
+}
+
+func GetImportReport(c echo.Context) error {
+	ctx := ServerContext(c)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+	}
+
+	imp := model.Import{}
+	err = ctx.Repository.FindByID(&imp, uint(id))
+	if err != nil {
+		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
+	}
+
+	canView, merr := imp.UserCanView(ArgonContext(c), ctx.User)
+	if merr != nil {
+		return log.AddDefaultError(c, merr)
+	}
+	if !canView {
+		return log.AddDefaultError(c, core.NewPermissionError("You do not have permission",
+			core.ERROR_SUBCODE_USER_LACKS_PERMISSION))
+	}
+
+	switch imp.Status {
+	case model.IMPORT_STATUS_DONE:
+		return c.Attachment(imp.ReportName, fmt.Sprintf("%s-import-%d-errors.csv", imp.Resource, imp.ID))
+	case model.IMPORT_STATUS_FAILED:
+		return log.AddDefaultError(c, core.NewServerError("Import failed: "+imp.Error))
+	}
+
+	ctx.Payload["results"] = imp
+	return c.JSON(http.StatusAccepted, ctx.Payload)
+}
+
+// ImportFormat picks the import format from ?format=, then from the file
+// extension and finally from the content type of the upload. An empty string
+// means the format is not supported.
+func ImportFormat(c echo.Context, fileName, contentType string) string {
+	switch strings.ToLower(c.QueryParam("format")) {
+	case IMPORT_FORMAT_CSV:
+		return IMPORT_FORMAT_CSV
+	case IMPORT_FORMAT_NDJSON:
+		return IMPORT_FORMAT_NDJSON
+	}
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return IMPORT_FORMAT_CSV
+	case ".ndjson", ".jsonl":
+		return IMPORT_FORMAT_NDJSON
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return IMPORT_FORMAT_CSV
+	case strings.HasPrefix(contentType, "application/x-ndjson"):
+		return IMPORT_FORMAT_NDJSON
+	}
+	return ""
+}
+
+// ImportDir is where uploads and reports of imports are kept, a temporary
+// directory unless configured.
+func ImportDir(cfg *config.Config) string {
+	dir := cfg.API.ImportDir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "imports")
+	}
+	return dir
+}
+
+// ImportFields maps the json name of every field an import may set to the
+// field itself. Fields of embedded structs are included.
+func ImportFields(t reflect.Type, apiType core.APIType) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for name, field := range ImportFields(f.Type, apiType) {
+				fields[name] = field
+			}
+			continue
+		}
+
+		name := core.JsonName(f)
+		if name == "" || name == "-" || !core.IsJsonEnabled(f, apiType) {
+			continue
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// ReadImport creates one item of type t per row of r. Every row runs in its
+// own nested transaction inside a single one, so a failed row never poisons
+// the ones after it, and the transaction is only committed when the mode and
+// dry-run flag allow it. Row errors go to report as they happen; only the
+// first IMPORT_ERROR_PREVIEW are returned. The returned error is set when
+// the file itself could not be read.
+func ReadImport(mctx model.ModelCtx, t reflect.Type, userID uint, imp *model.Import, r io.Reader, report io.Writer) ([]model.ImportRowError, core.DefaultError) {
+	reader, merr := newImportReader(imp.Format, r, ImportFields(t, mctx.APIType))
+	if merr != nil {
+		return nil, merr
+	}
+
+	reportWriter := csv.NewWriter(report)
+	reportWriter.Write([]string{"row", "field", "code", "subcode", "message"})
+
+	rowErrors := []model.ImportRowError{}
+	imp.TotalRows = 0
+	imp.FailedRows = 0
+
+	var readErr core.DefaultError
+	err := mctx.Repo().Transaction(func(tx repository.Repository) error {
+		mctx := mctx.WithRepository(tx)
+		passed := 0
+		for {
+			row, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				readErr = core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_IMPORT_INVALID)
+				return readErr
+			}
+			imp.TotalRows++
+
+			rowErr := row.Err
+			if rowErr == nil {
+				rowErr, err = importRow(mctx, t, userID, row.Values)
+				if err != nil {
+					return err
+				}
+			}
+			if rowErr == nil {
+				passed++
+				continue
+			}
+
+			imp.FailedRows++
+			for _, rowError := range model.NewImportRowErrors(row.Line, rowErr) {
+				reportWriter.Write([]string{
+					strconv.Itoa(rowError.Row),
+					rowError.Field,
+					strconv.Itoa(rowError.Code),
+					strconv.Itoa(rowError.Subcode),
+					rowError.Message,
+				})
+				if len(rowErrors) < IMPORT_ERROR_PREVIEW {
+					rowErrors = append(rowErrors, rowError)
+				}
+			}
+		}
+
+		imp.ImportedRows = passed
+		if imp.Mode == model.IMPORT_MODE_ALL_OR_NOTHING && imp.FailedRows > 0 {
+			imp.ImportedRows = 0
+		}
+		if imp.DryRun || imp.ImportedRows == 0 {
+			return errImportRolledBack
+		}
+		return nil
+	})
+	if readErr != nil {
+		return nil, readErr
+	}
+	if err != nil && err != errImportRolledBack {
+		return nil, core.NewServerError(err.Error())
+	}
+
+	reportWriter.Flush()
+	if err := reportWriter.Error(); err != nil {
+		return nil, core.NewServerError(err.Error())
+	}
+	return rowErrors, nil
+}
+
+func importUpload(c echo.Context) (io.ReadCloser, string, string, error) {
+	req := c.Request()
+	contentType := req.Header.Get(echo.HeaderContentType)
+	if !strings.HasPrefix(contentType, echo.MIMEMultipartForm) {
+		return req.Body, "", contentType, nil
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", "", err
+	}
+	f, err := header.Open()
+	if err != nil {
+		return nil, "", "", err
+	}
+	return f, header.Filename, header.Header.Get(echo.HeaderContentType), nil
+}
+
+// saveImportUpload copies the upload to dir so a background import can
+// still read it once the request is gone.
+func saveImportUpload(repo repository.Repository, imp *model.Import, src io.Reader, dir string) (int64, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+
+	fileName := filepath.Join(dir, fmt.Sprintf("import-%d.%s", imp.ID, imp.Format))
+	f, err := os.Create(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(fileName)
+		return size, err
+	}
+
+	return size, repo.UpdateFields(imp, map[string]interface{}{"file_name": fileName})
+}
+
+func processImport(repo repository.Repository, mctx model.ModelCtx, t reflect.Type, userID uint, imp model.Import, dir string, logger *logrus.Entry) ([]model.ImportRowError, core.DefaultError) {
+	repo.UpdateFields(&imp, map[string]interface{}{"status": model.IMPORT_STATUS_RUNNING})
+	defer os.Remove(imp.FileName)
+
+	fail := func(err core.DefaultError) core.DefaultError {
+		logger.Error("Import failed: " + err.Error())
+		repo.UpdateFields(&imp, map[string]interface{}{
+			"status": model.IMPORT_STATUS_FAILED,
+			"error":  err.Error(),
+		})
+		return err
+	}
+
+	src, err := os.Open(imp.FileName)
+	if err != nil {
+		return nil, fail(core.NewServerError(err.Error()))
+	}
+	defer src.Close()
+
+	reportName := filepath.Join(dir, fmt.Sprintf("import-%d-report.csv", imp.ID))
+	report, err := os.Create(reportName)
+	if err != nil {
+		return nil, fail(core.NewServerError(err.Error()))
+	}
+
+	rowErrors, merr := ReadImport(*mctx.WithRepository(repo), t, userID, &imp, src, report)
+	if err := report.Close(); merr == nil && err != nil {
+		merr = core.NewServerError(err.Error())
+	}
+	if merr != nil {
+		os.Remove(reportName)
+		return nil, fail(merr)
+	}
+
+	repo.UpdateFields(&imp, map[string]interface{}{
+		"status":        model.IMPORT_STATUS_DONE,
+		"total_rows":    imp.TotalRows,
+		"imported_rows": imp.ImportedRows,
+		"failed_rows":   imp.FailedRows,
+		"file_name":     "",
+		"report_name":   reportName,
+	})
+	logger.WithFields(logrus.Fields{
+		"rows":     imp.TotalRows,
+		"imported": imp.ImportedRows,
+		"failed":   imp.FailedRows,
+		"dry_run":  imp.DryRun,
+	}).Info("Import finished")
+
+	return rowErrors, nil
+}
+
+// importRow runs one decoded row through the same pipeline as a create: the
+// model's Creator when it has one, otherwise the Restrictor and Validator
+// checks followed by a plain insert. The row runs in a nested transaction,
+// rolled back when it fails. The returned error is set when the transaction
+// itself failed and the import can't go on.
+func importRow(mctx *model.ModelCtx, t reflect.Type, userID uint, values map[string]interface{}) (core.DefaultError, error) {
+	item := reflect.New(t).Interface()
+
+	j, err := json.Marshal(values)
+	if err != nil {
+		return core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_IMPORT_ROW_INVALID), nil
+	}
+	if err := json.Unmarshal(j, item); err != nil {
+		data := map[string]interface{}{}
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			data["field"] = typeErr.Field
+		}
+		return core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_IMPORT_ROW_INVALID, data), nil
+	}
+
+	if userID > 0 {
+		model.SetUserID(item, userID)
+	}
+
+	var merr core.DefaultError
+	err = mctx.Repo().Transaction(func(tx repository.Repository) error {
+		merr = createImportItem(mctx.WithRepository(tx), t, item)
+		if merr != nil {
+			return merr
+		}
+		return nil
+	})
+	if _, ok := err.(core.DefaultError); ok {
+		return merr, nil
+	}
+	return nil, err
+}
+
+func createImportItem(mctx *model.ModelCtx, t reflect.Type, item interface{}) core.DefaultError {
+	if model.IsCreator(reflect.PtrTo(t)) {
+		creator := item.(model.Creator)
+		return creator.Create(mctx, mctx.User)
+	}
+
+	if model.IsRestrictor(t) {
+		restrictor := item.(model.Restrictor)
+		canCreate, err := restrictor.UserCanCreate(mctx, mctx.User)
+		if err != nil {
+			return err
+		}
+		if !canCreate {
+			return core.NewPermissionError("You do not have permission",
+				core.ERROR_SUBCODE_USER_LACKS_PERMISSION)
+		}
+	}
+
+	if model.IsValidator(t) {
+		validator := item.(model.Validator)
+		err := validator.ValidateForCreate()
+		if err != nil {
+			return err
+		}
+	}
+
+	dberr := mctx.Repo().Create(item)
+	if dberr != nil {
+		return core.NewServerError(dberr.Error())
+	}
+	return nil
+}
+
+type importRecord struct {
+	Line   int
+	Values map[string]interface{}
+	Err    core.DefaultError
+}
+
+type importReader interface {
+	// Next returns io.EOF once every row has been read. Problems with a single
+	// row are reported through importRecord.Err instead.
+	Next() (importRecord, error)
+}
+
+func newImportReader(format string, r io.Reader, fields map[string]reflect.StructField) (importReader, core.DefaultError) {
+	if format == IMPORT_FORMAT_CSV {
+		return newCSVImportReader(r, fields)
+	}
+	return &ndjsonImportReader{r: bufio.NewReader(r), fields: fields}, nil
+}
+
+// csvImportReader numbers rows the way a spreadsheet does: the header is row 1.
+type csvImportReader struct {
+	r       *csv.Reader
+	names   []string
+	columns []*reflect.StructField
+	line    int
+}
+
+// newCSVImportReader reads the header and fails on any column the model does
+// not know. Columns that exist but are not settable, like id or created_at,
+// are skipped so an export can be imported back as is.
+func newCSVImportReader(r io.Reader, fields map[string]reflect.StructField) (*csvImportReader, core.DefaultError) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, core.NewBusinessError("Import file is empty", core.ERROR_SUBCODE_IMPORT_INVALID)
+	}
+	if err != nil {
+		return nil, core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_IMPORT_INVALID)
+	}
+
+	reader := &csvImportReader{r: cr, line: 1}
+	unknown := []string{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.TrimSpace(name)
+		reader.names = append(reader.names, name)
+
+		field, ok := fields[name]
+		if !ok {
+			unknown = append(unknown, name)
+			reader.columns = append(reader.columns, nil)
+			continue
+		}
+		if field.Tag.Get("settable") == "false" {
+			reader.columns = append(reader.columns, nil)
+			continue
+		}
+		reader.columns = append(reader.columns, &field)
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, core.NewBusinessError(
+			fmt.Sprintf("Unknown import columns: %s", strings.Join(unknown, ", ")),
+			core.ERROR_SUBCODE_IMPORT_UNKNOWN_COLUMN,
+			map[string]interface{}{"columns": unknown},
+		)
+	}
+	return reader, nil
+}
+
+func (cr *csvImportReader) Next() (importRecord, error) {
+	record, err := cr.r.Read()
+	if err == io.EOF {
+		return importRecord{}, err
+	}
+	cr.line++
+
+	if err != nil {
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			return importRecord{Line: cr.line, Err: core.NewBusinessError(parseErr.Error(),
+				core.ERROR_SUBCODE_IMPORT_ROW_INVALID)}, nil
+		}
+		return importRecord{}, err
+	}
+
+	if len(record) != len(cr.columns) {
+		return importRecord{Line: cr.line, Err: core.NewBusinessError(
+			fmt.Sprintf("Row has %d columns, the header has %d", len(record), len(cr.columns)),
+			core.ERROR_SUBCODE_IMPORT_ROW_INVALID)}, nil
+	}
+
+	values := map[string]interface{}{}
+	for i, cell := range record {
+		if cr.columns[i] == nil || cell == "" {
+			continue
+		}
+		values[cr.names[i]] = csvImportValue(*cr.columns[i], cell)
+	}
+	return importRecord{Line: cr.line, Values: values}, nil
+}
+
+// csvImportValue is the inverse of csvCell: strings are taken verbatim and
+// anything else is read as JSON, so numbers, booleans and timestamps decode
+// into the field the same way they would from a JSON body.
+func csvImportValue(field reflect.StructField, cell string) interface{} {
+	typ := field.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.String {
+		return cell
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(cell), &value); err != nil {
+		return cell
+	}
+	return value
+}
+
+type ndjsonImportReader struct {
+	r      *bufio.Reader
+	fields map[string]reflect.StructField
+	line   int
+}
+
+func (nr *ndjsonImportReader) Next() (importRecord, error) {
+	for {
+		data, err := nr.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return importRecord{}, err
+		}
+		if err == io.EOF && len(data) == 0 {
+			return importRecord{}, io.EOF
+		}
+		nr.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		return nr.record(data), nil
+	}
+}
+
+func (nr *ndjsonImportReader) record(data []byte) importRecord {
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return importRecord{Line: nr.line, Err: core.NewBusinessError(err.Error(),
+			core.ERROR_SUBCODE_IMPORT_ROW_INVALID)}
+	}
+
+	for name := range values {
+		field, ok := nr.fields[name]
+		if !ok {
+			return importRecord{Line: nr.line, Err: core.NewBusinessError(
+				fmt.Sprintf("%s: unknown field;", name),
+				core.ERROR_SUBCODE_IMPORT_UNKNOWN_COLUMN,
+				map[string]interface{}{"field": name})}
+		}
+		if field.Tag.Get("settable") == "false" {
+			delete(values, name)
+		}
+	}
+	return importRecord{Line: nr.line, Values: values}
+}
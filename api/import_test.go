@@ -0,0 +1,77 @@
+package api_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/api"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportFields(t *testing.T) {
+	fields := api.ImportFields(reflect.TypeOf(model.User{}), core.ADMIN_API)
+
+	assert.Contains(t, fields, "id")
+	assert.Contains(t, fields, "email")
+	assert.Contains(t, fields, "password")
+	assert.NotContains(t, fields, "hashed_password")
+	assert.Equal(t, "false", fields["id"].Tag.Get("settable"))
+}
+
+func TestImportFormat(t *testing.T) {
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/import?format=NDJSON", nil)
+	c := e.NewContext(req, httptest.NewRecorder())
+	assert.Equal(t, api.IMPORT_FORMAT_NDJSON, api.ImportFormat(c, "users.csv", "text/csv"))
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/users/import", nil)
+	c = e.NewContext(req, httptest.NewRecorder())
+	assert.Equal(t, api.IMPORT_FORMAT_CSV, api.ImportFormat(c, "users.csv", ""))
+	assert.Equal(t, api.IMPORT_FORMAT_NDJSON, api.ImportFormat(c, "users.jsonl", ""))
+	assert.Equal(t, api.IMPORT_FORMAT_CSV, api.ImportFormat(c, "", "text/csv; charset=utf-8"))
+	assert.Equal(t, "", api.ImportFormat(c, "users.xlsx", "application/octet-stream"))
+}
+
+const importUsers = `{"name":"Imported One","username":"imported1","email":"imported1@model.com","password":"12345"}
+{"name":"No","username":"imported2","email":"imported2@model.com","password":"12345"}
+{"name":"Imported Three","username":"imported3","email":"imported3@model.com","password":"12345"}
+`
+
+func readImportWithoutDatabase(t *testing.T, imp model.Import) (*repository.Memory, []model.ImportRowError) {
+	repo := repository.NewMemory()
+	mctx := model.ModelCtx{Repository: repo, APIType: core.ADMIN_API}
+	imp.Format = api.IMPORT_FORMAT_NDJSON
+	rowErrors, err := api.ReadImport(mctx, reflect.TypeOf(model.User{}), 0, &imp, strings.NewReader(importUsers), ioutil.Discard)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, imp.TotalRows)
+	assert.Equal(t, 1, imp.FailedRows)
+	return repo, rowErrors
+}
+
+func TestReadImportWithoutDatabase(t *testing.T) {
+	repo, rowErrors := readImportWithoutDatabase(t, model.Import{Mode: model.IMPORT_MODE_VALID_ONLY})
+	users := []model.User{}
+	assert.NoError(t, repo.List(&users, repository.Query{}))
+	assert.Len(t, users, 2, "the failed row is rolled back alone")
+	if assert.Len(t, rowErrors, 1) {
+		assert.Equal(t, 2, rowErrors[0].Row)
+		assert.Equal(t, "name", rowErrors[0].Field)
+	}
+
+	repo, _ = readImportWithoutDatabase(t, model.Import{Mode: model.IMPORT_MODE_ALL_OR_NOTHING})
+	assert.NoError(t, repo.List(&users, repository.Query{}))
+	assert.Empty(t, users)
+
+	repo, _ = readImportWithoutDatabase(t, model.Import{Mode: model.IMPORT_MODE_VALID_ONLY, DryRun: true})
+	assert.NoError(t, repo.List(&users, repository.Query{}))
+	assert.Empty(t, users)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	log "github.com/brunoksato/golang-boilerplate/log"
+	"github.com/labstack/echo/v4"
+)
+
+// GetLogLevels lists the log level of each system and sink.
+func GetLogLevels(c echo.Context) error {
+	ctx := ServerContext(c)
+	ctx.Payload["results"] = log.Current().Config()
+	return c.JSON(http.StatusOK, ctx.Payload)
+}
+
+// UpdateLogLevels changes the levels given in the body until the next
+// restart. Levels left out keep their value.
+func UpdateLogLevels(c echo.Context) error {
+	ctx := ServerContext(c)
+
+	config := log.LevelConfig{}
+	if err := c.Bind(&config); err != nil {
+		return log.AddDefaultError(c, core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_LOG_LEVEL_INVALID))
+	}
+
+	dispatcher := log.Current()
+	if err := dispatcher.SetConfig(config); err != nil {
+		return log.AddDefaultError(c, err)
+	}
+
+	log.LoggerForParams(c, map[string]interface{}{"levels": config}).Warn("Log levels changed")
+
+	ctx.Payload["results"] = dispatcher.Config()
+	return c.JSON(http.StatusOK, ctx.Payload)
+}
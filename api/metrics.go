@@ -0,0 +1,8 @@
+package api
+
+import "github.com/brunoksato/golang-boilerplate/metrics"
+
+var SIGNUPS = metrics.NewCounter("app_signups_total", "Users that signed up.")
+var LOGINS = metrics.NewCounter("app_logins_total", "Sign in attempts by result.", "result")
+var PASSWORD_RESETS = metrics.NewCounter("app_password_resets_total",
+	"Password resets by step, requested or completed.", "step")
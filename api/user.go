@@ -22,7 +22,6 @@ func Me(c echo.Context) error {
 
 func ChangePassword(c echo.Context) error {
 	ctx := ServerContext(c)
-	db := ctx.Database
 
 	type customPassword struct {
 		Password string `json:"password"`
@@ -34,14 +33,14 @@ func ChangePassword(c echo.Context) error {
 	}
 
 	user := model.User{}
-	err := db.First(&user, ctx.User.ID).Error
+	err := ctx.Repository.FindByID(&user, ctx.User.ID)
 	if err != nil {
 		return log.AddDefaultError(c, core.NewServerError(err.Error()))
 	}
 
-	user.HashedPassword, _ = bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 
-	serr := db.Model(&user).Set("gorm:save_associations", false).UpdateColumn("hashed_password", user.HashedPassword).Error
+	serr := ctx.Repository.UpdateFields(&user, map[string]interface{}{"hashed_password": hashedPassword})
 	if serr != nil {
 		return log.AddDefaultError(c, core.NewServerError(serr.Error()))
 	}
@@ -51,10 +50,9 @@ func ChangePassword(c echo.Context) error {
 
 func UpdateUser(c echo.Context) error {
 	ctx := ServerContext(c)
-	db := ctx.Database
 
 	user := model.User{}
-	err := db.First(&user, ctx.User.ID).Error
+	err := ctx.Repository.FindByID(&user, ctx.User.ID)
 	if err != nil {
 		return log.AddDefaultError(c, core.NewNotFoundError(err.Error()))
 	}
@@ -63,15 +61,12 @@ func UpdateUser(c echo.Context) error {
 		return log.AddDefaultError(c, core.NewServerError(err.Error()))
 	}
 
-	dberr := db.
-		Model(&user).
-		Set("gorm:save_associations", false).
-		Updates(map[string]interface{}{
-			"name":  user.Name,
-			"email": user.Email,
-			"phone": user.Phone,
-			"image": user.Image,
-		}).Error
+	dberr := ctx.Repository.UpdateFields(&user, map[string]interface{}{
+		"name":  user.Name,
+		"email": user.Email,
+		"phone": user.Phone,
+		"image": user.Image,
+	})
 	if dberr != nil {
 		return log.AddDefaultError(c, core.NewServerError(dberr.Error()))
 	}
@@ -1,8 +1,10 @@
 package api_test
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/brunoksato/golang-boilerplate/apitest"
 	"github.com/brunoksato/golang-boilerplate/core"
 	"github.com/brunoksato/golang-boilerplate/model"
 	"github.com/stretchr/testify/assert"
@@ -41,3 +43,84 @@ func TestUserDirects(t *testing.T) {
 	assert.Equal(t, actual[2].(map[string]interface{})["username"], "user3")
 	assert.Equal(t, actual[3].(map[string]interface{})["username"], "user4")
 }
+
+func TestMeNeedsAToken(t *testing.T) {
+	setup()
+	defer teardown()
+	client := apitest.New(t, TESTDB, TEST_CONFIG)
+
+	client.Anonymous().Get("/api/users/me").AssertCode(401)
+
+	user, err := model.CreateUser(TESTDB)
+	assert.NoError(t, err)
+	me := model.User{}
+	client.AsUser(user).Get("/api/users/me").AssertCode(200).Results(&me)
+	assert.Equal(t, user.ID, me.ID)
+	assert.Equal(t, user.Username, me.Username)
+}
+
+func TestAdminListsUsersWithTheirCount(t *testing.T) {
+	client := apitest.NewMemory(t, TEST_CONFIG)
+
+	user := client.CreateUser()
+	client.AsUser(user).Get("/admin/users").AssertCode(401)
+
+	for i := 0; i < 2; i++ {
+		client.CreateUser()
+	}
+
+	users := []model.User{}
+	res := client.AsAdmin().Get("/admin/users?limit=2&start=1").AssertCode(200).Results(&users)
+	assert.Len(t, users, 2)
+	assert.Equal(t, "factory", users[0].Username[:7])
+	// The three created above and the admin.
+	assert.Equal(t, 4, res.Count())
+}
+
+func TestPatchUserWithoutDatabase(t *testing.T) {
+	client := apitest.NewMemory(t, TEST_CONFIG)
+	user := client.CreateUser()
+	other := client.CreateUser()
+
+	patched := model.User{}
+	client.AsUser(user).
+		WithHeader("Content-Type", core.MERGE_PATCH_CONTENT_TYPE).
+		Patch(fmt.Sprintf("/api/users/%d", user.ID), `{"name":"Patched Name"}`).
+		AssertCode(200).
+		Results(&patched)
+	assert.Equal(t, "Patched Name", patched.Name)
+
+	me := model.User{}
+	client.AsUser(user).Get("/api/users/me").AssertCode(200).Results(&me)
+	assert.Equal(t, "Patched Name", me.Name)
+
+	client.AsUser(user).
+		WithHeader("Content-Type", core.MERGE_PATCH_CONTENT_TYPE).
+		Patch(fmt.Sprintf("/api/users/%d", other.ID), `{"name":"Not Mine"}`).
+		AssertCode(403)
+	client.AsUser(user).
+		WithHeader("Content-Type", core.MERGE_PATCH_CONTENT_TYPE).
+		Patch("/api/users/999999", `{"name":"Nobody"}`).
+		AssertCode(404)
+}
+
+func TestUserCantGrantThemselvesAdmin(t *testing.T) {
+	client := apitest.NewMemory(t, TEST_CONFIG)
+	user := client.CreateUser()
+	path := fmt.Sprintf("/api/users/%d", user.ID)
+
+	client.AsUser(user).
+		WithHeader("Content-Type", core.MERGE_PATCH_CONTENT_TYPE).
+		Patch(path, `{"admin":true}`).
+		AssertCode(403)
+	client.AsUser(user).
+		WithHeader("Content-Type", core.MERGE_PATCH_CONTENT_TYPE).
+		Patch(path, `{"name":"Rich User","balance":1000}`).
+		AssertCode(403)
+
+	stored := model.User{}
+	assert.NoError(t, client.Repository.FindByID(&stored, user.ID))
+	assert.False(t, stored.Admin)
+	assert.Equal(t, 0.0, stored.Balance)
+	assert.Equal(t, user.Name, stored.Name)
+}
@@ -0,0 +1,255 @@
+// Package apitest sends requests to the router in tests, signed in as a
+// user, an admin or a cron job the way clients are.
+//
+//	client := apitest.New(t, db, config.Default())
+//	user, _ := model.CreateUser(db)
+//	var me model.User
+//	client.AsUser(user).Get("/api/users/me").AssertCode(200).Results(&me)
+//
+// NewMemory serves the same routes without a database.
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/cache"
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/brunoksato/golang-boilerplate/server"
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+)
+
+// Client serves requests with a router storing the models in Repository.
+// Requests fail T when they can't be built or their response can't be read.
+type Client struct {
+	T          *testing.T
+	DB         *gorm.DB
+	Repository repository.Repository
+	Config     *config.Config
+	Router     *echo.Echo
+
+	admin *model.User
+}
+
+func New(t *testing.T, db *gorm.DB, cfg *config.Config) *Client {
+	return &Client{
+		T:          t,
+		DB:         db,
+		Repository: repository.NewGorm(db),
+		Config:     cfg,
+		Router:     server.SetupRouter(Configurer{DB: db, Config: cfg}),
+	}
+}
+
+// NewMemory is a client of a router on a repository.Memory, for handlers
+// that only store through the repository. Its writes invalidate the
+// cached responses as those of a database do.
+func NewMemory(t *testing.T, cfg *config.Config) *Client {
+	repo := repository.NewMemory()
+	repo.OnWrite = func(table string) {
+		cache.Invalidate(cache.Default(), table)
+	}
+	return &Client{
+		T:          t,
+		Repository: repo,
+		Config:     cfg,
+		Router:     server.SetupRouter(Configurer{Config: cfg, Repository: repo}),
+	}
+}
+
+// CreateUser saves a user of the factories in the repository of c.
+func (c *Client) CreateUser(overrides ...func(*model.User)) model.User {
+	user := model.BuildUser(overrides...)
+	if err := c.Repository.Create(&user); err != nil {
+		c.T.Fatalf("apitest: creating a user: %s", err)
+	}
+	return user
+}
+
+// Request is a request to build: its headers say who sends it.
+type Request struct {
+	client *Client
+	Header http.Header
+	User   model.User
+}
+
+func (c *Client) request(company string) *Request {
+	header := http.Header{}
+	header.Set("X-Company", company)
+	header.Set("Content-Type", "application/json")
+	return &Request{client: c, Header: header}
+}
+
+// Anonymous sends public requests, without a token.
+func (c *Client) Anonymous() *Request {
+	return c.request("Office")
+}
+
+// AsUser signs requests with a token of u, which must be saved in the
+// repository.
+func (c *Client) AsUser(u model.User) *Request {
+	r := c.request("Office")
+	r.signIn(u)
+	return r
+}
+
+// AsAdmin signs requests as an admin of the admin API, the same one for all
+// requests of c, created on first use.
+func (c *Client) AsAdmin() *Request {
+	if c.admin == nil {
+		admin := c.CreateUser(func(u *model.User) { u.Admin = true })
+		c.admin = &admin
+	}
+	r := c.request("Admin")
+	r.signIn(*c.admin)
+	return r
+}
+
+// AsCronJob sends requests with the cron job password of the config.
+func (c *Client) AsCronJob() *Request {
+	r := c.request("CronJob")
+	r.Header.Set("X-Cronjob", c.Config.Server.CronjobPassword)
+	return r
+}
+
+func (r *Request) signIn(u model.User) {
+	expireAt := model.JWTTokenExpirationDate(r.client.Config.JWT.TokenExpiration)
+	token, err := model.IssueJWToken(u.ID, model.JWTRoles(u), expireAt, r.client.Config.JWT.SigninKey)
+	if err != nil {
+		r.client.T.Fatalf("apitest: issuing a token: %s", err)
+	}
+	r.User = u
+	r.Header.Set("Authorization", "Bearer "+token)
+}
+
+// WithHeader sets a header of the request, replacing the default one.
+func (r *Request) WithHeader(key, value string) *Request {
+	r.Header.Set(key, value)
+	return r
+}
+
+func (r *Request) Get(path string) *Response {
+	return r.Do("GET", path, nil)
+}
+
+func (r *Request) Post(path string, body interface{}) *Response {
+	return r.Do("POST", path, body)
+}
+
+func (r *Request) Put(path string, body interface{}) *Response {
+	return r.Do("PUT", path, body)
+}
+
+func (r *Request) Patch(path string, body interface{}) *Response {
+	return r.Do("PATCH", path, body)
+}
+
+func (r *Request) Delete(path string) *Response {
+	return r.Do("DELETE", path, nil)
+}
+
+// Do serves the request. body is sent as it is when it is a string or
+// []byte, and as JSON otherwise.
+func (r *Request) Do(method, path string, body interface{}) *Response {
+	t := r.client.T
+	t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(b)
+	case []byte:
+		reader = bytes.NewBuffer(b)
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("apitest: encoding the body of %s %s: %s", method, path, err)
+		}
+		reader = bytes.NewBuffer(encoded)
+	}
+
+	request := httptest.NewRequest(method, path, reader)
+	for key, values := range r.Header {
+		request.Header[key] = values
+	}
+	recorder := httptest.NewRecorder()
+	r.client.Router.ServeHTTP(recorder, request)
+	return &Response{ResponseRecorder: recorder, t: t}
+}
+
+// Response is what the router answered.
+type Response struct {
+	*httptest.ResponseRecorder
+	t *testing.T
+}
+
+// Envelope is the payload the handlers answer with: the results and, for
+// lists, their total count.
+type Envelope struct {
+	Results json.RawMessage `json:"results"`
+	Count   *int            `json:"ct"`
+}
+
+// AssertCode fails the test unless the response has code.
+func (r *Response) AssertCode(code int) *Response {
+	r.t.Helper()
+	if r.Code != code {
+		r.t.Errorf("apitest: expected code %d but got %d: %s", code, r.Code, r.Body.String())
+	}
+	return r
+}
+
+func (r *Response) Envelope() Envelope {
+	r.t.Helper()
+	var envelope Envelope
+	if err := json.Unmarshal(r.Body.Bytes(), &envelope); err != nil {
+		r.t.Fatalf("apitest: decoding %q: %s", r.Body.String(), err)
+	}
+	return envelope
+}
+
+// Results decodes the results of the payload into v, a pointer to a model
+// or to a slice of them.
+func (r *Response) Results(v interface{}) *Response {
+	r.t.Helper()
+	results := r.Envelope().Results
+	if len(results) == 0 {
+		r.t.Fatalf("apitest: no results in %s", r.Body.String())
+	}
+	if err := json.Unmarshal(results, v); err != nil {
+		r.t.Fatalf("apitest: decoding the results into %T: %s", v, err)
+	}
+	return r
+}
+
+// Count is the total count of a list, ct in the payload.
+func (r *Response) Count() int {
+	r.t.Helper()
+	count := r.Envelope().Count
+	if count == nil {
+		r.t.Fatalf("apitest: no count in %s", r.Body.String())
+	}
+	return *count
+}
+
+// JSON decodes the whole body into v, as for payloads without results.
+func (r *Response) JSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		r.t.Fatalf("apitest: decoding %q into %T: %s", r.Body.String(), v, err)
+	}
+	return r
+}
+
+func (r *Response) String() string {
+	return fmt.Sprintf("%d %s", r.Code, r.Body.String())
+}
@@ -0,0 +1,98 @@
+package apitest
+
+import (
+	"github.com/brunoksato/golang-boilerplate/config"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Configurer is the server.MiddlewareConfigurer of tests: the production
+// middleware on DB, sessions included, without load shedding or the circuit
+// breaker. With a Repository the models are stored in it and DB may be nil,
+// retries are then not replayed. With Replicas, whose primary is DB, the
+// routes that may read from a replica do.
+type Configurer struct {
+	DB         *gorm.DB
+	Config     *config.Config
+	Repository repository.Repository
+	Replicas   *middle.Replicas
+}
+
+func (mc Configurer) ConfigureDefaultApiMiddleware(root *echo.Echo) *echo.Echo {
+	root.Use(middleware.Recover())
+	root.Use(middleware.CORS())
+	root.Use(middle.Config(mc.Config))
+	root.Use(middle.Timeout(mc.Config.Server.RequestTimeout))
+	root.Use(middleware.SecureWithConfig(middleware.SecureConfig{
+		XSSProtection:         "1; mode=block",
+		ContentTypeNosniff:    "nosniff",
+		XFrameOptions:         "SAMEORIGIN",
+		ContentSecurityPolicy: "default-src 'self'",
+	}))
+	if mc.Replicas != nil {
+		root.Use(middle.ReplicaDBMiddleware(mc.Replicas))
+	} else {
+		root.Use(middle.DBMiddleware(mc.DB))
+	}
+	if mc.Repository != nil {
+		root.Use(middle.RepositoryMiddleware(mc.Repository))
+	}
+	root.Use(middle.ElasticMiddleware(nil))
+	root.Use(middle.DetermineType)
+	root.Use(middle.InitializePayload)
+	root.Use(middle.LoadConfigurations)
+
+	return root
+}
+
+func (mc Configurer) ConfigurePublicApiMiddleware(root *echo.Echo) *echo.Group {
+	public := root.Group("/public")
+	public.Use(middleware.CORS())
+	public.Use(middle.SettingHeaders)
+	public.Use(middle.Session)
+	mc.useIdempotency(public)
+
+	return public
+}
+
+func (mc Configurer) ConfigurePrivateApiMiddleware(root *echo.Echo) *echo.Group {
+	private := root.Group("/api")
+	private.Use(middleware.Gzip())
+	private.Use(middleware.CORS())
+	private.Use(middle.SettingHeaders)
+	private.Use(middle.Session)
+	mc.useIdempotency(private)
+
+	return private
+}
+
+func (mc Configurer) ConfigureCronJobApiMiddleware(root *echo.Echo) *echo.Group {
+	private := root.Group("/cronjob")
+	private.Use(middleware.CORS())
+	private.Use(middleware.Gzip())
+	private.Use(middle.SettingHeaders)
+	private.Use(middle.Session)
+	mc.useIdempotency(private)
+
+	return private
+}
+
+func (mc Configurer) ConfigureAdminApiMiddleware(root *echo.Echo) *echo.Group {
+	private := root.Group("/admin")
+	private.Use(middleware.CORS())
+	private.Use(middleware.Gzip())
+	private.Use(middle.SettingHeaders)
+	private.Use(middle.Session)
+	mc.useIdempotency(private)
+
+	return private
+}
+
+func (mc Configurer) useIdempotency(group *echo.Group) {
+	if mc.DB != nil {
+		group.Use(middle.Idempotency(mc.Config.API.IdempotencyTTL, mc.Config.API.IdempotencyMaxBytes))
+	}
+}
@@ -0,0 +1,180 @@
+// Package cache keeps serialized responses behind a Cache interface. Each
+// entry belongs to the generation of the tables it was read from; writing
+// to a table starts a new generation, so its old entries are never read
+// again and age out of the cache.
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/metrics"
+	"github.com/jinzhu/gorm"
+)
+
+const BACKEND_MEMORY = "memory"
+const BACKEND_NONE = "none"
+
+const GENERATION_PREFIX = "generation:"
+
+var CACHE_REQUESTS = metrics.NewCounter("cache_requests_total", "Cache lookups by result, hit or miss.", "result")
+
+// Cache stores values until their ttl, 0 meaning no expiry. Backends must
+// be safe for concurrent use; shared ones, e.g. on Redis, are set with
+// SetDefault.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+var mutex sync.Mutex
+var defaultCache Cache
+
+// Default returns the cache set with SetDefault, or one built from the
+// default configuration on first use.
+func Default() Cache {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if defaultCache == nil {
+		defaultCache = New(config.Default())
+	}
+	return defaultCache
+}
+
+// SetDefault replaces the cache returned by Default.
+func SetDefault(c Cache) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	defaultCache = c
+}
+
+// New builds the cache of the backend cfg selects.
+func New(cfg *config.Config) Cache {
+	if cfg.Cache.Backend == BACKEND_NONE {
+		return Nop{}
+	}
+	return NewLRU(cfg.Cache.Size)
+}
+
+// Nop caches nothing.
+type Nop struct{}
+
+func (Nop) Get(key string) ([]byte, bool)                   { return nil, false }
+func (Nop) Set(key string, value []byte, ttl time.Duration) {}
+func (Nop) Delete(key string)                               {}
+
+var flights = &flight{}
+
+// Fetch returns the value of key, calling fill and caching its result for
+// ttl on a miss. Concurrent misses of a key share a single fill. Errors are
+// not cached.
+func Fetch(c Cache, key string, ttl time.Duration, fill func() ([]byte, error)) ([]byte, error) {
+	if value, ok := c.Get(key); ok {
+		CACHE_REQUESTS.Inc("hit")
+		return value, nil
+	}
+	CACHE_REQUESTS.Inc("miss")
+
+	return flights.Do(key, func() ([]byte, error) {
+		value, err := fill()
+		if err != nil {
+			return nil, err
+		}
+		c.Set(key, value, ttl)
+		return value, nil
+	})
+}
+
+// Generation is the current generation of tag, a table name. Keys built
+// with it stop matching once the tag is invalidated.
+func Generation(c Cache, tag string) string {
+	if generation, ok := c.Get(GENERATION_PREFIX + tag); ok {
+		return string(generation)
+	}
+	// Never set, or evicted: a new generation is safe either way.
+	return Invalidate(c, tag)
+}
+
+// Invalidate starts a new generation of tag and returns it.
+func Invalidate(c Cache, tag string) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	generation := hex.EncodeToString(b)
+	c.Set(GENERATION_PREFIX+tag, []byte(generation), 0)
+	return generation
+}
+
+// RegisterCallbacks invalidates the table of every successful create,
+// update and delete of db in the Default cache. Inside a transaction that
+// happens before the commit, so a concurrent read can still cache the old
+// rows under the new generation: transactions started with Begin end with
+// Commit, which invalidates their tables again.
+func RegisterCallbacks(db *gorm.DB) {
+	callback := db.Callback()
+	callback.Create().After("gorm:create").Register("cache:after_create", invalidateTable)
+	callback.Update().After("gorm:update").Register("cache:after_update", invalidateTable)
+	callback.Delete().After("gorm:delete").Register("cache:after_delete", invalidateTable)
+}
+
+// WRITTEN_TABLES_KEY holds the tables a transaction of Begin wrote to.
+const WRITTEN_TABLES_KEY = "cache:written_tables"
+
+type writtenTables struct {
+	mutex  sync.Mutex
+	tables map[string]bool
+}
+
+// Begin starts a transaction of db that keeps the tables it writes to for
+// Commit. They are kept in the transaction itself, so one ended with a plain
+// Commit or Rollback leaves nothing behind.
+func Begin(db *gorm.DB) *gorm.DB {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx
+	}
+	return tx.Set(WRITTEN_TABLES_KEY, &writtenTables{tables: map[string]bool{}})
+}
+
+// Commit commits tx, then invalidates the tables it wrote to once more.
+func Commit(tx *gorm.DB) *gorm.DB {
+	db := tx.Commit()
+	if written, ok := writtenTablesOf(tx); ok {
+		written.mutex.Lock()
+		defer written.mutex.Unlock()
+		for table := range written.tables {
+			Invalidate(Default(), table)
+		}
+	}
+	return db
+}
+
+func invalidateTable(scope *gorm.Scope) {
+	if scope.HasError() || scope.DB().RowsAffected == 0 {
+		return
+	}
+	table := scope.TableName()
+	Invalidate(Default(), table)
+
+	if written, ok := writtenTablesOf(scope.DB()); ok {
+		written.mutex.Lock()
+		defer written.mutex.Unlock()
+		written.tables[table] = true
+	}
+}
+
+func writtenTablesOf(db *gorm.DB) (*writtenTables, bool) {
+	value, ok := db.Get(WRITTEN_TABLES_KEY)
+	if !ok {
+		return nil, false
+	}
+	written, ok := value.(*writtenTables)
+	return written, ok
+}
@@ -0,0 +1,132 @@
+package cache_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/cache"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	lru := cache.NewLRU(2)
+	lru.Set("a", []byte("1"), 0)
+	lru.Set("b", []byte("2"), 0)
+	lru.Get("a")
+	lru.Set("c", []byte("3"), 0)
+
+	_, ok := lru.Get("b")
+	assert.False(t, ok)
+	value, ok := lru.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(value))
+	assert.Equal(t, 2, lru.Len())
+}
+
+func TestLRUExpires(t *testing.T) {
+	lru := cache.NewLRU(10)
+	lru.Set("a", []byte("1"), 10*time.Millisecond)
+	_, ok := lru.Get("a")
+	assert.True(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = lru.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, lru.Len())
+}
+
+func TestFetchCollapsesConcurrentMisses(t *testing.T) {
+	lru := cache.NewLRU(10)
+	var fills int32
+	release := make(chan struct{})
+	fill := func() ([]byte, error) {
+		atomic.AddInt32(&fills, 1)
+		<-release
+		return []byte("value"), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cache.Fetch(lru, "key", time.Minute, fill)
+			assert.NoError(t, err)
+			assert.Equal(t, "value", string(value))
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fills))
+
+	cache.Fetch(lru, "key", time.Minute, fill)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fills), "then served from the cache")
+}
+
+func TestFetchDoesNotCacheErrors(t *testing.T) {
+	lru := cache.NewLRU(10)
+	_, err := cache.Fetch(lru, "key", time.Minute, func() ([]byte, error) {
+		return nil, errors.New("down")
+	})
+	assert.Error(t, err)
+	_, ok := lru.Get("key")
+	assert.False(t, ok)
+}
+
+func TestInvalidateStartsNewGeneration(t *testing.T) {
+	lru := cache.NewLRU(10)
+	generation := cache.Generation(lru, "users")
+	assert.Equal(t, generation, cache.Generation(lru, "users"))
+
+	cache.Invalidate(lru, "users")
+	assert.NotEqual(t, generation, cache.Generation(lru, "users"))
+
+	lru.Delete(cache.GENERATION_PREFIX + "users")
+	assert.NotEqual(t, generation, cache.Generation(lru, "users"), "an evicted generation is replaced")
+}
+
+type cachedRow struct {
+	ID   uint
+	Name string
+}
+
+func TestCommitInvalidatesAgain(t *testing.T) {
+	db, err := core.OpenTestConnection()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	cache.RegisterCallbacks(db)
+	assert.NoError(t, db.AutoMigrate(&cachedRow{}).Error)
+	defer db.DropTable(&cachedRow{})
+
+	lru := cache.NewLRU(10)
+	cache.SetDefault(lru)
+	defer cache.SetDefault(nil)
+	table := db.NewScope(&cachedRow{}).TableName()
+
+	tx := cache.Begin(db)
+	assert.NoError(t, tx.Create(&cachedRow{Name: "committed"}).Error)
+	// A read outside of tx until the commit caches the old rows with it.
+	generation := cache.Generation(lru, table)
+	assert.NoError(t, cache.Commit(tx).Error)
+	assert.NotEqual(t, generation, cache.Generation(lru, table))
+
+	tx = cache.Begin(db)
+	assert.NoError(t, tx.Create(&cachedRow{Name: "rolled back"}).Error)
+	generation = cache.Generation(lru, table)
+	assert.NoError(t, tx.Rollback().Error)
+	assert.Equal(t, generation, cache.Generation(lru, table))
+
+	// A transaction of a plain Begin is only invalidated as it writes.
+	tx = db.Begin()
+	assert.NoError(t, tx.Create(&cachedRow{Name: "plain"}).Error)
+	generation = cache.Generation(lru, table)
+	assert.NoError(t, cache.Commit(tx).Error)
+	assert.Equal(t, generation, cache.Generation(lru, table))
+}
@@ -0,0 +1,43 @@
+package cache
+
+import "sync"
+
+// flight collapses concurrent calls for the same key into one, like
+// golang.org/x/sync/singleflight.
+type flight struct {
+	calls map[string]*call
+	mutex sync.Mutex
+}
+
+type call struct {
+	done  sync.WaitGroup
+	value []byte
+	err   error
+}
+
+// Do runs fn for key, unless a call for key is running already, in which
+// case it waits for that call and returns its result.
+func (f *flight) Do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	f.mutex.Lock()
+	if f.calls == nil {
+		f.calls = map[string]*call{}
+	}
+	if running, ok := f.calls[key]; ok {
+		f.mutex.Unlock()
+		running.done.Wait()
+		return running.value, running.err
+	}
+	c := &call{}
+	c.done.Add(1)
+	f.calls[key] = c
+	f.mutex.Unlock()
+
+	defer func() {
+		f.mutex.Lock()
+		delete(f.calls, key)
+		f.mutex.Unlock()
+		c.done.Done()
+	}()
+	c.value, c.err = fn()
+	return c.value, c.err
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is an in-process cache of up to Size entries. The least recently
+// used entry makes room for new ones; expired entries go on their next
+// read.
+type LRU struct {
+	Size int
+
+	items map[string]*list.Element
+	order *list.List
+	mutex sync.Mutex
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func NewLRU(size int) *LRU {
+	return &LRU{
+		Size:  size,
+		items: map[string]*list.Element{},
+		order: list.New(),
+	}
+}
+
+func (l *LRU) Get(key string) ([]byte, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	element, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		l.remove(element)
+		return nil, false
+	}
+	l.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (l *LRU) Set(key string, value []byte, ttl time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	if element, ok := l.items[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		l.order.MoveToFront(element)
+		return
+	}
+
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for l.order.Len() > l.Size {
+		l.remove(l.order.Back())
+	}
+}
+
+func (l *LRU) Delete(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if element, ok := l.items[key]; ok {
+		l.remove(element)
+	}
+}
+
+func (l *LRU) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.order.Len()
+}
+
+func (l *LRU) remove(element *list.Element) {
+	l.order.Remove(element)
+	delete(l.items, element.Value.(*lruEntry).key)
+}
@@ -1,137 +1,457 @@
 package config
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Sirupsen/logrus"
-	"github.com/brunoksato/golang-boilerplate/log"
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/postgres"
-	elastic "github.com/olivere/elastic"
-	"go.elastic.co/apm/module/apmgorm"
+	yaml "gopkg.in/yaml.v2"
 )
 
-var CONFIGURATIONS map[string]string = map[string]string{
-	"SERVER_ENV":            "development",
-	"SERVER_NAME":           "SERVER",
-	"DATABASE_URL":          "dbname=server sslmode=disable",
-	"AWS_ACCESS_KEY":        "",
-	"AWS_ACCESS_KEY_SECRET": "",
-	"AWS_REGION":            "us-east-1",
-	"AWS_BUCKET":            "development.company.asset",
-	"ES_HOST":               "localhost:9200",
-	"LOGGER_LEVEL":          "info",
-	"SENDGRID_KEY":          "key_sendgrid",
-	"SENDGRID_USER":         "support@company.com",
-	"JWT_KEY_SIGNIN":        "you_secret_key",
-	"JWT_KEY_EMAIL":         "you_secret_key_email",
-	"JWT_TOKEN_EXPIRATION":  "72",
+const ENV_DEVELOPMENT = "development"
+const ENV_PRODUCTION = "production"
+
+// CONFIG_FILE_ENV names the variable holding the path of the config file
+// when no -config flag is given.
+const CONFIG_FILE_ENV = "CONFIG_FILE"
+
+// Config is the configuration of the server. Each field is read, in order
+// of precedence, from its command line flag, like -server.port, its
+// environment variable, the config file and the default in its tag.
+//
+// Durations accept a bare number in the unit of their tag, so
+// JWT_TOKEN_EXPIRATION=72 is 72 hours, or anything time.ParseDuration
+// does. Lists are comma separated and maps are lists of key:value.
+type Config struct {
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	JWT           JWTConfig           `yaml:"jwt"`
+	Sendgrid      SendgridConfig      `yaml:"sendgrid"`
+	AWS           AWSConfig           `yaml:"aws"`
+	Storage       StorageConfig       `yaml:"storage"`
+	Cache         CacheConfig         `yaml:"cache"`
+	Upload        UploadConfig        `yaml:"upload"`
+	API           APIConfig           `yaml:"api"`
+	Elasticsearch ElasticsearchConfig `yaml:"elasticsearch"`
+	Log           LogConfig           `yaml:"log"`
+	Tracing       TracingConfig       `yaml:"tracing"`
+}
+
+type ServerConfig struct {
+	Env                string        `yaml:"env" env:"SERVER_ENV" default:"development"`
+	Name               string        `yaml:"name" env:"SERVER_NAME" default:"SERVER"`
+	Port               int           `yaml:"port" env:"PORT" default:"8080"`
+	DefaultLanguage    string        `yaml:"default_language" env:"DEFAULT_LANGUAGE" default:"en"`
+	ProblemTypeBaseURL string        `yaml:"problem_type_base_url" env:"PROBLEM_TYPE_BASE_URL" default:"/problems/"`
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout" env:"HEALTH_CHECK_TIMEOUT" default:"2" unit:"s"`
+	ShutdownDelay      time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY" default:"5" unit:"s"`
+	RequestTimeout     time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT" default:"30" unit:"s"`
+	// Imports and streamed exports get LongRequestTimeout instead.
+	LongRequestTimeout time.Duration `yaml:"long_request_timeout" env:"LONG_REQUEST_TIMEOUT" default:"300" unit:"s"`
+	MetricsToken       string        `yaml:"metrics_token" env:"METRICS_TOKEN" secret:"true"`
+	// Cron jobs send CronjobPassword in the X-Cronjob header.
+	CronjobPassword string `yaml:"cronjob_password" env:"CRONJOB_PASSWORD" default:"youpassword" secret:"true"`
+
+	// The concurrency limit starts at ConcurrencyLimit, 0 turns load
+	// shedding off, and adapts between its min and max.
+	ConcurrencyLimit         int           `yaml:"concurrency_limit" env:"CONCURRENCY_LIMIT" default:"40"`
+	ConcurrencyMinLimit      int           `yaml:"concurrency_min_limit" env:"CONCURRENCY_MIN_LIMIT" default:"10"`
+	ConcurrencyMaxLimit      int           `yaml:"concurrency_max_limit" env:"CONCURRENCY_MAX_LIMIT" default:"200"`
+	ConcurrencyLatencyTarget time.Duration `yaml:"concurrency_latency_target" env:"CONCURRENCY_LATENCY_TARGET" default:"500" unit:"ms"`
+	ConcurrencyUserShare     float64       `yaml:"concurrency_user_share" env:"CONCURRENCY_USER_SHARE" default:"0.8"`
+}
+
+type DatabaseConfig struct {
+	URL                  string        `yaml:"url" env:"DATABASE_URL" default:"dbname=server sslmode=disable" secret:"dsn"`
+	ReplicaURLs          []string      `yaml:"replica_urls" env:"DATABASE_REPLICA_URLS" secret:"dsn"`
+	ReplicaStickyWindow  time.Duration `yaml:"replica_sticky_window" env:"DATABASE_REPLICA_STICKY_WINDOW" default:"5" unit:"s"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" env:"DATABASE_REPLICA_CHECK_INTERVAL" default:"10" unit:"s"`
+	ConnectRetries       int           `yaml:"connect_retries" env:"DATABASE_CONNECT_RETRIES" default:"5"`
+	ConnectBackoff       time.Duration `yaml:"connect_backoff" env:"DATABASE_CONNECT_BACKOFF" default:"1" unit:"s"`
+	BreakerThreshold     int           `yaml:"breaker_threshold" env:"DATABASE_BREAKER_THRESHOLD" default:"5"`
+	BreakerCooldown      time.Duration `yaml:"breaker_cooldown" env:"DATABASE_BREAKER_COOLDOWN" default:"5" unit:"s"`
+}
+
+type JWTConfig struct {
+	SigninKey       string        `yaml:"signin_key" env:"JWT_KEY_SIGNIN" default:"you_secret_key" secret:"true"`
+	EmailKey        string        `yaml:"email_key" env:"JWT_KEY_EMAIL" default:"you_secret_key_email" secret:"true"`
+	TokenExpiration time.Duration `yaml:"token_expiration" env:"JWT_TOKEN_EXPIRATION" default:"72" unit:"h"`
+}
+
+type SendgridConfig struct {
+	Key  string `yaml:"key" env:"SENDGRID_KEY" default:"key_sendgrid" secret:"true"`
+	User string `yaml:"user" env:"SENDGRID_USER" default:"support@company.com"`
+}
+
+type AWSConfig struct {
+	AccessKey string `yaml:"access_key" env:"AWS_ACCESS_KEY"`
+	SecretKey string `yaml:"secret_key" env:"AWS_ACCESS_KEY_SECRET" secret:"true"`
+	Region    string `yaml:"region" env:"AWS_REGION" default:"us-east-1"`
+	Bucket    string `yaml:"bucket" env:"AWS_BUCKET" default:"development.company.asset"`
+}
+
+type StorageConfig struct {
+	Backend    string `yaml:"backend" env:"STORAGE_BACKEND" default:"filesystem"`
+	Dir        string `yaml:"dir" env:"STORAGE_DIR"`
+	BaseURL    string `yaml:"base_url" env:"STORAGE_BASE_URL"`
+	SigningKey string `yaml:"signing_key" env:"STORAGE_SIGNING_KEY" default:"you_secret_key_storage" secret:"true"`
+	S3Endpoint string `yaml:"s3_endpoint" env:"S3_ENDPOINT"`
+}
+
+// CacheConfig sets up the response cache. The memory backend keeps up to
+// Size entries per process, so other processes only see a write once their
+// entries expire; none turns caching off.
+type CacheConfig struct {
+	Backend string `yaml:"backend" env:"CACHE_BACKEND" default:"memory"`
+	Size    int    `yaml:"size" env:"CACHE_SIZE" default:"10000"`
+}
+
+type UploadConfig struct {
+	MaxBytes     int64    `yaml:"max_bytes" env:"UPLOAD_MAX_BYTES" default:"10485760"`
+	ContentTypes []string `yaml:"content_types" env:"UPLOAD_CONTENT_TYPES" default:"image/jpeg,image/png,image/gif,application/pdf"`
+	AvatarSize   int      `yaml:"avatar_size" env:"AVATAR_SIZE" default:"256"`
+}
+
+type APIConfig struct {
+	BatchMaxSize     int    `yaml:"batch_max_size" env:"BATCH_MAX_SIZE" default:"100"`
+	ExportDir        string `yaml:"export_dir" env:"EXPORT_DIR"`
+	ImportDir        string `yaml:"import_dir" env:"IMPORT_DIR"`
+	ImportAsyncBytes int64  `yaml:"import_async_bytes" env:"IMPORT_ASYNC_BYTES" default:"1048576"`
+	// Responses to requests with an Idempotency-Key are replayed for
+	// IdempotencyTTL. Bodies over IdempotencyMaxBytes can't use a key.
+	IdempotencyTTL      time.Duration `yaml:"idempotency_ttl" env:"IDEMPOTENCY_TTL" default:"24" unit:"h"`
+	IdempotencyMaxBytes int64         `yaml:"idempotency_max_bytes" env:"IDEMPOTENCY_MAX_BYTES" default:"1048576"`
 }
 
-func Init() {
-	if os.Getenv("SERVER_ENV") == "" {
-		os.Setenv("SERVER_ENV", CONFIGURATIONS["SERVER_ENV"])
+type ElasticsearchConfig struct {
+	Host             string        `yaml:"host" env:"ES_HOST" default:"localhost:9200"`
+	LogQueueSize     int           `yaml:"log_queue_size" env:"ES_LOG_QUEUE_SIZE" default:"10000"`
+	LogOverflow      string        `yaml:"log_overflow" env:"ES_LOG_OVERFLOW" default:"drop_newest"`
+	LogFlushInterval time.Duration `yaml:"log_flush_interval" env:"ES_LOG_FLUSH_INTERVAL" default:"5" unit:"s"`
+}
+
+type LogConfig struct {
+	Level              string            `yaml:"level" env:"LOGGER_LEVEL" default:"info"`
+	Levels             map[string]string `yaml:"levels" env:"LOG_LEVELS"`
+	Sinks              map[string]string `yaml:"sinks" env:"LOG_SINKS" default:"stdout,es"`
+	FilePath           string            `yaml:"file_path" env:"LOG_FILE_PATH" default:"server.log"`
+	FileMaxBytes       int64             `yaml:"file_max_bytes" env:"LOG_FILE_MAX_BYTES" default:"104857600"`
+	FileMaxBackups     int               `yaml:"file_max_backups" env:"LOG_FILE_MAX_BACKUPS" default:"5"`
+	SyslogAddress      string            `yaml:"syslog_address" env:"SYSLOG_ADDRESS"`
+	AccessSampleRate   float64           `yaml:"access_sample_rate" env:"ACCESS_LOG_SAMPLE_RATE" default:"1"`
+	AccessRedactParams []string          `yaml:"access_redact_params" env:"ACCESS_LOG_REDACT_PARAMS" default:"token,access_token,password,secret,key,signature,X-Amz-Signature,X-Amz-Credential"`
+}
+
+type TracingConfig struct {
+	Backends     []string `yaml:"backends" env:"TRACING_BACKEND" default:"apm"`
+	SampleRatio  float64  `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" default:"1"`
+	OTLPEndpoint string   `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" default:"http://localhost:4318"`
+	ServiceName  string   `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+}
+
+// IsProduction tells whether the server runs in production, where default
+// secrets are refused.
+func (cfg *Config) IsProduction() bool {
+	return cfg.Server.Env == ENV_PRODUCTION
+}
+
+// AppName names the server in logs, e.g. SERVER-production.
+func (cfg *Config) AppName() string {
+	return fmt.Sprintf("%s-%s", cfg.Server.Name, cfg.Server.Env)
+}
+
+// field is a setting of Config along with its tags.
+type field struct {
+	Path    string
+	Env     string
+	Default string
+	Secret  string
+	Unit    string
+	Value   reflect.Value
+}
+
+func (cfg *Config) fields() []field {
+	fields := []field{}
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i)
+		value := root.Field(i)
+		for j := 0; j < value.NumField(); j++ {
+			f := section.Type.Field(j)
+			fields = append(fields, field{
+				Path:    section.Tag.Get("yaml") + "." + f.Tag.Get("yaml"),
+				Env:     f.Tag.Get("env"),
+				Default: f.Tag.Get("default"),
+				Secret:  f.Tag.Get("secret"),
+				Unit:    f.Tag.Get("unit"),
+				Value:   value.Field(j),
+			})
+		}
 	}
-	if os.Getenv("SERVER_NAME") == "" {
-		os.Setenv("SERVER_NAME", CONFIGURATIONS["SERVER_NAME"])
+	return fields
+}
+
+// Default returns the configuration with every field at its default.
+func Default() *Config {
+	cfg := &Config{}
+	for _, f := range cfg.fields() {
+		if err := f.set(f.Default); err != nil {
+			panic(fmt.Sprintf("config: bad default of %s: %s", f.Path, err.Error()))
+		}
 	}
-	if os.Getenv("DATABASE_URL") == "" {
-		os.Setenv("DATABASE_URL", CONFIGURATIONS["DATABASE_URL"])
+	return cfg
+}
+
+// Load reads the configuration from the config file, the environment and
+// the flags in args, then validates it. The file is given with -config or
+// CONFIG_FILE.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	file := flags.String("config", "", "YAML config file")
+	for _, f := range cfg.fields() {
+		flags.String(f.Path, "", f.Env)
 	}
-	if os.Getenv("AWS_ACCESS_KEY") == "" {
-		os.Setenv("AWS_ACCESS_KEY", CONFIGURATIONS["AWS_ACCESS_KEY"])
+	if err := flags.Parse(args); err != nil {
+		return nil, err
 	}
-	if os.Getenv("AWS_ACCESS_KEY_SECRET") == "" {
-		os.Setenv("AWS_ACCESS_KEY_SECRET", CONFIGURATIONS["AWS_ACCESS_KEY_SECRET"])
+
+	path := *file
+	if path == "" {
+		path = os.Getenv(CONFIG_FILE_ENV)
 	}
-	if os.Getenv("AWS_REGION") == "" {
-		os.Setenv("AWS_REGION", CONFIGURATIONS["AWS_REGION"])
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return nil, err
+		}
 	}
-	if os.Getenv("AWS_BUCKET") == "" {
-		os.Setenv("AWS_BUCKET", CONFIGURATIONS["AWS_BUCKET"])
+
+	if err := cfg.LoadEnv(); err != nil {
+		return nil, err
 	}
-	if os.Getenv("ES_HOST") == "" {
-		os.Setenv("ES_HOST", CONFIGURATIONS["ES_HOST"])
+
+	errs := ValidationError{}
+	flags.Visit(func(fl *flag.Flag) {
+		if fl.Name == "config" {
+			return
+		}
+		if f, ok := cfg.field(fl.Name); ok {
+			if err := f.set(fl.Value.String()); err != nil {
+				errs = append(errs, fmt.Sprintf("-%s: %s", fl.Name, err.Error()))
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errs
 	}
-	if os.Getenv("LOGGER_LEVEL") == "" {
-		os.Setenv("LOGGER_LEVEL", CONFIGURATIONS["LOGGER_LEVEL"])
+
+	return cfg, cfg.Validate()
+}
+
+// LoadFile overrides the fields set in the YAML file at path. Unknown keys
+// are an error, they are most likely typos.
+func (cfg *Config) LoadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
 	}
-	if os.Getenv("SENDGRID_KEY") == "" {
-		os.Setenv("SENDGRID_KEY", CONFIGURATIONS["SENDGRID_KEY"])
+
+	sections := map[string]map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &sections); err != nil {
+		return fmt.Errorf("%s: %s", path, err.Error())
 	}
-	if os.Getenv("SENDGRID_USER") == "" {
-		os.Setenv("SENDGRID_USER", CONFIGURATIONS["SENDGRID_USER"])
+
+	errs := ValidationError{}
+	for section, values := range sections {
+		for key, value := range values {
+			name := section + "." + key
+			f, ok := cfg.field(name)
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s: unknown setting %s", path, name))
+				continue
+			}
+			if err := f.set(fileValue(value)); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s: %s", path, name, err.Error()))
+			}
+		}
 	}
-	if os.Getenv("JWT_KEY_SIGNIN") == "" {
-		os.Setenv("JWT_KEY_SIGNIN", CONFIGURATIONS["JWT_KEY_SIGNIN"])
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errs
 	}
-	if os.Getenv("JWT_KEY_EMAIL") == "" {
-		os.Setenv("JWT_KEY_EMAIL", CONFIGURATIONS["JWT_KEY_EMAIL"])
+	return nil
+}
+
+// LoadEnv overrides the fields whose environment variable is set and not
+// empty.
+func (cfg *Config) LoadEnv() error {
+	errs := ValidationError{}
+	for _, f := range cfg.fields() {
+		if value := os.Getenv(f.Env); value != "" {
+			if err := f.set(value); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", f.Env, err.Error()))
+			}
+		}
 	}
-	if os.Getenv("JWT_TOKEN_EXPIRATION") == "" {
-		os.Setenv("JWT_TOKEN_EXPIRATION", CONFIGURATIONS["JWT_TOKEN_EXPIRATION"])
+	if len(errs) > 0 {
+		return errs
 	}
+	return nil
 }
 
-func InitDB() *gorm.DB {
-	if os.Getenv("DATABASE_URL") == "" {
-		os.Setenv("DATABASE_URL", CONFIGURATIONS["DATABASE_URL"])
+func (cfg *Config) field(path string) (field, bool) {
+	for _, f := range cfg.fields() {
+		if f.Path == path {
+			return f, true
+		}
 	}
+	return field{}, false
+}
 
-	db, err := apmgorm.Open("postgres", os.Getenv("DATABASE_URL"))
-	if err != nil {
-		panic(err.Error())
-	}
+var durationType = reflect.TypeOf(time.Duration(0))
 
-	fmt.Println(fmt.Sprintf("Initialized read-write database connection pool: %s", os.Getenv("DATABASE_URL")))
-	return db
+var units = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
 }
 
-func InitElasticSearchAndLogger() (client *elastic.Client) {
-	logrus.SetFormatter(&log.LogstashFormatter{})
-	// Acceptable values are:
-	// debug, info, warn, error, fatal, panic
-	level := os.Getenv("LOGGER_LEVEL")
-	if level != "" {
-		l, err := logrus.ParseLevel(level)
-		if err == nil {
-			logrus.SetLevel(l)
-		} else {
-			fmt.Println("Error with log level configuraion:", err)
+func (f field) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+	v := f.Value
+
+	if v.Type() == durationType {
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			v.SetInt(n * int64(units[f.Unit]))
+			return nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
 		}
+		v.SetInt(int64(d))
+		return nil
 	}
 
-	appName := fmt.Sprintf("%s-%s", os.Getenv("NAME"), os.Getenv("ENV"))
-	esHostname := os.Getenv("ES_HOST")
-	thisHostname, _ := os.Hostname()
-
-	if esHostname != "" {
-		var esURL string
-		if strings.Contains(esHostname, "127.0.0.1") {
-			esURL = fmt.Sprintf("http://%s", esHostname)
-		} else {
-			esURL = fmt.Sprintf("https://%s", esHostname)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		if raw == "" {
+			v.SetInt(0)
+			return nil
 		}
-		fmt.Println(fmt.Sprintf("Configuring elasticsearch logging: %s", esURL))
-		client, err := elastic.NewClient(elastic.SetSniff(false), elastic.SetURL(esURL))
+		n, err := strconv.ParseInt(raw, 10, 64)
 		if err != nil {
-			fmt.Println(fmt.Sprintf("Error configuring elasticsearch logging: %s", err.Error()))
-		} else {
-			now := time.Now()
-			appName = fmt.Sprintf("logstash-%d.%d.%d", now.Year(), now.Month(), now.Day())
-			hook, err := log.NewElasticHook(client, thisHostname, logrus.DebugLevel, appName)
-			if err == nil {
-				logrus.AddHook(hook)
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		if raw == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		v.Set(reflect.ValueOf(ParseList(raw)))
+	case reflect.Map:
+		v.Set(reflect.ValueOf(ParseMap(raw)))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// String renders the value of f the way set reads it.
+func (f field) String() string {
+	v := f.Value
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	case reflect.Map:
+		m := v.Interface().(map[string]string)
+		items := []string{}
+		for key, value := range m {
+			if value == "" {
+				items = append(items, key)
 			} else {
-				fmt.Println(fmt.Sprintf("Error configuring logger for elastic search: %s", err.Error()))
+				items = append(items, key+":"+value)
 			}
 		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
 
-		return client
+// fileValue turns a YAML value into the string form of set, so lists and
+// maps can be written either way in the file.
+func fileValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	case map[interface{}]interface{}:
+		items := []string{}
+		for key, item := range v {
+			if item == nil {
+				items = append(items, fmt.Sprint(key))
+			} else {
+				items = append(items, fmt.Sprintf("%v:%v", key, item))
+			}
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
 	}
+	return fmt.Sprint(value)
+}
 
-	return
+// ParseList reads a comma separated list, skipping empty items.
+func ParseList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseMap reads a list like "access:warn,api:debug" into a map. Keys
+// without a value, like "stdout", map to an empty string.
+func ParseMap(list string) map[string]string {
+	m := map[string]string{}
+	for _, item := range ParseList(list) {
+		parts := strings.SplitN(item, ":", 2)
+		key := strings.TrimSpace(parts[0])
+		if key == "" {
+			continue
+		}
+		if len(parts) == 2 {
+			m[key] = strings.TrimSpace(parts[1])
+		} else {
+			m[key] = ""
+		}
+	}
+	return m
 }
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+var defaults *Config
+var defaultsOnce sync.Once
+
+// FromContext returns the configuration of a request, set by the Config
+// middleware, or the defaults when it runs without one, like in tests.
+// Callers must not change it.
+func FromContext(c echo.Context) *Config {
+	if cfg, ok := c.Get("Config").(*Config); ok && cfg != nil {
+		return cfg
+	}
+	defaultsOnce.Do(func() {
+		defaults = Default()
+	})
+	return defaults
+}
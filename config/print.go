@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const REDACTED = "REDACTED"
+
+var dsnPassword = regexp.MustCompile(`(password=)\S+`)
+
+// Print writes cfg as a config file, with secrets redacted, so the
+// configuration in effect can be checked without leaking them.
+func (cfg *Config) Print(w io.Writer) error {
+	section := ""
+	for _, f := range cfg.fields() {
+		parts := strings.SplitN(f.Path, ".", 2)
+		if parts[0] != section {
+			section = parts[0]
+			if _, err := fmt.Fprintf(w, "%s:\n", section); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "  %s: %s\n", parts[1], printValue(f)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printValue(f field) string {
+	value := f.String()
+	switch {
+	case f.Secret == "dsn" && f.Value.Kind() == reflect.Slice:
+		dsns := []string{}
+		for _, dsn := range f.Value.Interface().([]string) {
+			dsns = append(dsns, RedactDSN(dsn))
+		}
+		value = strings.Join(dsns, ",")
+	case f.Secret == "dsn":
+		value = RedactDSN(value)
+	case f.Secret != "" && value != "":
+		value = REDACTED
+	}
+
+	switch f.Value.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		if f.Value.Type() != durationType {
+			return value
+		}
+	}
+	return strconv.Quote(value)
+}
+
+// RedactDSN hides the password of a database URL or connection string.
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), REDACTED)
+			return u.String()
+		}
+		return dsn
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+REDACTED)
+}
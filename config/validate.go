@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/brunoksato/golang-boilerplate/i18n"
+)
+
+// LOG_SINKS are the log sinks LOG_SINKS may list.
+var LOG_SINKS = []string{"stdout", "text", "file", "syslog", "es"}
+
+// ValidationError lists every problem of a configuration, so they can all
+// be fixed at once.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e, "; ")
+}
+
+// Validate checks the ranges and choices of the fields. In production it
+// also refuses secrets still at their default value, which are public.
+func (cfg *Config) Validate() error {
+	errs := ValidationError{}
+	check := func(ok bool, f string, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, f+" "+fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(cfg.Server.Env != "", "SERVER_ENV", "must be set")
+	check(cfg.Server.Port > 0 && cfg.Server.Port < 65536, "PORT", "must be between 1 and 65535")
+	_, ok := i18n.CATALOGS[cfg.Server.DefaultLanguage]
+	check(ok, "DEFAULT_LANGUAGE", "has no catalog: %s", cfg.Server.DefaultLanguage)
+	check(cfg.Server.HealthCheckTimeout > 0, "HEALTH_CHECK_TIMEOUT", "must be positive")
+	check(cfg.Server.ShutdownDelay >= 0, "SHUTDOWN_DELAY", "must not be negative")
+	check(cfg.Server.RequestTimeout > 0, "REQUEST_TIMEOUT", "must be positive")
+	check(cfg.Server.LongRequestTimeout > 0, "LONG_REQUEST_TIMEOUT", "must be positive")
+	check(cfg.Server.CronjobPassword != "", "CRONJOB_PASSWORD", "must be set")
+	check(cfg.Server.ConcurrencyLimit >= 0, "CONCURRENCY_LIMIT", "must not be negative")
+	if cfg.Server.ConcurrencyLimit > 0 {
+		check(cfg.Server.ConcurrencyMinLimit > 0, "CONCURRENCY_MIN_LIMIT", "must be positive")
+		check(cfg.Server.ConcurrencyMinLimit <= cfg.Server.ConcurrencyLimit && cfg.Server.ConcurrencyLimit <= cfg.Server.ConcurrencyMaxLimit,
+			"CONCURRENCY_LIMIT", "must be between CONCURRENCY_MIN_LIMIT and CONCURRENCY_MAX_LIMIT")
+		check(cfg.Server.ConcurrencyLatencyTarget > 0, "CONCURRENCY_LATENCY_TARGET", "must be positive")
+		check(cfg.Server.ConcurrencyUserShare > 0 && cfg.Server.ConcurrencyUserShare <= 1, "CONCURRENCY_USER_SHARE", "must be above 0 and at most 1")
+	}
+
+	check(cfg.Database.URL != "", "DATABASE_URL", "must be set")
+	check(cfg.Database.ReplicaStickyWindow >= 0, "DATABASE_REPLICA_STICKY_WINDOW", "must not be negative")
+	check(cfg.Database.ReplicaCheckInterval > 0, "DATABASE_REPLICA_CHECK_INTERVAL", "must be positive")
+	check(cfg.Database.ConnectRetries >= 0, "DATABASE_CONNECT_RETRIES", "must not be negative")
+	check(cfg.Database.ConnectBackoff > 0, "DATABASE_CONNECT_BACKOFF", "must be positive")
+	check(cfg.Database.BreakerThreshold > 0, "DATABASE_BREAKER_THRESHOLD", "must be positive")
+	check(cfg.Database.BreakerCooldown > 0, "DATABASE_BREAKER_COOLDOWN", "must be positive")
+
+	check(cfg.JWT.SigninKey != "", "JWT_KEY_SIGNIN", "must be set")
+	check(cfg.JWT.EmailKey != "", "JWT_KEY_EMAIL", "must be set")
+	check(cfg.JWT.TokenExpiration > 0, "JWT_TOKEN_EXPIRATION", "must be positive")
+
+	check(oneOf(cfg.Storage.Backend, "filesystem", "s3"), "STORAGE_BACKEND", "must be filesystem or s3")
+	check(cfg.Storage.SigningKey != "", "STORAGE_SIGNING_KEY", "must be set")
+	if cfg.Storage.Backend == "s3" {
+		check(cfg.AWS.Bucket != "", "AWS_BUCKET", "must be set for the s3 storage")
+		check(cfg.AWS.AccessKey != "", "AWS_ACCESS_KEY", "must be set for the s3 storage")
+		check(cfg.AWS.SecretKey != "", "AWS_ACCESS_KEY_SECRET", "must be set for the s3 storage")
+	}
+
+	check(oneOf(cfg.Cache.Backend, "memory", "none"), "CACHE_BACKEND", "must be memory or none")
+	check(cfg.Cache.Size > 0, "CACHE_SIZE", "must be positive")
+
+	check(cfg.Upload.MaxBytes > 0, "UPLOAD_MAX_BYTES", "must be positive")
+	check(len(cfg.Upload.ContentTypes) > 0, "UPLOAD_CONTENT_TYPES", "must list a content type")
+	check(cfg.Upload.AvatarSize > 0, "AVATAR_SIZE", "must be positive")
+
+	check(cfg.API.BatchMaxSize > 0, "BATCH_MAX_SIZE", "must be positive")
+	check(cfg.API.ImportAsyncBytes > 0, "IMPORT_ASYNC_BYTES", "must be positive")
+	check(cfg.API.IdempotencyTTL > 0, "IDEMPOTENCY_TTL", "must be positive")
+	check(cfg.API.IdempotencyMaxBytes > 0, "IDEMPOTENCY_MAX_BYTES", "must be positive")
+
+	check(cfg.Elasticsearch.LogQueueSize > 0, "ES_LOG_QUEUE_SIZE", "must be positive")
+	check(oneOf(cfg.Elasticsearch.LogOverflow, "drop_newest", "drop_oldest"),
+		"ES_LOG_OVERFLOW", "must be drop_newest or drop_oldest")
+	check(cfg.Elasticsearch.LogFlushInterval > 0, "ES_LOG_FLUSH_INTERVAL", "must be positive")
+
+	check(validLevel(cfg.Log.Level), "LOGGER_LEVEL", "is not a log level: %s", cfg.Log.Level)
+	for system, level := range cfg.Log.Levels {
+		check(validLevel(level), "LOG_LEVELS", "has an invalid level for %s: %s", system, level)
+	}
+	for sink, level := range cfg.Log.Sinks {
+		check(oneOf(sink, LOG_SINKS...), "LOG_SINKS", "has an unknown sink: %s", sink)
+		check(level == "" || validLevel(level), "LOG_SINKS", "has an invalid level for %s: %s", sink, level)
+	}
+	if _, ok := cfg.Log.Sinks["file"]; ok {
+		check(cfg.Log.FilePath != "", "LOG_FILE_PATH", "must be set for the file sink")
+	}
+	check(cfg.Log.FileMaxBytes >= 0, "LOG_FILE_MAX_BYTES", "must not be negative")
+	check(cfg.Log.FileMaxBackups >= 0, "LOG_FILE_MAX_BACKUPS", "must not be negative")
+	check(cfg.Log.AccessSampleRate >= 0 && cfg.Log.AccessSampleRate <= 1, "ACCESS_LOG_SAMPLE_RATE", "must be between 0 and 1")
+
+	for _, backend := range cfg.Tracing.Backends {
+		check(oneOf(backend, "apm", "otel", "none"), "TRACING_BACKEND", "has an unknown backend: %s", backend)
+	}
+	check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO", "must be between 0 and 1")
+
+	if cfg.IsProduction() {
+		for _, f := range cfg.fields() {
+			if f.Secret != "" && f.Default != "" && f.String() == f.Default {
+				errs = append(errs, f.Env+" must be changed from its default value in production")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func oneOf(value string, choices ...string) bool {
+	for _, choice := range choices {
+		if value == choice {
+			return true
+		}
+	}
+	return false
+}
+
+func validLevel(level string) bool {
+	_, err := logrus.ParseLevel(level)
+	return err == nil
+}
@@ -1,13 +1,64 @@
 package core
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"io"
+	"net"
 	"reflect"
 	"strings"
 
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 )
 
+const GORM_REQUEST_CONTEXT_KEY = "request:context"
+
+// WithContext binds db to ctx: once ctx is cancelled or past its deadline,
+// queries through it fail with ctx.Err() instead of running. gorm runs
+// statements without a context, so one already sent runs to completion.
+func WithContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	return db.Set(GORM_REQUEST_CONTEXT_KEY, ctx)
+}
+
+// ContextOf returns the context db is bound to, or context.Background().
+func ContextOf(db *gorm.DB) context.Context {
+	if value, ok := db.Get(GORM_REQUEST_CONTEXT_KEY); ok {
+		if ctx, ok := value.(context.Context); ok && ctx != nil {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
+// RegisterContextCallbacks makes every query of db check the context it
+// is bound to with WithContext first.
+func RegisterContextCallbacks(db *gorm.DB) {
+	callback := db.Callback()
+	callback.Create().Before("gorm:begin_transaction").Register("context:before_create", checkContext)
+	callback.Query().Before("gorm:query").Register("context:before_query", checkContext)
+	callback.Update().Before("gorm:begin_transaction").Register("context:before_update", checkContext)
+	callback.Delete().Before("gorm:begin_transaction").Register("context:before_delete", checkContext)
+	callback.RowQuery().Before("gorm:row_query").Register("context:before_row_query", checkContext)
+}
+
+func checkContext(scope *gorm.Scope) {
+	value, ok := scope.Get(GORM_REQUEST_CONTEXT_KEY)
+	if !ok {
+		return
+	}
+	ctx, ok := value.(context.Context)
+	if !ok || ctx == nil {
+		return
+	}
+	if err := ctx.Err(); err != nil {
+		scope.Err(err)
+		scope.SkipLeft()
+	}
+}
+
 func DefaultPreloads(db *gorm.DB, t reflect.Type, api APIType, skipParent bool) func(*gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		elemT := t
@@ -159,3 +210,24 @@ func TableNameFor(t reflect.Type) string {
 	}
 	return name
 }
+
+// IsConnectionError tells whether err means the database could not be
+// reached, as opposed to a query that failed.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch err {
+	case driver.ErrBadConn, sql.ErrConnDone, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		// Class 08 is connection exception, 57P01 to 57P03 a server that
+		// is shutting down or starting up.
+		return pqErr.Code.Class() == "08" || strings.HasPrefix(string(pqErr.Code), "57P")
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"os"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// The dialects the server runs on: postgres in production, sqlite3 in
+// tests when TEST_DB_DIALECT asks for it.
+const (
+	DIALECT_POSTGRES = "postgres"
+	DIALECT_SQLITE   = "sqlite3"
+)
+
+// TEST_DB_SOURCES are the test databases of each dialect, SERVER_DB
+// overrides them.
+var TEST_DB_SOURCES = map[string]string{
+	DIALECT_POSTGRES: "user=postgres dbname=server_test sslmode=disable",
+	DIALECT_SQLITE:   "file::memory:?cache=shared",
+}
+
+// TestDialect is the dialect of TEST_DB_DIALECT, postgres by default.
+func TestDialect() string {
+	switch strings.ToLower(os.Getenv("TEST_DB_DIALECT")) {
+	case "sqlite", DIALECT_SQLITE:
+		return DIALECT_SQLITE
+	default:
+		return DIALECT_POSTGRES
+	}
+}
+
+func IsSQLite(db *gorm.DB) bool {
+	return db.Dialect().GetName() == DIALECT_SQLITE
+}
+
+// Quote quotes each identifier the way the dialect of db does and joins
+// them, so Quote(db, "users", "id") is "users"."id" on postgres.
+func Quote(db *gorm.DB, identifiers ...string) string {
+	dialect := db.Dialect()
+	quoted := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		quoted[i] = dialect.Quote(identifier)
+	}
+	return strings.Join(quoted, ".")
+}
+
+// QuoteColumn quotes a column written with or without its table, as in
+// "users.email".
+func QuoteColumn(db *gorm.DB, column string) string {
+	return Quote(db, strings.Split(column, ".")...)
+}
+
+// EqualFold is the condition of column being equal to its placeholder
+// ignoring case, column being quoted already.
+func EqualFold(db *gorm.DB, column string) string {
+	if IsSQLite(db) {
+		return column + " = ? COLLATE NOCASE"
+	}
+	return "LOWER(" + column + ") = LOWER(?)"
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	sql.Register("dialect-test", &FaultDriver{})
+}
+
+func openDialect(t *testing.T, dialect string) *gorm.DB {
+	sqlDB, err := sql.Open("dialect-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(dialect, sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestQuoteFollowsTheDialect(t *testing.T) {
+	AssertEqual(t, `"users"."email"`, Quote(openDialect(t, DIALECT_POSTGRES), "users", "email"))
+	AssertEqual(t, "`users`.`email`", QuoteColumn(openDialect(t, "mysql"), "users.email"))
+}
+
+func TestEqualFoldFollowsTheDialect(t *testing.T) {
+	AssertEqual(t, `LOWER("email") = LOWER(?)`, EqualFold(openDialect(t, DIALECT_POSTGRES), `"email"`))
+	AssertEqual(t, `"email" = ? COLLATE NOCASE`, EqualFold(openDialect(t, DIALECT_SQLITE), `"email"`))
+}
+
+func TestTestDialect(t *testing.T) {
+	defer os.Setenv("TEST_DB_DIALECT", os.Getenv("TEST_DB_DIALECT"))
+
+	os.Setenv("TEST_DB_DIALECT", "")
+	AssertEqual(t, DIALECT_POSTGRES, TestDialect())
+	os.Setenv("TEST_DB_DIALECT", "SQLite")
+	AssertEqual(t, DIALECT_SQLITE, TestDialect())
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"reflect"
 
 	"github.com/brunoksato/golang-boilerplate/util"
@@ -20,7 +21,10 @@ const ERROR_CODE_BUSINESS_ERROR int = 400
 const ERROR_CODE_AUTHENTICATION_ERROR int = 401
 const ERROR_CODE_PERMISSION_ERROR int = 403
 const ERROR_CODE_NOT_FOUND int = 404
+const ERROR_CODE_PRECONDITION_FAILED int = 412
+const ERROR_CODE_UNPROCESSABLE int = 422
 const ERROR_CODE_SERVER_ERROR int = 500
+const ERROR_CODE_SERVICE_UNAVAILABLE int = 503
 
 const ERROR_SUBCODE_UNDEFINED_IGNORE int = -1000
 const ERROR_SUBCODE_UNDEFINED int = -1999
@@ -28,6 +32,10 @@ const ERROR_SUBCODE_UNDEFINED int = -1999
 const ERROR_SUBCODE_FK int = -2000
 
 const ERROR_SUBCODE_CREDENTIALS_INVALID int = -2001
+const ERROR_SUBCODE_TOKEN_MISSING int = -2020
+const ERROR_SUBCODE_TOKEN_INVALID int = -2021
+const ERROR_SUBCODE_COMPANY_INVALID int = -2022
+const ERROR_SUBCODE_CRONJOB_KEY_INVALID int = -2023
 
 const ERROR_SUBCODE_EMAIL int = -2002
 const ERROR_SUBCODE_NAME_TAKEN int = -2003
@@ -44,6 +52,28 @@ const ERROR_SUBCODE_PHONE_TAKEN int = -2013
 const ERROR_SUBCODE_PHONE_LENGTH int = -2014
 const ERROR_SUBCODE_PHONE_FORMAT int = -2015
 
+const ERROR_SUBCODE_VERSION_MISMATCH int = -2100
+const ERROR_SUBCODE_PATCH_INVALID int = -2101
+const ERROR_SUBCODE_PATCH_TEST_FAILED int = -2102
+const ERROR_SUBCODE_PATCH_UNSUPPORTED_MEDIA_TYPE int = -2103
+const ERROR_SUBCODE_FIELD_UNSETTABLE int = -2104
+const ERROR_SUBCODE_BATCH_INVALID int = -2110
+const ERROR_SUBCODE_BATCH_TOO_LARGE int = -2111
+const ERROR_SUBCODE_BATCH_ROLLED_BACK int = -2112
+const ERROR_SUBCODE_IMPORT_INVALID int = -2120
+const ERROR_SUBCODE_IMPORT_UNSUPPORTED_FORMAT int = -2121
+const ERROR_SUBCODE_IMPORT_UNKNOWN_COLUMN int = -2122
+const ERROR_SUBCODE_IMPORT_ROW_INVALID int = -2123
+const ERROR_SUBCODE_UPLOAD_INVALID int = -2130
+const ERROR_SUBCODE_UPLOAD_TOO_LARGE int = -2131
+const ERROR_SUBCODE_UPLOAD_CONTENT_TYPE int = -2132
+const ERROR_SUBCODE_UPLOAD_SIGNATURE_INVALID int = -2133
+const ERROR_SUBCODE_UPLOAD_MISSING int = -2134
+const ERROR_SUBCODE_LOG_LEVEL_INVALID int = -2140
+const ERROR_SUBCODE_IDEMPOTENCY_KEY_INVALID int = -2150
+const ERROR_SUBCODE_IDEMPOTENCY_KEY_REUSED int = -2151
+const ERROR_SUBCODE_IDEMPOTENCY_KEY_IN_PROGRESS int = -2152
+
 const ERROR_SUBCODE_USER_UNDERAGE int = -2800
 const ERROR_SUBCODE_USER_LACKS_PERMISSION int = -2801
 const ERROR_SUBCODE_OTHER_USER_LACKS_PERMISSION int = -2802
@@ -51,6 +81,71 @@ const ERROR_SUBCODE_OTHER_USER_LACKS_PERMISSION int = -2802
 const ERROR_SUBCODE_DATABASE_UNAVAILABLE int = -2900
 const ERROR_SUBCODE_SERVER_OVERLOADED int = -2910
 
+// ERROR_CODE_NAMES and ERROR_SUBCODE_NAMES name every code an error response
+// can carry, for documentation like the OpenAPI document.
+var ERROR_CODE_NAMES = map[int]string{
+	ERROR_CODE_WARNING:              "WARNING",
+	ERROR_CODE_BUSINESS_ERROR:       "BUSINESS_ERROR",
+	ERROR_CODE_AUTHENTICATION_ERROR: "AUTHENTICATION_ERROR",
+	ERROR_CODE_PERMISSION_ERROR:     "PERMISSION_ERROR",
+	ERROR_CODE_NOT_FOUND:            "NOT_FOUND",
+	ERROR_CODE_PRECONDITION_FAILED:  "PRECONDITION_FAILED",
+	ERROR_CODE_UNPROCESSABLE:        "UNPROCESSABLE",
+	ERROR_CODE_SERVER_ERROR:         "SERVER_ERROR",
+	ERROR_CODE_SERVICE_UNAVAILABLE:  "SERVICE_UNAVAILABLE",
+}
+
+var ERROR_SUBCODE_NAMES = map[int]string{
+	ERROR_SUBCODE_UNDEFINED_IGNORE:             "UNDEFINED_IGNORE",
+	ERROR_SUBCODE_UNDEFINED:                    "UNDEFINED",
+	ERROR_SUBCODE_FK:                           "FK",
+	ERROR_SUBCODE_CREDENTIALS_INVALID:          "CREDENTIALS_INVALID",
+	ERROR_SUBCODE_TOKEN_MISSING:                "TOKEN_MISSING",
+	ERROR_SUBCODE_TOKEN_INVALID:                "TOKEN_INVALID",
+	ERROR_SUBCODE_COMPANY_INVALID:              "COMPANY_INVALID",
+	ERROR_SUBCODE_CRONJOB_KEY_INVALID:          "CRONJOB_KEY_INVALID",
+	ERROR_SUBCODE_EMAIL:                        "EMAIL",
+	ERROR_SUBCODE_NAME_TAKEN:                   "NAME_TAKEN",
+	ERROR_SUBCODE_NAME_LENGTH:                  "NAME_LENGTH",
+	ERROR_SUBCODE_NAME_FORMAT:                  "NAME_FORMAT",
+	ERROR_SUBCODE_EMAIL_TAKEN:                  "EMAIL_TAKEN",
+	ERROR_SUBCODE_EMAIL_FORMAT:                 "EMAIL_FORMAT",
+	ERROR_SUBCODE_PASSWORD_LENGTH:              "PASSWORD_LENGTH",
+	ERROR_SUBCODE_PASSWORD_FORMAT:              "PASSWORD_FORMAT",
+	ERROR_SUBCODE_USERNAME_TAKEN:               "USERNAME_TAKEN",
+	ERROR_SUBCODE_USERNAME_LENGTH:              "USERNAME_LENGTH",
+	ERROR_SUBCODE_USERNAME_FORMAT:              "USERNAME_FORMAT",
+	ERROR_SUBCODE_PHONE_TAKEN:                  "PHONE_TAKEN",
+	ERROR_SUBCODE_PHONE_LENGTH:                 "PHONE_LENGTH",
+	ERROR_SUBCODE_PHONE_FORMAT:                 "PHONE_FORMAT",
+	ERROR_SUBCODE_VERSION_MISMATCH:             "VERSION_MISMATCH",
+	ERROR_SUBCODE_PATCH_INVALID:                "PATCH_INVALID",
+	ERROR_SUBCODE_PATCH_TEST_FAILED:            "PATCH_TEST_FAILED",
+	ERROR_SUBCODE_PATCH_UNSUPPORTED_MEDIA_TYPE: "PATCH_UNSUPPORTED_MEDIA_TYPE",
+	ERROR_SUBCODE_FIELD_UNSETTABLE:             "FIELD_UNSETTABLE",
+	ERROR_SUBCODE_BATCH_INVALID:                "BATCH_INVALID",
+	ERROR_SUBCODE_BATCH_TOO_LARGE:              "BATCH_TOO_LARGE",
+	ERROR_SUBCODE_BATCH_ROLLED_BACK:            "BATCH_ROLLED_BACK",
+	ERROR_SUBCODE_IMPORT_INVALID:               "IMPORT_INVALID",
+	ERROR_SUBCODE_IMPORT_UNSUPPORTED_FORMAT:    "IMPORT_UNSUPPORTED_FORMAT",
+	ERROR_SUBCODE_IMPORT_UNKNOWN_COLUMN:        "IMPORT_UNKNOWN_COLUMN",
+	ERROR_SUBCODE_IMPORT_ROW_INVALID:           "IMPORT_ROW_INVALID",
+	ERROR_SUBCODE_UPLOAD_INVALID:               "UPLOAD_INVALID",
+	ERROR_SUBCODE_UPLOAD_TOO_LARGE:             "UPLOAD_TOO_LARGE",
+	ERROR_SUBCODE_UPLOAD_CONTENT_TYPE:          "UPLOAD_CONTENT_TYPE",
+	ERROR_SUBCODE_UPLOAD_SIGNATURE_INVALID:     "UPLOAD_SIGNATURE_INVALID",
+	ERROR_SUBCODE_UPLOAD_MISSING:               "UPLOAD_MISSING",
+	ERROR_SUBCODE_LOG_LEVEL_INVALID:            "LOG_LEVEL_INVALID",
+	ERROR_SUBCODE_IDEMPOTENCY_KEY_INVALID:      "IDEMPOTENCY_KEY_INVALID",
+	ERROR_SUBCODE_IDEMPOTENCY_KEY_REUSED:       "IDEMPOTENCY_KEY_REUSED",
+	ERROR_SUBCODE_IDEMPOTENCY_KEY_IN_PROGRESS:  "IDEMPOTENCY_KEY_IN_PROGRESS",
+	ERROR_SUBCODE_USER_UNDERAGE:                "USER_UNDERAGE",
+	ERROR_SUBCODE_USER_LACKS_PERMISSION:        "USER_LACKS_PERMISSION",
+	ERROR_SUBCODE_OTHER_USER_LACKS_PERMISSION:  "OTHER_USER_LACKS_PERMISSION",
+	ERROR_SUBCODE_DATABASE_UNAVAILABLE:         "DATABASE_UNAVAILABLE",
+	ERROR_SUBCODE_SERVER_OVERLOADED:            "SERVER_OVERLOADED",
+}
+
 type CoreError struct {
 	ErrCode     int
 	ErrSubcode  int
@@ -103,6 +198,46 @@ func NewDefaultError(code, subcode int, location, msg string, data map[string]in
 	return err
 }
 
+// FieldError is one failed validation rule of a field. Field is the json
+// name of the field, Rule the govalidator rule and Params its arguments.
+type FieldError struct {
+	Field   string   `json:"field"`
+	Rule    string   `json:"rule"`
+	Params  []string `json:"params,omitempty"`
+	Subcode int      `json:"subcode"`
+	Message string   `json:"message"`
+}
+
+// NewValidationError is a business error carrying every invalid field under
+// Data()["errors"]. Its subcode and field are those of the first one and its
+// message lists them all, so clients reading only code and message keep
+// working.
+func NewValidationError(errs []FieldError) DefaultError {
+	msg := ""
+	for _, fe := range errs {
+		msg = fmt.Sprintf("%s%s: %s;", msg, fe.Field, fe.Message)
+	}
+
+	subcode := 0
+	data := map[string]interface{}{"errors": errs}
+	if len(errs) > 0 {
+		subcode = errs[0].Subcode
+		data["field"] = errs[0].Field
+	}
+
+	return NewDefaultError(ERROR_CODE_BUSINESS_ERROR, subcode, util.ParentCallerInfo(), msg, data)
+}
+
+// FieldErrors returns the field errors of a validation error, nil for any
+// other error.
+func FieldErrors(err DefaultError) []FieldError {
+	if err == nil || err.Data() == nil {
+		return nil
+	}
+	errs, _ := err.Data()["errors"].([]FieldError)
+	return errs
+}
+
 func NewWarning(msg string, opts ...interface{}) DefaultError {
 	return newElipsisError(ERROR_CODE_WARNING, msg, opts...)
 }
@@ -123,10 +258,26 @@ func NewNotFoundError(msg string, opts ...interface{}) DefaultError {
 	return newElipsisError(ERROR_CODE_NOT_FOUND, msg, opts...)
 }
 
+func NewPreconditionFailedError(msg string, opts ...interface{}) DefaultError {
+	return newElipsisError(ERROR_CODE_PRECONDITION_FAILED, msg, opts...)
+}
+
+// NewUnprocessableError is for well-formed requests that can't be applied,
+// like an Idempotency-Key reused with another body.
+func NewUnprocessableError(msg string, opts ...interface{}) DefaultError {
+	return newElipsisError(ERROR_CODE_UNPROCESSABLE, msg, opts...)
+}
+
 func NewServerError(msg string, opts ...interface{}) DefaultError {
 	return newElipsisError(ERROR_CODE_SERVER_ERROR, msg, opts...)
 }
 
+// NewServiceUnavailableError is for failures the client should retry later,
+// like a database that is down.
+func NewServiceUnavailableError(msg string, opts ...interface{}) DefaultError {
+	return newElipsisError(ERROR_CODE_SERVICE_UNAVAILABLE, msg, opts...)
+}
+
 func newElipsisError(code int, msg string, opts ...interface{}) DefaultError {
 	subcode := 0
 	data := map[string]interface{}{}
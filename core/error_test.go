@@ -0,0 +1,72 @@
+package core
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// Every code constant needs a name, or it silently goes missing from the
+// OpenAPI document.
+func TestErrorCodeNamesAreComplete(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "error.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			for _, ident := range spec.(*ast.ValueSpec).Names {
+				name := ident.Name
+				switch {
+				case strings.HasPrefix(name, "ERROR_SUBCODE_"):
+					if !hasName(ERROR_SUBCODE_NAMES, strings.TrimPrefix(name, "ERROR_SUBCODE_")) {
+						t.Errorf("%s is missing from ERROR_SUBCODE_NAMES", name)
+					}
+				case strings.HasPrefix(name, "ERROR_CODE_"):
+					if !hasName(ERROR_CODE_NAMES, strings.TrimPrefix(name, "ERROR_CODE_")) {
+						t.Errorf("%s is missing from ERROR_CODE_NAMES", name)
+					}
+				}
+			}
+		}
+	}
+}
+
+func hasName(names map[int]string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewValidationError(t *testing.T) {
+	err := NewValidationError([]FieldError{
+		{Field: "name", Rule: "length", Params: []string{"3", "255"}, Subcode: ERROR_SUBCODE_NAME_LENGTH, Message: "u2 does not validate as length(3|255)"},
+		{Field: "email", Rule: "email", Subcode: ERROR_SUBCODE_EMAIL_FORMAT, Message: "32 does not validate as email"},
+	})
+
+	if err.Code() != ERROR_CODE_BUSINESS_ERROR || err.Subcode() != ERROR_SUBCODE_NAME_LENGTH {
+		t.Errorf("unexpected code %d and subcode %d", err.Code(), err.Subcode())
+	}
+	if err.Error() != "name: u2 does not validate as length(3|255);email: 32 does not validate as email;" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	if err.Data()["field"] != "name" {
+		t.Errorf("unexpected field %v", err.Data()["field"])
+	}
+	if len(FieldErrors(err)) != 2 {
+		t.Errorf("expected 2 field errors, got %d", len(FieldErrors(err)))
+	}
+	if FieldErrors(NewBusinessError("plain")) != nil {
+		t.Errorf("plain errors have no field errors")
+	}
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+)
+
+// FaultDriver is a database/sql driver for tests that wraps another one
+// and loses its connections while it is down, like a database that went
+// away. Without a wrapped driver only pings work.
+//
+//	faults := &core.FaultDriver{Driver: &pq.Driver{}}
+//	sql.Register("faulty", faults)
+//	sqlDB, _ := sql.Open("faulty", dsn)
+//	db, _ := gorm.Open("postgres", sqlDB)
+//	faults.SetDown(true)
+type FaultDriver struct {
+	Driver driver.Driver
+	down   int32
+}
+
+var errNoDriver = errors.New("fault driver: no database behind it")
+
+// SetDown starts or ends the outage.
+func (d *FaultDriver) SetDown(down bool) {
+	if down {
+		atomic.StoreInt32(&d.down, 1)
+	} else {
+		atomic.StoreInt32(&d.down, 0)
+	}
+}
+
+func (d *FaultDriver) Down() bool {
+	return atomic.LoadInt32(&d.down) == 1
+}
+
+func (d *FaultDriver) Open(name string) (driver.Conn, error) {
+	if d.Down() {
+		return nil, driver.ErrBadConn
+	}
+	if d.Driver == nil {
+		return &faultConn{driver: d}, nil
+	}
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultConn{driver: d, conn: conn}, nil
+}
+
+// faultConn fails with driver.ErrBadConn during an outage, so database/sql
+// drops it and tries to open a new one.
+type faultConn struct {
+	driver *FaultDriver
+	conn   driver.Conn
+}
+
+func (c *faultConn) Prepare(query string) (driver.Stmt, error) {
+	if c.driver.Down() {
+		return nil, driver.ErrBadConn
+	}
+	if c.conn == nil {
+		return nil, errNoDriver
+	}
+	return c.conn.Prepare(query)
+}
+
+func (c *faultConn) Begin() (driver.Tx, error) {
+	if c.driver.Down() {
+		return nil, driver.ErrBadConn
+	}
+	if c.conn == nil {
+		return nil, errNoDriver
+	}
+	return c.conn.Begin()
+}
+
+func (c *faultConn) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *faultConn) Ping(ctx context.Context) error {
+	if c.driver.Down() {
+		return driver.ErrBadConn
+	}
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
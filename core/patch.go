@@ -0,0 +1,350 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const MERGE_PATCH_CONTENT_TYPE = "application/merge-patch+json"
+const JSON_PATCH_CONTENT_TYPE = "application/json-patch+json"
+
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ApplyMergePatch applies an RFC 7386 merge patch to doc and returns the
+// patched document. doc is not modified.
+func ApplyMergePatch(doc map[string]interface{}, patch []byte) (map[string]interface{}, DefaultError) {
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, NewBusinessError("Invalid merge patch: "+err.Error(), ERROR_SUBCODE_PATCH_INVALID)
+	}
+
+	if _, ok := p.(map[string]interface{}); !ok {
+		return nil, NewBusinessError("Invalid merge patch: expected an object", ERROR_SUBCODE_PATCH_INVALID)
+	}
+
+	patched, ok := mergePatch(deepCopyJson(doc), p).(map[string]interface{})
+	if !ok {
+		return nil, NewBusinessError("Invalid merge patch: expected an object", ERROR_SUBCODE_PATCH_INVALID)
+	}
+	return patched, nil
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetMap, ok := target.(map[string]interface{})
+	if !ok {
+		targetMap = map[string]interface{}{}
+	}
+
+	for k, v := range patchMap {
+		if v == nil {
+			delete(targetMap, k)
+		} else {
+			targetMap[k] = mergePatch(targetMap[k], v)
+		}
+	}
+	return targetMap
+}
+
+// ApplyJsonPatch applies an RFC 6902 JSON patch to doc and returns the
+// patched document. doc is not modified.
+func ApplyJsonPatch(doc map[string]interface{}, patch []byte) (map[string]interface{}, DefaultError) {
+	var ops []PatchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, NewBusinessError("Invalid JSON patch: "+err.Error(), ERROR_SUBCODE_PATCH_INVALID)
+	}
+
+	var current interface{} = deepCopyJson(doc)
+	for i, op := range ops {
+		data := map[string]interface{}{"index": i, "op": op.Op, "path": op.Path}
+
+		var err error
+		switch op.Op {
+		case "add":
+			current, err = jsonPointerAdd(current, op.Path, deepCopyJson(op.Value))
+		case "remove":
+			current, _, err = jsonPointerRemove(current, op.Path)
+		case "replace":
+			current, _, err = jsonPointerRemove(current, op.Path)
+			if err == nil {
+				current, err = jsonPointerAdd(current, op.Path, deepCopyJson(op.Value))
+			}
+		case "move":
+			var value interface{}
+			current, value, err = jsonPointerRemove(current, op.From)
+			if err == nil {
+				current, err = jsonPointerAdd(current, op.Path, value)
+			}
+		case "copy":
+			var value interface{}
+			value, err = jsonPointerGet(current, op.From)
+			if err == nil {
+				current, err = jsonPointerAdd(current, op.Path, deepCopyJson(value))
+			}
+		case "test":
+			var value interface{}
+			value, err = jsonPointerGet(current, op.Path)
+			if err == nil && !reflect.DeepEqual(normalizeJson(value), normalizeJson(op.Value)) {
+				return nil, NewBusinessError(fmt.Sprintf("JSON patch test failed at %s", op.Path),
+					ERROR_SUBCODE_PATCH_TEST_FAILED, data)
+			}
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Op)
+		}
+
+		if err != nil {
+			return nil, NewBusinessError("Invalid JSON patch: "+err.Error(), ERROR_SUBCODE_PATCH_INVALID, data)
+		}
+	}
+
+	patched, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, NewBusinessError("Invalid JSON patch: document must remain an object", ERROR_SUBCODE_PATCH_INVALID)
+	}
+	return patched, nil
+}
+
+// ChangedJsonKeys lists the top level keys whose values differ between the
+// two documents, including keys that were added or removed.
+func ChangedJsonKeys(original, patched map[string]interface{}) []string {
+	keys := []string{}
+	for k, v := range patched {
+		old, ok := original[k]
+		if !ok || !reflect.DeepEqual(normalizeJson(old), normalizeJson(v)) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range original {
+		if _, ok := patched[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetJsonKeys copies the given keys from doc onto item, refusing unknown and
+// unsettable fields. A key missing from doc resets the field to its zero value.
+func SetJsonKeys(item interface{}, doc map[string]interface{}, keys []string) DefaultError {
+	v := reflect.Indirect(reflect.ValueOf(item))
+	values := map[string]interface{}{}
+
+	for _, key := range keys {
+		data := map[string]interface{}{"type": v.Type(), "key": key}
+
+		field, err := GetFieldByJsonTag(item, key)
+		if err != nil {
+			return NewBusinessError(fmt.Sprintf("%s: unknown field;", key), ERROR_SUBCODE_PATCH_INVALID, data)
+		}
+		if field.Tag.Get("settable") == "false" {
+			return NewPermissionError(fmt.Sprintf("%s: field is unsettable;", key), ERROR_SUBCODE_FIELD_UNSETTABLE, data)
+		}
+
+		value, ok := doc[key]
+		if !ok || value == nil {
+			fv := v.FieldByName(field.Name)
+			fv.Set(reflect.Zero(fv.Type()))
+			continue
+		}
+		values[key] = value
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	j, err := json.Marshal(values)
+	if err != nil {
+		return NewServerError(err.Error())
+	}
+	if err := json.Unmarshal(j, item); err != nil {
+		return NewBusinessError(err.Error(), ERROR_SUBCODE_PATCH_INVALID)
+	}
+	return nil
+}
+
+func jsonPointerTokens(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		token = strings.Replace(token, "~1", "/", -1)
+		tokens[i] = strings.Replace(token, "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func jsonPointerGet(doc interface{}, path string) (interface{}, error) {
+	tokens, err := jsonPointerTokens(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current := doc
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q not found", path)
+			}
+			current = value
+		case []interface{}:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("path %q not found", path)
+			}
+			current = node[idx]
+		default:
+			return nil, fmt.Errorf("path %q not found", path)
+		}
+	}
+	return current, nil
+}
+
+func jsonPointerAdd(doc interface{}, path string, value interface{}) (interface{}, error) {
+	tokens, err := jsonPointerTokens(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonPointerUpdate(doc, path, tokens, func(parent interface{}, last string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[last] = value
+			return node, nil
+		case []interface{}:
+			if last == "-" {
+				return append(node, value), nil
+			}
+			idx, err := strconv.Atoi(last)
+			if err != nil || idx < 0 || idx > len(node) {
+				return nil, fmt.Errorf("invalid index in path %q", path)
+			}
+			node = append(node, nil)
+			copy(node[idx+1:], node[idx:])
+			node[idx] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("path %q not found", path)
+	})
+}
+
+func jsonPointerRemove(doc interface{}, path string) (interface{}, interface{}, error) {
+	tokens, err := jsonPointerTokens(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	var removed interface{}
+	doc, err = jsonPointerUpdate(doc, path, tokens, func(parent interface{}, last string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			value, ok := node[last]
+			if !ok {
+				return nil, fmt.Errorf("path %q not found", path)
+			}
+			removed = value
+			delete(node, last)
+			return node, nil
+		case []interface{}:
+			idx, err := strconv.Atoi(last)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("path %q not found", path)
+			}
+			removed = node[idx]
+			return append(node[:idx], node[idx+1:]...), nil
+		}
+		return nil, fmt.Errorf("path %q not found", path)
+	})
+	return doc, removed, err
+}
+
+// jsonPointerUpdate walks to the parent of the last token and replaces it
+// with the result of fn, rebuilding slices on the way back up.
+func jsonPointerUpdate(doc interface{}, path string, tokens []string, fn func(interface{}, string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("path %q not found", path)
+		}
+		updated, err := jsonPointerUpdate(child, path, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[tokens[0]] = updated
+		return node, nil
+	case []interface{}:
+		idx, err := strconv.Atoi(tokens[0])
+		if err != nil || idx < 0 || idx >= len(node) {
+			return nil, fmt.Errorf("path %q not found", path)
+		}
+		updated, err := jsonPointerUpdate(node[idx], path, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[idx] = updated
+		return node, nil
+	}
+	return nil, fmt.Errorf("path %q not found", path)
+}
+
+func deepCopyJson(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = deepCopyJson(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = deepCopyJson(val)
+		}
+		return s
+	}
+	return value
+}
+
+// normalizeJson round trips a value through encoding/json so that numbers
+// and nested types compare equal regardless of where they came from.
+func normalizeJson(value interface{}) interface{} {
+	j, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(j, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
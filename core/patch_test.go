@@ -0,0 +1,69 @@
+package core
+
+import (
+	"testing"
+)
+
+type patchTestStruct struct {
+	ID    uint   `json:"id" settable:"false"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	doc := map[string]interface{}{"id": float64(1), "name": "bruno", "email": "bruno@model.com"}
+
+	patched, err := ApplyMergePatch(doc, []byte(`{"name":"sato","email":null}`))
+	AssertNoError(t, err)
+	AssertEqual(t, map[string]interface{}{"id": float64(1), "name": "sato"}, patched)
+	AssertEqual(t, "bruno", doc["name"])
+	AssertEqual(t, []string{"email", "name"}, ChangedJsonKeys(doc, patched))
+
+	_, err = ApplyMergePatch(doc, []byte(`[1]`))
+	AssertBusinessError(t, "Invalid merge patch: expected an object", err)
+}
+
+func TestApplyJsonPatch(t *testing.T) {
+	doc := map[string]interface{}{
+		"name": "bruno",
+		"tags": []interface{}{"a", "b"},
+	}
+
+	patched, err := ApplyJsonPatch(doc, []byte(`[
+		{"op":"test","path":"/name","value":"bruno"},
+		{"op":"replace","path":"/name","value":"sato"},
+		{"op":"add","path":"/tags/1","value":"c"},
+		{"op":"remove","path":"/tags/0"},
+		{"op":"copy","from":"/name","path":"/nick"}
+	]`))
+	AssertNoError(t, err)
+	AssertEqual(t, "sato", patched["name"])
+	AssertEqual(t, "sato", patched["nick"])
+	AssertEqual(t, []interface{}{"c", "b"}, patched["tags"])
+	AssertEqual(t, []string{"name", "nick", "tags"}, ChangedJsonKeys(doc, patched))
+
+	_, err = ApplyJsonPatch(doc, []byte(`[{"op":"test","path":"/name","value":"sato"}]`))
+	AssertBusinessError(t, "JSON patch test failed at /name", err)
+	AssertEqual(t, ERROR_SUBCODE_PATCH_TEST_FAILED, err.Subcode())
+
+	_, err = ApplyJsonPatch(doc, []byte(`[{"op":"remove","path":"/missing"}]`))
+	AssertEqual(t, ERROR_SUBCODE_PATCH_INVALID, err.Subcode())
+}
+
+func TestSetJsonKeys(t *testing.T) {
+	item := patchTestStruct{ID: 1, Name: "bruno", Email: "bruno@model.com", Phone: "123"}
+	doc := map[string]interface{}{"id": float64(1), "name": "sato", "email": "bruno@model.com"}
+
+	err := SetJsonKeys(&item, doc, []string{"name", "phone"})
+	AssertNoError(t, err)
+	AssertEqual(t, "sato", item.Name)
+	AssertEqual(t, "", item.Phone)
+
+	err = SetJsonKeys(&item, map[string]interface{}{"id": float64(2)}, []string{"id"})
+	AssertPermissionError(t, "id: field is unsettable;", err)
+	AssertEqual(t, uint(1), item.ID)
+
+	err = SetJsonKeys(&item, map[string]interface{}{"nope": 1}, []string{"nope"})
+	AssertBusinessError(t, "nope: unknown field;", err)
+}
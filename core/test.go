@@ -18,12 +18,15 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// OpenTestConnection opens the test database of TestDialect. The sqlite3
+// dialect needs cgo, so test packages register it rather than the server.
 func OpenTestConnection() (db *gorm.DB, err error) {
+	dialect := TestDialect()
 	testDB := os.Getenv("SERVER_DB")
 	if testDB == "" {
-		testDB = "user=postgres dbname=server_test sslmode=disable"
+		testDB = TEST_DB_SOURCES[dialect]
 	}
-	db, err = gorm.Open("postgres", testDB)
+	db, err = gorm.Open(dialect, testDB)
 	return
 }
 
@@ -178,6 +181,10 @@ func AssertNotFoundError(t *testing.T, msg string, err DefaultError) {
 	AssertDefaultError(t, "Not Found Error", msg, err, CallerInfo())
 }
 
+func AssertPreconditionFailedError(t *testing.T, msg string, err DefaultError) {
+	AssertDefaultError(t, "Precondition Failed Error", msg, err, CallerInfo())
+}
+
 func AssertServerError(t *testing.T, msg string, err DefaultError) {
 	AssertDefaultError(t, "Server Error", msg, err, CallerInfo())
 }
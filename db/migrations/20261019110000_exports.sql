@@ -0,0 +1,24 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE exports(
+	id serial not null,
+	created_at timestamp with time zone DEFAULT now(),
+	updated_at timestamp with time zone DEFAULT now(),
+	user_id integer not null,
+	resource varchar(100) not null,
+	format varchar(20) not null,
+	status varchar(20) not null,
+	row_count integer not null default 0,
+	file_name varchar(255),
+	error text
+);
+
+ALTER TABLE ONLY exports ADD CONSTRAINT exports_pkey PRIMARY KEY (id);
+CREATE INDEX idx_exports_user_id ON exports USING btree (user_id);
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE exports;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE imports(
+	id serial not null,
+	created_at timestamp with time zone DEFAULT now(),
+	updated_at timestamp with time zone DEFAULT now(),
+	user_id integer not null,
+	resource varchar(100) not null,
+	format varchar(20) not null,
+	mode varchar(20) not null,
+	dry_run boolean not null default false,
+	status varchar(20) not null,
+	total_rows integer not null default 0,
+	imported_rows integer not null default 0,
+	failed_rows integer not null default 0,
+	file_name varchar(255),
+	report_name varchar(255),
+	error text
+);
+
+ALTER TABLE ONLY imports ADD CONSTRAINT imports_pkey PRIMARY KEY (id);
+CREATE INDEX idx_imports_user_id ON imports USING btree (user_id);
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE imports;
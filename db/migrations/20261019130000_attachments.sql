@@ -0,0 +1,27 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE attachments(
+	id serial not null,
+	created_at timestamp with time zone DEFAULT now(),
+	updated_at timestamp with time zone DEFAULT now(),
+	user_id integer not null,
+	key varchar(255) not null,
+	file_name varchar(255),
+	content_type varchar(100) not null,
+	size bigint not null default 0,
+	status varchar(20) not null
+);
+
+ALTER TABLE ONLY attachments ADD CONSTRAINT attachments_pkey PRIMARY KEY (id);
+CREATE UNIQUE INDEX idx_attachments_key ON attachments USING btree (key);
+CREATE INDEX idx_attachments_user_id ON attachments USING btree (user_id);
+
+ALTER TABLE users ADD COLUMN avatar_id integer REFERENCES attachments(id) ON DELETE SET NULL;
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE users DROP COLUMN avatar_id;
+DROP TABLE attachments;
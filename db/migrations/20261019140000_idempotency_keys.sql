@@ -0,0 +1,26 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE idempotency_keys(
+	id serial not null,
+	created_at timestamp with time zone DEFAULT now(),
+	updated_at timestamp with time zone DEFAULT now(),
+	user_id integer not null default 0,
+	key varchar(255) not null,
+	fingerprint varchar(64) not null,
+	status integer not null default 0,
+	content_type varchar(255),
+	body bytea,
+	locked_until timestamp with time zone not null,
+	expires_at timestamp with time zone not null
+);
+
+ALTER TABLE ONLY idempotency_keys ADD CONSTRAINT idempotency_keys_pkey PRIMARY KEY (id);
+CREATE UNIQUE INDEX idx_idempotency_keys_user_id_key ON idempotency_keys USING btree (user_id, key);
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys USING btree (expires_at);
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE idempotency_keys;
@@ -4,7 +4,7 @@ module github.com/brunoksato/golang-boilerplate
 require (
 	github.com/Sirupsen/logrus v0.0.0-20170713114250-a3f95b5c4235
 	github.com/Zauberstuhl/go-coinbase v1.0.0
-	github.com/asaskevich/govalidator v0.0.0-20170425121227-4918b99a7cb9
+	github.com/asaskevich/govalidator v0.0.0-20200907205600-7a23bdc65eef
 	github.com/brunoksato/argon-server v0.0.0-20190812163325-5cd96a6e3814 // indirect
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/heroku/x v0.0.1
@@ -16,6 +16,7 @@ require (
 	github.com/mailru/easyjson v0.0.0-20180323154445-8b799c424f57
 	github.com/mattn/go-colorable v0.1.2
 	github.com/mattn/go-isatty v0.0.8
+	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/mitchellh/mapstructure v1.1.2
 	github.com/olivere/elastic v6.2.6+incompatible
 	github.com/pkg/errors v0.8.1
@@ -31,4 +32,5 @@ require (
 	golang.org/x/net v0.0.0-20190607181551-461777fb6f67
 	golang.org/x/sys v0.0.0-20190609082536-301114b31cce
 	golang.org/x/text v0.3.2
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,64 @@
+package i18n
+
+import "github.com/brunoksato/golang-boilerplate/core"
+
+var EN = Catalog{
+	core.ERROR_CODE_WARNING:              "Warning",
+	core.ERROR_CODE_BUSINESS_ERROR:       "Invalid request",
+	core.ERROR_CODE_AUTHENTICATION_ERROR: "Not authenticated",
+	core.ERROR_CODE_PERMISSION_ERROR:     "Permission denied",
+	core.ERROR_CODE_NOT_FOUND:            "Not found",
+	core.ERROR_CODE_PRECONDITION_FAILED:  "Precondition failed",
+	core.ERROR_CODE_UNPROCESSABLE:        "Unprocessable request",
+	core.ERROR_CODE_SERVER_ERROR:         "Internal server error",
+	core.ERROR_CODE_SERVICE_UNAVAILABLE:  "Service unavailable",
+
+	core.ERROR_SUBCODE_UNDEFINED_IGNORE:             "Unexpected error",
+	core.ERROR_SUBCODE_UNDEFINED:                    "Invalid request",
+	core.ERROR_SUBCODE_FK:                           "A referenced record does not exist",
+	core.ERROR_SUBCODE_CREDENTIALS_INVALID:          "Invalid credentials",
+	core.ERROR_SUBCODE_TOKEN_MISSING:                "Authentication token is missing",
+	core.ERROR_SUBCODE_TOKEN_INVALID:                "Authentication token is invalid",
+	core.ERROR_SUBCODE_COMPANY_INVALID:              "X-Company header is missing or invalid",
+	core.ERROR_SUBCODE_CRONJOB_KEY_INVALID:          "Cron job password is invalid",
+	core.ERROR_SUBCODE_EMAIL:                        "Invalid email",
+	core.ERROR_SUBCODE_NAME_TAKEN:                   "Name is already taken",
+	core.ERROR_SUBCODE_NAME_LENGTH:                  "Name has an invalid length",
+	core.ERROR_SUBCODE_NAME_FORMAT:                  "Name has an invalid format",
+	core.ERROR_SUBCODE_EMAIL_TAKEN:                  "Email is already taken",
+	core.ERROR_SUBCODE_EMAIL_FORMAT:                 "Email has an invalid format",
+	core.ERROR_SUBCODE_PASSWORD_LENGTH:              "Password has an invalid length",
+	core.ERROR_SUBCODE_PASSWORD_FORMAT:              "Password has an invalid format",
+	core.ERROR_SUBCODE_USERNAME_TAKEN:               "Username is already taken",
+	core.ERROR_SUBCODE_USERNAME_LENGTH:              "Username has an invalid length",
+	core.ERROR_SUBCODE_USERNAME_FORMAT:              "Username has an invalid format",
+	core.ERROR_SUBCODE_PHONE_TAKEN:                  "Phone is already taken",
+	core.ERROR_SUBCODE_PHONE_LENGTH:                 "Phone has an invalid length",
+	core.ERROR_SUBCODE_PHONE_FORMAT:                 "Phone has an invalid format",
+	core.ERROR_SUBCODE_VERSION_MISMATCH:             "The record was changed by someone else",
+	core.ERROR_SUBCODE_PATCH_INVALID:                "Invalid patch",
+	core.ERROR_SUBCODE_PATCH_TEST_FAILED:            "A patch test operation failed",
+	core.ERROR_SUBCODE_PATCH_UNSUPPORTED_MEDIA_TYPE: "Unsupported patch content type",
+	core.ERROR_SUBCODE_FIELD_UNSETTABLE:             "The field cannot be changed",
+	core.ERROR_SUBCODE_BATCH_INVALID:                "Invalid batch",
+	core.ERROR_SUBCODE_BATCH_TOO_LARGE:              "The batch has too many operations",
+	core.ERROR_SUBCODE_BATCH_ROLLED_BACK:            "Rolled back because another operation failed",
+	core.ERROR_SUBCODE_IMPORT_INVALID:               "Invalid import file",
+	core.ERROR_SUBCODE_IMPORT_UNSUPPORTED_FORMAT:    "Unsupported import format",
+	core.ERROR_SUBCODE_IMPORT_UNKNOWN_COLUMN:        "The import file has an unknown column",
+	core.ERROR_SUBCODE_IMPORT_ROW_INVALID:           "Invalid import row",
+	core.ERROR_SUBCODE_UPLOAD_INVALID:               "Invalid upload",
+	core.ERROR_SUBCODE_UPLOAD_TOO_LARGE:             "The file is too large",
+	core.ERROR_SUBCODE_UPLOAD_CONTENT_TYPE:          "The file type is not allowed",
+	core.ERROR_SUBCODE_UPLOAD_SIGNATURE_INVALID:     "The upload URL is invalid or expired",
+	core.ERROR_SUBCODE_UPLOAD_MISSING:               "The file was not uploaded",
+	core.ERROR_SUBCODE_LOG_LEVEL_INVALID:            "Invalid log level or sink",
+	core.ERROR_SUBCODE_IDEMPOTENCY_KEY_INVALID:      "Invalid Idempotency-Key",
+	core.ERROR_SUBCODE_IDEMPOTENCY_KEY_REUSED:       "The Idempotency-Key was already used for another request",
+	core.ERROR_SUBCODE_IDEMPOTENCY_KEY_IN_PROGRESS:  "A request with this Idempotency-Key is still running, try again later",
+	core.ERROR_SUBCODE_USER_UNDERAGE:                "The user is underage",
+	core.ERROR_SUBCODE_USER_LACKS_PERMISSION:        "You do not have permission",
+	core.ERROR_SUBCODE_OTHER_USER_LACKS_PERMISSION:  "The other user does not have permission",
+	core.ERROR_SUBCODE_DATABASE_UNAVAILABLE:         "The database is unavailable",
+	core.ERROR_SUBCODE_SERVER_OVERLOADED:            "The server is overloaded, try again later",
+}
@@ -0,0 +1,116 @@
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+)
+
+// SOURCE_LANGUAGE is the language error messages are written in. Requests in
+// it get the message of the error itself, which is more specific than the
+// catalog one.
+const SOURCE_LANGUAGE = "en"
+
+// Catalog maps an error code or subcode to its message.
+type Catalog map[int]string
+
+// CATALOGS holds a catalog per supported language tag.
+var CATALOGS = map[string]Catalog{
+	"en":    EN,
+	"pt-BR": PT_BR,
+}
+
+// Negotiate picks the supported language that best matches an
+// Accept-Language header. A bare language like "pt" matches any of its
+// regional variants, and a variant like "pt-PT" falls back to the language.
+// Requests without a usable header get fallback, or the source language
+// when fallback is not supported either.
+func Negotiate(acceptLanguage string, fallback string) string {
+	if _, ok := CATALOGS[fallback]; !ok {
+		fallback = SOURCE_LANGUAGE
+	}
+
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	ranges := []weighted{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, r := range ranges {
+		if lang := match(r.tag, fallback); lang != "" {
+			return lang
+		}
+	}
+	return fallback
+}
+
+func match(tag string, fallback string) string {
+	if tag == "*" {
+		return fallback
+	}
+
+	base := strings.ToLower(strings.Split(tag, "-")[0])
+	candidates := []string{}
+	for lang := range CATALOGS {
+		if strings.EqualFold(lang, tag) {
+			return lang
+		}
+		if strings.ToLower(strings.Split(lang, "-")[0]) == base {
+			candidates = append(candidates, lang)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Strings(candidates)
+	return candidates[0]
+}
+
+// Message looks up code in the catalog of lang, then in the source
+// language one.
+func Message(lang string, code int) (string, bool) {
+	if msg, ok := CATALOGS[lang][code]; ok {
+		return msg, true
+	}
+	msg, ok := CATALOGS[SOURCE_LANGUAGE][code]
+	return msg, ok
+}
+
+// Translate returns the catalog message of subcode in lang, or fallback
+// when lang is the source language or has no entry for it. Undefined
+// subcodes keep the fallback too, it says more than the generic message.
+func Translate(lang string, subcode int, fallback string) string {
+	if lang == SOURCE_LANGUAGE ||
+		subcode == core.ERROR_SUBCODE_UNDEFINED || subcode == core.ERROR_SUBCODE_UNDEFINED_IGNORE {
+		return fallback
+	}
+	if msg, ok := CATALOGS[lang][subcode]; ok {
+		return msg
+	}
+	return fallback
+}
@@ -0,0 +1,79 @@
+package i18n_test
+
+import (
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/i18n"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                      "en",
+		"pt-BR":                 "pt-BR",
+		"pt-br":                 "pt-BR",
+		"pt":                    "pt-BR",
+		"pt-PT":                 "pt-BR",
+		"fr":                    "en",
+		"*":                     "en",
+		"en-US,en;q=0.9":        "en",
+		"pt-BR,pt;q=0.9,en;q=0": "pt-BR",
+		"en;q=0.5,pt-BR;q=0.8":  "pt-BR",
+		"fr,pt;q=0.7,en;q=0.3":  "pt-BR",
+		"pt-BR;q=0,en":          "en",
+	}
+	for header, expected := range cases {
+		if actual := i18n.Negotiate(header, "en"); actual != expected {
+			t.Errorf("Negotiate(%q) = %q, expected %q", header, actual, expected)
+		}
+	}
+}
+
+func TestNegotiateFallback(t *testing.T) {
+	cases := map[string]string{
+		"":   "pt-BR",
+		"*":  "pt-BR",
+		"fr": "pt-BR",
+		"en": "en",
+	}
+	for header, expected := range cases {
+		if actual := i18n.Negotiate(header, "pt-BR"); actual != expected {
+			t.Errorf("Negotiate(%q) = %q, expected %q", header, actual, expected)
+		}
+	}
+	if actual := i18n.Negotiate("", "fr"); actual != i18n.SOURCE_LANGUAGE {
+		t.Errorf("an unsupported fallback gave %q", actual)
+	}
+}
+
+func TestCatalogsAreComplete(t *testing.T) {
+	for lang, catalog := range i18n.CATALOGS {
+		for code, name := range core.ERROR_CODE_NAMES {
+			if _, ok := catalog[code]; !ok {
+				t.Errorf("%s catalog has no message for %s", lang, name)
+			}
+		}
+		for subcode, name := range core.ERROR_SUBCODE_NAMES {
+			if _, ok := catalog[subcode]; !ok {
+				t.Errorf("%s catalog has no message for %s", lang, name)
+			}
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	msg := i18n.Translate("en", core.ERROR_SUBCODE_EMAIL_FORMAT, "email: value does not validate as email;")
+	if msg != "email: value does not validate as email;" {
+		t.Errorf("expected the source language to keep the original message, got %q", msg)
+	}
+
+	msg = i18n.Translate("pt-BR", core.ERROR_SUBCODE_EMAIL_FORMAT, "email: value does not validate as email;")
+	if msg != i18n.PT_BR[core.ERROR_SUBCODE_EMAIL_FORMAT] {
+		t.Errorf("expected the catalog message, got %q", msg)
+	}
+
+	msg = i18n.Translate("pt-BR", core.ERROR_SUBCODE_UNDEFINED, "Something specific")
+	if msg != "Something specific" {
+		t.Errorf("expected undefined subcodes to keep the original message, got %q", msg)
+	}
+}
@@ -0,0 +1,64 @@
+package i18n
+
+import "github.com/brunoksato/golang-boilerplate/core"
+
+var PT_BR = Catalog{
+	core.ERROR_CODE_WARNING:              "Aviso",
+	core.ERROR_CODE_BUSINESS_ERROR:       "Requisição inválida",
+	core.ERROR_CODE_AUTHENTICATION_ERROR: "Não autenticado",
+	core.ERROR_CODE_PERMISSION_ERROR:     "Permissão negada",
+	core.ERROR_CODE_NOT_FOUND:            "Não encontrado",
+	core.ERROR_CODE_PRECONDITION_FAILED:  "Pré-condição falhou",
+	core.ERROR_CODE_UNPROCESSABLE:        "Requisição não processável",
+	core.ERROR_CODE_SERVER_ERROR:         "Erro interno do servidor",
+	core.ERROR_CODE_SERVICE_UNAVAILABLE:  "Serviço indisponível",
+
+	core.ERROR_SUBCODE_UNDEFINED_IGNORE:             "Erro inesperado",
+	core.ERROR_SUBCODE_UNDEFINED:                    "Requisição inválida",
+	core.ERROR_SUBCODE_FK:                           "Um registro referenciado não existe",
+	core.ERROR_SUBCODE_CREDENTIALS_INVALID:          "Credenciais inválidas",
+	core.ERROR_SUBCODE_TOKEN_MISSING:                "Token de autenticação ausente",
+	core.ERROR_SUBCODE_TOKEN_INVALID:                "Token de autenticação inválido",
+	core.ERROR_SUBCODE_COMPANY_INVALID:              "Cabeçalho X-Company ausente ou inválido",
+	core.ERROR_SUBCODE_CRONJOB_KEY_INVALID:          "Senha do cron job inválida",
+	core.ERROR_SUBCODE_EMAIL:                        "Email inválido",
+	core.ERROR_SUBCODE_NAME_TAKEN:                   "Nome já está em uso",
+	core.ERROR_SUBCODE_NAME_LENGTH:                  "Nome com tamanho inválido",
+	core.ERROR_SUBCODE_NAME_FORMAT:                  "Nome com formato inválido",
+	core.ERROR_SUBCODE_EMAIL_TAKEN:                  "Email já está em uso",
+	core.ERROR_SUBCODE_EMAIL_FORMAT:                 "Email com formato inválido",
+	core.ERROR_SUBCODE_PASSWORD_LENGTH:              "Senha com tamanho inválido",
+	core.ERROR_SUBCODE_PASSWORD_FORMAT:              "Senha com formato inválido",
+	core.ERROR_SUBCODE_USERNAME_TAKEN:               "Nome de usuário já está em uso",
+	core.ERROR_SUBCODE_USERNAME_LENGTH:              "Nome de usuário com tamanho inválido",
+	core.ERROR_SUBCODE_USERNAME_FORMAT:              "Nome de usuário com formato inválido",
+	core.ERROR_SUBCODE_PHONE_TAKEN:                  "Telefone já está em uso",
+	core.ERROR_SUBCODE_PHONE_LENGTH:                 "Telefone com tamanho inválido",
+	core.ERROR_SUBCODE_PHONE_FORMAT:                 "Telefone com formato inválido",
+	core.ERROR_SUBCODE_VERSION_MISMATCH:             "O registro foi alterado por outra pessoa",
+	core.ERROR_SUBCODE_PATCH_INVALID:                "Patch inválido",
+	core.ERROR_SUBCODE_PATCH_TEST_FAILED:            "Uma operação de teste do patch falhou",
+	core.ERROR_SUBCODE_PATCH_UNSUPPORTED_MEDIA_TYPE: "Tipo de conteúdo do patch não suportado",
+	core.ERROR_SUBCODE_FIELD_UNSETTABLE:             "O campo não pode ser alterado",
+	core.ERROR_SUBCODE_BATCH_INVALID:                "Lote inválido",
+	core.ERROR_SUBCODE_BATCH_TOO_LARGE:              "O lote tem operações demais",
+	core.ERROR_SUBCODE_BATCH_ROLLED_BACK:            "Desfeita porque outra operação falhou",
+	core.ERROR_SUBCODE_IMPORT_INVALID:               "Arquivo de importação inválido",
+	core.ERROR_SUBCODE_IMPORT_UNSUPPORTED_FORMAT:    "Formato de importação não suportado",
+	core.ERROR_SUBCODE_IMPORT_UNKNOWN_COLUMN:        "O arquivo de importação tem uma coluna desconhecida",
+	core.ERROR_SUBCODE_IMPORT_ROW_INVALID:           "Linha de importação inválida",
+	core.ERROR_SUBCODE_UPLOAD_INVALID:               "Upload inválido",
+	core.ERROR_SUBCODE_UPLOAD_TOO_LARGE:             "O arquivo é grande demais",
+	core.ERROR_SUBCODE_UPLOAD_CONTENT_TYPE:          "O tipo de arquivo não é permitido",
+	core.ERROR_SUBCODE_UPLOAD_SIGNATURE_INVALID:     "A URL de upload é inválida ou expirou",
+	core.ERROR_SUBCODE_UPLOAD_MISSING:               "O arquivo não foi enviado",
+	core.ERROR_SUBCODE_LOG_LEVEL_INVALID:            "Nível de log ou destino inválido",
+	core.ERROR_SUBCODE_IDEMPOTENCY_KEY_INVALID:      "Idempotency-Key inválida",
+	core.ERROR_SUBCODE_IDEMPOTENCY_KEY_REUSED:       "A Idempotency-Key já foi usada em outra requisição",
+	core.ERROR_SUBCODE_IDEMPOTENCY_KEY_IN_PROGRESS:  "Uma requisição com esta Idempotency-Key ainda está em andamento, tente novamente mais tarde",
+	core.ERROR_SUBCODE_USER_UNDERAGE:                "O usuário é menor de idade",
+	core.ERROR_SUBCODE_USER_LACKS_PERMISSION:        "Você não tem permissão",
+	core.ERROR_SUBCODE_OTHER_USER_LACKS_PERMISSION:  "O outro usuário não tem permissão",
+	core.ERROR_SUBCODE_DATABASE_UNAVAILABLE:         "O banco de dados está indisponível",
+	core.ERROR_SUBCODE_SERVER_OVERLOADED:            "O servidor está sobrecarregado, tente novamente mais tarde",
+}
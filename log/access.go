@@ -0,0 +1,89 @@
+package log
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/labstack/echo/v4"
+)
+
+const REDACTED = "REDACTED"
+
+// AccessLog writes the access log line of a finished request: status,
+// latency, sizes, API type and the error code, if any. Requests that
+// succeeded are sampled with the access log sample rate, failures always
+// make it.
+func AccessLog(c echo.Context, start time.Time) {
+	cfg := config.FromContext(c)
+	res := c.Response()
+	if !sampleAccessLog(res.Status, cfg.Log.AccessSampleRate) {
+		return
+	}
+
+	latency := time.Since(start)
+	params := map[string]interface{}{
+		"system":     "access",
+		"status":     res.Status,
+		"latency-ms": float64(latency.Nanoseconds()) / float64(time.Millisecond),
+		"bytes-in":   c.Request().ContentLength,
+		"bytes-out":  res.Size,
+		"route":      c.Path(),
+		"remote-ip":  c.RealIP(),
+		"user-agent": c.Request().UserAgent(),
+	}
+	if apiType, ok := c.Get("APIType").(core.APIType); ok {
+		params["api-type"] = string(apiType)
+	}
+	if code, ok := c.Get("ErrorCode").(int); ok {
+		params["error-code"] = code
+		params["error-subcode"] = c.Get("ErrorSubcode")
+	}
+
+	logger := LoggerForParams(c, params)
+	msg := fmt.Sprintf("%s %s %d %s", c.Request().Method, RedactURL(c.Request().URL, cfg.Log.AccessRedactParams), res.Status, latency)
+	if res.Status >= 500 {
+		logger.Error(msg)
+	} else {
+		logger.Info(msg)
+	}
+}
+
+func sampleAccessLog(status int, rate float64) bool {
+	if status >= 400 || rate >= 1 {
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// RedactURL renders u with the values of the sensitive query parameters in
+// params replaced.
+func RedactURL(u *url.URL, params []string) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+
+	sensitive := map[string]bool{}
+	for _, name := range params {
+		sensitive[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	parts := strings.Split(u.RawQuery, "&")
+	for i, part := range parts {
+		name := strings.SplitN(part, "=", 2)[0]
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if sensitive[strings.ToLower(name)] {
+			parts[i] = url.QueryEscape(name) + "=" + REDACTED
+		}
+	}
+
+	redacted := *u
+	redacted.RawQuery = strings.Join(parts, "&")
+	return redacted.String()
+}
@@ -0,0 +1,253 @@
+package log
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/brunoksato/golang-boilerplate/core"
+)
+
+// DEFAULT_SYSTEM is the system of entries without a system field.
+const DEFAULT_SYSTEM = "default"
+
+// LevelConfig is the level of each system and sink. Systems are the
+// system field LoggerForParams sets, like api or access. An entry is
+// written to a sink when its level passes both the level of its system,
+// or Default, and the level of the sink.
+type LevelConfig struct {
+	Default string            `json:"default"`
+	Systems map[string]string `json:"systems"`
+	Sinks   map[string]string `json:"sinks"`
+}
+
+type namedSink struct {
+	name  string
+	sink  Sink
+	level logrus.Level
+}
+
+// Dispatcher is the logrus hook that hands entries to the sinks. The
+// logger itself writes nowhere.
+type Dispatcher struct {
+	mutex        sync.RWMutex
+	sinks        []*namedSink
+	defaultLevel logrus.Level
+	systemLevels map[string]logrus.Level
+}
+
+// DISPATCHER is the dispatcher of the standard logger, set up by Setup.
+var DISPATCHER = NewDispatcher(logrus.InfoLevel)
+
+var dispatcherMutex sync.RWMutex
+var dispatcherHooked bool
+
+func NewDispatcher(defaultLevel logrus.Level) *Dispatcher {
+	return &Dispatcher{defaultLevel: defaultLevel, systemLevels: map[string]logrus.Level{}}
+}
+
+// Setup routes the entries of the standard logger through d, in place of
+// the dispatcher of an earlier call.
+func Setup(d *Dispatcher) {
+	dispatcherMutex.Lock()
+	DISPATCHER = d
+	if !dispatcherHooked {
+		logrus.SetOutput(ioutil.Discard)
+		logrus.AddHook(standardHook{})
+		dispatcherHooked = true
+	}
+	dispatcherMutex.Unlock()
+	d.apply()
+}
+
+// Current returns the dispatcher of the standard logger.
+func Current() *Dispatcher {
+	dispatcherMutex.RLock()
+	defer dispatcherMutex.RUnlock()
+	return DISPATCHER
+}
+
+// standardHook hands the entries of the standard logger to the current
+// dispatcher.
+type standardHook struct{}
+
+func (standardHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (standardHook) Fire(entry *logrus.Entry) error {
+	return Current().Fire(entry)
+}
+
+// AddSink adds a sink receiving entries up to level.
+func (d *Dispatcher) AddSink(name string, sink Sink, level logrus.Level) {
+	d.mutex.Lock()
+	d.sinks = append(d.sinks, &namedSink{name, sink, level})
+	d.mutex.Unlock()
+	d.apply()
+}
+
+// Levels is required for logrus
+// hook implementation
+func (d *Dispatcher) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (d *Dispatcher) Fire(entry *logrus.Entry) error {
+	d.mutex.RLock()
+	level := d.defaultLevel
+	if system, ok := entry.Data["system"].(string); ok {
+		if l, ok := d.systemLevels[system]; ok {
+			level = l
+		}
+	}
+	if entry.Level > level {
+		d.mutex.RUnlock()
+		return nil
+	}
+	sinks := []Sink{}
+	for _, s := range d.sinks {
+		if entry.Level <= s.level {
+			sinks = append(sinks, s.sink)
+		}
+	}
+	d.mutex.RUnlock()
+
+	for _, sink := range sinks {
+		// A broken sink must not keep the others from logging, nor fail
+		// the caller.
+		if err := sink.Write(entry); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing log entry:", err.Error())
+		}
+	}
+	return nil
+}
+
+// Config returns the levels in use.
+func (d *Dispatcher) Config() LevelConfig {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	config := LevelConfig{
+		Default: d.defaultLevel.String(),
+		Systems: map[string]string{},
+		Sinks:   map[string]string{},
+	}
+	for system, level := range d.systemLevels {
+		config.Systems[system] = level.String()
+	}
+	for _, s := range d.sinks {
+		config.Sinks[s.name] = s.level.String()
+	}
+	return config
+}
+
+// SetConfig changes the levels given in config and leaves the others
+// alone. An empty system level removes the override of the system. Nothing
+// changes when a level or sink is invalid.
+func (d *Dispatcher) SetConfig(config LevelConfig) core.DefaultError {
+	defaultLevel, systemLevels, sinkLevels, err := d.parse(config)
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	if config.Default != "" {
+		d.defaultLevel = defaultLevel
+	}
+	for system, level := range systemLevels {
+		if level == nil {
+			delete(d.systemLevels, system)
+		} else {
+			d.systemLevels[system] = *level
+		}
+	}
+	for _, s := range d.sinks {
+		if level, ok := sinkLevels[s.name]; ok {
+			s.level = level
+		}
+	}
+	d.mutex.Unlock()
+
+	d.apply()
+	return nil
+}
+
+func (d *Dispatcher) parse(config LevelConfig) (logrus.Level, map[string]*logrus.Level, map[string]logrus.Level, core.DefaultError) {
+	invalid := func(msg string, value string) core.DefaultError {
+		return core.NewBusinessError(fmt.Sprintf(msg, value), core.ERROR_SUBCODE_LOG_LEVEL_INVALID)
+	}
+
+	defaultLevel := logrus.InfoLevel
+	if config.Default != "" {
+		level, err := logrus.ParseLevel(config.Default)
+		if err != nil {
+			return 0, nil, nil, invalid("Invalid default log level: %s", config.Default)
+		}
+		defaultLevel = level
+	}
+
+	systemLevels := map[string]*logrus.Level{}
+	for system, value := range config.Systems {
+		if value == "" {
+			systemLevels[system] = nil
+			continue
+		}
+		level, err := logrus.ParseLevel(value)
+		if err != nil {
+			return 0, nil, nil, invalid("Invalid log level of system "+system+": %s", value)
+		}
+		systemLevels[system] = &level
+	}
+
+	d.mutex.RLock()
+	known := map[string]bool{}
+	for _, s := range d.sinks {
+		known[s.name] = true
+	}
+	d.mutex.RUnlock()
+
+	sinkLevels := map[string]logrus.Level{}
+	for name, value := range config.Sinks {
+		if !known[name] {
+			return 0, nil, nil, invalid("Unknown log sink: %s", name)
+		}
+		level, err := logrus.ParseLevel(value)
+		if err != nil {
+			return 0, nil, nil, invalid("Invalid log level of sink "+name+": %s", value)
+		}
+		sinkLevels[name] = level
+	}
+
+	return defaultLevel, systemLevels, sinkLevels, nil
+}
+
+// apply sets the level of the standard logger to the most verbose one a
+// sink would write, so entries nobody wants are dropped early.
+func (d *Dispatcher) apply() {
+	if Current() != d {
+		return
+	}
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	wanted := d.defaultLevel
+	for _, level := range d.systemLevels {
+		if level > wanted {
+			wanted = level
+		}
+	}
+	accepted := logrus.PanicLevel
+	for _, s := range d.sinks {
+		if s.level > accepted {
+			accepted = s.level
+		}
+	}
+	if accepted < wanted {
+		wanted = accepted
+	}
+	logrus.SetLevel(wanted)
+}
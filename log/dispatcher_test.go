@@ -0,0 +1,136 @@
+package log
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/brunoksato/golang-boilerplate/core"
+)
+
+type memorySink struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (s *memorySink) Write(entry *logrus.Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.messages = append(s.messages, entry.Message)
+	return nil
+}
+
+func systemEntry(system string, level logrus.Level, msg string) *logrus.Entry {
+	e := entry(msg)
+	e.Level = level
+	if system != "" {
+		e.Data["system"] = system
+	}
+	return e
+}
+
+func TestDispatcherSinkLevels(t *testing.T) {
+	d := NewDispatcher(logrus.DebugLevel)
+	stdout, es := &memorySink{}, &memorySink{}
+	d.AddSink("stdout", stdout, logrus.InfoLevel)
+	d.AddSink("es", es, logrus.DebugLevel)
+
+	d.Fire(systemEntry("api", logrus.DebugLevel, "debug"))
+	d.Fire(systemEntry("api", logrus.ErrorLevel, "error"))
+
+	if len(stdout.messages) != 1 || stdout.messages[0] != "error" {
+		t.Errorf("stdout got %v, want [error]", stdout.messages)
+	}
+	if len(es.messages) != 2 {
+		t.Errorf("es got %v, want both entries", es.messages)
+	}
+}
+
+func TestDispatcherSystemLevels(t *testing.T) {
+	d := NewDispatcher(logrus.InfoLevel)
+	sink := &memorySink{}
+	d.AddSink("stdout", sink, logrus.DebugLevel)
+
+	err := d.SetConfig(LevelConfig{Systems: map[string]string{"access": "warn", "api": "debug"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Fire(systemEntry("access", logrus.InfoLevel, "access info"))
+	d.Fire(systemEntry("access", logrus.WarnLevel, "access warn"))
+	d.Fire(systemEntry("api", logrus.DebugLevel, "api debug"))
+	d.Fire(systemEntry("", logrus.DebugLevel, "default debug"))
+	d.Fire(systemEntry("", logrus.InfoLevel, "default info"))
+
+	want := []string{"access warn", "api debug", "default info"}
+	if len(sink.messages) != len(want) {
+		t.Fatalf("got %v, want %v", sink.messages, want)
+	}
+	for i := range want {
+		if sink.messages[i] != want[i] {
+			t.Errorf("got %v, want %v", sink.messages, want)
+		}
+	}
+
+	// An empty level drops the override.
+	if err := d.SetConfig(LevelConfig{Systems: map[string]string{"access": ""}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.Config().Systems["access"]; ok {
+		t.Error("the access override was not removed")
+	}
+	if d.Config().Systems["api"] != "debug" {
+		t.Error("a partial update changed another system")
+	}
+}
+
+func TestDispatcherSetConfigRejectsInvalid(t *testing.T) {
+	d := NewDispatcher(logrus.InfoLevel)
+	d.AddSink("stdout", &memorySink{}, logrus.DebugLevel)
+
+	invalid := []LevelConfig{
+		{Default: "loud"},
+		{Systems: map[string]string{"api": "loud"}},
+		{Sinks: map[string]string{"kafka": "info"}},
+		{Default: "debug", Sinks: map[string]string{"stdout": "loud"}},
+	}
+	for _, config := range invalid {
+		err := d.SetConfig(config)
+		if err == nil {
+			t.Errorf("%+v was accepted", config)
+			continue
+		}
+		if err.Subcode() != core.ERROR_SUBCODE_LOG_LEVEL_INVALID {
+			t.Errorf("%+v got subcode %d", config, err.Subcode())
+		}
+	}
+
+	config := d.Config()
+	if config.Default != "info" || config.Sinks["stdout"] != "debug" {
+		t.Errorf("a rejected update changed the levels: %+v", config)
+	}
+}
+
+func TestSetupSetsLoggerLevel(t *testing.T) {
+	previous := Current()
+	defer Setup(previous)
+
+	d := NewDispatcher(logrus.InfoLevel)
+	sink := &memorySink{}
+	d.AddSink("stdout", sink, logrus.WarnLevel)
+	Setup(d)
+
+	if logrus.GetLevel() != logrus.WarnLevel {
+		t.Errorf("got level %s, want warn: no sink takes info", logrus.GetLevel())
+	}
+
+	d.SetConfig(LevelConfig{Sinks: map[string]string{"stdout": "debug"}, Systems: map[string]string{"api": "debug"}})
+	if logrus.GetLevel() != logrus.DebugLevel {
+		t.Errorf("got level %s, want debug", logrus.GetLevel())
+	}
+
+	logrus.WithField("system", "api").Debug("through the standard logger")
+	if len(sink.messages) != 1 {
+		t.Errorf("got %v, want the entry of the standard logger", sink.messages)
+	}
+}
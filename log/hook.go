@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -14,12 +15,77 @@ var (
 	// Fired if the
 	// index is not created
 	ErrCannotCreateIndex = fmt.Errorf("Cannot create index")
+	// Fired if the index
+	// template is not stored
+	ErrCannotPutTemplate = fmt.Errorf("Cannot put index template")
 )
 
+// What the hook does with an entry when its queue is full.
+const (
+	OVERFLOW_DROP_NEWEST = "drop_newest"
+	OVERFLOW_DROP_OLDEST = "drop_oldest"
+)
+
+// ES 6 still wants a mapping type, _doc is the one that carries over to
+// typeless indices.
+const ELASTIC_DOC_TYPE = "_doc"
+
 type IndexNameFunc func() string
 
+// DailyIndexName names indices after the day entries are logged, so the
+// hook rolls over to a new index at midnight UTC, e.g. logstash-2019.08.12.
+func DailyIndexName(prefix string) IndexNameFunc {
+	return func() string {
+		now := time.Now().UTC()
+		return fmt.Sprintf("%s-%04d.%02d.%02d", prefix, now.Year(), now.Month(), now.Day())
+	}
+}
+
+// ElasticHookOptions tune the buffering of the hook.
+type ElasticHookOptions struct {
+	// QueueSize bounds the entries waiting to be handed to the bulk
+	// processor.
+	QueueSize int
+	// Overflow is OVERFLOW_DROP_NEWEST or OVERFLOW_DROP_OLDEST.
+	Overflow      string
+	Workers       int
+	BulkActions   int
+	FlushInterval time.Duration
+}
+
+func DefaultElasticHookOptions() ElasticHookOptions {
+	return ElasticHookOptions{
+		QueueSize:     10000,
+		Overflow:      OVERFLOW_DROP_NEWEST,
+		Workers:       1,
+		BulkActions:   500,
+		FlushInterval: 5 * time.Second,
+	}
+}
+
+type logSource struct {
+	Host      string
+	Timestamp string `json:"@timestamp"`
+	Message   string
+	Data      logrus.Fields
+	Level     string
+}
+
+type logDocument struct {
+	Index  string
+	Source logSource
+}
+
+// bulkProcessor is the part of elastic.BulkProcessor the hook uses.
+type bulkProcessor interface {
+	Add(elastic.BulkableRequest)
+	Flush() error
+	Close() error
+}
+
 // ElasticHook is a logrus
-// hook for ElasticSearch
+// hook for ElasticSearch. Entries are queued and indexed in bulk in the
+// background, so logging never waits on ElasticSearch.
 type ElasticHook struct {
 	client    *elastic.Client
 	host      string
@@ -27,6 +93,13 @@ type ElasticHook struct {
 	levels    []logrus.Level
 	ctx       context.Context
 	ctxCancel context.CancelFunc
+
+	overflow  string
+	processor bulkProcessor
+	queue     chan logDocument
+	mutex     sync.RWMutex
+	closed    bool
+	done      chan struct{}
 }
 
 // NewElasticHook creates new hook
@@ -40,12 +113,43 @@ func NewElasticHook(client *elastic.Client, host string, level logrus.Level, ind
 
 // NewElasticHookWithFunc creates new hook with
 // function that provides the index name. This is useful if the index name is
-// somehow dynamic especially based on time.
+// somehow dynamic especially based on time, see DailyIndexName.
 // client - ElasticSearch client using gopkg.in/olivere/elastic.v5
 // host - host of system
 // level - log level
 // indexFunc - function providing the name of index
 func NewElasticHookWithFunc(client *elastic.Client, host string, level logrus.Level, indexFunc IndexNameFunc) (*ElasticHook, error) {
+	return NewElasticHookWithOptions(client, host, level, indexFunc, DefaultElasticHookOptions())
+}
+
+// NewElasticHookWithOptions creates a hook with its own buffering. The
+// index is created by ElasticSearch on the first entry, see
+// PutIndexTemplate for its mapping.
+func NewElasticHookWithOptions(client *elastic.Client, host string, level logrus.Level, indexFunc IndexNameFunc, opts ElasticHookOptions) (*ElasticHook, error) {
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	hook := newElasticHook(host, level, indexFunc, opts)
+	hook.client = client
+	hook.ctx = ctx
+	hook.ctxCancel = cancel
+
+	processor, err := client.BulkProcessor().
+		Name("logrus").
+		Workers(opts.Workers).
+		BulkActions(opts.BulkActions).
+		FlushInterval(opts.FlushInterval).
+		After(afterBulk).
+		Do(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	hook.start(processor)
+	return hook, nil
+}
+
+func newElasticHook(host string, level logrus.Level, indexFunc IndexNameFunc, opts ElasticHookOptions) *ElasticHook {
 	levels := []logrus.Level{}
 	for _, l := range []logrus.Level{
 		logrus.PanicLevel,
@@ -60,68 +164,128 @@ func NewElasticHookWithFunc(client *elastic.Client, host string, level logrus.Le
 		}
 	}
 
-	ctx, cancel := context.WithCancel(context.TODO())
-
-	// Use the IndexExists service to check if a specified index exists.
-	exists, err := client.IndexExists(indexFunc()).Do(ctx)
-	if err != nil {
-		// Handle error
-		return nil, err
-	}
-	if !exists {
-		createIndex, err := client.CreateIndex(indexFunc()).Do(ctx)
-		if err != nil {
-			return nil, err
-		}
-		if !createIndex.Acknowledged {
-			return nil, ErrCannotCreateIndex
-		}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultElasticHookOptions().QueueSize
 	}
 
 	return &ElasticHook{
-		client:    client,
 		host:      host,
 		index:     indexFunc,
 		levels:    levels,
-		ctx:       ctx,
-		ctxCancel: cancel,
-	}, nil
+		ctxCancel: func() {},
+		overflow:  opts.Overflow,
+		queue:     make(chan logDocument, opts.QueueSize),
+		done:      make(chan struct{}),
+	}
+}
+
+func (hook *ElasticHook) start(processor bulkProcessor) {
+	hook.processor = processor
+	go func() {
+		defer close(hook.done)
+		for doc := range hook.queue {
+			hook.processor.Add(elastic.NewBulkIndexRequest().
+				Index(doc.Index).
+				Type(ELASTIC_DOC_TYPE).
+				Doc(doc.Source))
+		}
+	}()
+}
+
+func afterBulk(executionId int64, requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) {
+	if err != nil {
+		ES_HOOK_FAILURES.Add(float64(len(requests)))
+		return
+	}
+	if response != nil {
+		ES_HOOK_FAILURES.Add(float64(len(response.Failed())))
+	}
+}
+
+// PutIndexTemplate maps the fields of the entries in the indices matching
+// pattern, e.g. logstash-*, whenever ElasticSearch creates one.
+func PutIndexTemplate(client *elastic.Client, name string, pattern string) error {
+	template := fmt.Sprintf(`{
+	"index_patterns": [%q],
+	"settings": {"number_of_shards": 1},
+	"mappings": {
+		%q: {
+			"dynamic_templates": [
+				{"data_strings": {"path_match": "Data.*", "match_mapping_type": "string", "mapping": {"type": "keyword", "ignore_above": 1024}}}
+			],
+			"properties": {
+				"@timestamp": {"type": "date"},
+				"Host": {"type": "keyword"},
+				"Level": {"type": "keyword"},
+				"Message": {"type": "text"}
+			}
+		}
+	}
+}`, pattern, ELASTIC_DOC_TYPE)
+
+	res, err := client.IndexPutTemplate(name).BodyString(template).Do(context.TODO())
+	if err != nil {
+		return err
+	}
+	if !res.Acknowledged {
+		return ErrCannotPutTemplate
+	}
+	return nil
 }
 
 // Fire is required to implement
-// Logrus hook
+// Logrus hook. It only queues the entry and never fails, a full queue
+// drops entries according to the overflow policy.
 func (hook *ElasticHook) Fire(entry *logrus.Entry) error {
 
 	level := entry.Level.String()
 
-	if e, ok := entry.Data[logrus.ErrorKey]; ok && e != nil {
-		if err, ok := e.(error); ok {
-			entry.Data[logrus.ErrorKey] = err.Error()
+	data := logrus.Fields{}
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok && k == logrus.ErrorKey {
+			v = err.Error()
 		}
+		data[k] = v
 	}
 
-	msg := struct {
-		Host      string
-		Timestamp string `json:"@timestamp"`
-		Message   string
-		Data      logrus.Fields
-		Level     string
-	}{
-		hook.host,
-		entry.Time.UTC().Format(time.RFC3339Nano),
-		entry.Message,
-		entry.Data,
-		strings.ToUpper(level),
+	doc := logDocument{
+		// Named when the entry is logged, so entries of the previous day
+		// queued past midnight still land in its index.
+		Index: hook.index(),
+		Source: logSource{
+			hook.host,
+			entry.Time.UTC().Format(time.RFC3339Nano),
+			entry.Message,
+			data,
+			strings.ToUpper(level),
+		},
 	}
 
-	_, err := hook.client.
-		Index().
-		Index(hook.index()).
-		Type("log").
-		BodyJson(msg).
-		Do(hook.ctx)
+	hook.mutex.RLock()
+	defer hook.mutex.RUnlock()
+	if hook.closed {
+		ES_HOOK_DROPPED.Inc()
+		return nil
+	}
+
+	select {
+	case hook.queue <- doc:
+		return nil
+	default:
+	}
 
-	return err
+	if hook.overflow == OVERFLOW_DROP_OLDEST {
+		select {
+		case <-hook.queue:
+		default:
+		}
+		select {
+		case hook.queue <- doc:
+		default:
+		}
+	}
+	ES_HOOK_DROPPED.Inc()
+	return nil
 }
 
 // Required for logrus
@@ -130,6 +294,44 @@ func (hook *ElasticHook) Levels() []logrus.Level {
 	return hook.levels
 }
 
+// Close stops queueing entries and indexes the ones already queued,
+// waiting at most until ctx is done.
+func (hook *ElasticHook) Close(ctx context.Context) error {
+	hook.mutex.Lock()
+	if hook.closed {
+		hook.mutex.Unlock()
+		return nil
+	}
+	hook.closed = true
+	close(hook.queue)
+	hook.mutex.Unlock()
+
+	select {
+	case <-hook.done:
+	case <-ctx.Done():
+		hook.Cancel()
+		return ctx.Err()
+	}
+
+	flushed := make(chan error, 1)
+	go func() {
+		if err := hook.processor.Flush(); err != nil {
+			flushed <- err
+			return
+		}
+		flushed <- hook.processor.Close()
+	}()
+
+	select {
+	case err := <-flushed:
+		hook.Cancel()
+		return err
+	case <-ctx.Done():
+		hook.Cancel()
+		return ctx.Err()
+	}
+}
+
 // Cancels all calls to
 // elastic
 func (hook *ElasticHook) Cancel() {
@@ -0,0 +1,131 @@
+package log
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/olivere/elastic"
+)
+
+type fakeProcessor struct {
+	mutex   sync.Mutex
+	added   []elastic.BulkableRequest
+	blocked chan struct{}
+	flushed bool
+	closed  bool
+}
+
+func (p *fakeProcessor) Add(req elastic.BulkableRequest) {
+	if p.blocked != nil {
+		<-p.blocked
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.added = append(p.added, req)
+}
+
+func (p *fakeProcessor) Flush() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.flushed = true
+	return nil
+}
+
+func (p *fakeProcessor) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	return nil
+}
+
+func testHook(queueSize int, overflow string, processor *fakeProcessor) *ElasticHook {
+	hook := newElasticHook("test", logrus.DebugLevel, DailyIndexName("logstash"),
+		ElasticHookOptions{QueueSize: queueSize, Overflow: overflow})
+	hook.start(processor)
+	return hook
+}
+
+func entry(msg string) *logrus.Entry {
+	return &logrus.Entry{Message: msg, Data: logrus.Fields{}, Time: time.Now(), Level: logrus.InfoLevel}
+}
+
+func TestElasticHookFlushesOnClose(t *testing.T) {
+	processor := &fakeProcessor{}
+	hook := testHook(10, OVERFLOW_DROP_NEWEST, processor)
+
+	for i := 0; i < 5; i++ {
+		if err := hook.Fire(entry("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hook.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(processor.added) != 5 || !processor.flushed || !processor.closed {
+		t.Errorf("expected 5 flushed entries, got %d (flushed %v, closed %v)",
+			len(processor.added), processor.flushed, processor.closed)
+	}
+
+	dropped := ES_HOOK_DROPPED.Value()
+	hook.Fire(entry("too late"))
+	if ES_HOOK_DROPPED.Value() != dropped+1 {
+		t.Error("expected entries fired after close to be dropped")
+	}
+}
+
+func TestElasticHookNeverBlocks(t *testing.T) {
+	processor := &fakeProcessor{blocked: make(chan struct{})}
+	hook := testHook(2, OVERFLOW_DROP_NEWEST, processor)
+	dropped := ES_HOOK_DROPPED.Value()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			hook.Fire(entry("hello"))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Fire not to wait on a stuck processor")
+	}
+	// One entry is held by the stuck processor and two are queued.
+	if ES_HOOK_DROPPED.Value()-dropped < 7 {
+		t.Errorf("expected at least 7 dropped entries, got %v", ES_HOOK_DROPPED.Value()-dropped)
+	}
+
+	close(processor.blocked)
+	hook.Close(context.Background())
+}
+
+func TestElasticHookDropOldest(t *testing.T) {
+	processor := &fakeProcessor{blocked: make(chan struct{})}
+	hook := testHook(1, OVERFLOW_DROP_OLDEST, processor)
+
+	hook.Fire(entry("held by the processor"))
+	time.Sleep(10 * time.Millisecond)
+	hook.Fire(entry("old"))
+	hook.Fire(entry("new"))
+
+	queued := <-hook.queue
+	if queued.Source.Message != "new" {
+		t.Errorf("expected the newest entry to be queued, got %s", queued.Source.Message)
+	}
+
+	close(processor.blocked)
+	hook.Close(context.Background())
+}
+
+func TestDailyIndexName(t *testing.T) {
+	name := DailyIndexName("logstash")()
+	if !regexp.MustCompile(`^logstash-\d{4}\.\d{2}\.\d{2}$`).MatchString(name) {
+		t.Errorf("unexpected index name %s", name)
+	}
+}
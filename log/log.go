@@ -3,8 +3,11 @@ package log
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/brunoksato/golang-boilerplate/config"
 	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/i18n"
 	"github.com/labstack/echo/v4"
 )
 
@@ -25,12 +28,56 @@ func AddNotFoundError(c echo.Context, code int, message string) error {
 	return c.JSON(http.StatusNotFound, map[string]interface{}{"code": code, "message": message})
 }
 
+func AddPreconditionFailedError(c echo.Context, code int, message string) error {
+	return c.JSON(http.StatusPreconditionFailed, map[string]interface{}{"code": code, "message": message})
+}
+
 func AddServerError(c echo.Context, code int, message string) error {
 	return c.JSON(http.StatusInternalServerError, map[string]interface{}{"code": code, "message": message})
 }
 
+func StatusForError(errModel core.DefaultError) int {
+	switch errModel.Code() {
+	case core.ERROR_CODE_WARNING:
+		return http.StatusOK
+	case core.ERROR_CODE_BUSINESS_ERROR:
+		return http.StatusBadRequest
+	case core.ERROR_CODE_AUTHENTICATION_ERROR:
+		return http.StatusUnauthorized
+	case core.ERROR_CODE_PERMISSION_ERROR:
+		return http.StatusForbidden
+	case core.ERROR_CODE_NOT_FOUND:
+		return http.StatusNotFound
+	case core.ERROR_CODE_PRECONDITION_FAILED:
+		return http.StatusPreconditionFailed
+	case core.ERROR_CODE_UNPROCESSABLE:
+		return http.StatusUnprocessableEntity
+	case core.ERROR_CODE_SERVICE_UNAVAILABLE:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func ErrorPayload(errModel core.DefaultError) map[string]interface{} {
+	return LocalizedErrorPayload(errModel, i18n.SOURCE_LANGUAGE)
+}
+
+// LocalizedErrorPayload is the {"code", "message"} body of errModel with its
+// messages in lang.
+func LocalizedErrorPayload(errModel core.DefaultError, lang string) map[string]interface{} {
+	code := errModel.Code()
+	if errModel.Subcode() != 0 {
+		code = errModel.Subcode()
+	}
+	payload := map[string]interface{}{"code": code, "message": LocalizedMessage(errModel, lang)}
+	if errs := LocalizedFieldErrors(errModel, lang); len(errs) > 0 {
+		payload["errors"] = errs
+	}
+	return payload
+}
+
 func AddDefaultError(c echo.Context, errModel core.DefaultError) error {
-	var err error
 	msg := fmt.Sprintf("%s (caller: %s)", errModel.Error(), errModel.Location())
 
 	code := errModel.Code()
@@ -38,29 +85,91 @@ func AddDefaultError(c echo.Context, errModel core.DefaultError) error {
 		code = errModel.Subcode()
 	}
 
+	c.Set("ErrorCode", errModel.Code())
+	c.Set("ErrorSubcode", errModel.Subcode())
+
 	params := errModel.Data()
 	params["code"] = errModel.Code()
 	params["subcode"] = errModel.Subcode()
 
 	logger := LoggerForParams(c, params)
+	ERRORS.Inc(strconv.Itoa(errModel.Code()), strconv.Itoa(errModel.Subcode()))
 
 	switch errModel.Code() {
 	case 300:
 		logger.Warning("Warning: " + msg)
-		err = AddPayloadWarning(c, code, errModel.Error())
+		return AddPayloadWarning(c, code, errModel.Error())
 	case 400:
 		logger.Info("Business Error: " + msg)
-		err = AddPayloadError(c, code, errModel.Error())
+	case 401:
+		logger.Info("Authentication Error: " + msg)
 	case 403:
 		logger.Warning("Permission Error: " + msg)
-		err = AddPermissionError(c, code, errModel.Error())
 	case 404:
 		logger.Info("Not Found: " + msg)
-		err = AddNotFoundError(c, code, errModel.Error())
+	case 412:
+		logger.Info("Precondition Failed: " + msg)
+	case 422:
+		logger.Info("Unprocessable: " + msg)
+	case 503:
+		logger.Warning("Service Unavailable: " + msg)
 	default:
 		logger.Error("Server Error: " + msg)
-		err = AddServerError(c, code, errModel.Error())
 	}
 
-	return err
+	return WriteError(c, errModel)
+}
+
+// WriteError renders errModel in the language of the request, as an RFC 7807
+// problem when the client accepts application/problem+json.
+func WriteError(c echo.Context, errModel core.DefaultError) error {
+	lang := Language(c)
+	c.Response().Header().Add(echo.HeaderVary, "Accept-Language")
+
+	status := StatusForError(errModel)
+	if AcceptsProblem(c) {
+		c.Response().Header().Set(echo.HeaderContentType, PROBLEM_CONTENT_TYPE)
+		return c.JSON(status, NewProblem(errModel, lang, c.Request().URL.Path, config.FromContext(c).Server.ProblemTypeBaseURL))
+	}
+	return c.JSON(status, LocalizedErrorPayload(errModel, lang))
+}
+
+// Language is the language negotiated from the Accept-Language header of
+// the request.
+func Language(c echo.Context) string {
+	if lang, ok := c.Get("Language").(string); ok {
+		return lang
+	}
+	lang := i18n.Negotiate(c.Request().Header.Get("Accept-Language"), config.FromContext(c).Server.DefaultLanguage)
+	c.Set("Language", lang)
+	return lang
+}
+
+// LocalizedMessage translates the message of errModel. Validation errors
+// are rebuilt from their translated fields.
+func LocalizedMessage(errModel core.DefaultError, lang string) string {
+	errs := LocalizedFieldErrors(errModel, lang)
+	if len(errs) == 0 || lang == i18n.SOURCE_LANGUAGE {
+		return i18n.Translate(lang, errModel.Subcode(), errModel.Error())
+	}
+
+	msg := ""
+	for _, fe := range errs {
+		msg = fmt.Sprintf("%s%s: %s;", msg, fe.Field, fe.Message)
+	}
+	return msg
+}
+
+func LocalizedFieldErrors(errModel core.DefaultError, lang string) []core.FieldError {
+	errs := core.FieldErrors(errModel)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	localized := make([]core.FieldError, len(errs))
+	for i, fe := range errs {
+		fe.Message = i18n.Translate(lang, fe.Subcode, fe.Message)
+		localized[i] = fe
+	}
+	return localized
 }
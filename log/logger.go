@@ -18,19 +18,21 @@ func LoggerForParams(c echo.Context, params map[string]interface{}) *logrus.Entr
 		}
 	}
 
-	var user model.User
-	if c.Get("User") != nil {
-		user = c.Get("User").(model.User)
+	if user, ok := c.Get("User").(model.User); ok {
 		fields["id-u"] = user.ID
 	} else {
 		fields["id-u"] = 0
 	}
 
-	fields["@application"] = c.Get("AppName").(string)
-	fields["id-req"] = c.Get("RequestID").(string)
-	fields["method"] = c.Get("Method").(string)
-	fields["endpoint"] = c.Get("Endpoint").(string)
-	fields["path"] = c.Get("Path").(string)
+	fields["@application"], _ = c.Get("AppName").(string)
+	fields["id-req"], _ = c.Get("RequestID").(string)
+	fields["method"], _ = c.Get("Method").(string)
+	fields["endpoint"], _ = c.Get("Endpoint").(string)
+	fields["path"], _ = c.Get("Path").(string)
+	if traceID, ok := c.Get("TraceID").(string); ok {
+		fields["id-trace"] = traceID
+		fields["id-span"] = c.Get("SpanID")
+	}
 
 	if fields["system"] == nil {
 		fields["system"] = "api"
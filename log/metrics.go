@@ -0,0 +1,10 @@
+package log
+
+import "github.com/brunoksato/golang-boilerplate/metrics"
+
+var ERRORS = metrics.NewCounter("api_errors_total",
+	"Errors returned by AddDefaultError, by code and subcode.", "code", "subcode")
+var ES_HOOK_FAILURES = metrics.NewCounter("log_elasticsearch_failures_total",
+	"Log entries the Elasticsearch hook failed to index.")
+var ES_HOOK_DROPPED = metrics.NewCounter("log_elasticsearch_dropped_total",
+	"Log entries the Elasticsearch hook dropped because its queue was full or closed.")
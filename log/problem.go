@@ -0,0 +1,77 @@
+package log
+
+import (
+	"strings"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/i18n"
+	"github.com/labstack/echo/v4"
+)
+
+const PROBLEM_CONTENT_TYPE = "application/problem+json"
+const DEFAULT_PROBLEM_TYPE_BASE_URL = "/problems/"
+
+// Problem is an RFC 7807 problem detail. Code, Subcode and Errors are
+// extension members carrying what the plain error body carries.
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     int               `json:"code"`
+	Subcode  int               `json:"subcode,omitempty"`
+	Errors   []core.FieldError `json:"errors,omitempty"`
+}
+
+// NewProblem describes errModel in lang, with a type URI under typeBase.
+func NewProblem(errModel core.DefaultError, lang, instance, typeBase string) Problem {
+	title, _ := i18n.Message(lang, problemCode(errModel))
+	return Problem{
+		Type:     ProblemType(errModel, typeBase),
+		Title:    title,
+		Status:   StatusForError(errModel),
+		Detail:   LocalizedMessage(errModel, lang),
+		Instance: instance,
+		Code:     errModel.Code(),
+		Subcode:  errModel.Subcode(),
+		Errors:   LocalizedFieldErrors(errModel, lang),
+	}
+}
+
+// AcceptsProblem reports whether the client asked for problem details.
+func AcceptsProblem(c echo.Context) bool {
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), PROBLEM_CONTENT_TYPE)
+}
+
+// ProblemType is the stable type URI of errModel under base, named after
+// its subcode, or after its code when the subcode is undefined, e.g.
+// /problems/email-format.
+func ProblemType(errModel core.DefaultError, base string) string {
+	if base == "" {
+		base = DEFAULT_PROBLEM_TYPE_BASE_URL
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+
+	code := problemCode(errModel)
+	name, ok := core.ERROR_SUBCODE_NAMES[code]
+	if !ok {
+		name = core.ERROR_CODE_NAMES[code]
+	}
+	return base + strings.ToLower(strings.Replace(name, "_", "-", -1))
+}
+
+// problemCode is the subcode of errModel, or its code when the subcode
+// says nothing about the problem.
+func problemCode(errModel core.DefaultError) int {
+	switch errModel.Subcode() {
+	case 0, core.ERROR_SUBCODE_UNDEFINED, core.ERROR_SUBCODE_UNDEFINED_IGNORE:
+		return errModel.Code()
+	}
+	if _, ok := core.ERROR_SUBCODE_NAMES[errModel.Subcode()]; !ok {
+		return errModel.Code()
+	}
+	return errModel.Subcode()
+}
@@ -0,0 +1,32 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var closers []func(context.Context) error
+var closersMutex sync.Mutex
+
+// OnShutdown registers f to release a sink, like flushing a hook, when the
+// server stops.
+func OnShutdown(f func(context.Context) error) {
+	closersMutex.Lock()
+	defer closersMutex.Unlock()
+	closers = append(closers, f)
+}
+
+// Shutdown runs the functions given to OnShutdown, latest first.
+func Shutdown(ctx context.Context) {
+	closersMutex.Lock()
+	pending := closers
+	closers = nil
+	closersMutex.Unlock()
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		if err := pending[i](ctx); err != nil {
+			fmt.Println("Error shutting down logging:", err.Error())
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package log
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Sink is a destination of log entries, like stdout, a file or
+// ElasticSearch. The dispatcher decides which entries reach it.
+type Sink interface {
+	Write(entry *logrus.Entry) error
+}
+
+// WriterSink formats entries onto a writer.
+type WriterSink struct {
+	Formatter logrus.Formatter
+	Writer    io.Writer
+
+	mutex sync.Mutex
+}
+
+func NewWriterSink(formatter logrus.Formatter, writer io.Writer) *WriterSink {
+	return &WriterSink{Formatter: formatter, Writer: writer}
+}
+
+func (s *WriterSink) Write(entry *logrus.Entry) error {
+	b, err := s.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.Writer.Write(b)
+	return err
+}
+
+// Close closes the writer, when it can be closed.
+func (s *WriterSink) Close(ctx context.Context) error {
+	if closer, ok := s.Writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Write queues entry, the hook doubles as a sink.
+func (hook *ElasticHook) Write(entry *logrus.Entry) error {
+	return hook.Fire(entry)
+}
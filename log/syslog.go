@@ -0,0 +1,64 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package log
+
+import (
+	"context"
+	"log/syslog"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// SyslogSink sends entries to syslog with the severity of their level.
+type SyslogSink struct {
+	Formatter logrus.Formatter
+	writer    *syslog.Writer
+}
+
+// NewSyslogSink dials address, like udp://logs.example.com:514, or the
+// local syslog when it is empty.
+func NewSyslogSink(address string, tag string, formatter logrus.Formatter) (*SyslogSink, error) {
+	network, raddr := "", ""
+	if address != "" {
+		parts := strings.SplitN(address, "://", 2)
+		network, raddr = "udp", parts[0]
+		if len(parts) == 2 {
+			network, raddr = parts[0], parts[1]
+		}
+	}
+
+	writer, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{Formatter: formatter, writer: writer}, nil
+}
+
+func (s *SyslogSink) Write(entry *logrus.Entry) error {
+	b, err := s.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	line := string(b)
+
+	switch entry.Level {
+	case logrus.PanicLevel:
+		return s.writer.Crit(line)
+	case logrus.FatalLevel:
+		return s.writer.Crit(line)
+	case logrus.ErrorLevel:
+		return s.writer.Err(line)
+	case logrus.WarnLevel:
+		return s.writer.Warning(line)
+	case logrus.InfoLevel:
+		return s.writer.Info(line)
+	default:
+		return s.writer.Debug(line)
+	}
+}
+
+func (s *SyslogSink) Close(ctx context.Context) error {
+	return s.writer.Close()
+}
@@ -0,0 +1,25 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package log
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Sirupsen/logrus"
+)
+
+type SyslogSink struct{}
+
+func NewSyslogSink(address string, tag string, formatter logrus.Formatter) (*SyslogSink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+func (s *SyslogSink) Write(entry *logrus.Entry) error {
+	return nil
+}
+
+func (s *SyslogSink) Close(ctx context.Context) error {
+	return nil
+}
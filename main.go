@@ -2,30 +2,68 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/log"
 	"github.com/brunoksato/golang-boilerplate/server"
+	"github.com/brunoksato/golang-boilerplate/tracing"
 	_ "github.com/heroku/x/hmetrics/onload"
 )
 
 func main() {
-	server := server.Start()
-	addr := ":" + os.Getenv("PORT")
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "print" {
+		printConfig(os.Args[3:])
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	root := server.Start(cfg)
+	addr := ":" + strconv.Itoa(cfg.Server.Port)
 
 	go func() {
-		if err := server.Start(addr); err != nil {
-			server.Logger.Info("shutting down the server")
+		if err := root.Start(addr); err != nil {
+			root.Logger.Info("shutting down the server")
 		}
 	}()
 
-	quit := make(chan os.Signal)
-	signal.Notify(quit, os.Interrupt)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
+
+	// Fail readiness first and keep serving for a while, so the load
+	// balancer stops routing here before connections are refused.
+	server.StartShutdown()
+	time.Sleep(server.ShutdownDelay())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		server.Logger.Fatal(err)
+	if err := root.Shutdown(ctx); err != nil {
+		root.Logger.Fatal(err)
+	}
+	tracing.Shutdown(ctx)
+	log.Shutdown(ctx)
+}
+
+// printConfig writes the configuration in effect, with secrets redacted,
+// and fails if it would not start the server.
+func printConfig(args []string) {
+	cfg, err := config.Load(args)
+	if cfg != nil {
+		cfg.Print(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,27 @@
+package metrics
+
+import "database/sql"
+
+var DB_OPEN_CONNECTIONS = NewGauge("db_open_connections", "Open connections, in use and idle.", "pool")
+var DB_IN_USE_CONNECTIONS = NewGauge("db_in_use_connections", "Connections in use.", "pool")
+var DB_IDLE_CONNECTIONS = NewGauge("db_idle_connections", "Idle connections.", "pool")
+var DB_MAX_OPEN_CONNECTIONS = NewGauge("db_max_open_connections", "Maximum number of open connections.", "pool")
+var DB_WAIT_COUNT = NewCounter("db_wait_count_total", "Connections waited for.", "pool")
+var DB_WAIT_DURATION = NewCounter("db_wait_duration_seconds_total", "Time spent waiting for a connection.", "pool")
+var DB_MAX_IDLE_CLOSED = NewCounter("db_max_idle_closed_total", "Connections closed because of the idle limit.", "pool")
+var DB_MAX_LIFETIME_CLOSED = NewCounter("db_max_lifetime_closed_total", "Connections closed because of their maximum lifetime.", "pool")
+var DB_BREAKER_OPEN = NewGauge("db_breaker_open", "Whether the circuit breaker of a pool is open, 1 or 0.", "pool")
+var DB_REPLICA_HEALTHY = NewGauge("db_replica_healthy", "Whether a read replica is in rotation, 1 or 0.", "pool")
+
+// ObserveDBStats exposes the sql.DBStats of db under the pool label. They
+// are read on every scrape.
+func ObserveDBStats(pool string, db *sql.DB) {
+	DB_OPEN_CONNECTIONS.Func(func() float64 { return float64(db.Stats().OpenConnections) }, pool)
+	DB_IN_USE_CONNECTIONS.Func(func() float64 { return float64(db.Stats().InUse) }, pool)
+	DB_IDLE_CONNECTIONS.Func(func() float64 { return float64(db.Stats().Idle) }, pool)
+	DB_MAX_OPEN_CONNECTIONS.Func(func() float64 { return float64(db.Stats().MaxOpenConnections) }, pool)
+	DB_WAIT_COUNT.Func(func() float64 { return float64(db.Stats().WaitCount) }, pool)
+	DB_WAIT_DURATION.Func(func() float64 { return db.Stats().WaitDuration.Seconds() }, pool)
+	DB_MAX_IDLE_CLOSED.Func(func() float64 { return float64(db.Stats().MaxIdleClosed) }, pool)
+	DB_MAX_LIFETIME_CLOSED.Func(func() float64 { return float64(db.Stats().MaxLifetimeClosed) }, pool)
+}
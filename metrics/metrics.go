@@ -0,0 +1,374 @@
+// Package metrics keeps counters, gauges and histograms and renders them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const TEXT_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// DEFAULT_BUCKETS suit request latencies in seconds.
+var DEFAULT_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metric is a family of series sharing a name and label names.
+type Metric interface {
+	Name() string
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mutex   sync.RWMutex
+	metrics map[string]Metric
+}
+
+// REGISTRY is what /metrics exposes. Domain code adds its counters to it
+// with NewCounter and friends.
+var REGISTRY = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]Metric{}}
+}
+
+// Register adds m to the registry. Names are unique.
+func (r *Registry) Register(m Metric) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.metrics[m.Name()]; ok {
+		return fmt.Errorf("metric %s is already registered", m.Name())
+	}
+	r.metrics[m.Name()] = m
+	return nil
+}
+
+func (r *Registry) MustRegister(m Metric) {
+	if err := r.Register(m); err != nil {
+		panic(err)
+	}
+}
+
+// Get returns the metric registered under name, if any.
+func (r *Registry) Get(name string) Metric {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.metrics[name]
+}
+
+// WriteText renders every metric, sorted by name.
+func (r *Registry) WriteText(out io.Writer) error {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]Metric, len(names))
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	r.mutex.RUnlock()
+
+	w := bufio.NewWriter(out)
+	for _, m := range metrics {
+		m.write(w)
+	}
+	return w.Flush()
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := newCounter(name, help, labels)
+	REGISTRY.MustRegister(c)
+	return c
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := newGauge(name, help, labels)
+	REGISTRY.MustRegister(g)
+	return g
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := newHistogram(name, help, buckets, labels)
+	REGISTRY.MustRegister(h)
+	return h
+}
+
+// desc holds what every kind of metric has in common.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) Name() string {
+	return d.name
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s takes %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// line renders the name and label set of a sample, extra being appended as is,
+// like le for histogram buckets.
+func (d desc) line(suffix string, values []string, extra string) string {
+	pairs := []string{}
+	for i, label := range d.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, escapeLabel(values[i])))
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return d.name + suffix
+	}
+	return d.name + suffix + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// scalar is a value that is either kept or read from a function on every
+// scrape.
+type scalar struct {
+	values []string
+	value  float64
+	fn     func() float64
+}
+
+func (s *scalar) get() float64 {
+	if s.fn != nil {
+		return s.fn()
+	}
+	return s.value
+}
+
+// scalars backs counters and gauges.
+type scalars struct {
+	desc
+	mutex  sync.Mutex
+	series map[string]*scalar
+}
+
+func (s *scalars) at(values []string) *scalar {
+	key := s.key(values)
+	v, ok := s.series[key]
+	if !ok {
+		v = &scalar{values: append([]string{}, values...)}
+		s.series[key] = v
+	}
+	return v
+}
+
+func (s *scalars) add(delta float64, values []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.at(values).value += delta
+}
+
+func (s *scalars) set(value float64, values []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.at(values).value = value
+}
+
+func (s *scalars) setFunc(fn func() float64, values []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.at(values).fn = fn
+}
+
+func (s *scalars) value(values []string) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if v, ok := s.series[s.key(values)]; ok {
+		return v.get()
+	}
+	return 0
+}
+
+func (s *scalars) write(w *bufio.Writer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := make([]string, 0, len(s.series))
+	for key := range s.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	s.writeHeader(w)
+	for _, key := range keys {
+		sample := s.series[key]
+		fmt.Fprintf(w, "%s %s\n", s.line("", sample.values, ""), formatFloat(sample.get()))
+	}
+}
+
+// Counter only goes up. A counter without labels is reported as 0 before
+// its first increment.
+type Counter struct {
+	scalars
+}
+
+func newCounter(name, help string, labels []string) *Counter {
+	c := &Counter{scalars{desc: desc{name, help, "counter", labels}, series: map[string]*scalar{}}}
+	if len(labels) == 0 {
+		c.at(nil)
+	}
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// Add increments the counter by delta, which must not be negative.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.name))
+	}
+	c.add(delta, labelValues)
+}
+
+// Func reads the counter from fn on every scrape, for totals kept
+// elsewhere.
+func (c *Counter) Func(fn func() float64, labelValues ...string) {
+	c.setFunc(fn, labelValues)
+}
+
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.value(labelValues)
+}
+
+// Gauge goes up and down.
+type Gauge struct {
+	scalars
+}
+
+func newGauge(name, help string, labels []string) *Gauge {
+	return &Gauge{scalars{desc: desc{name, help, "gauge", labels}, series: map[string]*scalar{}}}
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.set(value, labelValues)
+}
+
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.add(delta, labelValues)
+}
+
+// Func reads the gauge from fn on every scrape.
+func (g *Gauge) Func(fn func() float64, labelValues ...string) {
+	g.setFunc(fn, labelValues)
+}
+
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.value(labelValues)
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(name, help string, buckets []float64, labels []string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DEFAULT_BUCKETS
+	}
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		desc:    desc{name, help, "histogram", labels},
+		buckets: sorted,
+		series:  map[string]*histogramSeries{},
+	}
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: append([]string{}, labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// Count is the number of observations of a series.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if s, ok := h.series[h.key(labelValues)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h.writeHeader(w)
+	for _, key := range keys {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s %d\n", h.line("_bucket", s.values, `le="`+formatFloat(bound)+`"`), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s %d\n", h.line("_bucket", s.values, `le="+Inf"`), s.count)
+		fmt.Fprintf(w, "%s %s\n", h.line("_sum", s.values, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s %d\n", h.line("_count", s.values, ""), s.count)
+	}
+}
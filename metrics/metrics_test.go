@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := newCounter("requests_total", "Requests.", []string{"route", "status"})
+	r.MustRegister(requests)
+	temperature := newGauge("temperature", "Temperature.", nil)
+	r.MustRegister(temperature)
+
+	requests.Inc("/users", "200")
+	requests.Add(2, "/users", "200")
+	requests.Inc(`/a"b`, "500")
+	temperature.Set(21.5)
+
+	out := &bytes.Buffer{}
+	if err := r.WriteText(out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="/a\"b",status="500"} 1
+requests_total{route="/users",status="200"} 3
+# HELP temperature Temperature.
+# TYPE temperature gauge
+temperature 21.5
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	latency := newHistogram("latency_seconds", "Latency.", []float64{1, 0.1}, []string{"route"})
+	r.MustRegister(latency)
+
+	latency.Observe(0.05, "/")
+	latency.Observe(0.5, "/")
+	latency.Observe(3, "/")
+
+	out := &bytes.Buffer{}
+	r.WriteText(out)
+
+	expected := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/",le="0.1"} 1
+latency_seconds_bucket{route="/",le="1"} 2
+latency_seconds_bucket{route="/",le="+Inf"} 3
+latency_seconds_sum{route="/"} 3.55
+latency_seconds_count{route="/"} 3
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+	if latency.Count("/") != 3 {
+		t.Errorf("expected 3 observations, got %d", latency.Count("/"))
+	}
+}
+
+func TestFuncIsReadOnScrape(t *testing.T) {
+	g := newGauge("open_connections", "Open connections.", []string{"pool"})
+	n := 1.0
+	g.Func(func() float64 { return n }, "rw")
+
+	n = 7
+	if g.Value("rw") != 7 {
+		t.Errorf("expected 7, got %v", g.Value("rw"))
+	}
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(newCounter("signups_total", "Signups.", nil))
+	if err := r.Register(newCounter("signups_total", "Signups.", nil)); err == nil {
+		t.Error("expected registering the same name twice to fail")
+	}
+}
+
+func TestCounterRejectsWrongLabels(t *testing.T) {
+	c := newCounter("logins_total", "Logins.", []string{"result"})
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a missing label value")
+		}
+	}()
+	c.Inc()
+}
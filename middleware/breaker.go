@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/log"
+	"github.com/brunoksato/golang-boilerplate/metrics"
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+)
+
+const BREAKER_CLOSED = "closed"
+const BREAKER_OPEN = "open"
+const BREAKER_HALF_OPEN = "half-open"
+
+// Breaker is a circuit breaker around a database pool. Threshold
+// connection errors in a row open it and requests fail fast instead of
+// waiting on a database that is down. After Cooldown one request probes
+// the database and closes it again if the probe succeeds.
+type Breaker struct {
+	Name      string
+	Threshold int
+	Cooldown  time.Duration
+	Probe     func(ctx context.Context) error
+
+	state    string
+	failures int
+	openedAt time.Time
+	mutex    sync.Mutex
+}
+
+// NewBreaker returns a closed breaker probing db with a ping.
+func NewBreaker(name string, db *gorm.DB, threshold int, cooldown time.Duration) *Breaker {
+	b := &Breaker{
+		Name:      name,
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		Probe: func(ctx context.Context) error {
+			return db.DB().PingContext(ctx)
+		},
+		state: BREAKER_CLOSED,
+	}
+	metrics.DB_BREAKER_OPEN.Set(0, name)
+	return b
+}
+
+func (b *Breaker) State() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+// Allow tells whether a request may use the database. Once the cooldown
+// is over the first caller runs the probe, the others keep failing fast
+// until it is done.
+func (b *Breaker) Allow(ctx context.Context) bool {
+	b.mutex.Lock()
+	if b.state == BREAKER_CLOSED {
+		b.mutex.Unlock()
+		return true
+	}
+	if b.state == BREAKER_HALF_OPEN || time.Since(b.openedAt) < b.Cooldown {
+		b.mutex.Unlock()
+		return false
+	}
+	b.state = BREAKER_HALF_OPEN
+	b.mutex.Unlock()
+
+	if err := b.Probe(ctx); err != nil {
+		b.Failure(err)
+		return false
+	}
+	b.Success()
+	return true
+}
+
+// Success closes the breaker.
+func (b *Breaker) Success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state != BREAKER_CLOSED {
+		b.logger().Info("Database is back, closing the circuit breaker")
+		metrics.DB_BREAKER_OPEN.Set(0, b.Name)
+	}
+	b.state = BREAKER_CLOSED
+	b.failures = 0
+}
+
+// Failure counts a connection error. A failed probe opens the breaker
+// again right away.
+func (b *Breaker) Failure(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures++
+	if b.state == BREAKER_HALF_OPEN || (b.state == BREAKER_CLOSED && b.failures >= b.Threshold) {
+		b.open(err)
+	}
+}
+
+// Trip opens the breaker, e.g. when the database is down at startup.
+func (b *Breaker) Trip(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.open(err)
+}
+
+func (b *Breaker) open(err error) {
+	if b.state == BREAKER_CLOSED {
+		b.logger().Error("Database is unavailable, opening the circuit breaker: " + err.Error())
+	}
+	b.state = BREAKER_OPEN
+	b.openedAt = time.Now()
+	metrics.DB_BREAKER_OPEN.Set(1, b.Name)
+}
+
+// RegisterCallbacks makes every query of db count as a success or, when
+// the database could not be reached, a failure.
+func (b *Breaker) RegisterCallbacks(db *gorm.DB) {
+	callback := db.Callback()
+	callback.Create().After("gorm:create").Register("breaker:after_create", b.afterQuery)
+	callback.Query().After("gorm:query").Register("breaker:after_query", b.afterQuery)
+	callback.Update().After("gorm:update").Register("breaker:after_update", b.afterQuery)
+	callback.Delete().After("gorm:delete").Register("breaker:after_delete", b.afterQuery)
+	callback.RowQuery().After("gorm:row_query").Register("breaker:after_row_query", b.afterQuery)
+}
+
+func (b *Breaker) afterQuery(scope *gorm.Scope) {
+	err := scope.DB().Error
+	if core.IsConnectionError(err) {
+		b.Failure(err)
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == BREAKER_CLOSED {
+		b.failures = 0
+	}
+}
+
+func (b *Breaker) logger() *logrus.Entry {
+	return logrus.WithFields(logrus.Fields{"system": "database", "pool": b.Name})
+}
+
+// DBBreaker answers 503 with ERROR_SUBCODE_DATABASE_UNAVAILABLE while the
+// breaker is open, and a Retry-After of its cooldown. Probes are let
+// through, /readyz reports the outage itself.
+func DBBreaker(b *Breaker) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !PROBE_PATHS[c.Path()] && !b.Allow(c.Request().Context()) {
+				c.Response().Header().Set("Retry-After", retryAfter(b.Cooldown))
+				return log.AddDefaultError(c, core.NewServiceUnavailableError("The database is unavailable", core.ERROR_SUBCODE_DATABASE_UNAVAILABLE))
+			}
+			return next(c)
+		}
+	}
+}
+
+func retryAfter(d time.Duration) string {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
@@ -0,0 +1,99 @@
+package middleware_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var faults = &core.FaultDriver{}
+
+func init() {
+	sql.Register("faulty", faults)
+}
+
+func newFaultyBreaker(t *testing.T) (*middle.Breaker, *gorm.DB) {
+	faults.SetDown(false)
+	sqlDB, err := sql.Open("faulty", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open("postgres", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	breaker := middle.NewBreaker("test", db, 2, 20*time.Millisecond)
+	breaker.RegisterCallbacks(db)
+	return breaker, db
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	breaker, db := newFaultyBreaker(t)
+	defer faults.SetDown(false)
+	ctx := context.Background()
+
+	faults.SetDown(true)
+	assert.Error(t, db.First(&model.User{}).Error)
+	assert.Equal(t, middle.BREAKER_CLOSED, breaker.State())
+	assert.Error(t, db.First(&model.User{}).Error)
+	assert.Equal(t, middle.BREAKER_OPEN, breaker.State())
+	assert.False(t, breaker.Allow(ctx))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, breaker.Allow(ctx), "the probe fails while the database is down")
+	assert.Equal(t, middle.BREAKER_OPEN, breaker.State())
+
+	faults.SetDown(false)
+	assert.False(t, breaker.Allow(ctx), "the probe waits for the cooldown")
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, breaker.Allow(ctx))
+	assert.Equal(t, middle.BREAKER_CLOSED, breaker.State())
+}
+
+func TestBreakerIgnoresQueryErrors(t *testing.T) {
+	breaker, db := newFaultyBreaker(t)
+
+	for i := 0; i < 3; i++ {
+		assert.Error(t, db.First(&model.User{}).Error)
+	}
+	assert.Equal(t, middle.BREAKER_CLOSED, breaker.State())
+}
+
+func TestDBBreakerMiddleware(t *testing.T) {
+	breaker, _ := newFaultyBreaker(t)
+	root := newRouter()
+	root.Use(middle.DBBreaker(breaker))
+	root.GET("/users", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	root.GET("/healthz", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	rw := httptest.NewRecorder()
+	root.ServeHTTP(rw, httptest.NewRequest("GET", "/users", nil))
+	assert.Equal(t, 200, rw.Code)
+
+	breaker.Trip(sql.ErrConnDone)
+
+	rw = httptest.NewRecorder()
+	root.ServeHTTP(rw, httptest.NewRequest("GET", "/users", nil))
+	assert.Equal(t, 503, rw.Code)
+	assert.Equal(t, "1", rw.Header().Get("Retry-After"))
+	body := core.JsonToMap(rw.Body.String())
+	assert.Equal(t, float64(core.ERROR_SUBCODE_DATABASE_UNAVAILABLE), body["code"])
+
+	rw = httptest.NewRecorder()
+	root.ServeHTTP(rw, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, 200, rw.Code)
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/labstack/echo/v4"
+)
+
+// Config hands cfg to the handlers of the request, see config.FromContext.
+func Config(cfg *config.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("Config", cfg)
+			return next(c)
+		}
+	}
+}
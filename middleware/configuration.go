@@ -1,17 +1,45 @@
 package middleware
 
 import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/brunoksato/golang-boilerplate/cache"
+	"github.com/brunoksato/golang-boilerplate/core"
 	"github.com/brunoksato/golang-boilerplate/model"
-	"github.com/jinzhu/gorm"
+	"github.com/brunoksato/golang-boilerplate/repository"
 	"github.com/labstack/echo/v4"
 )
 
+// PROBE_PATHS are polled by load balancers, orchestrators and scrapers. They answer
+// without loading the configuration, so a slow database can't stall them.
+var PROBE_PATHS = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/version": true,
+	"/metrics": true,
+}
+
+// LoadConfigurations sets the Configuration of the request, from the cache
+// while no one changed it.
 func LoadConfigurations(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		db := c.Get("Database").(*gorm.DB)
+		if PROBE_PATHS[c.Path()] {
+			return next(c)
+		}
+
+		repo := Repository(c)
 		config := model.Configuration{}
-		err := db.First(&config).Error
-		if err == nil {
+		store := cache.Default()
+		table := core.TableNameFor(reflect.TypeOf(config))
+		key := "configuration:" + cache.Generation(store, table)
+		value, err := cache.Fetch(store, key, config.CacheTTL(), func() ([]byte, error) {
+			if err := repo.First(&config, repository.Query{}); err != nil {
+				return nil, err
+			}
+			return json.Marshal(config)
+		})
+		if err == nil && json.Unmarshal(value, &config) == nil {
 			c.Set("Configuration", config)
 		}
 		return next(c)
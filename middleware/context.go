@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/olivere/elastic"
+)
+
+// The accessors below read what the middleware set on a request, with the
+// zero value when it is missing instead of a panic.
+
+// Database is the connection of the request, bound to its context so its
+// queries stop once the client goes away or the route times out.
+func Database(c echo.Context) *gorm.DB {
+	db, ok := c.Get("Database").(*gorm.DB)
+	if !ok || db == nil {
+		return nil
+	}
+	return core.WithContext(c.Request().Context(), db)
+}
+
+// Repository stores the models of the request: the one set on c under
+// "Repository", as tests do to run without a database, or else Database.
+func Repository(c echo.Context) repository.Repository {
+	if repo, ok := c.Get("Repository").(repository.Repository); ok && repo != nil {
+		return repo
+	}
+	return repository.NewGorm(Database(c))
+}
+
+func Elastic(c echo.Context) *elastic.Client {
+	es, _ := c.Get("Elastic").(*elastic.Client)
+	return es
+}
+
+// User is the signed in user, with a zero ID on public routes.
+func User(c echo.Context) model.User {
+	user, _ := c.Get("User").(model.User)
+	return user
+}
+
+func RequestID(c echo.Context) string {
+	id, _ := c.Get("RequestID").(string)
+	return id
+}
+
+func APIType(c echo.Context) core.APIType {
+	apiType, _ := c.Get("APIType").(core.APIType)
+	return apiType
+}
+
+func Configuration(c echo.Context) model.Configuration {
+	configuration, _ := c.Get("Configuration").(model.Configuration)
+	return configuration
+}
+
+// Types are the model of the route and its parent, nil when the route is
+// not about a model.
+func Types(c echo.Context) (t reflect.Type, parentType reflect.Type) {
+	t, _ = c.Get("Type").(reflect.Type)
+	parentType, _ = c.Get("ParentType").(reflect.Type)
+	return
+}
+
+// Timeout gives the request a deadline of d. Registered on the root it is
+// the default, on a route it replaces it, whether longer or shorter.
+func Timeout(d time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			base, ok := c.Get("BaseContext").(context.Context)
+			if !ok {
+				base = c.Request().Context()
+				c.Set("BaseContext", base)
+			}
+			ctx, cancel := context.WithTimeout(base, d)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
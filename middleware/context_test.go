@@ -0,0 +1,79 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessorsOnEmptyContext(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest("GET", "/", nil), httptest.NewRecorder())
+
+	assert.Nil(t, middle.Database(c))
+	assert.Nil(t, middle.Elastic(c))
+	assert.Equal(t, uint(0), middle.User(c).ID)
+	assert.Equal(t, "", middle.RequestID(c))
+	assert.Equal(t, core.APIType(""), middle.APIType(c))
+	typ, parentType := middle.Types(c)
+	assert.Nil(t, typ)
+	assert.Nil(t, parentType)
+	assert.IsType(t, &repository.Gorm{}, middle.Repository(c))
+
+	memory := repository.NewMemory()
+	c.Set("Repository", memory)
+	assert.Equal(t, memory, middle.Repository(c))
+}
+
+func TestRouteTimeoutReplacesDefault(t *testing.T) {
+	root := echo.New()
+	root.Use(middle.Timeout(time.Second))
+	root.Use(middle.Timeout(time.Second))
+	deadlines := make(chan time.Duration, 1)
+	handler := func(c echo.Context) error {
+		deadline, ok := c.Request().Context().Deadline()
+		assert.True(t, ok)
+		deadlines <- time.Until(deadline)
+		return c.NoContent(http.StatusOK)
+	}
+	root.GET("/default", handler)
+	root.GET("/long", handler, middle.Timeout(time.Hour))
+	root.GET("/short", handler, middle.Timeout(time.Millisecond))
+
+	root.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/default", nil))
+	d := <-deadlines
+	assert.True(t, d > 0 && d <= time.Second)
+
+	root.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/long", nil))
+	assert.True(t, <-deadlines > time.Minute)
+
+	root.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/short", nil))
+	assert.True(t, <-deadlines <= time.Millisecond)
+}
+
+func TestCancelledRequestStopsQueries(t *testing.T) {
+	breaker, db := newFaultyBreaker(t)
+	core.RegisterContextCallbacks(db)
+	defer faults.SetDown(false)
+	faults.SetDown(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		err := core.WithContext(ctx, db).First(&model.User{}).Error
+		assert.Equal(t, context.Canceled, err)
+	}
+	assert.Equal(t, middle.BREAKER_CLOSED, breaker.State(), "queries that never ran are no connection errors")
+
+	c := echo.New().NewContext(httptest.NewRequest("GET", "/", nil).WithContext(ctx), httptest.NewRecorder())
+	c.Set("Database", db)
+	assert.Equal(t, context.Canceled, middle.Database(c).First(&model.User{}).Error)
+}
@@ -1,7 +1,9 @@
 package middleware
 
 import (
-	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/brunoksato/golang-boilerplate/tracing"
 	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo/v4"
 )
@@ -9,13 +11,82 @@ import (
 func DBMiddleware(db *gorm.DB) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			if db == nil {
-				db = config.InitDB()
-			}
+			c.Set("Database", tracing.WithContext(c.Request().Context(), db))
+
+			return next(c)
+		}
+	}
+}
 
-			c.Set("Database", db)
+// RepositoryMiddleware stores the models of the requests in repo instead
+// of Database, as tests without a database do.
+func RepositoryMiddleware(repo repository.Repository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("Repository", repo)
 
 			return next(c)
 		}
 	}
 }
+
+// ReplicaDBMiddleware is DBMiddleware for a primary with read replicas.
+// Requests get the primary unless their route uses ReadReplica. A user's
+// successful writes make their reads stick to the primary for a while.
+func ReplicaDBMiddleware(replicas *Replicas) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("Database", tracing.WithContext(c.Request().Context(), replicas.Primary))
+			c.Set("Replicas", replicas)
+
+			err := next(c)
+			if err == nil && !readOnly(c.Request().Method) && c.Response().Status < 400 {
+				if user, ok := c.Get("User").(model.User); ok {
+					replicas.MarkWrite(user.ID)
+				}
+			}
+			return err
+		}
+	}
+}
+
+// ReadReplica gives a read-only route a replica connection. It goes after
+// Session, so the user's sticky window is known, and does nothing without
+// ReplicaDBMiddleware or once the handler chain called UsePrimary.
+func ReadReplica(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		replicas, ok := c.Get("Replicas").(*Replicas)
+		if ok && readOnly(c.Request().Method) && c.Get("ForcePrimary") == nil {
+			var userID uint
+			if user, ok := c.Get("User").(model.User); ok {
+				userID = user.ID
+			}
+			c.Set("Database", tracing.WithContext(c.Request().Context(), replicas.ReadFor(userID)))
+		}
+
+		return next(c)
+	}
+}
+
+// UsePrimary switches the request back to the primary, for handlers on a
+// ReadReplica route that must not read stale data. An api.Context already
+// built for the request is dropped, the next one gets the primary.
+func UsePrimary(c echo.Context) {
+	c.Set("ForcePrimary", true)
+	c.Set("Context", nil)
+	if replicas, ok := c.Get("Replicas").(*Replicas); ok {
+		c.Set("Database", tracing.WithContext(c.Request().Context(), replicas.Primary))
+	}
+}
+
+// Primary is UsePrimary as a route middleware.
+func Primary(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		UsePrimary(c)
+		return next(c)
+	}
+}
+
+func readOnly(method string) bool {
+	return method == echo.GET || method == echo.HEAD
+}
@@ -1,30 +1,42 @@
 package middleware
 
 import (
-	"net/http"
+	"crypto/subtle"
 
+	"github.com/brunoksato/golang-boilerplate/config"
 	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/log"
 	"github.com/labstack/echo/v4"
 )
 
+// API_TYPES maps the X-Company header to the API type of a request.
+var API_TYPES = map[string]core.APIType{
+	"Office":  core.USER_API,
+	"CronJob": core.CRONJOB_API,
+	"Admin":   core.ADMIN_API,
+}
+
 func SettingHeaders(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		xCompany := c.Request().Header.Get("X-Company")
-		switch xCompany {
-		case "Office":
-			c.Set("APIType", core.USER_API)
-		case "CronJob":
-			c.Set("APIType", core.CRONJOB_API)
-			cCronjob := c.Request().Header.Get("X-Cronjob")
-			if cCronjob != "youpassword" {
-				return echo.NewHTTPError(http.StatusUnauthorized)
+		apiType, ok := API_TYPES[c.Request().Header.Get("X-Company")]
+		if !ok {
+			return log.AddDefaultError(c, core.NewAuthenticationError("Missing or invalid X-Company header",
+				core.ERROR_SUBCODE_COMPANY_INVALID))
+		}
+		c.Set("APIType", apiType)
+
+		if apiType == core.CRONJOB_API {
+			if !validCronjobPassword(c) {
+				return log.AddDefaultError(c, core.NewAuthenticationError("Invalid cron job password",
+					core.ERROR_SUBCODE_CRONJOB_KEY_INVALID))
 			}
-		case "Admin":
-			c.Set("APIType", core.ADMIN_API)
-		default:
-			return echo.NewHTTPError(http.StatusUnauthorized)
 		}
 
 		return next(c)
 	}
 }
+
+func validCronjobPassword(c echo.Context) bool {
+	password := config.FromContext(c).Server.CronjobPassword
+	return subtle.ConstantTimeCompare([]byte(c.Request().Header.Get("X-Cronjob")), []byte(password)) == 1
+}
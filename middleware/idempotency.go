@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/log"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+)
+
+const IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+const IDEMPOTENCY_REPLAYED_HEADER = "Idempotent-Replayed"
+const IDEMPOTENCY_KEY_MAX_LENGTH = 255
+
+// IDEMPOTENCY_LOCK_TIMEOUT is how long a request without a deadline holds
+// its key before a retry may take it over.
+const IDEMPOTENCY_LOCK_TIMEOUT = time.Minute
+
+// IDEMPOTENCY_POLL_INTERVAL is how often a duplicate checks whether the
+// request holding its key is done.
+const IDEMPOTENCY_POLL_INTERVAL = 50 * time.Millisecond
+
+// Idempotency makes POST requests with an Idempotency-Key header safe to
+// retry. The first request with a key runs and its response is stored for
+// ttl; later ones with the same body get that response again, with an
+// Idempotent-Replayed header, and ones with another body a 422. Duplicates
+// arriving while the first runs wait for it. Keys belong to the signed in
+// user, so it goes after Session. Failed requests, 5xx or errors, keep no
+// response and can be retried.
+func Idempotency(ttl time.Duration, maxBytes int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(IDEMPOTENCY_KEY_HEADER)
+			if key == "" || c.Request().Method != echo.POST {
+				return next(c)
+			}
+			if len(key) > IDEMPOTENCY_KEY_MAX_LENGTH {
+				return log.AddDefaultError(c, core.NewBusinessError("Idempotency-Key is too long", core.ERROR_SUBCODE_IDEMPOTENCY_KEY_INVALID))
+			}
+
+			body, err := ioutil.ReadAll(io.LimitReader(c.Request().Body, maxBytes+1))
+			if err != nil {
+				return log.AddDefaultError(c, core.NewServerError(err.Error()))
+			}
+			if int64(len(body)) > maxBytes {
+				return log.AddDefaultError(c, core.NewBusinessError("The body is too large for an Idempotency-Key", core.ERROR_SUBCODE_IDEMPOTENCY_KEY_INVALID))
+			}
+			c.Request().Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			db := Database(c)
+			ctx := c.Request().Context()
+			now := time.Now()
+			lockedUntil := now.Add(IDEMPOTENCY_LOCK_TIMEOUT)
+			if deadline, ok := ctx.Deadline(); ok {
+				lockedUntil = deadline
+			}
+			record := &model.IdempotencyKey{
+				UserID:      User(c).ID,
+				Key:         key,
+				Fingerprint: fingerprint(c.Request(), body),
+				LockedUntil: lockedUntil,
+				ExpiresAt:   now.Add(ttl),
+			}
+
+			for {
+				claimed, existing, err := model.ClaimIdempotencyKey(db, record)
+				if err != nil {
+					if ctx.Err() != nil {
+						return idempotencyKeyInProgress(c)
+					}
+					return log.AddDefaultError(c, core.NewServerError(err.Error()))
+				}
+				if claimed {
+					break
+				}
+				if existing.Fingerprint != record.Fingerprint {
+					return log.AddDefaultError(c, core.NewUnprocessableError("The Idempotency-Key was already used for another request", core.ERROR_SUBCODE_IDEMPOTENCY_KEY_REUSED))
+				}
+				if existing.IsCompleted() {
+					c.Response().Header().Set(IDEMPOTENCY_REPLAYED_HEADER, "true")
+					return c.Blob(existing.Status, existing.ContentType, existing.Body)
+				}
+
+				select {
+				case <-ctx.Done():
+					return idempotencyKeyInProgress(c)
+				case <-time.After(IDEMPOTENCY_POLL_INTERVAL):
+				}
+			}
+
+			// The response is stored even when the request timed out.
+			store := core.WithContext(context.Background(), db)
+			recorder := &bodyRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			completed := false
+			defer func() {
+				if !completed {
+					if err := model.ReleaseIdempotencyKey(store, record); err != nil {
+						log.Logger(c).Error("Could not release the Idempotency-Key: " + err.Error())
+					}
+				}
+			}()
+
+			err = next(c)
+			status := c.Response().Status
+			if err != nil || status >= http.StatusInternalServerError {
+				return err
+			}
+			contentType := c.Response().Header().Get(echo.HeaderContentType)
+			if err := model.CompleteIdempotencyKey(store, record, status, contentType, recorder.body.Bytes()); err != nil {
+				log.Logger(c).Error("Could not store the Idempotency-Key response: " + err.Error())
+				return nil
+			}
+			completed = true
+			return nil
+		}
+	}
+}
+
+// PurgeIdempotencyKeys deletes the expired keys of db every interval until
+// ctx is done.
+func PurgeIdempotencyKeys(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := model.DeleteExpiredIdempotencyKeys(db, now)
+			if err != nil {
+				logrus.WithField("system", "database").Error("Could not purge Idempotency-Keys: " + err.Error())
+				continue
+			}
+			if n > 0 {
+				logrus.WithField("system", "database").Debugf("Purged %d expired Idempotency-Keys", n)
+			}
+		}
+	}
+}
+
+// fingerprint tells requests apart: the same key must come with the same
+// method, URL and body.
+func fingerprint(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, req.Method+" "+req.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func idempotencyKeyInProgress(c echo.Context) error {
+	c.Response().Header().Set("Retry-After", "1")
+	return log.AddDefaultError(c, core.NewServiceUnavailableError("A request with this Idempotency-Key is still running", core.ERROR_SUBCODE_IDEMPOTENCY_KEY_IN_PROGRESS))
+}
+
+// bodyRecorder keeps a copy of the body written to the client.
+type bodyRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
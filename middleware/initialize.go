@@ -2,27 +2,45 @@ package middleware
 
 import (
 	"fmt"
-	"os"
+	"regexp"
+	"time"
 
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/log"
 	"github.com/labstack/echo/v4"
 	uuid "github.com/satori/go.uuid"
 )
 
+// VALID_REQUEST_ID is what an incoming X-Request-ID must look like to be
+// kept, anything else gets a fresh UUID.
+var VALID_REQUEST_ID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
 func InitializePayload(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		newv4 := uuid.NewV4()
+		start := time.Now()
+		requestID := c.Request().Header.Get(echo.HeaderXRequestID)
+		if !VALID_REQUEST_ID.MatchString(requestID) {
+			requestID = uuid.NewV4().String()
+		}
+		c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+
 		c.Set("Payload", make(map[string]interface{}))
 		c.Set("Request", make(map[string]interface{}))
-		c.Set("AppName", fmt.Sprintf("%s-%s", os.Getenv("SERVER_NAME"), os.Getenv("SERVER_ENV")))
-		c.Set("RequestID", newv4.String())
+		cfg := config.FromContext(c)
+		c.Set("AppName", cfg.AppName())
+		c.Set("RequestID", requestID)
 		c.Set("Method", c.Request().Method)
 		c.Set("Endpoint", fmt.Sprintf("%s %s", c.Request().Method, c.Request().URL.Path))
-		c.Set("Path", c.Request().URL.String())
+		c.Set("Path", log.RedactURL(c.Request().URL, cfg.Log.AccessRedactParams))
 
-		//TODO???
-		c.Response().After(func() {
-		})
+		// Logged here rather than in c.Response().After, which runs on
+		// every Write and never for responses without a body.
+		err := next(c)
+		if err != nil {
+			c.Error(err)
+		}
+		log.AccessLog(c, start)
 
-		return next(c)
+		return err
 	}
 }
@@ -0,0 +1,146 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/log"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// accessLogHook keeps the access log entries written during a test.
+type accessLogHook struct {
+	mutex   sync.Mutex
+	entries []*logrus.Entry
+}
+
+func (h *accessLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *accessLogHook) Fire(entry *logrus.Entry) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if entry.Data["system"] == "access" {
+		h.entries = append(h.entries, entry)
+	}
+	return nil
+}
+
+var hook = &accessLogHook{}
+
+func init() {
+	logrus.AddHook(hook)
+}
+
+func accessLogs(f func()) []*logrus.Entry {
+	hook.mutex.Lock()
+	hook.entries = nil
+	hook.mutex.Unlock()
+
+	f()
+
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	return hook.entries
+}
+
+func newRouter() *echo.Echo {
+	return newConfiguredRouter(config.Default())
+}
+
+func newConfiguredRouter(cfg *config.Config) *echo.Echo {
+	root := echo.New()
+	root.Use(middle.Config(cfg))
+	root.Use(middle.InitializePayload)
+	root.GET("/ok", func(c echo.Context) error {
+		return c.String(http.StatusOK, "hello")
+	})
+	root.GET("/fail", func(c echo.Context) error {
+		c.Set("APIType", core.ADMIN_API)
+		return log.AddDefaultError(c, core.NewBusinessError("Email is invalid", core.ERROR_SUBCODE_EMAIL))
+	})
+	return root
+}
+
+func TestRequestIDIsPropagated(t *testing.T) {
+	root := newRouter()
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/ok", nil)
+	req.Header.Set("X-Request-ID", "client-42")
+	entries := accessLogs(func() { root.ServeHTTP(rw, req) })
+
+	assert.Equal(t, "client-42", rw.Header().Get("X-Request-ID"))
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "client-42", entries[0].Data["id-req"])
+	}
+}
+
+func TestInvalidRequestIDIsReplaced(t *testing.T) {
+	root := newRouter()
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/ok", nil)
+	req.Header.Set("X-Request-ID", "not valid\nid")
+	root.ServeHTTP(rw, req)
+
+	id := rw.Header().Get("X-Request-ID")
+	assert.NotEqual(t, "not valid\nid", id)
+	assert.Len(t, id, 36)
+}
+
+func TestAccessLog(t *testing.T) {
+	root := newRouter()
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/fail?token=secret&page=2", nil)
+	entries := accessLogs(func() { root.ServeHTTP(rw, req) })
+
+	assert.Equal(t, 400, rw.Code)
+	if assert.Len(t, entries, 1) {
+		entry := entries[0]
+		assert.Equal(t, 400, entry.Data["status"])
+		assert.Equal(t, int64(rw.Body.Len()), entry.Data["bytes-out"])
+		assert.Equal(t, "/fail", entry.Data["route"])
+		assert.Equal(t, "ADMIN_API", entry.Data["api-type"])
+		assert.Equal(t, core.ERROR_CODE_BUSINESS_ERROR, entry.Data["error-code"])
+		assert.Equal(t, core.ERROR_SUBCODE_EMAIL, entry.Data["error-subcode"])
+		assert.Equal(t, "/fail?token=REDACTED&page=2", entry.Data["path"])
+		assert.NotContains(t, entry.Message, "secret")
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	cfg := config.Default()
+	cfg.Log.AccessSampleRate = 0
+	root := newConfiguredRouter(cfg)
+
+	entries := accessLogs(func() {
+		root.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+		root.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+		root.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	})
+
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, 400, entries[0].Data["status"])
+		assert.Equal(t, 404, entries[1].Data["status"])
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	params := []string{"token", "Password"}
+
+	req := httptest.NewRequest("GET", "/recover?TOKEN=abc&password=p%40ss&email=a%40b.com", nil)
+	assert.Equal(t, "/recover?TOKEN=REDACTED&password=REDACTED&email=a%40b.com", log.RedactURL(req.URL, params))
+
+	req = httptest.NewRequest("GET", "/users", nil)
+	assert.Equal(t, "/users", log.RedactURL(req.URL, params))
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/log"
+	"github.com/brunoksato/golang-boilerplate/metrics"
+	"github.com/brunoksato/golang-boilerplate/model"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+var CONCURRENCY_LIMIT = metrics.NewGauge("http_concurrency_limit", "Adaptive limit of in-flight requests.")
+var IN_FLIGHT_REQUESTS = metrics.NewGauge("http_in_flight_requests", "Requests being served by API type.", "api_type")
+var SHED_REQUESTS = metrics.NewCounter("http_shed_requests_total", "Requests refused because the server was overloaded, by API type.", "api_type")
+
+// LIMITER_DECREASE is the factor the limit shrinks by when a request is
+// slower than the latency target.
+const LIMITER_DECREASE = 0.9
+
+// Limiter caps the requests in flight. User traffic only gets UserShare of
+// the limit, so admin and cron job requests still get through when users
+// saturate the server. The limit adapts to latency: it grows by one every
+// limit requests while it is in use and fast, and shrinks by a tenth at
+// most once per LatencyTarget while requests are slower than the target.
+type Limiter struct {
+	MinLimit      int
+	MaxLimit      int
+	LatencyTarget time.Duration
+	UserShare     float64
+
+	limit        float64
+	inFlight     int
+	lastDecrease time.Time
+	mutex        sync.Mutex
+}
+
+func NewLimiter(initial, min, max int, latencyTarget time.Duration, userShare float64) *Limiter {
+	CONCURRENCY_LIMIT.Set(float64(initial))
+	return &Limiter{
+		MinLimit:      min,
+		MaxLimit:      max,
+		LatencyTarget: latencyTarget,
+		UserShare:     userShare,
+		limit:         float64(initial),
+	}
+}
+
+func (l *Limiter) Limit() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return int(l.limit)
+}
+
+// Acquire admits a request of apiType, false means it must be shed.
+// Admitted requests must be released.
+func (l *Limiter) Acquire(apiType core.APIType) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	limit := l.limit
+	if apiType != core.ADMIN_API && apiType != core.CRONJOB_API {
+		limit *= l.UserShare
+	}
+	if float64(l.inFlight) >= limit {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// Release ends a request that took latency and adapts the limit.
+func (l *Limiter) Release(latency time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	saturated := float64(l.inFlight) >= l.limit*l.UserShare
+	l.inFlight--
+
+	switch {
+	case latency > l.LatencyTarget:
+		if time.Since(l.lastDecrease) >= l.LatencyTarget {
+			l.limit *= LIMITER_DECREASE
+			l.lastDecrease = time.Now()
+		}
+	case saturated:
+		l.limit += 1 / l.limit
+	}
+	if l.limit < float64(l.MinLimit) {
+		l.limit = float64(l.MinLimit)
+	}
+	if l.limit > float64(l.MaxLimit) {
+		l.limit = float64(l.MaxLimit)
+	}
+	CONCURRENCY_LIMIT.Set(l.limit)
+}
+
+// LoadShed answers 503 with ERROR_SUBCODE_SERVER_OVERLOADED and a
+// Retry-After when the limiter refuses a request. It goes on the root,
+// after InitializePayload and before the middleware that hits the
+// database, so it works out the priority of a request with priorityOf.
+// Probes are never shed and a nil limiter lets everything through.
+func LoadShed(l *Limiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if l == nil {
+			return next
+		}
+		return func(c echo.Context) error {
+			if PROBE_PATHS[c.Path()] {
+				return next(c)
+			}
+
+			apiType := priorityOf(c)
+			if !l.Acquire(apiType) {
+				SHED_REQUESTS.Inc(string(apiType))
+				c.Response().Header().Set("Retry-After", retryAfter(time.Second))
+				return log.AddDefaultError(c, core.NewServiceUnavailableError("The server is overloaded", core.ERROR_SUBCODE_SERVER_OVERLOADED))
+			}
+
+			IN_FLIGHT_REQUESTS.Add(1, string(apiType))
+			start := time.Now()
+			defer func() {
+				l.Release(time.Since(start))
+				IN_FLIGHT_REQUESTS.Add(-1, string(apiType))
+			}()
+			return next(c)
+		}
+	}
+}
+
+// priorityOf is the API type a request is admitted as. X-Company only
+// counts when the credentials it needs check out without the database: the
+// cron job password, or a token with the admin role. Anything else, like
+// a request Session would refuse, is user traffic.
+func priorityOf(c echo.Context) core.APIType {
+	switch API_TYPES[c.Request().Header.Get("X-Company")] {
+	case core.CRONJOB_API:
+		if validCronjobPassword(c) {
+			return core.CRONJOB_API
+		}
+	case core.ADMIN_API:
+		if hasAdminToken(c) {
+			return core.ADMIN_API
+		}
+	}
+	return core.USER_API
+}
+
+func hasAdminToken(c echo.Context) bool {
+	tokenSlice := strings.Split(c.Request().Header.Get("Authorization"), " ")
+	if len(tokenSlice) != 2 || tokenSlice[0] != "Bearer" {
+		return false
+	}
+
+	token, err := model.VerifyJWTToken(tokenSlice[1], config.FromContext(c).JWT.SigninKey)
+	if err != nil {
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return ok && claims["iss"] == model.JWT_ISS && model.HasJWTRole(claims, model.JWT_ROLE_ADMIN)
+}
@@ -0,0 +1,151 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterPrioritizesAdminAndCronJob(t *testing.T) {
+	limiter := middle.NewLimiter(10, 5, 20, 100*time.Millisecond, 0.5)
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, limiter.Acquire(core.USER_API))
+	}
+	assert.False(t, limiter.Acquire(core.USER_API))
+	assert.False(t, limiter.Acquire(""))
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, limiter.Acquire(core.ADMIN_API))
+	}
+	assert.False(t, limiter.Acquire(core.CRONJOB_API))
+
+	limiter.Release(time.Millisecond)
+	assert.True(t, limiter.Acquire(core.CRONJOB_API))
+}
+
+func TestLimiterAdaptsToLatency(t *testing.T) {
+	limiter := middle.NewLimiter(10, 5, 11, 20*time.Millisecond, 1)
+
+	limiter.Acquire(core.USER_API)
+	limiter.Release(50 * time.Millisecond)
+	assert.Equal(t, 9, limiter.Limit())
+
+	limiter.Acquire(core.USER_API)
+	limiter.Release(50 * time.Millisecond)
+	assert.Equal(t, 9, limiter.Limit(), "decreases at most once per latency target")
+
+	time.Sleep(25 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		limiter.Acquire(core.USER_API)
+		limiter.Release(50 * time.Millisecond)
+		time.Sleep(25 * time.Millisecond)
+	}
+	assert.Equal(t, 5, limiter.Limit(), "never under the minimum")
+
+	for i := 0; i < 100; i++ {
+		for limiter.Acquire(core.USER_API) {
+		}
+		limiter.Release(time.Millisecond)
+	}
+	assert.Equal(t, 11, limiter.Limit(), "grows while saturated, up to the maximum")
+}
+
+func TestLoadShed(t *testing.T) {
+	limiter := middle.NewLimiter(1, 1, 1, time.Second, 1)
+	root := newRouter()
+	root.Use(middle.LoadShed(limiter))
+	release := make(chan struct{})
+	started := make(chan struct{})
+	root.GET("/slow", func(c echo.Context) error {
+		close(started)
+		<-release
+		return c.NoContent(http.StatusOK)
+	})
+
+	done := make(chan int)
+	go func() {
+		rw := httptest.NewRecorder()
+		root.ServeHTTP(rw, httptest.NewRequest("GET", "/slow", nil))
+		done <- rw.Code
+	}()
+	<-started
+
+	rw := httptest.NewRecorder()
+	root.ServeHTTP(rw, httptest.NewRequest("GET", "/ok", nil))
+	assert.Equal(t, 503, rw.Code)
+	assert.Equal(t, "1", rw.Header().Get("Retry-After"))
+	body := core.JsonToMap(rw.Body.String())
+	assert.Equal(t, float64(core.ERROR_SUBCODE_SERVER_OVERLOADED), body["code"])
+
+	close(release)
+	assert.Equal(t, 200, <-done)
+
+	rw = httptest.NewRecorder()
+	root.ServeHTTP(rw, httptest.NewRequest("GET", "/ok", nil))
+	assert.Equal(t, 200, rw.Code)
+}
+
+func TestLoadShedTrustsOnlyCheckedCredentials(t *testing.T) {
+	cfg := config.Default()
+	// Users get one of the two requests in flight.
+	limiter := middle.NewLimiter(2, 2, 2, time.Second, 0.5)
+	root := newConfiguredRouter(cfg)
+	root.Use(middle.LoadShed(limiter))
+	release := make(chan struct{})
+	started := make(chan struct{})
+	root.GET("/slow", func(c echo.Context) error {
+		close(started)
+		<-release
+		return c.NoContent(http.StatusOK)
+	})
+
+	done := make(chan int)
+	go func() {
+		rw := httptest.NewRecorder()
+		root.ServeHTTP(rw, httptest.NewRequest("GET", "/slow", nil))
+		done <- rw.Code
+	}()
+	<-started
+	defer func() {
+		close(release)
+		assert.Equal(t, 200, <-done)
+	}()
+
+	token := func(admin bool) string {
+		u := model.User{Admin: admin}
+		u.ID = 1
+		jwt, err := model.IssueJWToken(u.ID, model.JWTRoles(u), model.JWTTokenExpirationDate(time.Hour), cfg.JWT.SigninKey)
+		assert.NoError(t, err)
+		return "Bearer " + jwt
+	}
+
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		code    int
+	}{
+		{"no credentials", map[string]string{"X-Company": "Admin"}, 503},
+		{"user token", map[string]string{"X-Company": "Admin", "Authorization": token(false)}, 503},
+		{"forged token", map[string]string{"X-Company": "Admin", "Authorization": "Bearer forged"}, 503},
+		{"admin token", map[string]string{"X-Company": "Admin", "Authorization": token(true)}, 200},
+		{"wrong password", map[string]string{"X-Company": "CronJob", "X-Cronjob": "guess"}, 503},
+		{"cron job password", map[string]string{"X-Company": "CronJob", "X-Cronjob": cfg.Server.CronjobPassword}, 200},
+	} {
+		req := httptest.NewRequest("GET", "/ok", nil)
+		for key, value := range tc.headers {
+			req.Header.Set(key, value)
+		}
+		rw := httptest.NewRecorder()
+		root.ServeHTTP(rw, req)
+		assert.Equal(t, tc.code, rw.Code, tc.name)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/metrics"
+	"github.com/labstack/echo/v4"
+)
+
+// UNMATCHED_ROUTE labels requests no route matched, their paths would make
+// a series each.
+const UNMATCHED_ROUTE = "unmatched"
+
+var HTTP_REQUESTS = metrics.NewCounter("http_requests_total",
+	"Requests by method, route template, API type and status.", "method", "route", "api_type", "status")
+var HTTP_REQUEST_DURATION = metrics.NewHistogram("http_request_duration_seconds",
+	"Request latency by method, route template and API type.", nil, "method", "route", "api_type")
+
+// Metrics counts and times requests. It must be registered on the root so
+// it sees every request once.
+func Metrics(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		status := c.Response().Status
+		if err != nil {
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			} else if !c.Response().Committed {
+				status = 500
+			}
+		}
+
+		route := c.Path()
+		if unmatched(c.Handler()) {
+			route = UNMATCHED_ROUTE
+		}
+		apiType := ""
+		if t, ok := c.Get("APIType").(core.APIType); ok {
+			apiType = string(t)
+		}
+
+		method := c.Request().Method
+		HTTP_REQUESTS.Inc(method, route, apiType, strconv.Itoa(status))
+		HTTP_REQUEST_DURATION.Observe(time.Since(start).Seconds(), method, route, apiType)
+		return err
+	}
+}
+
+func unmatched(h echo.HandlerFunc) bool {
+	p := reflect.ValueOf(h).Pointer()
+	return p == reflect.ValueOf(echo.NotFoundHandler).Pointer() ||
+		p == reflect.ValueOf(echo.MethodNotAllowedHandler).Pointer()
+}
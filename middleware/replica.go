@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/brunoksato/golang-boilerplate/metrics"
+	"github.com/jinzhu/gorm"
+)
+
+// Replicas routes reads to the healthy read replicas of a primary, round
+// robin, falling back to the primary when none is healthy. A user who wrote
+// within StickyWindow reads from the primary, so they see their writes
+// before the replicas catch up.
+type Replicas struct {
+	Primary      *gorm.DB
+	StickyWindow time.Duration
+
+	replicas []*replica
+	next     uint32
+	writes   map[uint]time.Time
+	mutex    sync.Mutex
+}
+
+type replica struct {
+	name    string
+	db      *gorm.DB
+	healthy int32
+}
+
+// NewReplicas starts with every replica healthy. Names label them in logs
+// and metrics, e.g. "ro1".
+func NewReplicas(primary *gorm.DB, names []string, dbs []*gorm.DB, stickyWindow time.Duration) *Replicas {
+	r := &Replicas{
+		Primary:      primary,
+		StickyWindow: stickyWindow,
+		writes:       map[uint]time.Time{},
+	}
+	for i, db := range dbs {
+		r.replicas = append(r.replicas, &replica{name: names[i], db: db, healthy: 1})
+		metrics.DB_REPLICA_HEALTHY.Set(1, names[i])
+	}
+	return r
+}
+
+// Read returns the next healthy replica, or the primary.
+func (r *Replicas) Read() *gorm.DB {
+	n := len(r.replicas)
+	start := atomic.AddUint32(&r.next, 1)
+	for i := 0; i < n; i++ {
+		rep := r.replicas[(int(start)+i)%n]
+		if atomic.LoadInt32(&rep.healthy) == 1 {
+			return rep.db
+		}
+	}
+	return r.Primary
+}
+
+// ReadFor is Read for a user, who gets the primary while their last write
+// is within the sticky window. Anonymous requests pass 0.
+func (r *Replicas) ReadFor(userID uint) *gorm.DB {
+	if userID != 0 && r.StickyWindow > 0 {
+		r.mutex.Lock()
+		wrote, ok := r.writes[userID]
+		r.mutex.Unlock()
+		if ok && time.Since(wrote) < r.StickyWindow {
+			return r.Primary
+		}
+	}
+	return r.Read()
+}
+
+// MarkWrite starts the sticky window of a user.
+func (r *Replicas) MarkWrite(userID uint) {
+	if userID == 0 || r.StickyWindow <= 0 || len(r.replicas) == 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.writes[userID] = time.Now()
+}
+
+// Healthy counts the replicas in rotation.
+func (r *Replicas) Healthy() int {
+	healthy := 0
+	for _, rep := range r.replicas {
+		if atomic.LoadInt32(&rep.healthy) == 1 {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// CheckHealth pings every replica, taking the ones that fail out of
+// rotation until they answer again, and forgets expired sticky windows.
+func (r *Replicas) CheckHealth(ctx context.Context, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, rep := range r.replicas {
+		wg.Add(1)
+		go func(rep *replica) {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			rep.setHealthy(rep.db.DB().PingContext(pingCtx))
+		}(rep)
+	}
+	wg.Wait()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for userID, wrote := range r.writes {
+		if time.Since(wrote) >= r.StickyWindow {
+			delete(r.writes, userID)
+		}
+	}
+}
+
+// Monitor runs CheckHealth every interval until ctx is done.
+func (r *Replicas) Monitor(ctx context.Context, interval, timeout time.Duration) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.CheckHealth(ctx, timeout)
+		}
+	}
+}
+
+func (rep *replica) setHealthy(err error) {
+	logger := logrus.WithFields(logrus.Fields{"system": "database", "pool": rep.name})
+	if err != nil {
+		if atomic.SwapInt32(&rep.healthy, 0) == 1 {
+			logger.Warning("Read replica out of rotation: " + err.Error())
+		}
+		metrics.DB_REPLICA_HEALTHY.Set(0, rep.name)
+		return
+	}
+	if atomic.SwapInt32(&rep.healthy, 1) == 0 {
+		logger.Info("Read replica back in rotation")
+	}
+	metrics.DB_REPLICA_HEALTHY.Set(1, rep.name)
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestReplicas(window time.Duration) (*Replicas, *gorm.DB, *gorm.DB, *gorm.DB) {
+	primary, ro1, ro2 := &gorm.DB{}, &gorm.DB{}, &gorm.DB{}
+	return NewReplicas(primary, []string{"test-ro1", "test-ro2"}, []*gorm.DB{ro1, ro2}, window), primary, ro1, ro2
+}
+
+func TestReplicasRead(t *testing.T) {
+	replicas, primary, ro1, ro2 := newTestReplicas(time.Minute)
+
+	read := map[*gorm.DB]int{}
+	for i := 0; i < 4; i++ {
+		read[replicas.Read()]++
+	}
+	assert.Equal(t, map[*gorm.DB]int{ro1: 2, ro2: 2}, read)
+
+	replicas.replicas[0].setHealthy(errors.New("connection refused"))
+	assert.Equal(t, 1, replicas.Healthy())
+	assert.True(t, replicas.Read() == ro2)
+	assert.True(t, replicas.Read() == ro2)
+
+	replicas.replicas[1].setHealthy(errors.New("connection refused"))
+	assert.True(t, replicas.Read() == primary)
+
+	replicas.replicas[0].setHealthy(nil)
+	assert.True(t, replicas.Read() == ro1)
+}
+
+func TestReplicasStickiness(t *testing.T) {
+	replicas, primary, _, _ := newTestReplicas(50 * time.Millisecond)
+
+	replicas.MarkWrite(7)
+	assert.True(t, replicas.ReadFor(7) == primary)
+	assert.False(t, replicas.ReadFor(8) == primary)
+	assert.False(t, replicas.ReadFor(0) == primary)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.False(t, replicas.ReadFor(7) == primary)
+}
+
+func TestReplicasWithoutReplicas(t *testing.T) {
+	primary := &gorm.DB{}
+	replicas := NewReplicas(primary, nil, nil, time.Minute)
+	assert.True(t, replicas.Read() == primary)
+	assert.True(t, replicas.ReadFor(7) == primary)
+}
+
+func TestReadReplicaRouting(t *testing.T) {
+	replicas, primary, _, _ := newTestReplicas(time.Minute)
+
+	var used *gorm.DB
+	handler := func(c echo.Context) error {
+		used = c.Get("Database").(*gorm.DB)
+		return c.NoContent(http.StatusOK)
+	}
+	root := echo.New()
+	root.Use(ReplicaDBMiddleware(replicas))
+	root.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get("X-User") != "" {
+				c.Set("User", model.User{Model: model.Model{ID: 7}})
+			}
+			return next(c)
+		}
+	})
+	root.GET("/items", handler, ReadReplica)
+	root.GET("/fresh", handler, Primary, ReadReplica)
+	root.GET("/jobs", handler)
+	root.PUT("/items", handler)
+
+	request := func(method, path string, user bool) *gorm.DB {
+		req := httptest.NewRequest(method, path, nil)
+		if user {
+			req.Header.Set("X-User", "7")
+		}
+		root.ServeHTTP(httptest.NewRecorder(), req)
+		return used
+	}
+
+	assert.False(t, request("GET", "/items", true) == primary)
+	assert.True(t, request("GET", "/fresh", true) == primary)
+	assert.True(t, request("GET", "/jobs", true) == primary)
+
+	assert.True(t, request("PUT", "/items", false) == primary)
+	assert.False(t, request("GET", "/items", true) == primary)
+
+	assert.True(t, request("PUT", "/items", true) == primary)
+	assert.True(t, request("GET", "/items", true) == primary)
+	assert.False(t, request("GET", "/items", false) == primary)
+}
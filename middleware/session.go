@@ -1,57 +1,57 @@
 package middleware
 
 import (
-	"net/http"
-	"os"
 	"strings"
 
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/log"
 	"github.com/brunoksato/golang-boilerplate/model"
 	jwt "github.com/dgrijalva/jwt-go"
-	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo/v4"
 )
 
 func Session(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		db := c.Get("Database").(*gorm.DB)
+		repo := Repository(c)
 		user := model.User{}
 		isPrivate := strings.Contains(c.Path(), "api")
 		isAdmin := strings.Contains(c.Path(), "admin")
 		if isPrivate || isAdmin {
 			authorization := c.Request().Header.Get("Authorization")
-			secretKey := os.Getenv("JWT_KEY_SIGNIN")
+			secretKey := config.FromContext(c).JWT.SigninKey
 			if authorization != "" {
 				tokenSlice := strings.Split(authorization, " ")
 				if len(tokenSlice) == 2 && tokenSlice[0] == "Bearer" {
 					token, err := model.VerifyJWTToken(tokenSlice[1], secretKey)
 					if err != nil {
-						return echo.NewHTTPError(http.StatusUnauthorized)
+						return invalidTokenError(c)
 					}
 
 					claims := token.Claims.(jwt.MapClaims)
 					if token.Valid && claims["iss"] == model.JWT_ISS {
 						uidParse := claims["user"].(float64)
 						uid := uint(uidParse)
-						err := db.
-							First(&user, uid).
-							Error
+						err := repo.FindByID(&user, uid)
 						if err != nil {
-							return echo.NewHTTPError(http.StatusUnauthorized)
+							return invalidTokenError(c)
 						}
 
 						if isAdmin {
 							if !user.IsAdmin() {
-								return echo.NewHTTPError(http.StatusUnauthorized)
+								return log.AddDefaultError(c, core.NewAuthenticationError("Admin access required",
+									core.ERROR_SUBCODE_USER_LACKS_PERMISSION))
 							}
 						}
 					} else {
-						return echo.NewHTTPError(http.StatusUnauthorized)
+						return invalidTokenError(c)
 					}
 				} else {
-					return echo.NewHTTPError(http.StatusUnauthorized)
+					return invalidTokenError(c)
 				}
 			} else {
-				return echo.NewHTTPError(http.StatusUnauthorized)
+				return log.AddDefaultError(c, core.NewAuthenticationError("Missing authorization token",
+					core.ERROR_SUBCODE_TOKEN_MISSING))
 			}
 		} else {
 			user.ID = 0
@@ -62,3 +62,8 @@ func Session(next echo.HandlerFunc) echo.HandlerFunc {
 		return next(c)
 	}
 }
+
+func invalidTokenError(c echo.Context) error {
+	return log.AddDefaultError(c, core.NewAuthenticationError("Invalid authorization token",
+		core.ERROR_SUBCODE_TOKEN_INVALID))
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/tracing"
+	"github.com/labstack/echo/v4"
+)
+
+// Tracing makes every request a server span, continuing the trace of the
+// caller when it sends a traceparent header. The trace and span IDs are
+// kept in the context for the logger.
+func Tracing(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		if sc, ok := tracing.ParseTraceparent(req.Header.Get("traceparent")); ok {
+			ctx = tracing.ContextWithRemoteParent(ctx, sc)
+		}
+
+		ctx, span := tracing.StartSpan(ctx, req.Method+" "+c.Path(), tracing.KIND_SERVER)
+		if span == nil {
+			return next(c)
+		}
+		defer span.End()
+
+		c.SetRequest(req.WithContext(ctx))
+		c.Set("TraceID", span.TraceID())
+		c.Set("SpanID", span.SpanID())
+
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.route", c.Path())
+		span.SetAttribute("http.target", req.URL.RequestURI())
+
+		err := next(c)
+
+		status := c.Response().Status
+		if he, ok := err.(*echo.HTTPError); ok {
+			status = he.Code
+		}
+		span.SetAttribute("http.status_code", status)
+		if id, ok := c.Get("RequestID").(string); ok {
+			span.SetAttribute("request.id", id)
+		}
+		if user, ok := c.Get("User").(model.User); ok {
+			span.SetAttribute("enduser.id", user.ID)
+		}
+		if err != nil {
+			span.SetError(err)
+		} else if status >= 500 {
+			span.SetError(fmt.Errorf("HTTP %d", status))
+		}
+
+		return err
+	}
+}
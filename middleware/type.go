@@ -10,21 +10,7 @@ import (
 
 func DetermineType(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		var tType reflect.Type
-		var parentType reflect.Type
-
-		parts := PathParts(c.Path())
-		var pathType string
-		for i := 0; i < len(parts); i++ {
-			pathType = parts[i]
-			t := StringToType(pathType)
-			if t != nil {
-				if tType != nil {
-					parentType = tType
-				}
-				tType = t
-			}
-		}
+		tType, parentType := TypesForPath(c.Path())
 
 		c.Set("ParentType", parentType)
 		c.Set("Type", tType)
@@ -33,6 +19,22 @@ func DetermineType(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// TypesForPath resolves the model a route path is about, the last segment
+// naming a type, and the one it is nested under, if any.
+func TypesForPath(path string) (tType reflect.Type, parentType reflect.Type) {
+	parts := PathParts(path)
+	for i := 0; i < len(parts); i++ {
+		t := StringToType(parts[i])
+		if t != nil {
+			if tType != nil {
+				parentType = tType
+			}
+			tType = t
+		}
+	}
+	return
+}
+
 func PathParts(path string) []string {
 	return strings.Split(strings.Trim(path, " /"), "/")
 }
@@ -45,6 +47,15 @@ func StringToType(typeName string) (t reflect.Type) {
 	case "configurations":
 		var m model.Configuration
 		t = reflect.TypeOf(m)
+	case "exports":
+		var m model.Export
+		t = reflect.TypeOf(m)
+	case "imports":
+		var m model.Import
+		t = reflect.TypeOf(m)
+	case "attachments":
+		var m model.Attachment
+		t = reflect.TypeOf(m)
 	}
 	return
 }
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/brunoksato/golang-boilerplate/storage"
+)
+
+const ATTACHMENT_STATUS_PENDING = "pending"
+const ATTACHMENT_STATUS_UPLOADED = "uploaded"
+
+// Attachment is a file kept in storage. Other models point at it through an
+// attachment id column, like User.AvatarID. A pending attachment was handed
+// a presigned URL and is waiting for the client to finish the upload.
+type Attachment struct {
+	Model
+	UserID      uint   `json:"user_id" settable:"false"`
+	Key         string `json:"key" settable:"false"`
+	FileName    string `json:"file_name" settable:"false"`
+	ContentType string `json:"content_type" settable:"false"`
+	Size        int64  `json:"size" settable:"false"`
+	Status      string `json:"status" settable:"false"`
+	URL         string `json:"url" sql:"-" settable:"false"`
+}
+
+func (a *Attachment) AfterFind() error {
+	a.URL = storage.Default().URL(a.Key)
+	return nil
+}
+
+func (a *Attachment) AfterSave() error {
+	a.URL = storage.Default().URL(a.Key)
+	return nil
+}
+
+// Restrictor
+func (a Attachment) UserCanView(ctx *ModelCtx, viewer User) (bool, core.DefaultError) {
+	return viewer.IsAdmin() || a.UserID == viewer.ID, nil
+}
+
+func (a Attachment) UserCanCreate(ctx *ModelCtx, creator User) (bool, core.DefaultError) {
+	return creator.ID > 0, nil
+}
+
+func (a Attachment) UserCanUpdate(ctx *ModelCtx, updater User, fields []string) (bool, core.DefaultError) {
+	return false, nil
+}
+
+func (a Attachment) UserCanDelete(ctx *ModelCtx, deleter User) (bool, core.DefaultError) {
+	return deleter.IsAdmin() || a.UserID == deleter.ID, nil
+}
+
+// Deleter Interface
+func (a *Attachment) Delete(ctx *ModelCtx, deleter User) core.DefaultError {
+	canDelete, err := a.UserCanDelete(ctx, deleter)
+	if err != nil {
+		return err
+	}
+	if !canDelete {
+		return core.NewPermissionError("You do not have permission",
+			core.ERROR_SUBCODE_USER_LACKS_PERMISSION)
+	}
+
+	err = a.ValidateForDelete(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Users showing it as their avatar lose it with the row.
+	dberr := ctx.Repo().Transaction(func(tx repository.Repository) error {
+		users := []User{}
+		if err := tx.List(&users, repository.Where(repository.Eq("avatar_id", a.ID))); err != nil {
+			return core.NewServerError(err.Error())
+		}
+		for i := range users {
+			err := tx.UpdateFields(&users[i], map[string]interface{}{"avatar_id": nil, "image": ""})
+			if err != nil {
+				return core.NewServerError(err.Error())
+			}
+		}
+
+		if err := DefaultDelete(ctx.WithRepository(tx), a); err != nil {
+			return err
+		}
+		return nil
+	})
+	if merr, ok := dberr.(core.DefaultError); ok {
+		return merr
+	}
+	if dberr != nil {
+		return core.NewServerError(dberr.Error())
+	}
+
+	// The row is gone either way; a leftover object only costs space.
+	serr := storage.Default().Delete(a.Key)
+	if serr != nil && serr != storage.ErrNotFound && ctx.Logger != nil {
+		ctx.Logger.WithField("key", a.Key).Warn("Could not delete attachment object: " + serr.Error())
+	}
+	return nil
+}
+
+func (a Attachment) ValidateForDelete(ctx *ModelCtx) core.DefaultError {
+	return nil
+}
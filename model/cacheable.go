@@ -0,0 +1,17 @@
+package model
+
+import (
+	"reflect"
+	"time"
+)
+
+// Cacheable models have their Get and List responses cached for CacheTTL.
+// Writes to their table invalidate them; preloaded associations don't.
+type Cacheable interface {
+	CacheTTL() time.Duration
+}
+
+func IsCacheable(t reflect.Type) bool {
+	modelType := reflect.TypeOf((*Cacheable)(nil)).Elem()
+	return t.Implements(modelType)
+}
@@ -1,14 +1,22 @@
 package model
 
 import (
+	"time"
+
 	"github.com/brunoksato/golang-boilerplate/core"
 )
 
 type Configuration struct {
 	Model
+	Version     uint    `json:"version" sql:"not null;default:1" settable:"false" version_field:"version"`
 	MinValueBuy float64 `json:"min_value_buy"`
 }
 
+// Cacheable: the configuration is read on every request.
+func (c Configuration) CacheTTL() time.Duration {
+	return time.Minute
+}
+
 func (c Configuration) ValidateForCreate() core.DefaultError {
 	err := ValidateStruct(c)
 	if err != nil {
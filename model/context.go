@@ -1,16 +1,50 @@
 package model
 
 import (
+	"context"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/repository"
 	"github.com/jinzhu/gorm"
 )
 
 type ModelCtx struct {
+	Ctx           context.Context
 	RequestID     string
 	APIType       core.APIType
 	Database      *gorm.DB
+	Repository    repository.Repository
 	User          User
 	Configuration Configuration
 	Logger        *logrus.Entry
 }
+
+// Context is the context of the request, done when the client goes away or
+// the route times out. Work outside of a request gets context.Background().
+func (mctx *ModelCtx) Context() context.Context {
+	if mctx.Ctx == nil {
+		return context.Background()
+	}
+	return mctx.Ctx
+}
+
+// Repo is where the models are stored: Repository when set, as tests do
+// with a repository.Memory, or else the gorm Database.
+func (mctx *ModelCtx) Repo() repository.Repository {
+	if mctx.Repository != nil {
+		return mctx.Repository
+	}
+	return repository.NewGorm(mctx.Database)
+}
+
+// WithRepository is a copy of mctx storing in repo, like the one of a
+// transaction. A gorm repo becomes its Database too.
+func (mctx *ModelCtx) WithRepository(repo repository.Repository) *ModelCtx {
+	c := *mctx
+	c.Repository = repo
+	if g, ok := repo.(*repository.Gorm); ok {
+		c.Database = g.DB
+	}
+	return &c
+}
@@ -5,6 +5,7 @@ import (
 	"reflect"
 
 	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/repository"
 )
 
 type Deleter interface {
@@ -23,8 +24,22 @@ func DefaultDelete(ctx *ModelCtx, item interface{}) core.DefaultError {
 		return core.NewNotFoundError(fmt.Sprintf("A %v must exist in the database to be deleted", reflect.TypeOf(item)))
 	}
 
-	db := ctx.Database
-	err = db.Set("gorm:save_associations", false).Delete(item).Error
+	// A versioned item is only deleted as it was loaded, like BumpVersion
+	// only updates it.
+	var where []repository.Condition
+	if version := VersionOf(item); version != nil {
+		_, dbFieldName := VersionField(reflect.TypeOf(item))
+		where = append(where, repository.Eq(dbFieldName, version))
+	}
+
+	err = ctx.Repo().Delete(item, where...)
+	if err == repository.ErrNotFound && len(where) > 0 {
+		return core.NewPreconditionFailedError("The item was modified or deleted by someone else",
+			core.ERROR_SUBCODE_VERSION_MISMATCH)
+	}
+	if err == repository.ErrNotFound {
+		return core.NewNotFoundError(fmt.Sprintf("The %v was deleted already", reflect.TypeOf(item)))
+	}
 	if err != nil {
 		return core.NewServerError("Database error while deleting: " + err.Error())
 	}
@@ -5,9 +5,26 @@ import (
 	"testing"
 
 	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/repository"
 )
 
 func TestIsDeleter(t *testing.T) {
 	core.AssertFalse(t, IsDeleter(reflect.TypeOf(&User{})))
 	core.AssertFalse(t, IsDeleter(reflect.TypeOf(&Configuration{})))
 }
+
+func TestDefaultDeleteChecksTheVersion(t *testing.T) {
+	ctx := &ModelCtx{Repository: repository.NewMemory()}
+	c := BuildConfiguration()
+	core.AssertNoError(t, ctx.Repo().Create(&c))
+
+	loaded := c
+	core.AssertNoError(t, BumpVersion(ctx.Repo(), &c, c.Version))
+
+	err := DefaultDelete(ctx, &loaded)
+	core.AssertPreconditionFailedError(t, "The item was modified or deleted by someone else", err)
+	core.AssertNoError(t, ctx.Repo().FindByID(&Configuration{}, c.ID))
+
+	core.AssertNoError(t, DefaultDelete(ctx, &c))
+	core.AssertEqual(t, repository.ErrNotFound, ctx.Repo().FindByID(&Configuration{}, c.ID))
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"github.com/brunoksato/golang-boilerplate/core"
+)
+
+const EXPORT_STATUS_PENDING = "pending"
+const EXPORT_STATUS_RUNNING = "running"
+const EXPORT_STATUS_DONE = "done"
+const EXPORT_STATUS_FAILED = "failed"
+
+type Export struct {
+	Model
+	UserID   uint   `json:"user_id" settable:"false"`
+	Resource string `json:"resource" settable:"false"`
+	Format   string `json:"format" settable:"false"`
+	Status   string `json:"status" settable:"false"`
+	RowCount int    `json:"row_count" settable:"false"`
+	FileName string `json:"-" settable:"false"`
+	Error    string `json:"error,omitempty" settable:"false"`
+}
+
+func (e Export) IsFinished() bool {
+	return e.Status == EXPORT_STATUS_DONE || e.Status == EXPORT_STATUS_FAILED
+}
+
+// Restrictor
+func (e Export) UserCanView(ctx *ModelCtx, viewer User) (bool, core.DefaultError) {
+	return viewer.IsAdmin() || e.UserID == viewer.ID, nil
+}
+
+func (e Export) UserCanCreate(ctx *ModelCtx, creator User) (bool, core.DefaultError) {
+	return creator.IsAdmin(), nil
+}
+
+func (e Export) UserCanUpdate(ctx *ModelCtx, updater User, fields []string) (bool, core.DefaultError) {
+	return false, nil
+}
+
+func (e Export) UserCanDelete(ctx *ModelCtx, deleter User) (bool, core.DefaultError) {
+	return deleter.IsAdmin(), nil
+}
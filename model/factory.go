@@ -0,0 +1,144 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// FACTORY_PASSWORD is the password of the users the factories build.
+const FACTORY_PASSWORD = "password"
+
+// factorySequence makes the values of each built model unique.
+var factorySequence uint64
+
+var factoryMutex sync.RWMutex
+
+// FACTORIES build a valid model of each type for tests, unsaved, with
+// values unique to n. RegisterFactory adds the ones of new models.
+var FACTORIES = map[reflect.Type]func(n uint64) interface{}{
+	reflect.TypeOf(User{}): func(n uint64) interface{} {
+		return &User{
+			Name:           fmt.Sprintf("Factory User %d", n),
+			Username:       fmt.Sprintf("factory%d", n),
+			Email:          fmt.Sprintf("factory%d@example.com", n),
+			Phone:          "12982573000",
+			HashedPassword: factoryHashedPassword(),
+		}
+	},
+	reflect.TypeOf(Configuration{}): func(n uint64) interface{} {
+		return &Configuration{Version: 1, MinValueBuy: 25.0}
+	},
+	reflect.TypeOf(Export{}): func(n uint64) interface{} {
+		return &Export{
+			Resource: "users",
+			Format:   "csv",
+			Status:   EXPORT_STATUS_DONE,
+			FileName: fmt.Sprintf("factory-%d.csv", n),
+		}
+	},
+	reflect.TypeOf(Import{}): func(n uint64) interface{} {
+		return &Import{
+			Resource: "users",
+			Format:   "csv",
+			Mode:     IMPORT_MODE_VALID_ONLY,
+			Status:   IMPORT_STATUS_DONE,
+			FileName: fmt.Sprintf("factory-%d.csv", n),
+		}
+	},
+	reflect.TypeOf(Attachment{}): func(n uint64) interface{} {
+		return &Attachment{
+			Key:         fmt.Sprintf("attachments/factory-%d.txt", n),
+			FileName:    fmt.Sprintf("factory-%d.txt", n),
+			ContentType: "text/plain",
+			Status:      ATTACHMENT_STATUS_UPLOADED,
+		}
+	},
+}
+
+var hashedFactoryPassword []byte
+var hashFactoryPassword sync.Once
+
+// factoryHashedPassword hashes FACTORY_PASSWORD once, at the lowest cost.
+func factoryHashedPassword() []byte {
+	hashFactoryPassword.Do(func() {
+		hashedFactoryPassword, _ = bcrypt.GenerateFromPassword([]byte(FACTORY_PASSWORD), bcrypt.MinCost)
+	})
+	return hashedFactoryPassword
+}
+
+// RegisterFactory sets the factory of t, which returns a pointer to a t.
+func RegisterFactory(t reflect.Type, factory func(n uint64) interface{}) {
+	factoryMutex.Lock()
+	defer factoryMutex.Unlock()
+	FACTORIES[t] = factory
+}
+
+// Build returns a pointer to a new t from its factory, changed by
+// overrides in order.
+func Build(t reflect.Type, overrides ...func(interface{})) (interface{}, error) {
+	factoryMutex.RLock()
+	factory, ok := FACTORIES[t]
+	factoryMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("No factory for %v", t)
+	}
+
+	item := factory(atomic.AddUint64(&factorySequence, 1))
+	for _, override := range overrides {
+		override(item)
+	}
+	return item, nil
+}
+
+// Create saves what Build returns to db.
+func Create(db *gorm.DB, t reflect.Type, overrides ...func(interface{})) (interface{}, error) {
+	item, err := Build(t, overrides...)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Set("gorm:save_associations", false).Create(item).Error; err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func BuildUser(overrides ...func(*User)) User {
+	item, _ := Build(reflect.TypeOf(User{}))
+	user := item.(*User)
+	for _, override := range overrides {
+		override(user)
+	}
+	return *user
+}
+
+// CreateUser saves a user signing in with FACTORY_PASSWORD.
+func CreateUser(db *gorm.DB, overrides ...func(*User)) (User, error) {
+	user := BuildUser(overrides...)
+	err := db.Set("gorm:save_associations", false).Create(&user).Error
+	return user, err
+}
+
+func CreateAdmin(db *gorm.DB, overrides ...func(*User)) (User, error) {
+	admin := func(u *User) { u.Admin = true }
+	return CreateUser(db, append([]func(*User){admin}, overrides...)...)
+}
+
+func BuildConfiguration(overrides ...func(*Configuration)) Configuration {
+	item, _ := Build(reflect.TypeOf(Configuration{}))
+	configuration := item.(*Configuration)
+	for _, override := range overrides {
+		override(configuration)
+	}
+	return *configuration
+}
+
+func CreateConfiguration(db *gorm.DB, overrides ...func(*Configuration)) (Configuration, error) {
+	configuration := BuildConfiguration(overrides...)
+	err := db.Set("gorm:save_associations", false).Create(&configuration).Error
+	return configuration, err
+}
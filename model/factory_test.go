@@ -0,0 +1,47 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+)
+
+func TestFactoriesBuildValidUniqueModels(t *testing.T) {
+	u1 := BuildUser()
+	u1.Password = FACTORY_PASSWORD
+	core.AssertNoError(t, u1.ValidateForCreate())
+
+	u2 := BuildUser(func(u *User) { u.Admin = true })
+	if u1.Username == u2.Username || u1.Email == u2.Email {
+		t.Errorf("Expected unique users, got %s and %s", u1.Username, u2.Username)
+	}
+	core.AssertEqual(t, true, u2.IsAdmin())
+
+	ok, _ := u2.VerifyPassword(FACTORY_PASSWORD)
+	core.AssertEqual(t, true, ok)
+
+	for typeName, factory := range FACTORIES {
+		item := factory(1)
+		if reflect.TypeOf(item) != reflect.PtrTo(typeName) {
+			t.Errorf("The factory of %v builds a %T", typeName, item)
+		}
+	}
+
+	_, err := Build(reflect.TypeOf(ModelCtx{}))
+	if err == nil {
+		t.Error("Expected no factory for ModelCtx")
+	}
+}
+
+func TestCreateUserSaves(t *testing.T) {
+	setupDB()
+	defer teardownDB()
+
+	user, err := CreateUser(TESTDB)
+	core.AssertNoError(t, err)
+
+	found := User{}
+	core.AssertNoError(t, TESTDB.First(&found, user.ID).Error)
+	core.AssertEqual(t, user.Email, found.Email)
+}
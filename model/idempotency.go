@@ -0,0 +1,93 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// IdempotencyKey is the first response to the requests a user sent with an
+// Idempotency-Key header. Status is 0 while that first request runs, until
+// LockedUntil; after ExpiresAt the key can be used again.
+type IdempotencyKey struct {
+	Model
+	UserID      uint
+	Key         string
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	LockedUntil time.Time
+	ExpiresAt   time.Time
+}
+
+func (k IdempotencyKey) IsCompleted() bool {
+	return k.Status != 0
+}
+
+// ClaimIdempotencyKey stores k unless the user already has a live row for
+// its key. claimed tells whether k is now the caller's to run and complete;
+// otherwise existing is the row that was there. Expired rows and rows whose
+// request stopped before completing them are taken over.
+func ClaimIdempotencyKey(db *gorm.DB, k *IdempotencyKey) (claimed bool, existing IdempotencyKey, err error) {
+	err = db.Where("user_id = ? AND key = ?", k.UserID, k.Key).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		if err = db.Create(k).Error; err == nil {
+			return true, existing, nil
+		}
+		// Another request with the key created it first.
+		existing = IdempotencyKey{}
+		if db.Where("user_id = ? AND key = ?", k.UserID, k.Key).First(&existing).Error != nil {
+			return false, existing, err
+		}
+	} else if err != nil {
+		return false, existing, err
+	}
+
+	now := time.Now()
+	if existing.ExpiresAt.After(now) && (existing.IsCompleted() || existing.LockedUntil.After(now)) {
+		return false, existing, nil
+	}
+
+	// Only one of the requests racing for a stale row wins it.
+	result := db.Model(&IdempotencyKey{}).
+		Where("id = ? AND locked_until = ? AND expires_at = ?", existing.ID, existing.LockedUntil, existing.ExpiresAt).
+		Updates(map[string]interface{}{
+			"fingerprint":  k.Fingerprint,
+			"status":       0,
+			"content_type": "",
+			"body":         []byte{},
+			"locked_until": k.LockedUntil,
+			"expires_at":   k.ExpiresAt,
+		})
+	if result.Error != nil {
+		return false, existing, result.Error
+	}
+	if result.RowsAffected == 0 {
+		err = db.First(&existing, existing.ID).Error
+		return false, existing, err
+	}
+	k.ID = existing.ID
+	k.CreatedAt = existing.CreatedAt
+	return true, existing, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request that claimed k.
+func CompleteIdempotencyKey(db *gorm.DB, k *IdempotencyKey, status int, contentType string, body []byte) error {
+	return db.Model(k).Updates(map[string]interface{}{
+		"status":       status,
+		"content_type": contentType,
+		"body":         body,
+	}).Error
+}
+
+// ReleaseIdempotencyKey deletes k so a retry runs the request again.
+func ReleaseIdempotencyKey(db *gorm.DB, k *IdempotencyKey) error {
+	return db.Delete(k).Error
+}
+
+// DeleteExpiredIdempotencyKeys removes the keys expired before now.
+func DeleteExpiredIdempotencyKeys(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("expires_at < ?", now).Delete(&IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
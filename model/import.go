@@ -0,0 +1,88 @@
+package model
+
+import (
+	"github.com/brunoksato/golang-boilerplate/core"
+)
+
+const IMPORT_STATUS_PENDING = "pending"
+const IMPORT_STATUS_RUNNING = "running"
+const IMPORT_STATUS_DONE = "done"
+const IMPORT_STATUS_FAILED = "failed"
+
+// IMPORT_MODE_VALID_ONLY keeps every row that passed, IMPORT_MODE_ALL_OR_NOTHING
+// keeps nothing if a single row failed.
+const IMPORT_MODE_VALID_ONLY = "valid_only"
+const IMPORT_MODE_ALL_OR_NOTHING = "all_or_nothing"
+
+type Import struct {
+	Model
+	UserID       uint   `json:"user_id" settable:"false"`
+	Resource     string `json:"resource" settable:"false"`
+	Format       string `json:"format" settable:"false"`
+	Mode         string `json:"mode" settable:"false"`
+	DryRun       bool   `json:"dry_run" settable:"false"`
+	Status       string `json:"status" settable:"false"`
+	TotalRows    int    `json:"total_rows" settable:"false"`
+	ImportedRows int    `json:"imported_rows" settable:"false"`
+	FailedRows   int    `json:"failed_rows" settable:"false"`
+	FileName     string `json:"-" settable:"false"`
+	ReportName   string `json:"-" settable:"false"`
+	Error        string `json:"error,omitempty" settable:"false"`
+}
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Code    int    `json:"code"`
+	Subcode int    `json:"subcode"`
+	Message string `json:"message"`
+}
+
+// NewImportRowErrors turns the error of a row into one entry per invalid
+// field, or a single entry when err is not a validation error.
+func NewImportRowErrors(row int, err core.DefaultError) []ImportRowError {
+	fieldErrs := core.FieldErrors(err)
+	if len(fieldErrs) == 0 {
+		field, _ := err.Data()["field"].(string)
+		return []ImportRowError{{
+			Row:     row,
+			Field:   field,
+			Code:    err.Code(),
+			Subcode: err.Subcode(),
+			Message: err.Error(),
+		}}
+	}
+
+	rowErrors := []ImportRowError{}
+	for _, fe := range fieldErrs {
+		rowErrors = append(rowErrors, ImportRowError{
+			Row:     row,
+			Field:   fe.Field,
+			Code:    err.Code(),
+			Subcode: fe.Subcode,
+			Message: fe.Message,
+		})
+	}
+	return rowErrors
+}
+
+func (i Import) IsFinished() bool {
+	return i.Status == IMPORT_STATUS_DONE || i.Status == IMPORT_STATUS_FAILED
+}
+
+// Restrictor
+func (i Import) UserCanView(ctx *ModelCtx, viewer User) (bool, core.DefaultError) {
+	return viewer.IsAdmin() || i.UserID == viewer.ID, nil
+}
+
+func (i Import) UserCanCreate(ctx *ModelCtx, creator User) (bool, core.DefaultError) {
+	return creator.IsAdmin(), nil
+}
+
+func (i Import) UserCanUpdate(ctx *ModelCtx, updater User, fields []string) (bool, core.DefaultError) {
+	return false, nil
+}
+
+func (i Import) UserCanDelete(ctx *ModelCtx, deleter User) (bool, core.DefaultError) {
+	return deleter.IsAdmin(), nil
+}
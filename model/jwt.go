@@ -2,8 +2,6 @@ package model
 
 import (
 	"fmt"
-	"os"
-	"strconv"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -11,9 +9,32 @@ import (
 
 const JWT_ISS = "server"
 
-func IssueJWToken(uid uint, roles []string, exp time.Time) (string, error) {
+const JWT_ROLE_USER = "user"
+const JWT_ROLE_ADMIN = "admin"
+
+// JWTRoles are the roles of the tokens of u. Session still checks the user,
+// they only let middleware that runs before it tell admins apart.
+func JWTRoles(u User) []string {
+	if u.IsAdmin() {
+		return []string{JWT_ROLE_USER, JWT_ROLE_ADMIN}
+	}
+	return []string{JWT_ROLE_USER}
+}
+
+// HasJWTRole tells whether the roles claim of a token lists role.
+func HasJWTRole(claims jwt.MapClaims, role string) bool {
+	roles, _ := claims["roles"].([]interface{})
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func IssueJWToken(uid uint, roles []string, exp time.Time, secretKey string) (string, error) {
 	if len(roles) == 0 {
-		roles = []string{"user"}
+		roles = []string{JWT_ROLE_USER}
 	}
 
 	claims := jwt.MapClaims{}
@@ -24,8 +45,7 @@ func IssueJWToken(uid uint, roles []string, exp time.Time) (string, error) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	secretKey := []byte(os.Getenv("JWT_KEY_SIGNIN"))
-	tokenString, err := token.SignedString(secretKey)
+	tokenString, err := token.SignedString([]byte(secretKey))
 
 	if err != nil {
 		return tokenString, fmt.Errorf("Couldn't issue token: %v", err)
@@ -34,7 +54,7 @@ func IssueJWToken(uid uint, roles []string, exp time.Time) (string, error) {
 	return tokenString, nil
 }
 
-func IssueJWTTokenForEmail(uid uint, email string, exp time.Time) (string, error) {
+func IssueJWTTokenForEmail(uid uint, email string, exp time.Time, secretKey string) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := jwt.MapClaims{}
@@ -43,8 +63,7 @@ func IssueJWTTokenForEmail(uid uint, email string, exp time.Time) (string, error
 	claims["email"] = email
 	claims["exp"] = exp.Unix()
 	token.Claims = claims
-	secretKey := []byte(os.Getenv("JWT_KEY_EMAIL"))
-	tokenString, err := token.SignedString(secretKey)
+	tokenString, err := token.SignedString([]byte(secretKey))
 
 	if err != nil {
 		return tokenString, fmt.Errorf("Couldn't issue token: %v", err)
@@ -53,15 +72,8 @@ func IssueJWTTokenForEmail(uid uint, email string, exp time.Time) (string, error
 	return tokenString, nil
 }
 
-func JWTTokenExpirationDate() time.Time {
-	var err error
-	var jwtHours int
-	jwtHours, err = strconv.Atoi(os.Getenv("JWT_TOKEN_EXPIRATION"))
-	if err != nil {
-		jwtHours = 24
-	}
-	jwtDuration := time.Duration(jwtHours) * time.Hour
-	return (time.Now().Add(jwtDuration)).Round(time.Millisecond)
+func JWTTokenExpirationDate(expiration time.Duration) time.Time {
+	return (time.Now().Add(expiration)).Round(time.Millisecond)
 }
 
 func VerifyJWTToken(tokenString, secretKey string) (*jwt.Token, error) {
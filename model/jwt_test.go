@@ -1,28 +1,36 @@
 package model
 
 import (
-	"os"
 	"testing"
 	"time"
 
 	"github.com/brunoksato/golang-boilerplate/core"
+	jwt "github.com/dgrijalva/jwt-go"
 )
 
 func TestJWTTokenExpirationDate(t *testing.T) {
 	jwtTime := time.Now().Add(time.Hour * 24).Round(time.Second)
-	core.AssertEqual(t, jwtTime, JWTTokenExpirationDate().Round(time.Second))
+	core.AssertEqual(t, jwtTime, JWTTokenExpirationDate(24*time.Hour).Round(time.Second))
 
-	os.Setenv("JWT_TOKEN_EXPIRATION", "0")
-	jwtTime = time.Now().Add(time.Hour * 0).Round(time.Second)
-	core.AssertEqual(t, jwtTime, JWTTokenExpirationDate().Round(time.Second))
+	jwtTime = time.Now().Round(time.Second)
+	core.AssertEqual(t, jwtTime, JWTTokenExpirationDate(0).Round(time.Second))
 
-	os.Setenv("JWT_TOKEN_EXPIRATION", "2")
 	jwtTime = time.Now().Add(time.Hour * 2).Round(time.Second)
-	core.AssertEqual(t, jwtTime, JWTTokenExpirationDate().Round(time.Second))
+	core.AssertEqual(t, jwtTime, JWTTokenExpirationDate(2*time.Hour).Round(time.Second))
+}
 
-	os.Setenv("JWT_TOKEN_EXPIRATION", "") // defaults to 24h if the conversion is wrong
-	jwtTime = time.Now().Add(time.Hour * 24).Round(time.Second)
-	core.AssertEqual(t, jwtTime, JWTTokenExpirationDate().Round(time.Second))
+func TestJWTRoles(t *testing.T) {
+	key := "secret"
+	for _, admin := range []bool{false, true} {
+		u := User{Admin: admin}
+		u.ID = 7
+		token, err := IssueJWToken(u.ID, JWTRoles(u), JWTTokenExpirationDate(time.Hour), key)
+		core.AssertNoError(t, err)
 
-	os.Setenv("JWT_TOKEN_EXPIRATION", "24")
+		parsed, err := VerifyJWTToken(token, key)
+		core.AssertNoError(t, err)
+		claims := parsed.Claims.(jwt.MapClaims)
+		core.AssertEqual(t, true, HasJWTRole(claims, JWT_ROLE_USER))
+		core.AssertEqual(t, admin, HasJWTRole(claims, JWT_ROLE_ADMIN))
+	}
 }
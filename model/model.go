@@ -18,8 +18,7 @@ type Model struct {
 }
 
 func (m Model) OrderBy(db *gorm.DB) *gorm.DB {
-	order := "\"created_at\" DESC"
-	return db.Order(order)
+	return db.Order(core.Quote(db, "created_at") + " DESC")
 }
 
 func ParentIdField(t reflect.Type) (field *reflect.StructField, dbFieldName string) {
@@ -68,6 +67,22 @@ func OrderField(t reflect.Type) (field *reflect.StructField, dbFieldName string)
 	return
 }
 
+func VersionField(t reflect.Type) (field *reflect.StructField, dbFieldName string) {
+	elemT := t
+	if elemT.Kind() == reflect.Ptr {
+		elemT = elemT.Elem()
+	}
+	for i := 0; i < elemT.NumField(); i++ {
+		tag := elemT.Field(i).Tag
+		if tag.Get("version_field") != "" {
+			dbFieldName = tag.Get("version_field")
+			fieldRef := elemT.Field(i)
+			field = &fieldRef
+		}
+	}
+	return
+}
+
 func SetUserID(item interface{}, id uint) error {
 	v := reflect.ValueOf(item)
 	if v.Kind() == reflect.Ptr {
@@ -95,6 +110,11 @@ func TypeHasParentField(t reflect.Type) bool {
 	return parentField != nil
 }
 
+func TypeHasVersionField(t reflect.Type) bool {
+	versionField, _ := VersionField(t)
+	return versionField != nil
+}
+
 func TypeHasUserField(t reflect.Type) bool {
 	userField, _ := UserIDField(t)
 	return userField != nil
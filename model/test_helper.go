@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/brunoksato/golang-boilerplate/cache"
 	"github.com/brunoksato/golang-boilerplate/core"
 	"github.com/jinzhu/gorm"
 	"golang.org/x/crypto/bcrypt"
@@ -53,6 +54,8 @@ func InitTestDB() *gorm.DB {
 	db.DB().SetMaxIdleConns(1)
 	db.DB().SetMaxOpenConns(1)
 
+	core.RegisterContextCallbacks(db)
+	cache.RegisterCallbacks(db)
 	runMigration(db)
 
 	return db
@@ -62,6 +65,10 @@ func runMigration(db *gorm.DB) {
 	values := []interface{}{
 		&Configuration{},
 		&User{},
+		&Export{},
+		&Import{},
+		&Attachment{},
+		&IdempotencyKey{},
 	}
 
 	for _, value := range values {
@@ -75,9 +82,10 @@ func runMigration(db *gorm.DB) {
 		panic(fmt.Sprintf("No error should happen when create table, but got %+v", err))
 	}
 
-	db.Exec("CREATE UNIQUE INDEX idx_users_email ON users USING btree (email);")
-	db.Exec("CREATE UNIQUE INDEX idx_users_username ON users USING btree (username);")
+	db.Exec("CREATE UNIQUE INDEX idx_users_email ON users (email);")
+	db.Exec("CREATE UNIQUE INDEX idx_users_username ON users (username);")
 	db.Exec("CREATE UNIQUE INDEX idx_lower_case_username ON users ((lower(username)));")
+	db.Exec("CREATE UNIQUE INDEX idx_idempotency_keys_user_id_key ON idempotency_keys (user_id, key);")
 
 	SeedDatabase(db)
 }
@@ -91,6 +99,22 @@ func DeleteAllCommitedEntities(db *gorm.DB) {
 	if err != nil {
 		fmt.Println("Error deleting User", err)
 	}
+	err = db.Delete(&Export{}).Error
+	if err != nil {
+		fmt.Println("Error deleting Export", err)
+	}
+	err = db.Delete(&Import{}).Error
+	if err != nil {
+		fmt.Println("Error deleting Import", err)
+	}
+	err = db.Delete(&Attachment{}).Error
+	if err != nil {
+		fmt.Println("Error deleting Attachment", err)
+	}
+	err = db.Delete(&IdempotencyKey{}).Error
+	if err != nil {
+		fmt.Println("Error deleting IdempotencyKey", err)
+	}
 }
 
 func SeedDatabase(db *gorm.DB) {
@@ -1,12 +1,14 @@
 package model
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"os"
-	"strings"
 
+	"github.com/brunoksato/golang-boilerplate/config"
 	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/brunoksato/golang-boilerplate/tracing"
 	"github.com/jinzhu/gorm"
 	"github.com/sendgrid/sendgrid-go"
 	"golang.org/x/crypto/bcrypt"
@@ -22,6 +24,7 @@ type User struct {
 	Password       string                  `json:"password,omitempty" sql:"-" valid:"length(5|64)"`
 	HashedPassword []byte                  `json:"-" sql:"hashed_password;not null" gorm:"size:32"`
 	Image          string                  `json:"image"`
+	AvatarID       *uint                   `json:"avatar_id,omitempty" settable:"false"`
 	Phone          string                  `json:"phone"`
 	Balance        float64                 `json:"balance" sql:"default:0"`
 	Admin          bool                    `json:"admin"`
@@ -29,44 +32,11 @@ type User struct {
 }
 
 func (u User) ValidateForCreate() core.DefaultError {
-	err := u.ValidateField("name")
-	if err != nil {
-		return err
-	}
-	err = u.ValidateField("username")
-	if err != nil {
-		return err
-	}
-	err = u.ValidateField("email")
-	if err != nil {
-		return err
-	}
-	err = u.ValidateField("password")
-	if err != nil {
-		return err
-	}
-	err = u.ValidateField("phone")
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return ValidateStructFields(u, []string{"name", "username", "email", "password", "phone"})
 }
 
 func (u User) ValidateForUpdate() core.DefaultError {
-	err := u.ValidateField("name")
-	if err != nil {
-		return err
-	}
-	err = u.ValidateField("email")
-	if err != nil {
-		return err
-	}
-	err = u.ValidateField("phone")
-	if err != nil {
-		return err
-	}
-	return nil
+	return ValidateStructFields(u, []string{"name", "email", "phone"})
 }
 
 func (u User) ValidateForDelete(ctx *ModelCtx) core.DefaultError {
@@ -74,43 +44,7 @@ func (u User) ValidateForDelete(ctx *ModelCtx) core.DefaultError {
 }
 
 func (u User) ValidateField(f string) core.DefaultError {
-	data := map[string]interface{}{"field": f}
-	err := ValidateStructField(u, f)
-
-	if err != nil {
-		switch f {
-		case "email":
-			if strings.Contains(err.Error(), "validate as email") {
-				err = core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_EMAIL_FORMAT, data)
-			}
-		case "name":
-			if strings.Contains(err.Error(), "validate as matches") {
-				err = core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_NAME_FORMAT, data)
-			} else if strings.Contains(err.Error(), "validate as length") {
-				err = core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_NAME_LENGTH, data)
-			}
-		case "username":
-			if strings.Contains(err.Error(), "validate as matches") {
-				err = core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_USERNAME_FORMAT, data)
-			} else if strings.Contains(err.Error(), "validate as length") {
-				err = core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_USERNAME_LENGTH, data)
-			}
-		case "phone":
-			if strings.Contains(err.Error(), "validate as matches") {
-				err = core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_PHONE_TAKEN, data)
-			} else if strings.Contains(err.Error(), "validate as length") {
-				err = core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_PHONE_LENGTH, data)
-			}
-		case "password":
-			if strings.Contains(err.Error(), "validate as password") {
-				err = core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_PASSWORD_FORMAT, data)
-			} else if strings.Contains(err.Error(), "validate as length") {
-				err = core.NewBusinessError(err.Error(), core.ERROR_SUBCODE_PASSWORD_LENGTH, data)
-			}
-		}
-	}
-
-	return err
+	return ValidateStructField(u, f)
 }
 
 // Restrictor
@@ -123,11 +57,25 @@ func (u User) UserCanCreate(ctx *ModelCtx, creator User) (bool, core.DefaultErro
 	return true, nil
 }
 
+// USER_UPDATABLE_FIELDS are the json fields users change on their own
+// account, the others are only set by the system.
+var USER_UPDATABLE_FIELDS = map[string]bool{
+	"name":  true,
+	"email": true,
+	"phone": true,
+	"image": true,
+}
+
 func (u User) UserCanUpdate(ctx *ModelCtx, updater User, fields []string) (bool, core.DefaultError) {
-	if u.ID == updater.ID {
-		return true, nil
+	if u.ID != updater.ID {
+		return false, nil
 	}
-	return false, nil
+	for _, field := range fields {
+		if !USER_UPDATABLE_FIELDS[field] {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 func (u User) UserCanDelete(ctx *ModelCtx, deleter User) (bool, core.DefaultError) {
@@ -136,7 +84,7 @@ func (u User) UserCanDelete(ctx *ModelCtx, deleter User) (bool, core.DefaultErro
 
 // Creator Interface
 func (u *User) Create(ctx *ModelCtx, creator User) core.DefaultError {
-	db := ctx.Database
+	repo := ctx.Repo()
 
 	err := u.ValidateForCreate()
 	if err != nil {
@@ -144,7 +92,7 @@ func (u *User) Create(ctx *ModelCtx, creator User) core.DefaultError {
 	}
 
 	var existing User
-	dberr := db.Scopes(ByUserEmail(u.Email)).First(&existing).Error
+	dberr := repo.First(&existing, repository.Where(repository.EqualFold("email", u.Email)))
 	if dberr == nil {
 		data := map[string]interface{}{
 			"creator_id": creator.ID,
@@ -158,7 +106,7 @@ func (u *User) Create(ctx *ModelCtx, creator User) core.DefaultError {
 		)
 	}
 
-	dberr = db.Scopes(ByUserUsername(u.Username)).First(&existing).Error
+	dberr = repo.First(&existing, repository.Where(repository.EqualFold("username", u.Username)))
 	if dberr == nil {
 		data := map[string]interface{}{
 			"creator_id": creator.ID,
@@ -172,6 +120,11 @@ func (u *User) Create(ctx *ModelCtx, creator User) core.DefaultError {
 		)
 	}
 
+	// Hashing is slow, don't when the client is gone.
+	if cerr := ctx.Context().Err(); cerr != nil {
+		return core.NewServerError(cerr.Error())
+	}
+
 	// User bcrypt to generate HashedPassword
 	u.HashedPassword, dberr = bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 	if dberr != nil {
@@ -185,7 +138,7 @@ func (u *User) Create(ctx *ModelCtx, creator User) core.DefaultError {
 
 	u.Password = ""
 
-	dberr = db.Set("gorm:save_associations", false).Create(&u).Error
+	dberr = repo.Create(u)
 	if dberr != nil {
 		data := map[string]interface{}{
 			"creator_id": creator.ID,
@@ -199,11 +152,14 @@ func (u *User) Create(ctx *ModelCtx, creator User) core.DefaultError {
 }
 
 func (u *User) Update(ctx *ModelCtx, creator User) core.DefaultError {
-	db := ctx.Database
+	repo := ctx.Repo()
 
 	if u.Email != "" {
 		var existing User
-		dberr := db.Scopes(ByUserEmail(u.Email)).First(&existing).Error
+		dberr := repo.First(&existing, repository.Where(
+			repository.EqualFold("email", u.Email),
+			repository.Not("id", u.ID),
+		))
 		if dberr == nil {
 			data := map[string]interface{}{
 				"creator_id": creator.ID,
@@ -218,7 +174,7 @@ func (u *User) Update(ctx *ModelCtx, creator User) core.DefaultError {
 		}
 	}
 
-	dberr := db.Set("gorm:save_associations", false).Save(&u).Error
+	dberr := repo.Update(u)
 	if dberr != nil {
 		data := map[string]interface{}{
 			"creator_id": creator.ID,
@@ -248,19 +204,23 @@ func (u User) VerifyPassword(password string) (bool, error) {
 // Scopes
 func ByUserEmail(email string) func(*gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
-		return db.Where("LOWER(users.email) = LOWER(?)", email)
+		return db.Where(core.EqualFold(db, core.Quote(db, "users", "email")), email)
 	}
 }
 
 func ByUserUsername(username string) func(*gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
-		return db.Where("LOWER(users.username) = LOWER(?)", username)
+		return db.Where(core.EqualFold(db, core.Quote(db, "users", "username")), username)
 	}
 }
 
 // email
-func (u User) ResetPasswordEmail(token string) {
-	request := sendgrid.GetRequest(os.Getenv("SENDGRID_KEY"), "/v3/mail/send", "https://api.sendgrid.com")
+func (u User) ResetPasswordEmail(ctx context.Context, token string, cfg config.SendgridConfig) {
+	_, span := tracing.StartSpan(ctx, "sendgrid.send", tracing.KIND_CLIENT)
+	defer span.End()
+	span.SetAttribute("peer.service", "sendgrid")
+
+	request := sendgrid.GetRequest(cfg.Key, "/v3/mail/send", "https://api.sendgrid.com")
 	request.Method = "POST"
 	request.Body = []byte(`{
     "personalizations": [
@@ -279,7 +239,7 @@ func (u User) ResetPasswordEmail(token string) {
 			}
     ],
     "from": {
-			"email": "` + os.Getenv("SENDGRID_USER") + `",
+			"email": "` + cfg.User + `",
 			"name": "Server"
     },
     "template_id" : "d-aedb512d0ca7460cadc0027d561d9c25"
@@ -287,6 +247,7 @@ func (u User) ResetPasswordEmail(token string) {
 
 	response, err := sendgrid.API(request)
 	if err != nil {
+		span.SetError(err)
 		log.Println(err)
 	} else {
 		fmt.Println(response.Body)
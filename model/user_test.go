@@ -81,6 +81,10 @@ func TestUserRestrictor(t *testing.T) {
 	AssertUserCan(t, owner.UserCanView, CTX, owner)
 	AssertUserCan(t, owner.UserCanCreate, CTX, owner)
 	AssertUserCanUpdate(t, owner.UserCanUpdate, CTX, owner, []string{})
+	AssertUserCanUpdate(t, owner.UserCanUpdate, CTX, owner, []string{"name", "email", "phone", "image"})
+	AssertUserCantUpdate(t, owner.UserCanUpdate, CTX, owner, []string{"name", "admin"})
+	AssertUserCantUpdate(t, owner.UserCanUpdate, CTX, owner, []string{"balance"})
+	AssertUserCantUpdate(t, owner.UserCanUpdate, CTX, owner, []string{"ban"})
 	AssertUserCant(t, owner.UserCanDelete, CTX, owner)
 
 	AssertUserCan(t, notOwner.UserCanView, CTX, view)
@@ -1,8 +1,8 @@
 package model
 
 import (
-	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/brunoksato/golang-boilerplate/core"
@@ -16,65 +16,232 @@ type Validator interface {
 	ValidateField(string) core.DefaultError
 }
 
+// VALIDATION_SUBCODES maps the json name of a field and the valid rule it
+// failed to the subcode of the error. Failures not listed here get
+// ERROR_SUBCODE_UNDEFINED.
+var VALIDATION_SUBCODES = map[string]map[string]int{
+	"name": {
+		"length":  core.ERROR_SUBCODE_NAME_LENGTH,
+		"matches": core.ERROR_SUBCODE_NAME_FORMAT,
+	},
+	"username": {
+		"length":  core.ERROR_SUBCODE_USERNAME_LENGTH,
+		"matches": core.ERROR_SUBCODE_USERNAME_FORMAT,
+	},
+	"email": {
+		"email": core.ERROR_SUBCODE_EMAIL_FORMAT,
+	},
+	"phone": {
+		"length":  core.ERROR_SUBCODE_PHONE_LENGTH,
+		"matches": core.ERROR_SUBCODE_PHONE_FORMAT,
+	},
+	"password": {
+		"length":  core.ERROR_SUBCODE_PASSWORD_LENGTH,
+		"matches": core.ERROR_SUBCODE_PASSWORD_FORMAT,
+	},
+}
+
 func IsValidator(t reflect.Type) bool {
 	modelType := reflect.TypeOf((*Validator)(nil)).Elem()
 	return t.Implements(modelType)
 }
 
-func ValidateStruct(item interface{}) core.DefaultError {
-	_, err := govalidator.ValidateStruct(item)
-	if err != nil {
-		return core.NewBusinessError(err.Error())
+func ValidationSubcode(field, rule string) int {
+	if subcode, ok := VALIDATION_SUBCODES[field][rule]; ok {
+		return subcode
 	}
-	return nil
+	return core.ERROR_SUBCODE_UNDEFINED
 }
 
-func ValidateStructField(item interface{}, f string) core.DefaultError {
-	_, err := govalidator.ValidateStruct(item)
-	errStr := govalidator.ErrorByField(err, f)
-
-	if errStr != "" {
-		return core.NewBusinessError(fmt.Sprintf("%s: %s;", f, errStr))
+func ValidateStruct(item interface{}) core.DefaultError {
+	errs := ValidationErrors(item)
+	if len(errs) == 0 {
+		return nil
 	}
+	return core.NewValidationError(errs)
+}
 
-	return nil
+func ValidateStructField(item interface{}, f string) core.DefaultError {
+	return ValidateStructFields(item, []string{f})
 }
 
+// ValidateStructFields only reports the given fields, named either by json
+// name or by struct field name, in the order given.
 func ValidateStructFields(item interface{}, fs []string) core.DefaultError {
-	_, err := govalidator.ValidateStruct(item)
-	if err == nil {
-		return nil
+	byField := map[string]core.FieldError{}
+	for _, fe := range validationErrors(item) {
+		byField[fe.GoName] = fe.FieldError
+		byField[fe.Field] = fe.FieldError
 	}
 
-	result := ""
+	errs := []core.FieldError{}
 	for _, f := range fs {
-		errStr := govalidator.ErrorByField(err, f)
-		if errStr != "" {
-			result = fmt.Sprintf("%s%s: %s;", result, f, errStr)
+		if fe, ok := byField[f]; ok {
+			errs = append(errs, fe)
 		}
 	}
 
-	if result == "" {
+	if len(errs) == 0 {
 		return nil
 	}
-
-	return core.NewBusinessError(result)
+	return core.NewValidationError(errs)
 }
 
 func ValidateRequiredFields(item interface{}, fields []string) core.DefaultError {
 	itemVal := reflect.ValueOf(item)
-	errStr := ""
+	errs := []core.FieldError{}
 
 	for _, fName := range fields {
 		f := itemVal.FieldByName(fName)
 		if util.IsEmptyValue(f) {
-			errStr = fmt.Sprintf("%s%s: non zero value required;", errStr, fName)
+			errs = append(errs, core.FieldError{
+				Field:   fName,
+				Rule:    "required",
+				Subcode: ValidationSubcode(fName, "required"),
+				Message: "non zero value required",
+			})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return core.NewValidationError(errs)
+}
+
+type namedFieldError struct {
+	core.FieldError
+	GoName string
+}
+
+// ValidationErrors checks the valid rules of every field of item, in field
+// order, and returns the first rule each field fails. Fields are named like
+// govalidator names them: by json name when they have one.
+func ValidationErrors(item interface{}) []core.FieldError {
+	errs := []core.FieldError{}
+	for _, fe := range validationErrors(item) {
+		errs = append(errs, fe.FieldError)
+	}
+	return errs
+}
+
+// validationErrors maps the errors of govalidator.ValidateStruct to field
+// errors. Those of embedded structs are kept, those of other nested structs
+// left to their own validation. A rule govalidator does not know fails too.
+func validationErrors(item interface{}) []namedFieldError {
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	_, err := govalidator.ValidateStruct(v.Interface())
+	if err == nil {
+		return nil
+	}
+
+	fields := map[string]reflect.StructField{}
+	embedded := map[string]bool{}
+	addValidFields(v.Type(), fields, embedded)
+
+	errs := []namedFieldError{}
+	for _, err := range flattenValidationErrors(err) {
+		e, ok := err.(govalidator.Error)
+		if !ok {
+			errs = append(errs, namedFieldError{FieldError: core.FieldError{
+				Subcode: core.ERROR_SUBCODE_UNDEFINED,
+				Message: err.Error(),
+			}})
+			continue
 		}
+		if !isEmbeddedPath(e.Path, embedded) {
+			continue
+		}
+
+		f := fields[e.Name]
+		goName := f.Name
+		if goName == "" {
+			goName = e.Name
+		}
+		errs = append(errs, namedFieldError{
+			FieldError: core.FieldError{
+				Field:   e.Name,
+				Rule:    e.Validator,
+				Params:  ruleParams(f.Tag.Get("valid"), e.Validator),
+				Subcode: ValidationSubcode(e.Name, e.Validator),
+				Message: e.Err.Error(),
+			},
+			GoName: goName,
+		})
 	}
+	return errs
+}
 
-	if errStr != "" {
-		return core.NewBusinessError(errStr)
+func flattenValidationErrors(err error) []error {
+	errs, ok := err.(govalidator.Errors)
+	if !ok {
+		return []error{err}
 	}
+	flat := []error{}
+	for _, err := range errs {
+		flat = append(flat, flattenValidationErrors(err)...)
+	}
+	return flat
+}
 
+// addValidFields indexes the fields of t with valid rules by the name
+// govalidator gives them, and notes the embedded structs it descends into.
+func addValidFields(t reflect.Type, fields map[string]reflect.StructField, embedded map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			embedded[f.Name] = true
+			addValidFields(f.Type, fields, embedded)
+			continue
+		}
+
+		name := core.JsonName(f)
+		if name == "" || name == "-" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+}
+
+func isEmbeddedPath(path []string, embedded map[string]bool) bool {
+	for _, name := range path {
+		if !embedded[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleParams are the parameters of rule in a valid tag, like 3 and 255 for
+// length(3|255).
+func ruleParams(tag, rule string) []string {
+	re, ok := govalidator.ParamTagRegexMap[rule]
+	if !ok {
+		re, ok = govalidator.InterfaceParamTagRegexMap[rule]
+	}
+	if !ok {
+		return nil
+	}
+
+	for _, spec := range strings.Split(tag, ",") {
+		// govalidator accepts a custom message after a tilde.
+		if i := strings.Index(spec, "~"); i >= 0 {
+			spec = spec[:i]
+		}
+		spec = strings.TrimPrefix(strings.TrimSpace(spec), "!")
+		if match := re.FindStringSubmatch(spec); len(match) > 0 {
+			return match[1:]
+		}
+	}
 	return nil
 }
@@ -133,3 +133,51 @@ type ValidationTestStruct struct {
 	Email            string `valid:"email"`
 	DoubleValidation string `valid:"alphanum,length(3|10)"`
 }
+
+func TestValidationErrorsAreStructured(t *testing.T) {
+	u := User{Name: "u2", Username: "brunoksato", Email: "32", Password: "N"}
+
+	err := u.ValidateForCreate()
+	core.AssertBusinessError(t, "name: u2 does not validate as length(3|255);email: 32 does not validate as email;password: N does not validate as length(5|64);", err)
+	core.AssertEqual(t, core.ERROR_SUBCODE_NAME_LENGTH, err.Subcode())
+
+	errs := core.FieldErrors(err)
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 field errors, got %d", len(errs))
+	}
+	core.AssertEqual(t, "name", errs[0].Field)
+	core.AssertEqual(t, "length", errs[0].Rule)
+	core.AssertEqual(t, "3", errs[0].Params[0])
+	core.AssertEqual(t, "255", errs[0].Params[1])
+	core.AssertEqual(t, "email", errs[1].Field)
+	core.AssertEqual(t, core.ERROR_SUBCODE_EMAIL_FORMAT, errs[1].Subcode)
+	core.AssertEqual(t, "password", errs[2].Field)
+	core.AssertEqual(t, core.ERROR_SUBCODE_PASSWORD_LENGTH, errs[2].Subcode)
+}
+
+func TestValidateStructFieldsByStructName(t *testing.T) {
+	u := User{Name: "Bruno Sato", Username: "u1", Email: "bruno@model.com"}
+
+	err := ValidateStructFields(u, []string{"Username"})
+	core.AssertEqual(t, core.ERROR_SUBCODE_USERNAME_LENGTH, err.Subcode())
+	core.AssertEqual(t, "username", core.FieldErrors(err)[0].Field)
+
+	u.Username = "-bad"
+	err = ValidateStructFields(u, []string{"username"})
+	core.AssertEqual(t, core.ERROR_SUBCODE_USERNAME_FORMAT, err.Subcode())
+	core.AssertEqual(t, "matches", core.FieldErrors(err)[0].Rule)
+}
+
+func TestValidateStructUnknownRuleFails(t *testing.T) {
+	v := struct {
+		Code string `valid:"nosuchrule"`
+	}{Code: "x"}
+
+	errs := ValidationErrors(v)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 field error, got %d", len(errs))
+	}
+	core.AssertEqual(t, "Code", errs[0].Field)
+	core.AssertEqual(t, "nosuchrule", errs[0].Rule)
+	core.AssertEqual(t, core.ERROR_SUBCODE_UNDEFINED, errs[0].Subcode)
+}
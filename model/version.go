@@ -0,0 +1,74 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/repository"
+)
+
+func VersionOf(item interface{}) interface{} {
+	v := reflect.Indirect(reflect.ValueOf(item))
+	versionField, _ := VersionField(v.Type())
+	if versionField == nil {
+		return nil
+	}
+
+	return v.FieldByName(versionField.Name).Interface()
+}
+
+func ETagFor(item interface{}) string {
+	version := VersionOf(item)
+	if version == nil {
+		return ""
+	}
+
+	id, _ := core.GetID(item)
+	switch val := version.(type) {
+	case time.Time:
+		return fmt.Sprintf("\"%d-%d\"", id, val.UnixNano())
+	default:
+		return fmt.Sprintf("\"%d-%v\"", id, val)
+	}
+}
+
+// BumpVersion moves the stored version of item forward, but only if the row
+// still carries the expected version. The new value is set on item so that a
+// following Save keeps it.
+func BumpVersion(repo repository.Repository, item interface{}, expected interface{}) core.DefaultError {
+	v := reflect.Indirect(reflect.ValueOf(item))
+	versionField, dbFieldName := VersionField(v.Type())
+	if versionField == nil {
+		return nil
+	}
+
+	var next interface{}
+	switch val := expected.(type) {
+	case time.Time:
+		next = time.Now()
+	case uint:
+		next = val + 1
+	case uint64:
+		next = val + 1
+	case int:
+		next = val + 1
+	case int64:
+		next = val + 1
+	default:
+		return core.NewServerError(fmt.Sprintf("Unsupported version type %T", expected))
+	}
+
+	err := repo.UpdateFields(item, map[string]interface{}{dbFieldName: next}, repository.Eq(dbFieldName, expected))
+	if err == repository.ErrNotFound {
+		return core.NewPreconditionFailedError("The item was modified by someone else",
+			core.ERROR_SUBCODE_VERSION_MISMATCH)
+	}
+	if err != nil {
+		return core.NewServerError(err.Error())
+	}
+
+	v.FieldByName(versionField.Name).Set(reflect.ValueOf(next))
+	return nil
+}
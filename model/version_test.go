@@ -0,0 +1,61 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/repository"
+)
+
+func TestTypeHasVersionField(t *testing.T) {
+	core.AssertTrue(t, TypeHasVersionField(reflect.TypeOf(Configuration{})))
+	core.AssertFalse(t, TypeHasVersionField(reflect.TypeOf(User{})))
+
+	_, dbFieldName := VersionField(reflect.TypeOf(&Configuration{}))
+	core.AssertEqual(t, "version", dbFieldName)
+}
+
+func TestETagFor(t *testing.T) {
+	c := Configuration{Model: Model{ID: 3}, Version: 7}
+	core.AssertEqual(t, "\"3-7\"", ETagFor(&c))
+
+	u := User{Model: Model{ID: 3}}
+	core.AssertEqual(t, "", ETagFor(&u))
+}
+
+func TestBumpVersion(t *testing.T) {
+	setupDB()
+	defer teardownDB()
+
+	c := Configuration{MinValueBuy: 10}
+	TESTDB.Create(&c)
+	TESTDB.First(&c, c.ID)
+	core.AssertEqual(t, uint(1), c.Version)
+
+	err := BumpVersion(repository.NewGorm(TESTDB), &c, uint(1))
+	core.AssertNoError(t, err)
+	core.AssertEqual(t, uint(2), c.Version)
+
+	stored := Configuration{}
+	TESTDB.First(&stored, c.ID)
+	core.AssertEqual(t, uint(2), stored.Version)
+
+	err = BumpVersion(repository.NewGorm(TESTDB), &c, uint(1))
+	core.AssertPreconditionFailedError(t, "The item was modified by someone else", err)
+	core.AssertEqual(t, core.ERROR_SUBCODE_VERSION_MISMATCH, err.Subcode())
+}
+
+func TestBumpVersionWithoutDatabase(t *testing.T) {
+	repo := repository.NewMemory()
+	c := Configuration{MinValueBuy: 10, Version: 1}
+	core.AssertNoError(t, repo.Create(&c))
+
+	core.AssertNoError(t, BumpVersion(repo, &c, uint(1)))
+	stored := Configuration{}
+	repo.FindByID(&stored, c.ID)
+	core.AssertEqual(t, uint(2), stored.Version)
+
+	err := BumpVersion(repo, &c, uint(1))
+	core.AssertEqual(t, core.ERROR_SUBCODE_VERSION_MISMATCH, err.Subcode())
+}
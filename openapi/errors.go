@@ -0,0 +1,121 @@
+package openapi
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+)
+
+// ERROR_RESPONSES names the shared error response of each status code.
+var ERROR_RESPONSES = map[int]string{
+	core.ERROR_CODE_BUSINESS_ERROR:       "BusinessError",
+	core.ERROR_CODE_AUTHENTICATION_ERROR: "AuthenticationError",
+	core.ERROR_CODE_PERMISSION_ERROR:     "PermissionError",
+	core.ERROR_CODE_NOT_FOUND:            "NotFound",
+	core.ERROR_CODE_PRECONDITION_FAILED:  "PreconditionFailed",
+	core.ERROR_CODE_UNPROCESSABLE:        "Unprocessable",
+	core.ERROR_CODE_SERVER_ERROR:         "ServerError",
+	core.ERROR_CODE_SERVICE_UNAVAILABLE:  "ServiceUnavailable",
+}
+
+// ErrorSchema mirrors the body log.AddDefaultError writes: the code is the
+// subcode of the error when it has one and its code otherwise.
+func ErrorSchema() *Schema {
+	codes := []int{}
+	for code := range core.ERROR_CODE_NAMES {
+		codes = append(codes, code)
+	}
+	for code := range core.ERROR_SUBCODE_NAMES {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	lines := []string{"Subcode of the error, or its code when it has none."}
+	enum := []interface{}{}
+	for _, code := range codes {
+		name, ok := core.ERROR_SUBCODE_NAMES[code]
+		if !ok {
+			name = core.ERROR_CODE_NAMES[code]
+		}
+		lines = append(lines, fmt.Sprintf("  * %d - %s", code, name))
+		enum = append(enum, code)
+	}
+
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code": {
+				Type:        "integer",
+				Format:      "int32",
+				Description: strings.Join(lines, "\n"),
+				Enum:        enum,
+			},
+			"message": {Type: "string"},
+			"errors":  fieldErrorsSchema(),
+		},
+		Required: []string{"message"},
+	}
+}
+
+// ProblemSchema mirrors the RFC 7807 body clients get when they accept
+// application/problem+json.
+func ProblemSchema() *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"type":     {Type: "string", Format: "uri-reference", Description: "Named after the subcode, e.g. /problems/email-format"},
+			"title":    {Type: "string"},
+			"status":   {Type: "integer", Format: "int32"},
+			"detail":   {Type: "string"},
+			"instance": {Type: "string", Format: "uri-reference"},
+			"code":     {Type: "integer", Format: "int32"},
+			"subcode":  {Type: "integer", Format: "int32"},
+			"errors":   fieldErrorsSchema(),
+		},
+		Required: []string{"code", "status", "title", "type"},
+	}
+}
+
+func fieldErrorsSchema() *Schema {
+	return &Schema{
+		Type:        "array",
+		Description: "Every invalid field of a validation error.",
+		Items: &Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"field":   {Type: "string"},
+				"rule":    {Type: "string"},
+				"params":  {Type: "array", Items: &Schema{Type: "string"}},
+				"subcode": {Type: "integer", Format: "int32"},
+				"message": {Type: "string"},
+			},
+			Required: []string{"field", "message", "rule", "subcode"},
+		},
+	}
+}
+
+func errorResponses() map[string]*Response {
+	responses := map[string]*Response{}
+	for code, name := range ERROR_RESPONSES {
+		responses[name] = &Response{
+			Description: core.ERROR_CODE_NAMES[code],
+			Content: map[string]MediaType{
+				"application/json":         {Schema: &Schema{Ref: "#/components/schemas/Error"}},
+				"application/problem+json": {Schema: &Schema{Ref: "#/components/schemas/Problem"}},
+			},
+		}
+	}
+	return responses
+}
+
+// AddError adds the shared error response of status code to op.
+func (op *Operation) AddError(code int) {
+	name, ok := ERROR_RESPONSES[code]
+	if !ok {
+		return
+	}
+	op.Responses[strconv.Itoa(code)] = &Response{Ref: "#/components/responses/" + name}
+}
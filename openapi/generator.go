@@ -0,0 +1,229 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Route is one registered endpoint. Handler is the short handler name, like
+// "api.Get", and Type the model the path resolves to, if any.
+type Route struct {
+	Method  string
+	Path    string
+	Handler string
+	Type    reflect.Type
+}
+
+// Describer fills in the operation of a route served by a given handler.
+type Describer func(g *Generator, r Route, op *Operation)
+
+type Generator struct {
+	Info Info
+	// Describers is keyed by short handler name. Routes without one get a
+	// bare 200 response.
+	Describers map[string]Describer
+	// Security returns the security requirements of a path, nil when the
+	// path is public.
+	Security        func(path string) []map[string][]string
+	SecuritySchemes map[string]*SecurityScheme
+
+	doc *Document
+}
+
+// Generate builds the document of routes. Its output only depends on the
+// routes and types, so it can be diffed against a committed copy.
+func (g *Generator) Generate(routes []Route) *Document {
+	g.doc = &Document{
+		OpenAPI: OPENAPI_VERSION,
+		Info:    g.Info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{"Error": ErrorSchema(), "Problem": ProblemSchema()},
+			Responses:       errorResponses(),
+			SecuritySchemes: g.SecuritySchemes,
+		},
+	}
+
+	sorted := make([]Route, len(routes))
+	copy(sorted, routes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Method < sorted[j].Method
+	})
+
+	for _, r := range sorted {
+		path := Path(r.Path)
+		item, ok := g.doc.Paths[path]
+		if !ok {
+			item = PathItem{}
+			g.doc.Paths[path] = item
+		}
+		item[strings.ToLower(r.Method)] = g.operation(r)
+	}
+
+	return g.doc
+}
+
+func (g *Generator) operation(r Route) *Operation {
+	op := &Operation{
+		OperationID: OperationID(r.Method, r.Path),
+		Parameters:  PathParameters(r.Path),
+		Responses:   map[string]*Response{},
+	}
+	if tag := Tag(r.Path); tag != "" {
+		op.Tags = []string{tag}
+	}
+
+	secured := false
+	if g.Security != nil {
+		op.Security = g.Security(r.Path)
+		secured = op.Security != nil
+	}
+
+	if describe, ok := g.Describers[r.Handler]; ok {
+		describe(g, r, op)
+	} else {
+		op.Responses["200"] = &Response{Description: http.StatusText(http.StatusOK)}
+	}
+
+	if secured {
+		op.AddError(http.StatusUnauthorized)
+	}
+	op.AddError(http.StatusInternalServerError)
+	op.AddError(http.StatusServiceUnavailable)
+	return op
+}
+
+// Path turns an echo path into an OpenAPI one: /users/:id becomes
+// /users/{id} and a trailing wildcard becomes {path}.
+func Path(echoPath string) string {
+	parts := strings.Split(echoPath, "/")
+	for i, part := range parts {
+		switch {
+		case strings.HasPrefix(part, ":"):
+			parts[i] = "{" + part[1:] + "}"
+		case part == "*":
+			parts[i] = "{path}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// PathParameters lists the parameters of an echo path in order.
+func PathParameters(echoPath string) []*Parameter {
+	params := []*Parameter{}
+	for _, part := range strings.Split(echoPath, "/") {
+		switch {
+		case strings.HasPrefix(part, ":"):
+			// Ids, like :id or :parentId, are numeric.
+			s := &Schema{Type: "string"}
+			if part == ":id" || strings.HasSuffix(part, "Id") {
+				s = &Schema{Type: "integer", Format: "int64"}
+			}
+			params = append(params, &Parameter{
+				Name:     part[1:],
+				In:       "path",
+				Required: true,
+				Schema:   s,
+			})
+		case part == "*":
+			params = append(params, &Parameter{
+				Name:     "path",
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// OperationID names an operation after its method and path, e.g.
+// GET /admin/users/:id is getAdminUsersById.
+func OperationID(method, echoPath string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.Split(echoPath, "/") {
+		switch {
+		case part == "":
+			continue
+		case part == "*":
+			part = "by_path"
+		case strings.HasPrefix(part, ":"):
+			part = "by_" + part[1:]
+		}
+		id += camel(part)
+	}
+	return id
+}
+
+func camel(s string) string {
+	out := []rune{}
+	upper := true
+	for _, r := range s {
+		if r == '_' || r == '-' || r == '.' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// Tag groups operations by the first path segment after the API prefix.
+func Tag(echoPath string) string {
+	parts := strings.Split(strings.Trim(echoPath, "/"), "/")
+	if len(parts) > 1 {
+		switch parts[0] {
+		case "api", "admin", "public", "cronjob":
+			return parts[1]
+		}
+	}
+	if parts[0] == "" {
+		return ""
+	}
+	return parts[0]
+}
+
+// Results wraps s in the payload every handler writes.
+func Results(s *Schema) *Schema {
+	return &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{"results": s},
+	}
+}
+
+func JSONContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
+
+// JSONResponse is a response with a JSON body.
+func JSONResponse(description string, s *Schema) *Response {
+	return &Response{Description: description, Content: JSONContent(s)}
+}
+
+// JSONBody is a required request body with a JSON schema.
+func JSONBody(s *Schema) *RequestBody {
+	return &RequestBody{Required: true, Content: JSONContent(s)}
+}
+
+// QueryParameter is an optional query string parameter.
+func QueryParameter(name, description string, s *Schema) *Parameter {
+	return &Parameter{Name: name, In: "query", Description: description, Schema: s}
+}
+
+// HeaderParameter is an optional request header.
+func HeaderParameter(name, description string) *Parameter {
+	return &Parameter{Name: name, In: "header", Description: description, Schema: &Schema{Type: "string"}}
+}
@@ -0,0 +1,235 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var timestampType = reflect.TypeOf(core.Timestamp{})
+var nullableTimestampType = reflect.TypeOf(core.NullableTimestamp{})
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// Schema describes t the way encoding/json renders it. Named structs are
+// registered under components/schemas and referenced, everything else is
+// inlined.
+func (g *Generator) Schema(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		nullable = true
+		t = t.Elem()
+	}
+
+	s := g.schema(t)
+	if nullable {
+		if s.Ref != "" {
+			// Siblings of $ref are ignored, so wrap it.
+			return &Schema{OneOf: []*Schema{s}, Nullable: true}
+		}
+		s.Nullable = true
+	}
+	return s
+}
+
+func (g *Generator) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case timestampType, nullableTimestampType:
+		return &Schema{Type: "integer", Format: "int64", Description: "Microseconds since the Unix epoch"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.Schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.Schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.objectSchema(t)
+		}
+		return g.Ref(t)
+	}
+
+	// interface{} and anything else encoding/json takes as it comes.
+	return &Schema{}
+}
+
+// Ref registers the named struct t as a component and returns a reference
+// to it.
+func (g *Generator) Ref(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name := t.Name()
+	if _, ok := g.doc.Components.Schemas[name]; !ok {
+		// Reserve the name first so self references terminate.
+		g.doc.Components.Schemas[name] = nil
+		g.doc.Components.Schemas[name] = g.objectSchema(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (g *Generator) objectSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.addFields(s, t)
+	sort.Strings(s.Required)
+	return s
+}
+
+func (g *Generator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := core.JsonName(f)
+		if name == "-" {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := g.Schema(f.Type)
+		required := FieldSchema(fs, f)
+		s.Properties[name] = fs
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// FieldSchema applies the tags of f to its schema fs and reports whether the
+// field is required:
+//   - settable:"false" fields are read only, the API ignores them on input
+//   - sql:"-" fields are write only, they are never stored nor returned
+//   - valid rules become the matching JSON schema keywords
+//   - valid:"required" and sql:"not null" without a default make it required
+func FieldSchema(fs *Schema, f reflect.StructField) bool {
+	target := fs
+	if len(fs.OneOf) == 1 {
+		target = fs.OneOf[0]
+	}
+
+	readOnly := f.Tag.Get("settable") == "false"
+	sqlTag := strings.ToLower(f.Tag.Get("sql"))
+	if readOnly {
+		fs.ReadOnly = true
+	} else if sqlTag == "-" {
+		fs.WriteOnly = true
+	}
+
+	required := false
+	if strings.Contains(sqlTag, "not null") && !strings.Contains(sqlTag, "default") && !readOnly {
+		required = true
+	}
+
+	for _, rule := range strings.Split(f.Tag.Get("valid"), ",") {
+		// govalidator accepts a custom message after a tilde.
+		if i := strings.Index(rule, "~"); i >= 0 {
+			rule = rule[:i]
+		}
+		rule = strings.TrimSpace(rule)
+		name, args := ruleArgs(rule)
+
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			target.Format = "email"
+		case "url", "requrl", "requri":
+			target.Format = "uri"
+		case "uuid", "uuidv3", "uuidv4", "uuidv5":
+			target.Format = "uuid"
+		case "ipv4", "ipv6":
+			target.Format = name
+		case "alpha":
+			target.Pattern = "^[a-zA-Z]+$"
+		case "alphanum":
+			target.Pattern = "^[a-zA-Z0-9]+$"
+		case "numeric":
+			target.Pattern = "^[0-9]+$"
+		case "matches":
+			if len(args) > 0 {
+				target.Pattern = strings.Join(args, "|")
+			}
+		case "length", "stringlength", "runelength":
+			if len(args) == 2 {
+				target.MinLength = intArg(args[0])
+				target.MaxLength = intArg(args[1])
+			}
+		case "range":
+			if len(args) == 2 {
+				target.Minimum = floatArg(args[0])
+				target.Maximum = floatArg(args[1])
+			}
+		case "in":
+			for _, arg := range args {
+				target.Enum = append(target.Enum, arg)
+			}
+		}
+	}
+
+	return required
+}
+
+// ruleArgs splits a govalidator rule like length(3|255) into its name and
+// arguments.
+func ruleArgs(rule string) (string, []string) {
+	open := strings.Index(rule, "(")
+	if open < 0 || !strings.HasSuffix(rule, ")") {
+		return rule, nil
+	}
+	return rule[:open], strings.Split(rule[open+1:len(rule)-1], "|")
+}
+
+func intArg(s string) *int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+func floatArg(s string) *float64 {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
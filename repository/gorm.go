@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/brunoksato/golang-boilerplate/cache"
+	"github.com/jinzhu/gorm"
+)
+
+// savepoints names the savepoints of nested transactions.
+var savepoints uint64
+
+// Gorm is the Repository of a database, it queries through DB and so keeps
+// its context and callbacks.
+type Gorm struct {
+	DB *gorm.DB
+}
+
+func NewGorm(db *gorm.DB) *Gorm {
+	return &Gorm{DB: db}
+}
+
+// Scope is the gorm query of q, for what only gorm can do with it, like
+// streaming the rows.
+func (r *Gorm) Scope(q Query) *gorm.DB {
+	db := r.DB
+	for _, condition := range q.Where {
+		db = db.Where(condition.clause(r.DB), condition.Value)
+	}
+	if len(q.Scopes) > 0 {
+		db = db.Scopes(q.Scopes...)
+	}
+	for _, order := range q.Order {
+		db = db.Order(order.clause(r.DB))
+	}
+	if q.Start > 0 {
+		db = db.Offset(q.Start)
+	}
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+	return db
+}
+
+func (r *Gorm) FindByID(item interface{}, id uint) error {
+	return translate(r.DB.First(item, id).Error)
+}
+
+func (r *Gorm) First(item interface{}, q Query) error {
+	return translate(r.Scope(q).First(item).Error)
+}
+
+func (r *Gorm) List(items interface{}, q Query) error {
+	return translate(r.Scope(q).Find(items).Error)
+}
+
+// Count keeps the scopes of q, joins included, so the total is that of the
+// pages List returns.
+func (r *Gorm) Count(item interface{}, q Query) (int, error) {
+	count := 0
+	err := r.Scope(Query{Where: q.Where, Scopes: q.Scopes}).Model(item).Count(&count).Error
+	return count, translate(err)
+}
+
+func (r *Gorm) Each(item interface{}, q Query, fn func() error) error {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("repository: %T is not a pointer to a model", item)
+	}
+
+	db := r.Scope(q).Model(item)
+	rows, err := db.Rows()
+	if err != nil {
+		return translate(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		if err := db.ScanRows(rows, item); err != nil {
+			return err
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *Gorm) Create(item interface{}) error {
+	return translate(r.DB.Set("gorm:save_associations", false).Create(item).Error)
+}
+
+func (r *Gorm) Update(item interface{}) error {
+	return translate(r.DB.Set("gorm:save_associations", false).Save(item).Error)
+}
+
+// UpdateFields without conditions can't tell a missing item from one
+// already holding fields, gorm skips the update of both. With conditions
+// the fields must change something, as a bumped version does.
+func (r *Gorm) UpdateFields(item interface{}, fields map[string]interface{}, where ...Condition) error {
+	db := r.Scope(Where(where...)).Model(item).Set("gorm:save_associations", false).Updates(fields)
+	if db.Error != nil {
+		return translate(db.Error)
+	}
+	if len(where) > 0 && db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Gorm) Delete(item interface{}, where ...Condition) error {
+	db := r.Scope(Where(where...)).Set("gorm:save_associations", false).Delete(item)
+	if db.Error != nil {
+		return translate(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Gorm) Transaction(fn func(Repository) error) (err error) {
+	if _, ok := r.DB.CommonDB().(*sql.Tx); ok {
+		return r.savepoint(fn)
+	}
+
+	tx := cache.Begin(r.DB)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(NewGorm(tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return cache.Commit(tx).Error
+}
+
+// savepoint runs fn in a savepoint of the transaction of r.
+func (r *Gorm) savepoint(fn func(Repository) error) (err error) {
+	name := fmt.Sprintf("repository_%d", atomic.AddUint64(&savepoints, 1))
+	if err := r.DB.Exec("SAVEPOINT " + name).Error; err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			r.DB.Exec("ROLLBACK TO SAVEPOINT " + name)
+			panic(p)
+		}
+	}()
+
+	if err = fn(r); err != nil {
+		if rerr := r.DB.Exec("ROLLBACK TO SAVEPOINT " + name).Error; rerr != nil {
+			return rerr
+		}
+		return err
+	}
+	return r.DB.Exec("RELEASE SAVEPOINT " + name).Error
+}
+
+func translate(err error) error {
+	if err == gorm.ErrRecordNotFound {
+		return ErrNotFound
+	}
+	return err
+}
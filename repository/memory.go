@@ -0,0 +1,617 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/jinzhu/gorm"
+)
+
+// Memory is a Repository kept in maps, for tests that don't need a
+// database. It stores copies of the models without their associations and
+// numbers them like a serial column. A transaction is rolled back by
+// restoring what was there before it, so it doesn't isolate concurrent
+// writers from each other.
+type Memory struct {
+	// OnWrite, when set, is called with the table of every create, update
+	// and delete, as the cache callbacks of a gorm database are.
+	OnWrite func(table string)
+
+	tables map[string]*memoryTable
+	mutex  sync.Mutex
+}
+
+type memoryTable struct {
+	rows   map[uint]reflect.Value
+	nextID uint
+}
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) FindByID(item interface{}, id uint) error {
+	return m.First(item, Where(Eq("id", id)))
+}
+
+func (m *Memory) First(item interface{}, q Query) error {
+	v, err := structValue(item)
+	if err != nil {
+		return err
+	}
+	q.Limit = 1
+	rows, err := m.find(v.Type(), q)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	v.Set(rows[0])
+	return nil
+}
+
+func (m *Memory) List(items interface{}, q Query) error {
+	slice := reflect.ValueOf(items)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("repository: %T is not a pointer to a slice", items)
+	}
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+	t := elemType
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	rows, err := m.find(t, q)
+	if err != nil {
+		return err
+	}
+	result := reflect.MakeSlice(slice.Type(), 0, len(rows))
+	for _, row := range rows {
+		if elemType.Kind() == reflect.Ptr {
+			row = row.Addr()
+		}
+		result = reflect.Append(result, row)
+	}
+	slice.Set(result)
+	return nil
+}
+
+func (m *Memory) Count(item interface{}, q Query) (int, error) {
+	v, err := structValue(item)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := m.find(v.Type(), Query{Where: q.Where})
+	return len(rows), err
+}
+
+func (m *Memory) Each(item interface{}, q Query, fn func() error) error {
+	v, err := structValue(item)
+	if err != nil {
+		return err
+	}
+	rows, err := m.find(v.Type(), q)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		v.Set(row)
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Create(item interface{}) error {
+	v, err := structValue(item)
+	if err != nil {
+		return err
+	}
+	id, err := idOf(v)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	table := m.table(v.Type())
+	if id == 0 {
+		table.nextID++
+		id = table.nextID
+		v.FieldByName("ID").SetUint(uint64(id))
+	} else if _, ok := table.rows[id]; ok {
+		return fmt.Errorf("repository: duplicate key %d in %s", id, core.TableNameFor(v.Type()))
+	}
+	if id > table.nextID {
+		table.nextID = id
+	}
+
+	now := time.Now()
+	setTime(v, "CreatedAt", now, false)
+	setTime(v, "UpdatedAt", now, false)
+	table.rows[id] = stored(v)
+	m.wrote(v.Type())
+	return nil
+}
+
+func (m *Memory) Update(item interface{}) error {
+	v, err := structValue(item)
+	if err != nil {
+		return err
+	}
+	id, err := idOf(v)
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		return m.Create(item)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	table := m.table(v.Type())
+	if id > table.nextID {
+		table.nextID = id
+	}
+	setTime(v, "UpdatedAt", time.Now(), true)
+	table.rows[id] = stored(v)
+	m.wrote(v.Type())
+	return nil
+}
+
+func (m *Memory) UpdateFields(item interface{}, fields map[string]interface{}, where ...Condition) error {
+	v, err := structValue(item)
+	if err != nil {
+		return err
+	}
+	id, err := idOf(v)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	table := m.table(v.Type())
+	current, ok := table.rows[id]
+	if !ok || isDeleted(current) {
+		return ErrNotFound
+	}
+	if ok, err := matches(current, where); err != nil {
+		return err
+	} else if !ok {
+		return ErrNotFound
+	}
+
+	row := copyOf(current)
+	for column, value := range fields {
+		for _, target := range []reflect.Value{row, v} {
+			if err := setColumn(target, column, value); err != nil {
+				return err
+			}
+		}
+	}
+	now := time.Now()
+	setTime(row, "UpdatedAt", now, true)
+	setTime(v, "UpdatedAt", now, true)
+	table.rows[id] = row
+	m.wrote(v.Type())
+	return nil
+}
+
+func (m *Memory) Delete(item interface{}, where ...Condition) error {
+	v, err := structValue(item)
+	if err != nil {
+		return err
+	}
+	id, err := idOf(v)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	table := m.table(v.Type())
+	current, ok := table.rows[id]
+	if !ok || isDeleted(current) {
+		return ErrNotFound
+	}
+	if ok, err := matches(current, where); err != nil {
+		return err
+	} else if !ok {
+		return ErrNotFound
+	}
+
+	deletedAt := current.FieldByName("DeletedAt")
+	if deletedAt.IsValid() && deletedAt.Kind() == reflect.Ptr {
+		row := copyOf(current)
+		row.FieldByName("DeletedAt").Set(timestamp(deletedAt.Type().Elem(), time.Now()))
+		table.rows[id] = row
+	} else {
+		delete(table.rows, id)
+	}
+	m.wrote(v.Type())
+	return nil
+}
+
+func (m *Memory) Transaction(fn func(Repository) error) (err error) {
+	snapshot := m.snapshot()
+	defer func() {
+		if p := recover(); p != nil {
+			m.restore(snapshot)
+			panic(p)
+		}
+	}()
+
+	if err = fn(m); err != nil {
+		m.restore(snapshot)
+	}
+	return err
+}
+
+func (m *Memory) snapshot() map[string]*memoryTable {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	snapshot := map[string]*memoryTable{}
+	for name, table := range m.tables {
+		rows := make(map[uint]reflect.Value, len(table.rows))
+		for id, row := range table.rows {
+			rows[id] = row
+		}
+		snapshot[name] = &memoryTable{rows: rows, nextID: table.nextID}
+	}
+	return snapshot
+}
+
+func (m *Memory) restore(snapshot map[string]*memoryTable) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.tables = snapshot
+}
+
+// table must be called with the mutex held.
+func (m *Memory) table(t reflect.Type) *memoryTable {
+	if m.tables == nil {
+		m.tables = map[string]*memoryTable{}
+	}
+	name := core.TableNameFor(t)
+	table, ok := m.tables[name]
+	if !ok {
+		table = &memoryTable{rows: map[uint]reflect.Value{}}
+		m.tables[name] = table
+	}
+	return table
+}
+
+func (m *Memory) wrote(t reflect.Type) {
+	if m.OnWrite != nil {
+		m.OnWrite(core.TableNameFor(t))
+	}
+}
+
+// find returns copies of the rows of t matching q, by id unless q orders
+// them otherwise.
+func (m *Memory) find(t reflect.Type, q Query) ([]reflect.Value, error) {
+	m.mutex.Lock()
+	table := m.table(t)
+	rows := make([]reflect.Value, 0, len(table.rows))
+	for _, row := range table.rows {
+		if !isDeleted(row) {
+			rows = append(rows, copyOf(row))
+		}
+	}
+	m.mutex.Unlock()
+
+	matching := rows[:0]
+	for _, row := range rows {
+		ok, err := matches(row, q.Where)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matching = append(matching, row)
+		}
+	}
+	rows = matching
+
+	order := append([]Order{}, q.Order...)
+	order = append(order, Order{Column: "id"})
+	for _, o := range order {
+		if _, ok := column(reflect.New(t).Elem(), o.Column); !ok {
+			return nil, fmt.Errorf("repository: unknown column %s", o.Column)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, o := range order {
+			a, _ := column(rows[i], o.Column)
+			b, _ := column(rows[j], o.Column)
+			if c := compare(a, b); c != 0 {
+				return (c < 0) != o.Desc
+			}
+		}
+		return false
+	})
+
+	if q.Start > 0 {
+		if q.Start >= len(rows) {
+			return nil, nil
+		}
+		rows = rows[q.Start:]
+	}
+	if q.Limit > 0 && q.Limit < len(rows) {
+		rows = rows[:q.Limit]
+	}
+	return rows, nil
+}
+
+func structValue(item interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr {
+		return v, fmt.Errorf("repository: %T is not a pointer to a model", item)
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return v, fmt.Errorf("repository: %T is nil", item)
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return v, fmt.Errorf("repository: %T is not a pointer to a model", item)
+	}
+	return v, nil
+}
+
+func idOf(v reflect.Value) (uint, error) {
+	id := v.FieldByName("ID")
+	if !id.IsValid() || id.Kind() != reflect.Uint {
+		return 0, fmt.Errorf("repository: %s has no uint ID", v.Type())
+	}
+	return uint(id.Uint()), nil
+}
+
+func copyOf(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+// stored is the copy of v the database would keep: only its columns.
+func stored(v reflect.Value) reflect.Value {
+	c := copyOf(v)
+	clearNonColumns(c)
+	return c
+}
+
+func clearNonColumns(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			clearNonColumns(v.Field(i))
+			continue
+		}
+		if !isColumn(f) {
+			v.Field(i).Set(reflect.Zero(f.Type))
+		}
+	}
+}
+
+func isColumn(f reflect.StructField) bool {
+	if f.Tag.Get("sql") == "-" || f.Tag.Get("gorm") == "-" {
+		return false
+	}
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType || t.Implements(valuerType) || reflect.PtrTo(t).Implements(valuerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Interface:
+		return false
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return true
+}
+
+// column finds the field stored in the column named name, with or without
+// its table.
+func column(v reflect.Value, name string) (reflect.Value, bool) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Trim(name, `"`)
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if field, ok := column(v.Field(i), name); ok {
+				return field, true
+			}
+			continue
+		}
+		if isColumn(f) && columnName(f) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func columnName(f reflect.StructField) string {
+	for _, setting := range strings.Split(f.Tag.Get("gorm"), ";") {
+		if parts := strings.SplitN(setting, ":", 2); len(parts) == 2 && strings.ToLower(parts[0]) == "column" {
+			return parts[1]
+		}
+	}
+	return gorm.ToDBName(f.Name)
+}
+
+func setColumn(v reflect.Value, name string, value interface{}) error {
+	field, ok := column(v, name)
+	if !ok {
+		return fmt.Errorf("repository: unknown column %s", name)
+	}
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	t := field.Type()
+	switch {
+	case rv.Type().AssignableTo(t):
+		field.Set(rv)
+	case convertible(rv, t):
+		field.Set(rv.Convert(t))
+	// A value for a nullable column, as gorm takes them.
+	case t.Kind() == reflect.Ptr && convertible(rv, t.Elem()):
+		p := reflect.New(t.Elem())
+		p.Elem().Set(rv.Convert(t.Elem()))
+		field.Set(p)
+	default:
+		return fmt.Errorf("repository: can't set %s to a %T", name, value)
+	}
+	return nil
+}
+
+// convertible leaves out numbers to strings, which Go converts to runes.
+func convertible(v reflect.Value, t reflect.Type) bool {
+	if (v.Kind() == reflect.String) != (t.Kind() == reflect.String) {
+		return false
+	}
+	return v.Type().ConvertibleTo(t)
+}
+
+func matches(v reflect.Value, conditions []Condition) (bool, error) {
+	for _, condition := range conditions {
+		field, ok := column(v, condition.Column)
+		if !ok {
+			return false, fmt.Errorf("repository: unknown column %s", condition.Column)
+		}
+		if equal(field, condition.Value, condition.Fold) == condition.Not {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func equal(field reflect.Value, value interface{}, fold bool) bool {
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return value == nil
+		}
+		field = field.Elem()
+	}
+	if value == nil {
+		return false
+	}
+	if fold {
+		return strings.EqualFold(fmt.Sprint(field.Interface()), fmt.Sprint(value))
+	}
+	rv := reflect.ValueOf(value)
+	if !convertible(rv, field.Type()) {
+		return false
+	}
+	value = rv.Convert(field.Type()).Interface()
+	if field.Type() == timeType {
+		return field.Interface().(time.Time).Equal(value.(time.Time))
+	}
+	return reflect.DeepEqual(field.Interface(), value)
+}
+
+// compare orders a before b like the database would, with nulls first.
+func compare(a, b reflect.Value) int {
+	for a.Kind() == reflect.Ptr {
+		if a.IsNil() || b.IsNil() {
+			return boolCompare(!a.IsNil(), !b.IsNil())
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intCompare(a.Int() < b.Int(), a.Int() > b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return intCompare(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return intCompare(a.Float() < b.Float(), a.Float() > b.Float())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Bool:
+		return boolCompare(a.Bool(), b.Bool())
+	case reflect.Struct:
+		if a.Type() == timeType {
+			ta, tb := a.Interface().(time.Time), b.Interface().(time.Time)
+			return intCompare(ta.Before(tb), ta.After(tb))
+		}
+		if field := a.FieldByName("Time"); field.IsValid() && field.Type() == timeType {
+			ta, tb := field.Interface().(time.Time), b.FieldByName("Time").Interface().(time.Time)
+			return intCompare(ta.Before(tb), ta.After(tb))
+		}
+	}
+	return 0
+}
+
+func intCompare(less, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
+
+func boolCompare(a, b bool) int {
+	return intCompare(!a && b, a && !b)
+}
+
+func isDeleted(v reflect.Value) bool {
+	deletedAt := v.FieldByName("DeletedAt")
+	return deletedAt.IsValid() && deletedAt.Kind() == reflect.Ptr && !deletedAt.IsNil()
+}
+
+// setTime sets the time.Time field name of v to now, only when it is zero
+// unless always.
+func setTime(v reflect.Value, name string, now time.Time, always bool) {
+	field := v.FieldByName(name)
+	if !field.IsValid() || field.Type() != timeType || !field.CanSet() {
+		return
+	}
+	if always || field.Interface().(time.Time).IsZero() {
+		field.Set(reflect.ValueOf(now))
+	}
+}
+
+// timestamp is a pointer to a t holding now, where t is a time.Time or a
+// struct with a Time field like core.NullableTimestamp.
+func timestamp(t reflect.Type, now time.Time) reflect.Value {
+	ptr := reflect.New(t)
+	if t == timeType {
+		ptr.Elem().Set(reflect.ValueOf(now))
+	} else if field := ptr.Elem().FieldByName("Time"); field.IsValid() && field.Type() == timeType {
+		field.Set(reflect.ValueOf(now))
+	}
+	return ptr
+}
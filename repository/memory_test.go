@@ -0,0 +1,200 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+type Widget struct {
+	ID        uint
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *core.NullableTimestamp
+	Name      string
+	Rank      int
+	ParentID  *uint
+	Secret    string   `sql:"-"`
+	Parts     []Widget `json:"parts"`
+}
+
+func seed(t *testing.T, repo repository.Repository, names ...string) []Widget {
+	widgets := []Widget{}
+	for i, name := range names {
+		w := Widget{Name: name, Rank: len(names) - i}
+		assert.NoError(t, repo.Create(&w))
+		widgets = append(widgets, w)
+	}
+	return widgets
+}
+
+func TestMemoryCreateStoresColumns(t *testing.T) {
+	repo := repository.NewMemory()
+	w := Widget{Name: "a", Secret: "s", Parts: []Widget{{Name: "b"}}}
+	assert.NoError(t, repo.Create(&w))
+	assert.Equal(t, uint(1), w.ID)
+	assert.False(t, w.CreatedAt.IsZero())
+
+	found := Widget{}
+	assert.NoError(t, repo.FindByID(&found, w.ID))
+	assert.Equal(t, "a", found.Name)
+	assert.Empty(t, found.Secret)
+	assert.Empty(t, found.Parts)
+
+	assert.Equal(t, repository.ErrNotFound, repo.FindByID(&found, 2))
+}
+
+func TestMemoryListFiltersSortsAndPages(t *testing.T) {
+	repo := repository.NewMemory()
+	seed(t, repo, "Ann", "bob", "ann", "carl")
+
+	widgets := []Widget{}
+	assert.NoError(t, repo.List(&widgets, repository.Query{
+		Where: []repository.Condition{repository.EqualFold("name", "ANN")},
+	}))
+	assert.Len(t, widgets, 2)
+
+	pointers := []*Widget{}
+	assert.NoError(t, repo.List(&pointers, repository.Query{
+		Where: []repository.Condition{repository.Not("name", "bob")},
+		Order: []repository.Order{{Column: "rank"}},
+		Start: 1,
+		Limit: 1,
+	}))
+	assert.Len(t, pointers, 1)
+	assert.Equal(t, "ann", pointers[0].Name)
+
+	count, err := repo.Count(&Widget{}, repository.Where(repository.Eq("rank", 4)))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	err = repo.List(&widgets, repository.Where(repository.Eq("missing", 1)))
+	assert.Error(t, err)
+}
+
+func TestMemoryEachStopsOnError(t *testing.T) {
+	repo := repository.NewMemory()
+	seed(t, repo, "a", "b", "c")
+
+	names := []string{}
+	w := Widget{}
+	q := repository.Query{Order: []repository.Order{{Column: "rank"}}}
+	assert.NoError(t, repo.Each(&w, q, func() error {
+		names = append(names, w.Name)
+		return nil
+	}))
+	assert.Equal(t, []string{"c", "b", "a"}, names)
+
+	stop := errors.New("stop")
+	seen := 0
+	assert.Equal(t, stop, repo.Each(&w, q, func() error {
+		seen++
+		return stop
+	}))
+	assert.Equal(t, 1, seen)
+}
+
+func TestMemoryUpdate(t *testing.T) {
+	repo := repository.NewMemory()
+	w := seed(t, repo, "a")[0]
+
+	w.Name = "b"
+	assert.NoError(t, repo.Update(&w))
+	assert.NoError(t, repo.UpdateFields(&w, map[string]interface{}{"rank": 7}))
+	assert.Equal(t, 7, w.Rank)
+
+	found := Widget{}
+	repo.FindByID(&found, w.ID)
+	assert.Equal(t, "b", found.Name)
+	assert.Equal(t, 7, found.Rank)
+
+	missing := Widget{ID: 9}
+	assert.Equal(t, repository.ErrNotFound, repo.UpdateFields(&missing, map[string]interface{}{"rank": 1}))
+
+	stale := repository.Eq("rank", 6)
+	assert.Equal(t, repository.ErrNotFound, repo.UpdateFields(&w, map[string]interface{}{"rank": 8}, stale))
+	assert.Equal(t, 7, w.Rank)
+	assert.NoError(t, repo.UpdateFields(&w, map[string]interface{}{"rank": 8}, repository.Eq("rank", 7)))
+	assert.Equal(t, 8, w.Rank)
+
+	assert.NoError(t, repo.UpdateFields(&w, map[string]interface{}{"parent_id": uint(3)}))
+	if assert.NotNil(t, w.ParentID) {
+		assert.Equal(t, uint(3), *w.ParentID)
+	}
+	assert.NoError(t, repo.UpdateFields(&w, map[string]interface{}{"parent_id": nil}))
+	assert.Nil(t, w.ParentID)
+}
+
+func TestMemoryDeleteMarksDeleted(t *testing.T) {
+	repo := repository.NewMemory()
+	w := seed(t, repo, "a", "b")[0]
+
+	assert.Equal(t, repository.ErrNotFound, repo.Delete(&w, repository.Eq("rank", 9)))
+	assert.NoError(t, repo.Delete(&w, repository.Eq("rank", w.Rank)))
+	assert.Equal(t, repository.ErrNotFound, repo.FindByID(&Widget{}, w.ID))
+	assert.Equal(t, repository.ErrNotFound, repo.Delete(&w))
+
+	count, _ := repo.Count(&Widget{}, repository.Query{})
+	assert.Equal(t, 1, count)
+}
+
+func TestMemoryTransactionRollsBack(t *testing.T) {
+	repo := repository.NewMemory()
+	seed(t, repo, "a")
+
+	err := repo.Transaction(func(tx repository.Repository) error {
+		seed(t, tx, "b")
+		return errors.New("rollback")
+	})
+	assert.Error(t, err)
+	count, _ := repo.Count(&Widget{}, repository.Query{})
+	assert.Equal(t, 1, count)
+
+	assert.NoError(t, repo.Transaction(func(tx repository.Repository) error {
+		seed(t, tx, "c")
+		return nil
+	}))
+	count, _ = repo.Count(&Widget{}, repository.Query{})
+	assert.Equal(t, 2, count)
+
+	repo.Transaction(func(tx repository.Repository) error {
+		seed(t, tx, "d")
+		assert.Error(t, tx.Transaction(func(nested repository.Repository) error {
+			seed(t, nested, "e")
+			return errors.New("rollback")
+		}))
+		return nil
+	})
+	names := []Widget{}
+	repo.List(&names, repository.Query{})
+	assert.Equal(t, "d", names[len(names)-1].Name)
+	assert.Len(t, names, 3)
+}
+
+func TestUserCreateWithoutDatabase(t *testing.T) {
+	ctx := &model.ModelCtx{Repository: repository.NewMemory()}
+	u := model.User{Name: "Name", Username: "username", Email: "user@server.com", Password: "12345"}
+	assert.Nil(t, u.Create(ctx, model.User{}))
+	assert.NotZero(t, u.ID)
+	assert.NotEmpty(t, u.HashedPassword)
+
+	taken := model.User{Name: "Name", Username: "other", Email: "USER@server.com", Password: "12345"}
+	err := taken.Create(ctx, model.User{})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, core.ERROR_SUBCODE_EMAIL_TAKEN, err.Subcode())
+	}
+
+	taken = model.User{Name: "Name", Username: "USERNAME", Email: "other@server.com", Password: "12345"}
+	err = taken.Create(ctx, model.User{})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, core.ERROR_SUBCODE_USERNAME_TAKEN, err.Subcode())
+	}
+
+	u.Email = "USER@server.com"
+	assert.Nil(t, u.Update(ctx, model.User{}), "keeping its own email")
+}
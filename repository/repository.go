@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrNotFound is returned when no row matches, whatever the backend.
+var ErrNotFound = errors.New("record not found")
+
+// Condition filters rows on a column, named with or without its table.
+type Condition struct {
+	Column string
+	Value  interface{}
+	Not    bool
+	Fold   bool
+}
+
+// Eq matches rows where column is value.
+func Eq(column string, value interface{}) Condition {
+	return Condition{Column: column, Value: value}
+}
+
+// Not matches rows where column is anything but value.
+func Not(column string, value interface{}) Condition {
+	return Condition{Column: column, Value: value, Not: true}
+}
+
+// EqualFold matches rows where column is value, ignoring case.
+func EqualFold(column string, value string) Condition {
+	return Condition{Column: column, Value: value, Fold: true}
+}
+
+func (c Condition) clause(db *gorm.DB) string {
+	column := core.QuoteColumn(db, c.Column)
+	clause := column + " = ?"
+	if c.Fold {
+		clause = core.EqualFold(db, column)
+	}
+	if c.Not {
+		return "NOT (" + clause + ")"
+	}
+	return clause
+}
+
+type Order struct {
+	Column string
+	Desc   bool
+}
+
+func (o Order) clause(db *gorm.DB) string {
+	if o.Desc {
+		return core.QuoteColumn(db, o.Column) + " DESC"
+	}
+	return core.QuoteColumn(db, o.Column)
+}
+
+// Query selects rows matching all of Where, sorted by Order, skipping Start
+// of them and returning at most Limit, or all when Limit is 0. Scopes are
+// applied by the gorm backend only, to lists and counts alike, for the
+// joins, preloads and orders the others can't express.
+type Query struct {
+	Where  []Condition
+	Order  []Order
+	Start  int
+	Limit  int
+	Scopes []func(*gorm.DB) *gorm.DB
+}
+
+func Where(conditions ...Condition) Query {
+	return Query{Where: conditions}
+}
+
+// Repository stores models. item is a pointer to a model and items a
+// pointer to a slice of them, the table is named after their type.
+// Deleting a model with a DeletedAt field only marks it as deleted.
+type Repository interface {
+	FindByID(item interface{}, id uint) error
+	First(item interface{}, q Query) error
+	List(items interface{}, q Query) error
+	Count(item interface{}, q Query) (int, error)
+	// Each loads the rows matching q one at a time into item and calls fn
+	// after each, so memory stays flat however many there are. An error of
+	// fn stops it and is returned.
+	Each(item interface{}, q Query, fn func() error) error
+	Create(item interface{}) error
+	// Update saves all the fields of item.
+	Update(item interface{}) error
+	// UpdateFields saves the given columns of item and sets them on it.
+	// With conditions, only a row also matching them is updated and
+	// ErrNotFound means none did.
+	UpdateFields(item interface{}, fields map[string]interface{}, where ...Condition) error
+	// Delete removes item, only when its row also matches the conditions.
+	Delete(item interface{}, where ...Condition) error
+	// Transaction runs fn in a transaction, committed when fn returns nil
+	// and rolled back otherwise. Inside a transaction fn runs in a nested
+	// one, rolled back alone.
+	Transaction(fn func(Repository) error) error
+}
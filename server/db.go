@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/cache"
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/metrics"
+	"github.com/brunoksato/golang-boilerplate/tracing"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"go.elastic.co/apm/module/apmgorm"
+)
+
+// MAX_CONNECT_BACKOFF caps the wait between two connection attempts at
+// startup.
+const MAX_CONNECT_BACKOFF = 30 * time.Second
+
+func InitDB(cfg *config.Config) *gorm.DB {
+	db := openDB(cfg.Database.URL, cfg.Database.ConnectRetries, cfg.Database.ConnectBackoff)
+	fmt.Println(fmt.Sprintf("Initialized read-write database connection pool: %s", config.RedactDSN(cfg.Database.URL)))
+	return db
+}
+
+// InitReplicaDBs opens a read-only pool for each replica URL, named ro1,
+// ro2 and so on. With none configured every read goes to the primary.
+func InitReplicaDBs(cfg *config.Config) ([]string, []*gorm.DB) {
+	names := []string{}
+	pools := []*gorm.DB{}
+	for i, url := range cfg.Database.ReplicaURLs {
+		name := fmt.Sprintf("ro%d", i+1)
+		names = append(names, name)
+		pools = append(pools, openDB(url, cfg.Database.ConnectRetries, cfg.Database.ConnectBackoff))
+		fmt.Println(fmt.Sprintf("Initialized read-only database connection pool %s: %s", name, config.RedactDSN(url)))
+	}
+	return names, pools
+}
+
+func configurePool(name string, db *gorm.DB) {
+	db.DB().SetConnMaxLifetime(time.Second * 30)
+	db.DB().SetMaxIdleConns(40)
+	db.DB().SetMaxOpenConns(40)
+	db.LogMode(true)
+	metrics.ObserveDBStats(name, db.DB())
+}
+
+// openDB retries with exponential backoff while the database can't be
+// reached, so the server survives starting before it. Other errors, like
+// bad credentials, fail at once.
+func openDB(url string, retries int, backoff time.Duration) *gorm.DB {
+	var db *gorm.DB
+	var err error
+	for attempt := 0; ; attempt++ {
+		if tracing.Enabled(tracing.BACKEND_APM) {
+			db, err = apmgorm.Open("postgres", url)
+		} else {
+			db, err = gorm.Open("postgres", url)
+		}
+		if err == nil {
+			break
+		}
+		if attempt >= retries || !core.IsConnectionError(err) {
+			panic(err.Error())
+		}
+		fmt.Println(fmt.Sprintf("Database unreachable, retrying in %s: %s", backoff, err.Error()))
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > MAX_CONNECT_BACKOFF {
+			backoff = MAX_CONNECT_BACKOFF
+		}
+	}
+	core.RegisterContextCallbacks(db)
+	cache.RegisterCallbacks(db)
+	if tracing.Enabled(tracing.BACKEND_OTEL) {
+		tracing.RegisterCallbacks(db)
+	}
+	return db
+}
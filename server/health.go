@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/olivere/elastic"
+)
+
+// APP_COMMIT_REF and APP_BUILD_DATE are set at link time, e.g.
+// -ldflags "-X github.com/brunoksato/golang-boilerplate/server.APP_COMMIT_REF=abc123".
+// The environment variables of the same name are used when they are empty.
+var APP_COMMIT_REF string
+var APP_BUILD_DATE string
+
+// Check pings a dependency the API needs to serve requests.
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of one check in the /readyz report.
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+var checks = map[string]Check{}
+var checksMutex sync.RWMutex
+var shuttingDown int32
+
+// RegisterCheck adds a dependency to the readiness report, replacing the
+// check registered under the same name.
+func RegisterCheck(name string, check Check) {
+	checksMutex.Lock()
+	defer checksMutex.Unlock()
+	checks[name] = check
+}
+
+// StartShutdown makes /readyz fail so the load balancer stops sending
+// requests before the server goes away.
+func StartShutdown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+}
+
+func ShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+func HealthCheckTimeout() time.Duration {
+	return CONFIG.Server.HealthCheckTimeout
+}
+
+// ShutdownDelay is how long the server keeps serving after readiness starts
+// failing.
+func ShutdownDelay() time.Duration {
+	return CONFIG.Server.ShutdownDelay
+}
+
+func DatabaseCheck(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		if db == nil {
+			return errors.New("database is not configured")
+		}
+		return db.DB().PingContext(ctx)
+	}
+}
+
+func ElasticsearchCheck(client *elastic.Client) Check {
+	return func(ctx context.Context) error {
+		health, err := client.ClusterHealth().Do(ctx)
+		if err != nil {
+			return err
+		}
+		if health.Status == "red" {
+			return errors.New("cluster status is red")
+		}
+		return nil
+	}
+}
+
+// RunChecks runs every registered check concurrently, each with its own
+// timeout, and reports whether all of them passed.
+func RunChecks(ctx context.Context) (map[string]CheckResult, bool) {
+	checksMutex.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	running := make([]Check, len(names))
+	for i, name := range names {
+		running[i] = checks[name]
+	}
+	checksMutex.RUnlock()
+
+	timeout := HealthCheckTimeout()
+	outcomes := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i := range running {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outcomes[i] = runCheck(ctx, running[i], timeout)
+		}(i)
+	}
+	wg.Wait()
+
+	results := map[string]CheckResult{}
+	ok := true
+	for i, name := range names {
+		results[name] = outcomes[i]
+		if outcomes[i].Status != "ok" {
+			ok = false
+		}
+	}
+	return results, ok
+}
+
+func runCheck(ctx context.Context, check Check, timeout time.Duration) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- errors.New("check panicked")
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: "ok", Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status = "failing"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Healthz tells whether the process is alive. It never touches
+// dependencies, a database outage should not get the API restarted.
+func Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+// Readyz tells whether the API can serve requests, with the status of each
+// registered dependency.
+func Readyz(c echo.Context) error {
+	if ShuttingDown() {
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{"status": "shutting down"})
+	}
+
+	results, ok := RunChecks(c.Request().Context())
+	if !ok {
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{"status": "failing", "checks": results})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"status": "ok", "checks": results})
+}
+
+// Version describes the running build.
+func Version(c echo.Context) error {
+	commit := APP_COMMIT_REF
+	if commit == "" {
+		commit = os.Getenv("APP_COMMIT_REF")
+	}
+	buildDate := APP_BUILD_DATE
+	if buildDate == "" {
+		buildDate = os.Getenv("APP_BUILD_DATE")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"commit":     commit,
+		"build_date": buildDate,
+		"go_version": runtime.Version(),
+	})
+}
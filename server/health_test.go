@@ -0,0 +1,107 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func probe(path string) *httptest.ResponseRecorder {
+	root := server.SetupRouter(docsMiddlewareConfigurer{})
+	rw := httptest.NewRecorder()
+	root.ServeHTTP(rw, httptest.NewRequest("GET", path, nil))
+	return rw
+}
+
+func TestHealthz(t *testing.T) {
+	server.RegisterCheck("test", func(ctx context.Context) error {
+		return errors.New("down")
+	})
+	defer server.RegisterCheck("test", func(ctx context.Context) error { return nil })
+
+	rw := probe("/healthz")
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, "ok", core.JsonToMap(rw.Body.String())["status"])
+}
+
+func TestReadyz(t *testing.T) {
+	server.RegisterCheck("test", func(ctx context.Context) error { return nil })
+
+	rw := probe("/readyz")
+	assert.Equal(t, 200, rw.Code)
+
+	body := core.JsonToMap(rw.Body.String())
+	assert.Equal(t, "ok", body["status"])
+	check := body["checks"].(map[string]interface{})["test"].(map[string]interface{})
+	assert.Equal(t, "ok", check["status"])
+}
+
+func TestReadyzReportsFailingChecks(t *testing.T) {
+	server.RegisterCheck("test", func(ctx context.Context) error { return nil })
+	server.RegisterCheck("broken", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	defer server.RegisterCheck("broken", func(ctx context.Context) error { return nil })
+
+	rw := probe("/readyz")
+	assert.Equal(t, 503, rw.Code)
+
+	body := core.JsonToMap(rw.Body.String())
+	assert.Equal(t, "failing", body["status"])
+	checks := body["checks"].(map[string]interface{})
+	assert.Equal(t, "ok", checks["test"].(map[string]interface{})["status"])
+	assert.Equal(t, "failing", checks["broken"].(map[string]interface{})["status"])
+	assert.Equal(t, "connection refused", checks["broken"].(map[string]interface{})["error"])
+}
+
+func TestReadyzTimesOutSlowChecks(t *testing.T) {
+	defer func(timeout time.Duration) { server.CONFIG.Server.HealthCheckTimeout = timeout }(server.CONFIG.Server.HealthCheckTimeout)
+	server.CONFIG.Server.HealthCheckTimeout = time.Second
+
+	server.RegisterCheck("slow", func(ctx context.Context) error {
+		time.Sleep(5 * time.Second)
+		return nil
+	})
+	defer server.RegisterCheck("slow", func(ctx context.Context) error { return nil })
+
+	start := time.Now()
+	rw := probe("/readyz")
+	assert.Equal(t, 503, rw.Code)
+	assert.True(t, time.Since(start) < 3*time.Second)
+
+	checks := core.JsonToMap(rw.Body.String())["checks"].(map[string]interface{})
+	assert.Equal(t, context.DeadlineExceeded.Error(), checks["slow"].(map[string]interface{})["error"])
+}
+
+func TestVersion(t *testing.T) {
+	server.APP_COMMIT_REF = "abc123"
+	defer func() { server.APP_COMMIT_REF = "" }()
+	os.Setenv("APP_BUILD_DATE", "2019-06-01")
+	defer os.Unsetenv("APP_BUILD_DATE")
+
+	rw := probe("/version")
+	assert.Equal(t, 200, rw.Code)
+
+	body := core.JsonToMap(rw.Body.String())
+	assert.Equal(t, "abc123", body["commit"])
+	assert.Equal(t, "2019-06-01", body["build_date"])
+	assert.NotEmpty(t, body["go_version"])
+}
+
+// Shutting down can't be undone, keep this test last.
+func TestReadyzFailsDuringShutdown(t *testing.T) {
+	server.StartShutdown()
+
+	rw := probe("/readyz")
+	assert.Equal(t, 503, rw.Code)
+	assert.Equal(t, "shutting down", core.JsonToMap(rw.Body.String())["status"])
+
+	assert.Equal(t, 200, probe("/healthz").Code)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/log"
+	"github.com/brunoksato/golang-boilerplate/tracing"
+	elastic "github.com/olivere/elastic"
+)
+
+const ES_LOG_INDEX_PREFIX = "logstash"
+
+// ElasticHookOptions is the buffering of the elastic search log hook.
+func ElasticHookOptions(cfg *config.Config) log.ElasticHookOptions {
+	opts := log.DefaultElasticHookOptions()
+	opts.QueueSize = cfg.Elasticsearch.LogQueueSize
+	opts.Overflow = cfg.Elasticsearch.LogOverflow
+	opts.FlushInterval = cfg.Elasticsearch.LogFlushInterval
+	return opts
+}
+
+// InitElasticSearchAndLogger sets up the log sinks, each with an optional
+// level, like stdout:info,es:debug. The sinks are stdout (JSON), text (for
+// development), file, syslog and es. The log level applies to every system
+// but the ones given their own.
+func InitElasticSearchAndLogger(cfg *config.Config) (client *elastic.Client) {
+	// Acceptable values are:
+	// debug, info, warn, error, fatal, panic
+	defaultLevel, err := logrus.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		defaultLevel = logrus.InfoLevel
+	}
+
+	dispatcher := log.NewDispatcher(defaultLevel)
+	log.Setup(dispatcher)
+
+	thisHostname, _ := os.Hostname()
+
+	for _, name := range config.LOG_SINKS {
+		value, ok := cfg.Log.Sinks[name]
+		if !ok {
+			continue
+		}
+		level := logrus.DebugLevel
+		if value != "" {
+			if l, err := logrus.ParseLevel(value); err == nil {
+				level = l
+			}
+		}
+
+		switch name {
+		case "stdout":
+			dispatcher.AddSink(name, log.NewWriterSink(&log.LogstashFormatter{}, os.Stdout), level)
+		case "text":
+			dispatcher.AddSink(name, log.NewWriterSink(&logrus.TextFormatter{}, os.Stdout), level)
+		case "file":
+			file, err := log.OpenRotatingFile(cfg.Log.FilePath, cfg.Log.FileMaxBytes, cfg.Log.FileMaxBackups)
+			if err != nil {
+				fmt.Println(fmt.Sprintf("Error opening the log file: %s", err.Error()))
+				continue
+			}
+			sink := log.NewWriterSink(&log.LogstashFormatter{}, file)
+			dispatcher.AddSink(name, sink, level)
+			log.OnShutdown(sink.Close)
+		case "syslog":
+			sink, err := log.NewSyslogSink(cfg.Log.SyslogAddress, cfg.Server.Name, &log.LogstashFormatter{})
+			if err != nil {
+				fmt.Println(fmt.Sprintf("Error configuring syslog logging: %s", err.Error()))
+				continue
+			}
+			dispatcher.AddSink(name, sink, level)
+			log.OnShutdown(sink.Close)
+		case "es":
+			if cfg.Elasticsearch.Host == "" {
+				continue
+			}
+			client = initElasticSearch(cfg.Elasticsearch.Host)
+			if client == nil {
+				continue
+			}
+			hook, err := log.NewElasticHookWithOptions(client, thisHostname, logrus.DebugLevel,
+				log.DailyIndexName(ES_LOG_INDEX_PREFIX), ElasticHookOptions(cfg))
+			if err == nil {
+				dispatcher.AddSink(name, hook, level)
+				log.OnShutdown(hook.Close)
+			} else {
+				fmt.Println(fmt.Sprintf("Error configuring logger for elastic search: %s", err.Error()))
+			}
+		}
+	}
+
+	if len(cfg.Log.Levels) > 0 {
+		if err := dispatcher.SetConfig(log.LevelConfig{Systems: cfg.Log.Levels}); err != nil {
+			fmt.Println("Error with log level configuraion:", err)
+		}
+	}
+
+	if client == nil && cfg.Elasticsearch.Host != "" {
+		client = initElasticSearch(cfg.Elasticsearch.Host)
+	}
+	return client
+}
+
+func initElasticSearch(esHostname string) *elastic.Client {
+	var esURL string
+	if strings.Contains(esHostname, "127.0.0.1") {
+		esURL = fmt.Sprintf("http://%s", esHostname)
+	} else {
+		esURL = fmt.Sprintf("https://%s", esHostname)
+	}
+	fmt.Println(fmt.Sprintf("Configuring elasticsearch logging: %s", esURL))
+	client, err := elastic.NewClient(elastic.SetSniff(false), elastic.SetURL(esURL),
+		elastic.SetHttpClient(tracing.HTTPClient()))
+	if err != nil {
+		fmt.Println(fmt.Sprintf("Error configuring elasticsearch logging: %s", err.Error()))
+		return nil
+	}
+	if err := log.PutIndexTemplate(client, ES_LOG_INDEX_PREFIX, ES_LOG_INDEX_PREFIX+"-*"); err != nil {
+		fmt.Println(fmt.Sprintf("Error putting the elastic search index template: %s", err.Error()))
+	}
+	return client
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/brunoksato/golang-boilerplate/metrics"
+	"github.com/labstack/echo/v4"
+)
+
+// Metrics exposes the metrics registry to Prometheus. When a metrics token
+// is configured scrapers must send it as a bearer token.
+func Metrics(c echo.Context) error {
+	if token := CONFIG.Server.MetricsToken; token != "" {
+		if c.Request().Header.Get(echo.HeaderAuthorization) != "Bearer "+token {
+			return c.JSON(http.StatusUnauthorized, map[string]interface{}{"status": "Not Authorized"})
+		}
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, metrics.TEXT_CONTENT_TYPE)
+	c.Response().WriteHeader(http.StatusOK)
+	return metrics.REGISTRY.WriteText(c.Response())
+}
@@ -0,0 +1,44 @@
+package server_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/metrics"
+	"github.com/brunoksato/golang-boilerplate/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	root := server.SetupRouter(docsMiddlewareConfigurer{})
+	root.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+	root.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/no/such/route/42", nil))
+
+	rw := httptest.NewRecorder()
+	root.ServeHTTP(rw, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, metrics.TEXT_CONTENT_TYPE, rw.Header().Get("Content-Type"))
+
+	body := rw.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/healthz",api_type="",status="200"}`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="unmatched",api_type="",status="404"}`)
+	assert.Contains(t, body, `http_request_duration_seconds_bucket{method="GET",route="/healthz",api_type="",le="+Inf"}`)
+	assert.Contains(t, body, "# TYPE app_signups_total counter")
+	assert.NotContains(t, body, "/no/such/route/42")
+}
+
+func TestMetricsToken(t *testing.T) {
+	server.CONFIG.Server.MetricsToken = "scraper"
+	defer func() { server.CONFIG.Server.MetricsToken = "" }()
+	root := server.SetupRouter(docsMiddlewareConfigurer{})
+
+	rw := httptest.NewRecorder()
+	root.ServeHTTP(rw, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 401, rw.Code)
+
+	rw = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scraper")
+	root.ServeHTTP(rw, req)
+	assert.Equal(t, 200, rw.Code)
+}
@@ -0,0 +1,548 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/brunoksato/golang-boilerplate/api"
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/log"
+	"github.com/brunoksato/golang-boilerplate/metrics"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/model"
+	"github.com/brunoksato/golang-boilerplate/openapi"
+	"github.com/labstack/echo/v4"
+)
+
+const API_TITLE = "golang-boilerplate API"
+const API_VERSION = "1.0.0"
+
+// Only handlers of this module are documented; echo registers its own for
+// group middleware.
+const HANDLER_PREFIX = "github.com/brunoksato/golang-boilerplate/"
+
+// OpenAPIHandler serves the document of the routes of root. It is built on
+// the first request, once every route is registered.
+func OpenAPIHandler(root *echo.Echo) echo.HandlerFunc {
+	var once sync.Once
+	var doc *openapi.Document
+	return func(c echo.Context) error {
+		once.Do(func() {
+			doc = OpenAPIDocument(root)
+		})
+		return c.JSON(http.StatusOK, doc)
+	}
+}
+
+func OpenAPIDocument(root *echo.Echo) *openapi.Document {
+	g := openapi.Generator{
+		Info: openapi.Info{
+			Title:   API_TITLE,
+			Version: API_VERSION,
+		},
+		Describers:      OPENAPI_DESCRIBERS,
+		Security:        openAPISecurity,
+		SecuritySchemes: OPENAPI_SECURITY_SCHEMES,
+	}
+	doc := g.Generate(OpenAPIRoutes(root))
+	documentIdempotency(doc)
+	return doc
+}
+
+// documentIdempotency mirrors the Idempotency middleware of the groups:
+// their POST operations take an Idempotency-Key.
+func documentIdempotency(doc *openapi.Document) {
+	for path, item := range doc.Paths {
+		op, ok := item["post"]
+		if !ok || openAPISecurity(path) == nil {
+			continue
+		}
+		op.Parameters = append(op.Parameters, openapi.HeaderParameter(middle.IDEMPOTENCY_KEY_HEADER,
+			"Makes the request safe to retry, the response to its first use is replayed"))
+		op.AddError(http.StatusUnprocessableEntity)
+	}
+}
+
+// OpenAPIRoutes lists the documented routes of root.
+func OpenAPIRoutes(root *echo.Echo) []openapi.Route {
+	routes := []openapi.Route{}
+	for _, r := range root.Routes() {
+		if !strings.HasPrefix(r.Name, HANDLER_PREFIX) {
+			continue
+		}
+		t, _ := middle.TypesForPath(r.Path)
+		routes = append(routes, openapi.Route{
+			Method:  r.Method,
+			Path:    r.Path,
+			Handler: r.Name[strings.LastIndex(r.Name, "/")+1:],
+			Type:    t,
+		})
+	}
+	return routes
+}
+
+var OPENAPI_SECURITY_SCHEMES = map[string]*openapi.SecurityScheme{
+	"company": {
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "X-Company",
+		Description: "Office for the user API, Admin for the admin API and CronJob for cron jobs.",
+	},
+	"bearer": {
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "The token returned by /public/signin.",
+	},
+	"cronjob": {
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "X-Cronjob",
+		Description: "The cron job password.",
+	},
+}
+
+// openAPISecurity mirrors SettingHeaders and Session: every group needs
+// X-Company, /api and /admin a token and /cronjob its password.
+func openAPISecurity(path string) []map[string][]string {
+	switch middle.PathParts(path)[0] {
+	case "public":
+		return []map[string][]string{{"company": {}}}
+	case "api", "admin":
+		return []map[string][]string{{"company": {}, "bearer": {}}}
+	case "cronjob":
+		return []map[string][]string{{"company": {}, "cronjob": {}}}
+	}
+	return nil
+}
+
+var OPENAPI_DESCRIBERS = map[string]openapi.Describer{
+	"api.List":                   describeList,
+	"api.Create":                 describeCreate,
+	"api.Get":                    describeGet,
+	"api.Update":                 describeUpdate,
+	"api.Patch":                  describePatch,
+	"api.Delete":                 describeDelete,
+	"api.Batch":                  describeBatch,
+	"api.Import":                 describeImport,
+	"api.GetExportDownload":      describeExportDownload,
+	"api.GetImportReport":        describeImportReport,
+	"api.SignUp":                 describeSignUp,
+	"api.SignIn":                 describeSignIn,
+	"api.RecoverPassword":        describeRecoverPassword,
+	"api.ChangePasswordExternal": describeChangePasswordExternal,
+	"api.Logout":                 describeStatus,
+	"api.Me":                     describeMe,
+	"api.UpdateUser":             describeUpdateUser,
+	"api.ChangePassword":         describeChangePassword,
+	"api.UploadAvatar":           describeUploadAvatar,
+	"api.UploadAttachment":       describeUploadAttachment,
+	"api.PresignAttachment":      describePresignAttachment,
+	"api.CompleteAttachment":     describeCompleteAttachment,
+	"api.GetFile":                describeGetFile,
+	"api.PutSignedFile":          describePutSignedFile,
+	"api.GetLogLevels":           describeGetLogLevels,
+	"api.UpdateLogLevels":        describeUpdateLogLevels,
+	"server.Healthz":             describeHealthz,
+	"server.Readyz":              describeReadyz,
+	"server.Version":             describeVersion,
+	"server.Metrics":             describeMetrics,
+}
+
+var statusSchema = &openapi.Schema{
+	Type:       "object",
+	Properties: map[string]*openapi.Schema{"status": {Type: "string"}},
+}
+
+func describeList(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "List " + core.TableNameFor(r.Type)
+	op.Parameters = append(op.Parameters,
+		openapi.QueryParameter("start", "Offset of the first item", &openapi.Schema{Type: "integer"}),
+		openapi.QueryParameter("limit", "Maximum number of items", &openapi.Schema{Type: "integer"}),
+		openapi.QueryParameter("sort", "Comma separated fields, each may end in -asc or -desc", &openapi.Schema{Type: "string"}),
+		openapi.QueryParameter("format", "Stream the list as an export instead", &openapi.Schema{
+			Type: "string",
+			Enum: []interface{}{api.EXPORT_FORMAT_CSV, api.EXPORT_FORMAT_NDJSON},
+		}),
+		openapi.QueryParameter("async", "With format, export in the background", &openapi.Schema{Type: "boolean"}),
+	)
+
+	list := openapi.Results(&openapi.Schema{Type: "array", Items: g.Ref(r.Type)})
+	list.Properties["ct"] = &openapi.Schema{Type: "integer", Description: "Total number of items"}
+	op.Responses["200"] = &openapi.Response{
+		Description: "The items, or the export stream when format is set",
+		Content: map[string]openapi.MediaType{
+			"application/json":     {Schema: list},
+			"text/csv":             {Schema: &openapi.Schema{Type: "string"}},
+			"application/x-ndjson": {Schema: &openapi.Schema{Type: "string"}},
+		},
+	}
+	op.Responses["202"] = exportAccepted(g)
+	op.AddError(http.StatusBadRequest)
+}
+
+func describeCreate(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Create a " + typeName(r.Type)
+	op.RequestBody = openapi.JSONBody(g.Ref(r.Type))
+	op.Responses["201"] = openapi.JSONResponse("Created", openapi.Results(g.Ref(r.Type)))
+	op.AddError(http.StatusBadRequest)
+	op.AddError(http.StatusForbidden)
+}
+
+func describeGet(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Get a " + typeName(r.Type)
+	op.Parameters = append(op.Parameters,
+		openapi.HeaderParameter("If-None-Match", "ETag of a cached copy"))
+	ok := openapi.JSONResponse("OK", openapi.Results(g.Ref(r.Type)))
+	ok.Headers = etagHeader()
+	op.Responses["200"] = ok
+	op.Responses["304"] = &openapi.Response{Description: "The cached copy is current"}
+	op.AddError(http.StatusForbidden)
+	op.AddError(http.StatusNotFound)
+}
+
+func describeUpdate(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Replace the fields of a " + typeName(r.Type)
+	op.Parameters = append(op.Parameters, ifMatchParameter())
+	op.RequestBody = openapi.JSONBody(g.Ref(r.Type))
+	accepted := openapi.JSONResponse("Updated", openapi.Results(g.Ref(r.Type)))
+	accepted.Headers = etagHeader()
+	op.Responses["202"] = accepted
+	addUpdateErrors(op)
+}
+
+func describePatch(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Patch a " + typeName(r.Type)
+	op.Parameters = append(op.Parameters, ifMatchParameter())
+	op.RequestBody = &openapi.RequestBody{
+		Required: true,
+		Content: map[string]openapi.MediaType{
+			core.MERGE_PATCH_CONTENT_TYPE: {Schema: g.Ref(r.Type)},
+			core.JSON_PATCH_CONTENT_TYPE: {Schema: &openapi.Schema{
+				Type:  "array",
+				Items: g.Ref(reflect.TypeOf(core.PatchOperation{})),
+			}},
+		},
+	}
+	ok := openapi.JSONResponse("Patched", openapi.Results(g.Ref(r.Type)))
+	ok.Headers = etagHeader()
+	op.Responses["200"] = ok
+	addUpdateErrors(op)
+}
+
+func describeDelete(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Delete a " + typeName(r.Type)
+	op.Parameters = append(op.Parameters, ifMatchParameter())
+	op.Responses["200"] = openapi.JSONResponse("Deleted", openapi.Results(g.Ref(r.Type)))
+	op.AddError(http.StatusBadRequest)
+	op.AddError(http.StatusForbidden)
+	op.AddError(http.StatusNotFound)
+	op.AddError(http.StatusPreconditionFailed)
+}
+
+func describeBatch(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Create, update and delete " + core.TableNameFor(r.Type) + " in one request"
+	op.RequestBody = openapi.JSONBody(g.Ref(reflect.TypeOf(api.BatchRequest{})))
+	results := openapi.Results(&openapi.Schema{
+		Type:  "array",
+		Items: g.Ref(reflect.TypeOf(api.BatchResult{})),
+	})
+	op.Responses["200"] = openapi.JSONResponse("Every operation succeeded", results)
+	op.Responses["207"] = openapi.JSONResponse("Some operations failed", results)
+	op.AddError(http.StatusBadRequest)
+}
+
+func describeImport(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Import " + core.TableNameFor(r.Type) + " from CSV or NDJSON"
+	op.Parameters = append(op.Parameters,
+		openapi.QueryParameter("mode", "What to do with invalid rows", &openapi.Schema{
+			Type: "string",
+			Enum: []interface{}{model.IMPORT_MODE_VALID_ONLY, model.IMPORT_MODE_ALL_OR_NOTHING},
+		}),
+		openapi.QueryParameter("dry_run", "Validate without saving", &openapi.Schema{Type: "boolean"}),
+		openapi.QueryParameter("async", "Import in the background", &openapi.Schema{Type: "boolean"}),
+		openapi.QueryParameter("format", "Format of the file, guessed from it when missing", &openapi.Schema{
+			Type: "string",
+			Enum: []interface{}{api.IMPORT_FORMAT_CSV, api.IMPORT_FORMAT_NDJSON},
+		}),
+	)
+	op.RequestBody = &openapi.RequestBody{
+		Required: true,
+		Content: map[string]openapi.MediaType{
+			"multipart/form-data":  {Schema: fileForm()},
+			"text/csv":             {Schema: &openapi.Schema{Type: "string"}},
+			"application/x-ndjson": {Schema: &openapi.Schema{Type: "string"}},
+		},
+	}
+
+	imp := g.Ref(reflect.TypeOf(model.Import{}))
+	done := openapi.Results(imp)
+	done.Properties["errors"] = &openapi.Schema{
+		Type:  "array",
+		Items: g.Ref(reflect.TypeOf(model.ImportRowError{})),
+	}
+	done.Properties["report_url"] = &openapi.Schema{Type: "string"}
+	op.Responses["200"] = openapi.JSONResponse("Imported", done)
+
+	accepted := openapi.Results(imp)
+	accepted.Properties["url"] = &openapi.Schema{Type: "string"}
+	op.Responses["202"] = openapi.JSONResponse("Importing in the background", accepted)
+	op.AddError(http.StatusBadRequest)
+}
+
+func describeExportDownload(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Download a finished export"
+	op.Responses["200"] = &openapi.Response{
+		Description: "The export file",
+		Content: map[string]openapi.MediaType{
+			"text/csv":             {Schema: &openapi.Schema{Type: "string"}},
+			"application/x-ndjson": {Schema: &openapi.Schema{Type: "string"}},
+		},
+	}
+	op.Responses["202"] = openapi.JSONResponse("Still running",
+		openapi.Results(g.Ref(reflect.TypeOf(model.Export{}))))
+	op.AddError(http.StatusForbidden)
+	op.AddError(http.StatusNotFound)
+}
+
+func describeImportReport(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Download the error report of an import"
+	op.Responses["200"] = &openapi.Response{
+		Description: "CSV with the row, field, code, subcode and message of each error",
+		Content:     map[string]openapi.MediaType{"text/csv": {Schema: &openapi.Schema{Type: "string"}}},
+	}
+	op.Responses["202"] = openapi.JSONResponse("Still running",
+		openapi.Results(g.Ref(reflect.TypeOf(model.Import{}))))
+	op.AddError(http.StatusForbidden)
+	op.AddError(http.StatusNotFound)
+}
+
+func describeSignUp(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Create an account"
+	op.RequestBody = openapi.JSONBody(g.Ref(reflect.TypeOf(model.User{})))
+	op.Responses["201"] = openapi.JSONResponse("Created", openapi.Results(g.Ref(reflect.TypeOf(model.User{}))))
+	op.AddError(http.StatusBadRequest)
+}
+
+func describeSignIn(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Sign in with username and password"
+	op.RequestBody = openapi.JSONBody(&openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"username": {Type: "string"},
+			"password": {Type: "string", WriteOnly: true},
+		},
+		Required: []string{"password", "username"},
+	})
+	signedIn := openapi.Results(g.Ref(reflect.TypeOf(model.User{})))
+	signedIn.Properties["token"] = &openapi.Schema{Type: "string", Description: "Bearer token of the session"}
+	op.Responses["200"] = openapi.JSONResponse("Signed in", signedIn)
+	op.AddError(http.StatusUnauthorized)
+}
+
+func describeRecoverPassword(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Email a password reset link"
+	op.Responses["200"] = openapi.JSONResponse("Sent when the email is known", statusSchema)
+	op.Responses["400"] = openapi.JSONResponse("Lookup failed", statusSchema)
+}
+
+func describeChangePasswordExternal(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Reset the password with the emailed token"
+	op.RequestBody = openapi.JSONBody(&openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"token":    {Type: "string"},
+			"password": {Type: "string", WriteOnly: true},
+		},
+		Required: []string{"password", "token"},
+	})
+	op.Responses["200"] = openapi.JSONResponse("OK", statusSchema)
+	op.AddError(http.StatusBadRequest)
+}
+
+func describeStatus(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Responses["200"] = openapi.JSONResponse("OK", statusSchema)
+}
+
+func describeHealthz(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Liveness probe"
+	op.Responses["200"] = openapi.JSONResponse("The process is alive", statusSchema)
+}
+
+func describeReadyz(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Readiness probe with the status of each dependency"
+	report := &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"status": {Type: "string", Enum: []interface{}{"ok", "failing", "shutting down"}},
+			"checks": g.Schema(reflect.TypeOf(map[string]CheckResult{})),
+		},
+	}
+	op.Responses["200"] = openapi.JSONResponse("Every dependency is reachable", report)
+	op.Responses["503"] = openapi.JSONResponse("A dependency is failing or the server is shutting down", report)
+}
+
+func describeVersion(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Build information"
+	op.Responses["200"] = openapi.JSONResponse("OK", &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"commit":     {Type: "string"},
+			"build_date": {Type: "string"},
+			"go_version": {Type: "string"},
+		},
+	})
+}
+
+func describeMetrics(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Prometheus metrics"
+	op.Parameters = append(op.Parameters, openapi.HeaderParameter("Authorization", "Bearer METRICS_TOKEN, when one is configured"))
+	op.Responses["200"] = &openapi.Response{
+		Description: "Metrics in the Prometheus text format",
+		Content:     map[string]openapi.MediaType{metrics.TEXT_CONTENT_TYPE: {Schema: &openapi.Schema{Type: "string"}}},
+	}
+	op.Responses["401"] = openapi.JSONResponse("Wrong metrics token", statusSchema)
+}
+
+func describeGetLogLevels(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Get the log level of each system and sink"
+	op.Responses["200"] = openapi.JSONResponse("OK", openapi.Results(g.Ref(reflect.TypeOf(log.LevelConfig{}))))
+}
+
+func describeUpdateLogLevels(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Change log levels without a restart"
+	op.RequestBody = openapi.JSONBody(g.Ref(reflect.TypeOf(log.LevelConfig{})))
+	op.RequestBody.Description = "Levels left out keep their value, and an empty system level removes its override."
+	op.Responses["200"] = openapi.JSONResponse("OK", openapi.Results(g.Ref(reflect.TypeOf(log.LevelConfig{}))))
+	op.AddError(http.StatusBadRequest)
+}
+
+func describeMe(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Get the signed in user"
+	op.Responses["200"] = openapi.JSONResponse("OK", openapi.Results(g.Ref(reflect.TypeOf(model.User{}))))
+}
+
+func describeUpdateUser(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Update the profile of the signed in user"
+	op.RequestBody = openapi.JSONBody(g.Ref(reflect.TypeOf(model.User{})))
+	op.Responses["200"] = openapi.JSONResponse("OK", statusSchema)
+	op.AddError(http.StatusNotFound)
+}
+
+func describeChangePassword(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Change the password of the signed in user"
+	op.RequestBody = openapi.JSONBody(&openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"password": {Type: "string", WriteOnly: true}},
+		Required:   []string{"password"},
+	})
+	op.Responses["200"] = openapi.JSONResponse("OK", g.Ref(reflect.TypeOf(model.User{})))
+}
+
+func describeUploadAvatar(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Replace the avatar of the signed in user"
+	op.RequestBody = uploadBody()
+	op.Responses["200"] = openapi.JSONResponse("OK", openapi.Results(g.Ref(reflect.TypeOf(model.User{}))))
+	op.AddError(http.StatusBadRequest)
+}
+
+func describeUploadAttachment(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Upload an attachment"
+	op.RequestBody = uploadBody()
+	op.Responses["201"] = openapi.JSONResponse("Created", openapi.Results(g.Ref(r.Type)))
+	op.AddError(http.StatusBadRequest)
+}
+
+func describePresignAttachment(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Get a URL to upload an attachment to"
+	op.RequestBody = openapi.JSONBody(g.Ref(reflect.TypeOf(api.PresignRequest{})))
+	created := openapi.Results(g.Ref(r.Type))
+	created.Properties["upload"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"method":     {Type: "string"},
+			"url":        {Type: "string"},
+			"headers":    {Type: "object", AdditionalProperties: &openapi.Schema{Type: "string"}},
+			"expires_at": {Type: "string", Format: "date-time"},
+		},
+	}
+	op.Responses["201"] = openapi.JSONResponse("Created", created)
+	op.AddError(http.StatusBadRequest)
+}
+
+func describeCompleteAttachment(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Mark a presigned upload as finished"
+	op.Responses["200"] = openapi.JSONResponse("OK", openapi.Results(g.Ref(r.Type)))
+	op.AddError(http.StatusBadRequest)
+	op.AddError(http.StatusForbidden)
+	op.AddError(http.StatusNotFound)
+}
+
+func describeGetFile(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Download a stored file"
+	op.Responses["200"] = &openapi.Response{
+		Description: "The file",
+		Content:     map[string]openapi.MediaType{"*/*": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}},
+	}
+	op.AddError(http.StatusNotFound)
+}
+
+func describePutSignedFile(g *openapi.Generator, r openapi.Route, op *openapi.Operation) {
+	op.Summary = "Upload to a presigned URL"
+	op.Parameters = append(op.Parameters,
+		openapi.QueryParameter("content_type", "Signed content type", &openapi.Schema{Type: "string"}),
+		openapi.QueryParameter("expires", "Signed expiration, in Unix seconds", &openapi.Schema{Type: "integer"}),
+		openapi.QueryParameter("signature", "Signature of the URL", &openapi.Schema{Type: "string"}),
+	)
+	op.RequestBody = &openapi.RequestBody{
+		Required: true,
+		Content:  map[string]openapi.MediaType{"*/*": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}},
+	}
+	op.Responses["200"] = &openapi.Response{Description: "Stored"}
+	op.AddError(http.StatusBadRequest)
+	op.AddError(http.StatusForbidden)
+}
+
+func exportAccepted(g *openapi.Generator) *openapi.Response {
+	accepted := openapi.Results(g.Ref(reflect.TypeOf(model.Export{})))
+	accepted.Properties["url"] = &openapi.Schema{Type: "string", Description: "Where to download the export from"}
+	return openapi.JSONResponse("Exporting in the background", accepted)
+}
+
+func addUpdateErrors(op *openapi.Operation) {
+	op.AddError(http.StatusBadRequest)
+	op.AddError(http.StatusForbidden)
+	op.AddError(http.StatusNotFound)
+	op.AddError(http.StatusPreconditionFailed)
+}
+
+func ifMatchParameter() *openapi.Parameter {
+	return openapi.HeaderParameter("If-Match", "Only apply the change when the ETag still matches")
+}
+
+func etagHeader() map[string]*openapi.Header {
+	return map[string]*openapi.Header{
+		"ETag": {Schema: &openapi.Schema{Type: "string"}},
+	}
+}
+
+func fileForm() *openapi.Schema {
+	return &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"file": {Type: "string", Format: "binary"}},
+		Required:   []string{"file"},
+	}
+}
+
+func uploadBody() *openapi.RequestBody {
+	return &openapi.RequestBody{
+		Required: true,
+		Content:  map[string]openapi.MediaType{"multipart/form-data": {Schema: fileForm()}},
+	}
+}
+
+func typeName(t reflect.Type) string {
+	return strings.TrimSuffix(core.TableNameFor(t), "s")
+}
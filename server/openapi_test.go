@@ -0,0 +1,107 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/core"
+	"github.com/brunoksato/golang-boilerplate/server"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite docs/openapi.json")
+
+var openAPIFile = filepath.Join("..", "docs", "openapi.json")
+
+// docsMiddlewareConfigurer registers the groups without middleware, the
+// document only needs the routes.
+type docsMiddlewareConfigurer struct{}
+
+func (mc docsMiddlewareConfigurer) ConfigureDefaultApiMiddleware(root *echo.Echo) *echo.Echo {
+	return root
+}
+
+func (mc docsMiddlewareConfigurer) ConfigurePublicApiMiddleware(root *echo.Echo) *echo.Group {
+	return root.Group("/public")
+}
+
+func (mc docsMiddlewareConfigurer) ConfigurePrivateApiMiddleware(root *echo.Echo) *echo.Group {
+	return root.Group("/api")
+}
+
+func (mc docsMiddlewareConfigurer) ConfigureCronJobApiMiddleware(root *echo.Echo) *echo.Group {
+	return root.Group("/cronjob")
+}
+
+func (mc docsMiddlewareConfigurer) ConfigureAdminApiMiddleware(root *echo.Echo) *echo.Group {
+	return root.Group("/admin")
+}
+
+// The committed document must match the routes; run make openapi after
+// changing them.
+func TestOpenAPIDocument(t *testing.T) {
+	root := server.SetupRouter(docsMiddlewareConfigurer{})
+	doc, err := json.MarshalIndent(server.OpenAPIDocument(root), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = append(doc, '\n')
+
+	if *update {
+		if err := ioutil.WriteFile(openAPIFile, doc, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	committed, err := ioutil.ReadFile(openAPIFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(doc, committed) {
+		t.Errorf("docs/openapi.json is out of date, run make openapi")
+	}
+}
+
+func TestOpenAPISchemaFromTags(t *testing.T) {
+	root := server.SetupRouter(docsMiddlewareConfigurer{})
+	doc := server.OpenAPIDocument(root)
+
+	user := doc.Components.Schemas["User"]
+	assert.Equal(t, []string{"email", "name", "username"}, user.Required)
+	assert.True(t, user.Properties["id"].ReadOnly)
+	assert.True(t, user.Properties["password"].WriteOnly)
+	assert.Nil(t, user.Properties["hashed_password"])
+	assert.Equal(t, "email", user.Properties["email"].Format)
+	assert.Equal(t, 3, *user.Properties["username"].MinLength)
+	assert.Equal(t, 15, *user.Properties["username"].MaxLength)
+	assert.Equal(t, "^[a-zA-Z0-9][a-zA-Z0-9-_]+$", user.Properties["username"].Pattern)
+	assert.True(t, user.Properties["avatar_id"].Nullable)
+
+	code := doc.Components.Schemas["Error"].Properties["code"]
+	assert.Contains(t, code.Enum, core.ERROR_SUBCODE_EMAIL_TAKEN)
+	assert.Contains(t, code.Enum, core.ERROR_CODE_NOT_FOUND)
+
+	get := doc.Paths["/admin/configurations/{id}"]["get"]
+	assert.Equal(t, "getAdminConfigurationsById", get.OperationID)
+	assert.Equal(t, "#/components/responses/NotFound", get.Responses["404"].Ref)
+	assert.Equal(t, "#/components/responses/AuthenticationError", get.Responses["401"].Ref)
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	root := server.SetupRouter(docsMiddlewareConfigurer{})
+	rw := httptest.NewRecorder()
+	root.ServeHTTP(rw, httptest.NewRequest("GET", "/openapi.json", nil))
+	core.AssertResponseCode(t, rw, 200)
+
+	body := core.JsonToMap(rw.Body.String())
+	assert.Equal(t, "3.0.3", body["openapi"])
+	assert.Contains(t, body["paths"], "/admin/users")
+	assert.Contains(t, body["paths"], "/openapi.json")
+}
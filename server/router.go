@@ -2,10 +2,10 @@ package server
 
 import (
 	"net/http"
-	"os"
 
 	"github.com/brunoksato/golang-boilerplate/api"
 	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/tracing"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"go.elastic.co/apm/module/apmechov4"
@@ -13,6 +13,9 @@ import (
 
 var cors []string
 
+// MiddlewareConfigurer sets up the middleware of the router. The default
+// middleware goes on the root once and runs for every route, the others
+// configure the group of an API type.
 type MiddlewareConfigurer interface {
 	ConfigureDefaultApiMiddleware(*echo.Echo) *echo.Echo
 	ConfigurePublicApiMiddleware(*echo.Echo) *echo.Group
@@ -23,15 +26,34 @@ type MiddlewareConfigurer interface {
 
 func SetupRouter(mc MiddlewareConfigurer) *echo.Echo {
 	root := echo.New()
-	root.Use(apmechov4.Middleware())
+	if tracing.Enabled(tracing.BACKEND_APM) {
+		root.Use(apmechov4.Middleware())
+	}
+	if tracing.Enabled(tracing.BACKEND_OTEL) {
+		root.Use(middle.Tracing)
+	}
+	root.Use(middle.Metrics)
+	root = mc.ConfigureDefaultApiMiddleware(root)
 	root.GET("/", func(c echo.Context) error {
 		hello := map[string]interface{}{"status": "API OK"}
 		return c.JSON(http.StatusOK, hello)
 	})
 
+	root.GET("/healthz", Healthz)
+	root.GET("/readyz", Readyz)
+	root.GET("/version", Version)
+	root.GET("/metrics", Metrics)
+
+	root.GET("/openapi.json", OpenAPIHandler(root))
+
 	root.POST("/webhook/sample", api.WebhookSample)
 
-	if os.Getenv("ENV") == "production" {
+	// Objects of the filesystem storage; presigned uploads carry their own
+	// signature instead of a session.
+	root.GET("/files/*", api.GetFile)
+	root.PUT("/files/*", api.PutSignedFile)
+
+	if CONFIG.IsProduction() {
 		cors = []string{"*"}
 	} else {
 		cors = []string{"*"}
@@ -61,17 +83,48 @@ func SetupRouter(mc MiddlewareConfigurer) *echo.Echo {
 	private.GET("/logout", api.Logout)
 
 	/* User */
-	private.GET("/users/me", api.Me)
+	private.GET("/users/me", api.Me, middle.ReadReplica)
 
 	private.PUT("/users", api.UpdateUser)
 	private.PUT("/users/password", api.ChangePassword)
+	private.PATCH("/users/:id", api.Patch)
+	private.PUT("/users/avatar", api.UploadAvatar)
+
+	/* Attachment */
+	private.POST("/attachments", api.UploadAttachment)
+	private.POST("/attachments/presign", api.PresignAttachment)
+	private.POST("/attachments/:id/complete", api.CompleteAttachment)
+	private.GET("/attachments/:id", api.Get, middle.ReadReplica)
+	private.DELETE("/attachments/:id", api.Delete)
 
 	//
 	// ADMIN ENDPOINTS
 	//
 	admin := mc.ConfigureAdminApiMiddleware(root)
 
-	admin.GET("/users", api.List)
+	// Imports and streamed exports run longer than the default timeout.
+	long := middle.Timeout(CONFIG.Server.LongRequestTimeout)
+
+	admin.GET("/users", api.List, middle.ReadReplica, long)
+	admin.POST("/users/batch", api.Batch)
+	admin.POST("/users/import", api.Import, long)
+
+	admin.GET("/configurations/:id", api.Get, middle.ReadReplica)
+	admin.PUT("/configurations/:id", api.Update)
+	admin.PATCH("/configurations/:id", api.Patch)
+	admin.POST("/configurations/batch", api.Batch)
+	admin.POST("/configurations/import", api.Import, long)
+
+	// Exports and imports stay on the primary, their status is written by
+	// background jobs and polled right away.
+	admin.GET("/exports/:id", api.Get)
+	admin.GET("/exports/:id/download", api.GetExportDownload)
+
+	admin.GET("/imports/:id", api.Get)
+	admin.GET("/imports/:id/report", api.GetImportReport)
+
+	admin.GET("/logging/levels", api.GetLogLevels)
+	admin.PUT("/logging/levels", api.UpdateLogLevels)
 
 	return root
 }
@@ -79,63 +132,66 @@ func SetupRouter(mc MiddlewareConfigurer) *echo.Echo {
 type ProductionMiddlewareConfigurer struct{}
 
 func (mc ProductionMiddlewareConfigurer) ConfigureDefaultApiMiddleware(root *echo.Echo) *echo.Echo {
-	root.Use(middleware.Logger())
 	root.Use(middleware.Recover())
 	root.Use(middleware.CORS())
+	root.Use(middle.Config(CONFIG))
+	root.Use(middle.Timeout(CONFIG.Server.RequestTimeout))
 	root.Use(middleware.SecureWithConfig(middleware.SecureConfig{
 		XSSProtection:         "1; mode=block",
 		ContentTypeNosniff:    "nosniff",
 		XFrameOptions:         "SAMEORIGIN",
 		ContentSecurityPolicy: "default-src 'self'",
 	}))
-	root.Use(middle.DBMiddleware(RW_DB_POOL))
+	root.Use(middle.ReplicaDBMiddleware(REPLICAS))
 	root.Use(middle.ElasticMiddleware(ES))
 	root.Use(middle.DetermineType)
 	root.Use(middle.InitializePayload)
+	root.Use(middle.LoadShed(LIMITER))
+	root.Use(middle.DBBreaker(DB_BREAKER))
 	root.Use(middle.LoadConfigurations)
 
 	return root
 }
 
 func (mc ProductionMiddlewareConfigurer) ConfigurePublicApiMiddleware(root *echo.Echo) *echo.Group {
-	api := mc.ConfigureDefaultApiMiddleware(root)
-	public := api.Group("/public")
+	public := root.Group("/public")
 	public.Use(middleware.CORS())
 	public.Use(middle.SettingHeaders)
 	public.Use(middle.Session)
+	public.Use(middle.Idempotency(CONFIG.API.IdempotencyTTL, CONFIG.API.IdempotencyMaxBytes))
 
 	return public
 }
 
 func (mc ProductionMiddlewareConfigurer) ConfigurePrivateApiMiddleware(root *echo.Echo) *echo.Group {
-	api := mc.ConfigureDefaultApiMiddleware(root)
-	private := api.Group("/api")
+	private := root.Group("/api")
 	private.Use(middleware.Gzip())
 	private.Use(middleware.CORS())
 	private.Use(middle.SettingHeaders)
 	private.Use(middle.Session)
+	private.Use(middle.Idempotency(CONFIG.API.IdempotencyTTL, CONFIG.API.IdempotencyMaxBytes))
 
 	return private
 }
 
 func (mc ProductionMiddlewareConfigurer) ConfigureCronJobApiMiddleware(root *echo.Echo) *echo.Group {
-	api := mc.ConfigureDefaultApiMiddleware(root)
-	private := api.Group("/cronjob")
+	private := root.Group("/cronjob")
 	private.Use(middleware.CORS())
 	private.Use(middleware.Gzip())
 	private.Use(middle.SettingHeaders)
 	private.Use(middle.Session)
+	private.Use(middle.Idempotency(CONFIG.API.IdempotencyTTL, CONFIG.API.IdempotencyMaxBytes))
 
 	return private
 }
 
 func (mc ProductionMiddlewareConfigurer) ConfigureAdminApiMiddleware(root *echo.Echo) *echo.Group {
-	api := mc.ConfigureDefaultApiMiddleware(root)
-	private := api.Group("/admin")
+	private := root.Group("/admin")
 	private.Use(middleware.CORS())
 	private.Use(middleware.Gzip())
 	private.Use(middle.SettingHeaders)
 	private.Use(middle.Session)
+	private.Use(middle.Idempotency(CONFIG.API.IdempotencyTTL, CONFIG.API.IdempotencyMaxBytes))
 
 	return private
 }
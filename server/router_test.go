@@ -0,0 +1,37 @@
+package server_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brunoksato/golang-boilerplate/server"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingMiddlewareConfigurer counts the runs of its default middleware.
+type countingMiddlewareConfigurer struct {
+	docsMiddlewareConfigurer
+	runs *int
+}
+
+func (mc countingMiddlewareConfigurer) ConfigureDefaultApiMiddleware(root *echo.Echo) *echo.Echo {
+	root.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			*mc.runs++
+			return next(c)
+		}
+	})
+	return root
+}
+
+func TestDefaultMiddlewareRunsOnce(t *testing.T) {
+	runs := 0
+	root := server.SetupRouter(countingMiddlewareConfigurer{runs: &runs})
+
+	rw := httptest.NewRecorder()
+	root.ServeHTTP(rw, httptest.NewRequest("GET", "/healthz", nil))
+
+	assert.Equal(t, 200, rw.Code)
+	assert.Equal(t, 1, runs)
+}
@@ -1,25 +1,61 @@
 package server
 
 import (
+	"context"
 	"time"
 
-	config "github.com/brunoksato/golang-boilerplate/config"
+	"github.com/brunoksato/golang-boilerplate/cache"
+	"github.com/brunoksato/golang-boilerplate/config"
+	middle "github.com/brunoksato/golang-boilerplate/middleware"
+	"github.com/brunoksato/golang-boilerplate/storage"
+	"github.com/brunoksato/golang-boilerplate/tracing"
 	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo/v4"
 	"github.com/olivere/elastic"
 )
 
+// CONFIG is the configuration the server was started with. It is handed
+// to the components that need it, and to handlers through the request.
+var CONFIG = config.Default()
 var RW_DB_POOL *gorm.DB
+var RO_DB_POOLS []*gorm.DB
+var REPLICAS *middle.Replicas
+var DB_BREAKER *middle.Breaker
+var LIMITER *middle.Limiter
 var ES *elastic.Client
 
-func Start() *echo.Echo {
-	config.Init()
-	RW_DB_POOL = config.InitDB()
-	RW_DB_POOL.DB().SetConnMaxLifetime(time.Second * 30)
-	RW_DB_POOL.DB().SetMaxIdleConns(40)
-	RW_DB_POOL.DB().SetMaxOpenConns(40)
-	RW_DB_POOL.LogMode(true)
-	ES = config.InitElasticSearchAndLogger()
+// IDEMPOTENCY_PURGE_INTERVAL is how often expired Idempotency-Keys are
+// deleted.
+const IDEMPOTENCY_PURGE_INTERVAL = time.Hour
+
+func Start(cfg *config.Config) *echo.Echo {
+	CONFIG = cfg
+	tracing.Init(cfg.Tracing, cfg.Server.Name)
+	storage.SetDefault(storage.New(cfg))
+	cache.SetDefault(cache.New(cfg))
+	RW_DB_POOL = InitDB(cfg)
+	configurePool("rw", RW_DB_POOL)
+	DB_BREAKER = middle.NewBreaker("rw", RW_DB_POOL, cfg.Database.BreakerThreshold, cfg.Database.BreakerCooldown)
+	DB_BREAKER.RegisterCallbacks(RW_DB_POOL)
+	names, pools := InitReplicaDBs(cfg)
+	for i, pool := range pools {
+		configurePool(names[i], pool)
+	}
+	RO_DB_POOLS = pools
+	REPLICAS = middle.NewReplicas(RW_DB_POOL, names, pools, cfg.Database.ReplicaStickyWindow)
+	go REPLICAS.Monitor(context.Background(), cfg.Database.ReplicaCheckInterval, cfg.Server.HealthCheckTimeout)
+	go middle.PurgeIdempotencyKeys(context.Background(), RW_DB_POOL, IDEMPOTENCY_PURGE_INTERVAL)
+	ES = InitElasticSearchAndLogger(cfg)
+	if cfg.Server.ConcurrencyLimit > 0 {
+		LIMITER = middle.NewLimiter(cfg.Server.ConcurrencyLimit, cfg.Server.ConcurrencyMinLimit, cfg.Server.ConcurrencyMaxLimit,
+			cfg.Server.ConcurrencyLatencyTarget, cfg.Server.ConcurrencyUserShare)
+	}
+
+	RegisterCheck("database", DatabaseCheck(RW_DB_POOL))
+	if ES != nil {
+		RegisterCheck("elasticsearch", ElasticsearchCheck(ES))
+	}
+
 	root := SetupRouter(ProductionMiddlewareConfigurer{})
 
 	return root
@@ -0,0 +1,52 @@
+package server_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/server"
+	"github.com/brunoksato/golang-boilerplate/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingExporter struct {
+	mutex sync.Mutex
+	spans []*tracing.Span
+}
+
+func (e *recordingExporter) Export(ctx context.Context, spans []*tracing.Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	tracing.SetBackends("otel")
+	defer tracing.SetBackends()
+	exporter := &recordingExporter{}
+	tracing.SetTracer(&tracing.Tracer{Exporter: exporter, SampleRatio: 1})
+	defer tracing.SetTracer(nil)
+
+	root := server.SetupRouter(docsMiddlewareConfigurer{})
+	req := httptest.NewRequest("GET", "/version", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	root.ServeHTTP(httptest.NewRecorder(), req)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	tracing.Shutdown(ctx)
+
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	if assert.Len(t, exporter.spans, 1) {
+		span := exporter.spans[0]
+		assert.Equal(t, "GET /version", span.Name)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent.String())
+		assert.Equal(t, 200, span.Attributes["http.status_code"])
+	}
+}
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/config"
+)
+
+var ErrSignatureInvalid = errors.New("storage: signature is invalid")
+var ErrSignatureExpired = errors.New("storage: signature has expired")
+
+// Filesystem keeps objects as plain files under Dir. Objects are served and
+// presigned uploads accepted under BaseURL, see api.GetFile and
+// api.PutSignedFile, which stores them with Create.
+type Filesystem struct {
+	Dir     string
+	BaseURL string
+	Secret  []byte
+	Now     func() time.Time
+}
+
+func NewFilesystem(dir, baseURL string, secret []byte) *Filesystem {
+	return &Filesystem{
+		Dir:     dir,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Secret:  secret,
+		Now:     time.Now,
+	}
+}
+
+// NewFilesystemFromConfig stores objects under the storage dir, a
+// temporary one by default, served from the storage base URL.
+func NewFilesystemFromConfig(cfg *config.Config) *Filesystem {
+	dir := cfg.Storage.Dir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "storage")
+	}
+	baseURL := cfg.Storage.BaseURL
+	if baseURL == "" {
+		baseURL = "/files"
+	}
+	return NewFilesystem(dir, baseURL, []byte(cfg.Storage.SigningKey))
+}
+
+func (fs *Filesystem) Put(key string, r io.Reader, size int64, contentType string) error {
+	fileName, tmp, err := fs.write(key, r, size)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, fileName)
+}
+
+// Create is Put, except that it fails with ErrObjectExists instead of
+// replacing an object, even one written concurrently.
+func (fs *Filesystem) Create(key string, r io.Reader, size int64, contentType string) error {
+	fileName, tmp, err := fs.write(key, r, size)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	err = os.Link(tmp, fileName)
+	if os.IsExist(err) {
+		return ErrObjectExists
+	}
+	return err
+}
+
+// write copies r next to the file of key, so readers never see half a file,
+// and returns both names.
+func (fs *Filesystem) write(key string, r io.Reader, size int64) (string, string, error) {
+	fileName, err := fs.path(key)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return "", "", err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".*.part")
+	if err != nil {
+		return "", "", err
+	}
+
+	n, err := io.Copy(f, r)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("storage: wrote %d bytes, expected %d", n, size)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	return fileName, f.Name(), nil
+}
+
+func (fs *Filesystem) Open(key string) (io.ReadCloser, error) {
+	fileName, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (fs *Filesystem) Stat(key string) (Object, error) {
+	f, err := fs.Open(key)
+	if err != nil {
+		return Object{}, err
+	}
+	defer f.Close()
+
+	info, err := f.(*os.File).Stat()
+	if err != nil {
+		return Object{}, err
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return Object{}, err
+	}
+
+	return Object{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: http.DetectContentType(head[:n]),
+	}, nil
+}
+
+func (fs *Filesystem) Delete(key string) error {
+	fileName, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(fileName)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (fs *Filesystem) URL(key string) string {
+	return fs.BaseURL + "/" + escapeKey(key)
+}
+
+func (fs *Filesystem) PresignPut(key, contentType string, expires time.Duration) (string, error) {
+	if _, err := CleanKey(key); err != nil {
+		return "", err
+	}
+
+	expiresAt := strconv.FormatInt(fs.Now().Add(expires).Unix(), 10)
+	query := url.Values{}
+	query.Set("content_type", contentType)
+	query.Set("expires", expiresAt)
+	query.Set("signature", fs.sign(key, contentType, expiresAt))
+	return fs.URL(key) + "?" + query.Encode(), nil
+}
+
+// VerifyPut checks the query of a URL made by PresignPut against the key
+// and content type of the upload actually being made.
+func (fs *Filesystem) VerifyPut(key, contentType string, query url.Values) error {
+	expiresAt := query.Get("expires")
+	expected := fs.sign(key, query.Get("content_type"), expiresAt)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return ErrSignatureInvalid
+	}
+	if query.Get("content_type") != contentType {
+		return ErrSignatureInvalid
+	}
+
+	expires, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	if fs.Now().Unix() > expires {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+func (fs *Filesystem) sign(key, contentType, expiresAt string) string {
+	mac := hmac.New(sha256.New, fs.Secret)
+	mac.Write([]byte("PUT\n" + key + "\n" + contentType + "\n" + expiresAt))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (fs *Filesystem) path(key string) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(fs.Dir, filepath.FromSlash(key)), nil
+}
+
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testFilesystem(t *testing.T) (*Filesystem, func()) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewFilesystem(dir, "/files/", []byte("secret")), func() { os.RemoveAll(dir) }
+}
+
+func TestFilesystemRoundTrip(t *testing.T) {
+	fs, cleanup := testFilesystem(t)
+	defer cleanup()
+
+	err := fs.Put("docs/readme.txt", strings.NewReader("hello world"), 11, "text/plain")
+	assert.Nil(t, err)
+
+	obj, err := fs.Stat("docs/readme.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), obj.Size)
+	assert.Equal(t, "text/plain; charset=utf-8", obj.ContentType)
+
+	f, err := fs.Open("docs/readme.txt")
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(f)
+	f.Close()
+	assert.Equal(t, "hello world", string(body))
+
+	assert.Equal(t, "/files/docs/readme.txt", fs.URL("docs/readme.txt"))
+
+	assert.Nil(t, fs.Delete("docs/readme.txt"))
+	_, err = fs.Open("docs/readme.txt")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, fs.Delete("docs/readme.txt"))
+}
+
+func TestFilesystemPutSizeMismatch(t *testing.T) {
+	fs, cleanup := testFilesystem(t)
+	defer cleanup()
+
+	err := fs.Put("short.txt", strings.NewReader("abc"), 10, "text/plain")
+	assert.NotNil(t, err)
+
+	_, err = fs.Stat("short.txt")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestFilesystemRejectsTraversal(t *testing.T) {
+	fs, cleanup := testFilesystem(t)
+	defer cleanup()
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../b", "a//b", `a\b`} {
+		err := fs.Put(key, strings.NewReader("x"), 1, "text/plain")
+		assert.Equal(t, ErrInvalidKey, err, key)
+	}
+}
+
+func TestFilesystemPresignPut(t *testing.T) {
+	fs, cleanup := testFilesystem(t)
+	defer cleanup()
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	fs.Now = func() time.Time { return now }
+
+	presigned, err := fs.PresignPut("avatars/me.png", "image/png", 15*time.Minute)
+	assert.Nil(t, err)
+
+	u, err := url.Parse(presigned)
+	assert.Nil(t, err)
+	assert.Equal(t, "/files/avatars/me.png", u.Path)
+
+	query := u.Query()
+	assert.Nil(t, fs.VerifyPut("avatars/me.png", "image/png", query))
+	assert.Equal(t, ErrSignatureInvalid, fs.VerifyPut("avatars/you.png", "image/png", query))
+	assert.Equal(t, ErrSignatureInvalid, fs.VerifyPut("avatars/me.png", "text/html", query))
+
+	tampered := url.Values{}
+	for k, v := range query {
+		tampered[k] = v
+	}
+	tampered.Set("expires", "9999999999")
+	assert.Equal(t, ErrSignatureInvalid, fs.VerifyPut("avatars/me.png", "image/png", tampered))
+
+	now = now.Add(16 * time.Minute)
+	assert.Equal(t, ErrSignatureExpired, fs.VerifyPut("avatars/me.png", "image/png", query))
+}
+
+func TestFilesystemCreateOnce(t *testing.T) {
+	fs, cleanup := testFilesystem(t)
+	defer cleanup()
+
+	assert.Nil(t, fs.Create("avatars/me.png", strings.NewReader("first"), 5, "image/png"))
+	assert.Equal(t, ErrObjectExists, fs.Create("avatars/me.png", strings.NewReader("second"), 6, "image/png"))
+
+	f, err := fs.Open("avatars/me.png")
+	assert.Nil(t, err)
+	defer f.Close()
+	content, _ := ioutil.ReadAll(f)
+	assert.Equal(t, "first", string(content))
+
+	parts, _ := filepath.Glob(filepath.Join(fs.Dir, "avatars", "*.part"))
+	assert.Empty(t, parts)
+}
+
+func TestNewKey(t *testing.T) {
+	key := NewKey("attachments/12", "Report.PDF")
+	assert.True(t, strings.HasPrefix(key, "attachments/12/"))
+	assert.True(t, strings.HasSuffix(key, ".pdf"))
+	assert.NotEqual(t, key, NewKey("attachments/12", "Report.PDF"))
+
+	key = NewKey("attachments/12", "evil.p/hp")
+	_, err := CleanKey(key)
+	assert.Nil(t, err)
+}
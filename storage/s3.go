@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/config"
+)
+
+const s3Algorithm = "AWS4-HMAC-SHA256"
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3 talks to Amazon S3 or any S3 compatible store (MinIO, Ceph, R2...)
+// through the REST API, signing every request with AWS signature version 4.
+//
+// Endpoint is the scheme and host requests go to. With PathStyle the bucket
+// is the first path segment (http://minio:9000/bucket/key), otherwise it is
+// already part of the host (https://bucket.s3.amazonaws.com/key).
+type S3 struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	// PublicURL, when set, replaces the endpoint in URL, e.g. a CDN.
+	PublicURL string
+	Client    *http.Client
+	Now       func() time.Time
+}
+
+// NewS3FromConfig uses the bucket, region and keys of the AWS config. The
+// S3 endpoint points it at a compatible store and switches to path style
+// addressing.
+func NewS3FromConfig(cfg *config.Config) *S3 {
+	s := &S3{
+		Endpoint:  strings.TrimSuffix(cfg.Storage.S3Endpoint, "/"),
+		Bucket:    cfg.AWS.Bucket,
+		Region:    cfg.AWS.Region,
+		AccessKey: cfg.AWS.AccessKey,
+		SecretKey: cfg.AWS.SecretKey,
+		PublicURL: strings.TrimSuffix(cfg.Storage.BaseURL, "/"),
+		Client:    http.DefaultClient,
+		Now:       time.Now,
+	}
+
+	if s.Endpoint == "" {
+		s.Endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", s.Bucket, s.Region)
+	} else {
+		s.PathStyle = true
+	}
+	return s
+}
+
+func (s *S3) Put(key string, r io.Reader, size int64, contentType string) error {
+	req, err := s.request(http.MethodPut, key, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3) Open(key string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *S3) Stat(key string) (Object, error) {
+	req, err := s.request(http.MethodHead, key, nil)
+	if err != nil {
+		return Object{}, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return Object{}, err
+	}
+	res.Body.Close()
+
+	return Object{
+		Key:         key,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+	}, nil
+}
+
+func (s *S3) Delete(key string) error {
+	req, err := s.request(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3) URL(key string) string {
+	if s.PublicURL != "" {
+		return s.PublicURL + "/" + escapeKey(key)
+	}
+	return s.objectURL(key)
+}
+
+func (s *S3) PresignPut(key, contentType string, expires time.Duration) (string, error) {
+	if _, err := CleanKey(key); err != nil {
+		return "", err
+	}
+
+	headers := http.Header{}
+	for name, value := range PresignedPutHeaders(contentType) {
+		headers.Set(name, value)
+	}
+	return s.Presign(http.MethodPut, key, headers, expires)
+}
+
+// Presign builds a query string authenticated URL. Every header given must
+// be sent unchanged by whoever uses the URL.
+func (s *S3) Presign(method, key string, headers http.Header, expires time.Duration) (string, error) {
+	u, err := url.Parse(s.objectURL(key))
+	if err != nil {
+		return "", err
+	}
+
+	now := s.Now().UTC()
+	headers = cloneHeader(headers)
+	headers.Set("Host", u.Host)
+	signedHeaders, canonicalHeaders := s3CanonicalHeaders(headers)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		s3CanonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", s.signature(now, canonicalRequest))
+	u.RawQuery = s3CanonicalQuery(query)
+	return u.String(), nil
+}
+
+func (s *S3) objectURL(key string) string {
+	if s.PathStyle {
+		return s.Endpoint + "/" + s3Escape(s.Bucket, false) + "/" + s3Escape(key, true)
+	}
+	return s.Endpoint + "/" + s3Escape(key, true)
+}
+
+func (s *S3) request(method, key string, body io.Reader) (*http.Request, error) {
+	if _, err := CleanKey(key); err != nil {
+		return nil, err
+	}
+
+	return http.NewRequest(method, s.objectURL(key), body)
+}
+
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	s.sign(req)
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		return nil, fmt.Errorf("storage: s3 %s %s: %s %s", req.Method, req.URL.Path, res.Status, strings.TrimSpace(string(msg)))
+	}
+	return res, nil
+}
+
+// sign adds an Authorization header. The payload is not hashed, which S3
+// accepts and which lets uploads stream straight from the client.
+func (s *S3) sign(req *http.Request) {
+	now := s.Now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	headers := cloneHeader(req.Header)
+	headers.Set("Host", req.URL.Host)
+	signedHeaders, canonicalHeaders := s3CanonicalHeaders(headers)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.AccessKey, s.scope(now), signedHeaders, s.signature(now, canonicalRequest)))
+}
+
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(now time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format("20060102T150405Z"),
+		s.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func cloneHeader(h http.Header) http.Header {
+	clone := http.Header{}
+	for name, values := range h {
+		clone[name] = append([]string{}, values...)
+	}
+	return clone
+}
+
+func s3CanonicalHeaders(h http.Header) (string, string) {
+	names := []string{}
+	values := map[string]string{}
+	for name, vals := range h {
+		lower := strings.ToLower(name)
+		if lower == "authorization" || lower == "user-agent" {
+			continue
+		}
+		trimmed := make([]string, len(vals))
+		for i, v := range vals {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		names = append(names, lower)
+		values[lower] = strings.Join(trimmed, ",")
+	}
+	sort.Strings(names)
+
+	canonical := ""
+	for _, name := range names {
+		canonical += name + ":" + values[name] + "\n"
+	}
+	return strings.Join(names, ";"), canonical
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape is the URI encoding of signature version 4: everything but the
+// unreserved characters is percent encoded, and "/" too unless it separates
+// path segments.
+func s3Escape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && path:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
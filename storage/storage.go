@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/config"
+)
+
+const BACKEND_FILESYSTEM = "filesystem"
+const BACKEND_S3 = "s3"
+
+var ErrNotFound = errors.New("storage: object not found")
+var ErrInvalidKey = errors.New("storage: invalid key")
+var ErrObjectExists = errors.New("storage: object already exists")
+
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+}
+
+// Storage is an object store addressed by slash separated keys. Backends
+// must be safe for concurrent use.
+type Storage interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Open(key string) (io.ReadCloser, error)
+	Stat(key string) (Object, error)
+	Delete(key string) error
+	// URL is where clients download the object from.
+	URL(key string) string
+	// PresignPut returns a URL that accepts a single PUT of the object with
+	// the given content type until it expires, without any other credential.
+	// The PUT must send PresignedPutHeaders, and fails once the object
+	// exists so the URL can't replace what was already checked.
+	PresignPut(key, contentType string, expires time.Duration) (string, error)
+}
+
+// PresignedPutHeaders are the headers a PUT to a URL of PresignPut sends.
+// If-None-Match makes the store refuse to overwrite the object.
+func PresignedPutHeaders(contentType string) map[string]string {
+	return map[string]string{
+		"Content-Type":  contentType,
+		"If-None-Match": "*",
+	}
+}
+
+var mutex sync.Mutex
+var defaultStorage Storage
+
+// Default returns the storage set with SetDefault, or a filesystem one
+// built from the default configuration on first use.
+func Default() Storage {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if defaultStorage == nil {
+		defaultStorage = New(config.Default())
+	}
+	return defaultStorage
+}
+
+// SetDefault replaces the storage returned by Default. Tests use it to point
+// uploads at a temporary directory.
+func SetDefault(s Storage) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	defaultStorage = s
+}
+
+// New builds the storage of the backend cfg selects.
+func New(cfg *config.Config) Storage {
+	if cfg.Storage.Backend == BACKEND_S3 {
+		return NewS3FromConfig(cfg)
+	}
+	return NewFilesystemFromConfig(cfg)
+}
+
+// NewKey builds a unique key under prefix that keeps the extension of
+// fileName, e.g. attachments/12/2f1c...9a.png.
+func NewKey(prefix, fileName string) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if len(ext) > 10 || strings.ContainsAny(ext, "/\\?#% ") {
+		ext = ""
+	}
+	return path.Join(prefix, hex.EncodeToString(b)+ext)
+}
+
+// CleanKey rejects keys that are empty, absolute or try to climb out of the
+// store with "..".
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+)
+
+const GORM_CONTEXT_KEY = "tracing:context"
+const GORM_SPAN_KEY = "tracing:span"
+
+// WithContext returns db tied to ctx, queries run through it are spans of
+// the trace in ctx.
+func WithContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if ctx == nil || SpanFromContext(ctx) == nil {
+		return db
+	}
+	return db.Set(GORM_CONTEXT_KEY, ctx)
+}
+
+// RegisterCallbacks makes every query of db run through WithContext a
+// span.
+func RegisterCallbacks(db *gorm.DB) {
+	callback := db.Callback()
+	callback.Create().Before("gorm:create").Register("tracing:before_create", beforeQuery("gorm.create"))
+	callback.Create().After("gorm:create").Register("tracing:after_create", afterQuery)
+	callback.Query().Before("gorm:query").Register("tracing:before_query", beforeQuery("gorm.query"))
+	callback.Query().After("gorm:query").Register("tracing:after_query", afterQuery)
+	callback.Update().Before("gorm:update").Register("tracing:before_update", beforeQuery("gorm.update"))
+	callback.Update().After("gorm:update").Register("tracing:after_update", afterQuery)
+	callback.Delete().Before("gorm:delete").Register("tracing:before_delete", beforeQuery("gorm.delete"))
+	callback.Delete().After("gorm:delete").Register("tracing:after_delete", afterQuery)
+	callback.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", beforeQuery("gorm.row_query"))
+	callback.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", afterQuery)
+}
+
+func beforeQuery(name string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		value, ok := scope.Get(GORM_CONTEXT_KEY)
+		if !ok {
+			return
+		}
+		ctx, ok := value.(context.Context)
+		if !ok {
+			return
+		}
+		_, span := StartSpan(ctx, name, KIND_CLIENT)
+		span.SetAttribute("db.system", scope.Dialect().GetName())
+		span.SetAttribute("db.sql.table", scope.TableName())
+		scope.Set(GORM_SPAN_KEY, span)
+	}
+}
+
+func afterQuery(scope *gorm.Scope) {
+	value, ok := scope.Get(GORM_SPAN_KEY)
+	if !ok {
+		return
+	}
+	span, ok := value.(*Span)
+	if !ok || span == nil {
+		return
+	}
+	span.SetAttribute("db.statement", scope.SQL)
+	span.SetAttribute("db.rows_affected", scope.DB().RowsAffected)
+	if err := scope.DB().Error; err != nil && err != gorm.ErrRecordNotFound {
+		span.SetError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Transport traces outgoing requests made with a context holding a span,
+// and passes the trace on in the traceparent header. Requests outside of a
+// trace go out untouched.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// HTTPClient is a client for calls to other services, like webhooks.
+func HTTPClient() *http.Client {
+	return &http.Client{Transport: &Transport{}}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if SpanFromContext(req.Context()) == nil {
+		return base.RoundTrip(req)
+	}
+
+	ctx, span := StartSpan(req.Context(), "HTTP "+req.Method, KIND_CLIENT)
+	defer span.End()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	span.SetAttribute("net.peer.name", req.URL.Hostname())
+
+	// RoundTrippers must not change the request they are given.
+	out := req.WithContext(ctx)
+	out.Header = http.Header{}
+	for k, v := range req.Header {
+		out.Header[k] = v
+	}
+	out.Header.Set("traceparent", span.Context.Traceparent())
+
+	res, err := base.RoundTrip(out)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", res.StatusCode)
+	if res.StatusCode >= 500 {
+		span.SetError(fmt.Errorf("HTTP %d", res.StatusCode))
+	}
+	return res, nil
+}
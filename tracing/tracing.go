@@ -0,0 +1,247 @@
+// Package tracing creates spans and exports them to an OpenTelemetry
+// collector. Spans travel in context.Context and across services in the
+// W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/brunoksato/golang-boilerplate/config"
+)
+
+// Backends selectable with TRACING_BACKEND, a comma separated list.
+const (
+	BACKEND_APM  = "apm"
+	BACKEND_OTEL = "otel"
+)
+
+const DEFAULT_QUEUE_SIZE = 2048
+const DEFAULT_BATCH_SIZE = 512
+const DEFAULT_FLUSH_INTERVAL = 5 * time.Second
+
+// Exporter ships finished spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Tracer starts spans and exports the sampled ones in batches.
+type Tracer struct {
+	Exporter Exporter
+	// SampleRatio is the share of new traces that are recorded. Traces
+	// started elsewhere follow the decision of their caller.
+	SampleRatio   float64
+	BatchSize     int
+	FlushInterval time.Duration
+
+	queue chan *Span
+	flush chan chan struct{}
+	once  sync.Once
+}
+
+var tracer *Tracer
+var backends = map[string]bool{}
+var tracerMutex sync.RWMutex
+
+// Enabled tells whether backend was selected by Init or SetBackends.
+func Enabled(backend string) bool {
+	tracerMutex.RLock()
+	defer tracerMutex.RUnlock()
+	return backends[backend]
+}
+
+// SetBackends selects the tracing backends, replacing the previous ones.
+func SetBackends(names ...string) {
+	tracerMutex.Lock()
+	defer tracerMutex.Unlock()
+	backends = map[string]bool{}
+	for _, name := range names {
+		backends[name] = true
+	}
+}
+
+// Init selects the backends of cfg and sets up the OpenTelemetry tracer
+// when otel is one of them. Spans are exported as serviceName unless cfg
+// names the service.
+func Init(cfg config.TracingConfig, serviceName string) {
+	SetBackends(cfg.Backends...)
+	if !Enabled(BACKEND_OTEL) {
+		return
+	}
+
+	if cfg.ServiceName != "" {
+		serviceName = cfg.ServiceName
+	}
+	SetTracer(&Tracer{
+		Exporter:    NewOTLPExporter(cfg.OTLPEndpoint, serviceName),
+		SampleRatio: cfg.SampleRatio,
+	})
+}
+
+// SetTracer replaces the global tracer, nil disables tracing.
+func SetTracer(t *Tracer) {
+	if t != nil {
+		t.start()
+	}
+	tracerMutex.Lock()
+	defer tracerMutex.Unlock()
+	tracer = t
+}
+
+func current() *Tracer {
+	tracerMutex.RLock()
+	defer tracerMutex.RUnlock()
+	return tracer
+}
+
+// Shutdown exports the spans still queued.
+func Shutdown(ctx context.Context) {
+	if t := current(); t != nil {
+		t.Flush(ctx)
+	}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan returns ctx carrying span as the parent of spans started
+// from it.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent makes sc, read from an incoming request, the
+// parent of the next span started from ctx.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// StartSpan starts a span, a child of the one in ctx if any. It returns a
+// nil span when tracing is disabled.
+func StartSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	t := current()
+	if t == nil {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: map[string]interface{}{},
+		tracer:     t,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.Context = SpanContext{TraceID: parent.Context.TraceID, Sampled: parent.Context.Sampled}
+		span.Parent = parent.Context.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok && remote.IsValid() {
+		span.Context = SpanContext{TraceID: remote.TraceID, Sampled: remote.Sampled}
+		span.Parent = remote.SpanID
+	} else {
+		span.Context.TraceID = newTraceID()
+		span.Context.Sampled = t.sample(span.Context.TraceID)
+	}
+	span.Context.SpanID = newSpanID()
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// sample decides from the trace ID itself, so every service keeping the
+// same ratio makes the same decision.
+func (t *Tracer) sample(id TraceID) bool {
+	switch {
+	case t.SampleRatio >= 1:
+		return true
+	case t.SampleRatio <= 0:
+		return false
+	}
+	bound := uint64(t.SampleRatio * (1 << 63))
+	return binary.BigEndian.Uint64(id[8:])>>1 < bound
+}
+
+func (t *Tracer) start() {
+	t.once.Do(func() {
+		if t.BatchSize <= 0 {
+			t.BatchSize = DEFAULT_BATCH_SIZE
+		}
+		if t.FlushInterval <= 0 {
+			t.FlushInterval = DEFAULT_FLUSH_INTERVAL
+		}
+		t.queue = make(chan *Span, DEFAULT_QUEUE_SIZE)
+		t.flush = make(chan chan struct{})
+		go t.run()
+	})
+}
+
+// export queues span, dropping it when the exporter can't keep up rather
+// than slowing requests down.
+func (t *Tracer) export(span *Span) {
+	if t.Exporter == nil {
+		return
+	}
+	select {
+	case t.queue <- span:
+	default:
+	}
+}
+
+func (t *Tracer) run() {
+	ticker := time.NewTicker(t.FlushInterval)
+	defer ticker.Stop()
+
+	batch := []*Span{}
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), t.FlushInterval)
+		t.Exporter.Export(ctx, batch)
+		cancel()
+		batch = []*Span{}
+	}
+
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= t.BatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case flushed := <-t.flush:
+			for len(t.queue) > 0 {
+				batch = append(batch, <-t.queue)
+			}
+			send()
+			close(flushed)
+		}
+	}
+}
+
+// Flush exports every queued span, waiting at most until ctx is done.
+func (t *Tracer) Flush(ctx context.Context) {
+	flushed := make(chan struct{})
+	select {
+	case t.flush <- flushed:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+	}
+}
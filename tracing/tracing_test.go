@@ -0,0 +1,203 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingExporter struct {
+	mutex sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(ctx context.Context, spans []*Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func withTracer(t *testing.T, ratio float64) *recordingExporter {
+	exporter := &recordingExporter{}
+	SetTracer(&Tracer{Exporter: exporter, SampleRatio: ratio})
+	return exporter
+}
+
+func flushed(exporter *recordingExporter) []*Span {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	Shutdown(ctx)
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	return exporter.spans
+}
+
+func TestParseTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(header)
+	if !ok {
+		t.Fatal("expected a valid traceparent")
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("unexpected span context %+v", sc)
+	}
+	if sc.Traceparent() != header {
+		t.Errorf("expected %s, got %s", header, sc.Traceparent())
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := ParseTraceparent(invalid); ok {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Error("expected later versions to be read as version 00")
+	}
+}
+
+func TestStartSpanWithoutTracer(t *testing.T) {
+	SetTracer(nil)
+	ctx, span := StartSpan(context.Background(), "noop", KIND_INTERNAL)
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Error("expected no span while tracing is disabled")
+	}
+	span.SetAttribute("key", "value")
+	span.End()
+}
+
+func TestChildSpans(t *testing.T) {
+	exporter := withTracer(t, 1)
+	defer SetTracer(nil)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ContextWithRemoteParent(context.Background(), remote)
+	ctx, parent := StartSpan(ctx, "GET /users", KIND_SERVER)
+	_, child := StartSpan(ctx, "gorm.query", KIND_CLIENT)
+	child.End()
+	parent.End()
+	parent.End()
+
+	spans := flushed(exporter)
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if parent.Context.TraceID != remote.TraceID || parent.Parent != remote.SpanID {
+		t.Error("expected the server span to continue the remote trace")
+	}
+	if child.Context.TraceID != remote.TraceID || child.Parent != parent.Context.SpanID {
+		t.Error("expected the query span to be a child of the server span")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	exporter := withTracer(t, 0)
+	defer SetTracer(nil)
+
+	_, span := StartSpan(context.Background(), "unsampled", KIND_INTERNAL)
+	span.End()
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, sampled := StartSpan(ContextWithRemoteParent(context.Background(), remote), "sampled", KIND_SERVER)
+	sampled.End()
+
+	spans := flushed(exporter)
+	if len(spans) != 1 || spans[0].Name != "sampled" {
+		t.Errorf("expected only the span of the sampled caller, got %d spans", len(spans))
+	}
+}
+
+func TestTransport(t *testing.T) {
+	withTracer(t, 1)
+	defer SetTracer(nil)
+
+	received := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+	}))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("POST", ts.URL+"/hook", nil)
+	if _, err := HTTPClient().Do(req); err != nil {
+		t.Fatal(err)
+	}
+	if received != "" {
+		t.Error("expected requests outside of a trace to go out untouched")
+	}
+
+	ctx, parent := StartSpan(context.Background(), "webhook", KIND_INTERNAL)
+	if _, err := HTTPClient().Do(req.WithContext(ctx)); err != nil {
+		t.Fatal(err)
+	}
+	sc, ok := ParseTraceparent(received)
+	if !ok || sc.TraceID != parent.Context.TraceID || sc.SpanID == parent.Context.SpanID {
+		t.Errorf("expected a traceparent of a child span, got %q", received)
+	}
+	if req.Header.Get("traceparent") != "" {
+		t.Error("expected the original request to be left alone")
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	path := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &body)
+	}))
+	defer ts.Close()
+
+	exporter := &OTLPExporter{Endpoint: ts.URL, ServiceName: "api", Client: ts.Client()}
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := &Span{
+		Name:       "GET /users",
+		Kind:       KIND_SERVER,
+		Context:    SpanContext{TraceID: remote.TraceID, SpanID: newSpanID(), Sampled: true},
+		Parent:     remote.SpanID,
+		Start:      time.Unix(0, 1000),
+		Finish:     time.Unix(0, 2000),
+		Attributes: map[string]interface{}{"http.status_code": 500, "http.route": "/users"},
+		Error:      "HTTP 500",
+	}
+	if err := exporter.Export(context.Background(), []*Span{span}); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/traces" {
+		t.Errorf("expected the traces endpoint, got %s", path)
+	}
+	resource := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	service := resource["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if service["key"] != "service.name" || service["value"].(map[string]interface{})["stringValue"] != "api" {
+		t.Errorf("unexpected resource %v", service)
+	}
+	exported := resource["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+	if exported["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || exported["parentSpanId"] != "00f067aa0ba902b7" {
+		t.Errorf("unexpected ids in %v", exported)
+	}
+	if exported["startTimeUnixNano"] != "1000" || exported["endTimeUnixNano"] != "2000" {
+		t.Errorf("unexpected times in %v", exported)
+	}
+	if exported["status"].(map[string]interface{})["code"] != float64(2) {
+		t.Errorf("expected an error status in %v", exported)
+	}
+	attributes := exported["attributes"].([]interface{})
+	if attributes[1].(map[string]interface{})["value"].(map[string]interface{})["intValue"] != "500" {
+		t.Errorf("expected integers as strings in %v", attributes)
+	}
+}
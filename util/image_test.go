@@ -0,0 +1,44 @@
+package util
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	// 400x200, left half black and right half white, so the center square
+	// averages out to a gradient around mid grey.
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			c := color.RGBA{0, 0, 0, 255}
+			if x >= 200 {
+				c = color.RGBA{255, 255, 255, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	thumb := Thumbnail(img, 50)
+	AssertEqual(t, image.Rect(0, 0, 50, 50), thumb.Bounds())
+	AssertEqual(t, color.RGBA{0, 0, 0, 255}, thumb.RGBAAt(0, 25))
+	AssertEqual(t, color.RGBA{255, 255, 255, 255}, thumb.RGBAAt(49, 25))
+}
+
+func TestThumbnailNeverUpscales(t *testing.T) {
+	img := image.NewRGBA(image.Rect(10, 10, 40, 30))
+	thumb := Thumbnail(img, 256)
+	AssertEqual(t, image.Rect(0, 0, 20, 20), thumb.Bounds())
+}
+
+func TestBoxResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.SetRGBA(0, 0, color.RGBA{100, 0, 0, 255})
+	src.SetRGBA(1, 0, color.RGBA{200, 0, 0, 255})
+	src.SetRGBA(0, 1, color.RGBA{100, 0, 0, 255})
+	src.SetRGBA(1, 1, color.RGBA{200, 0, 0, 255})
+
+	dst := BoxResize(src, 1, 1)
+	AssertEqual(t, color.RGBA{150, 0, 0, 255}, dst.RGBAAt(0, 0))
+}